@@ -6,6 +6,8 @@ import * as sqs from '@aws-cdk/aws-sqs';
 import * as events from '@aws-cdk/aws-events';
 import * as eventsTargets from '@aws-cdk/aws-events-targets';
 import * as dynamodb from '@aws-cdk/aws-dynamodb';
+import * as apigateway from '@aws-cdk/aws-apigateway';
+import * as s3 from '@aws-cdk/aws-s3';
 
 import {
   SqsEventSource,
@@ -21,15 +23,120 @@ interface CrawlerSettings {
   readonly secretsARN?: string;
 };
 
+interface EntityFormatRule {
+  readonly bucket?: string;
+  readonly prefix?: string;
+  readonly format?: string;
+  readonly source?: string;
+  readonly csv?: {
+    readonly has_header?: boolean;
+    readonly delimiter?: string;
+  };
+  readonly mapping?: {
+    readonly values: {[field: string]: string};
+    readonly subject?: string;
+    readonly timestamp?: string;
+    readonly time_format?: string;
+    readonly description?: string;
+  };
+  readonly extractor?: {
+    readonly source?: string;
+    readonly fields?: {[path: string]: string};
+    readonly text_fields?: string[];
+    readonly subject?: string;
+    readonly timestamp?: string;
+    readonly time_format?: string;
+    readonly description?: string;
+  };
+  readonly internal_cidrs?: Array<string>;
+};
+
 interface RetrospectorProps extends cdk.StackProps{
   readonly lambdaRoleARN?: string;
   readonly entityObjectTopicARN?: string;
   readonly slackWebhookURL?: string;
   readonly crawler?: CrawlerSettings;
 
+  // "split" (default) runs entityRecord and entityDetect separately.
+  // "combined" runs entityIngest that reads each entity object only once.
+  readonly entityIngestMode?: 'split' | 'combined';
+
+  // S3 location of IOC Bloom filter. iocRecord updates it and entityDetect uses it
+  // to skip lookups of values that are not IOC. Lambda role needs read/write access.
+  readonly iocFilterBucketName?: string;
+  readonly iocFilterKey?: string;
+
+  // Streaming mode for large entity objects. Entities are handled in windows of
+  // entityWindowSize entities with a dedupe set of entityDedupeSize values.
+  readonly entityWindowSize?: number;
+  readonly entityDedupeSize?: number;
+
+  // Format rules of entity objects (see reader.Rule). Format of objects that match
+  // no rule is detected by object key and content.
+  readonly entityFormatRules?: Array<EntityFormatRule>;
+
+  // Period before IOC publication in which entities still match the IOC (Go duration, e.g. "72h").
+  // Default is 7 days.
+  readonly iocLookbackMargin?: string;
+
+  // Alert enrichment. enrichers is list of "geoip", "asn", "rdap", "rdns",
+  // "virustotal", "abuseipdb" and "greynoise".
+  // MaxMind DB files (e.g. in Lambda layer) are required for geoip and asn.
+  // API keys of reputation services are read from secrets.
+  readonly enrichers?: Array<string>;
+  readonly geoIPDBPath?: string;
+  readonly asnDBPath?: string;
+  readonly rdapBaseURL?: string;
+  readonly enrichTimeout?: string;
+  // Drop alerts of values that reputation services consider benign
+  readonly suppressBenignAlert?: boolean;
+
+  // Re-alert policy of values that have been alerted. realertOn is list of "new_subject" and
+  // "new_source" (default ["new_subject"]). realertCooldown is period after which the same
+  // subject is alerted again (Go duration, e.g. "168h"). Same subject is never alerted again if not set.
+  readonly realertOn?: Array<string>;
+  readonly realertCooldown?: string;
+
+  // Internal networks that are not recorded from network logs such as VPC Flow Logs.
+  // RFC1918 networks are always regarded as internal.
+  readonly internalCIDRs?: Array<string>;
+
+  // HTTP API for analysts. Requests are authenticated by API keys in secrets ("api_keys")
+  // or by IAM (SigV4) if apiAuthorization is 'iam'.
+  readonly enableAPI?: boolean;
+  readonly apiAuthorization?: 'apiKey' | 'iam';
+
+  // Hunt function for IOC list in S3 object. It is invoked directly with
+  // {"bucket", "key", "alert"} or by S3 event notification of huntBucketName.
+  readonly enableHunt?: boolean;
+  readonly huntBucketName?: string;
+
+  // Export function that writes IOCs and entities to exportBucketName in exportFormat
+  // ('jsonl', 'csv' or 'stix', default 'jsonl'). It runs every exportInterval if set,
+  // and can be invoked directly with filters, e.g. {"sources": [...], "since": 1600000000}.
+  readonly enableExport?: boolean;
+  readonly exportBucketName?: string;
+  readonly exportPrefix?: string;
+  readonly exportFormat?: 'jsonl' | 'csv' | 'stix';
+  readonly exportInterval?: cdk.Duration;
+
+  // Reconciliation sweeper that matches IOC set and entities stored in the last sweepWindow
+  // (Go duration, default "2h", up to "24h") against each other every sweepInterval (default 1 hour).
+  // It catches matches missed when iocRecord and entityRecord handle them concurrently.
+  readonly enableSweep?: boolean;
+  readonly sweepInterval?: cdk.Duration;
+  readonly sweepWindow?: string;
+
+  // Lambda functions emit metrics in CloudWatch Embedded Metric Format to namespace "Retrospector".
+  readonly disableMetrics?: boolean;
+  // Base URL of OTLP/HTTP collector, e.g. "http://collector.example.com:4318". Spans are not exported if not set.
+  readonly otlpEndpoint?: string;
+
   readonly dynamoCapacity?: number;
   readonly entityLambdaConcurrency?: number;
+  // Concurrency of iocRecord and iocDetect. iocRecord runs with concurrency 1 if iocFilterBucketName is set to update IOC filter safely.
   readonly iocLambdaConcurrency?: number;
+  // Errors and panics of Lambda functions are reported to Sentry or compatible endpoint if sentryDSN is set.
   readonly sentryDSN?: string;
   readonly sentryEnv?: string;
 };
@@ -52,8 +159,9 @@ export class RetrospectorStack extends cdk.Stack {
   // SQS queues
   iocRecordQueue: sqs.Queue;
   iocDetectQueue: sqs.Queue;
-  entityRecordQueue: sqs.Queue;
-  entityDetectQueue: sqs.Queue;
+  entityRecordQueue?: sqs.Queue;
+  entityDetectQueue?: sqs.Queue;
+  entityIngestQueue?: sqs.Queue;
 
   // SNS topics
   iocTopic: sns.Topic;
@@ -62,11 +170,17 @@ export class RetrospectorStack extends cdk.Stack {
   // Lambda functions
   crawlers: Array<lambda.Function>;
   handlers: {[key: string]: lambda.Function};
+  apiFunction?: lambda.Function;
+  huntFunction?: lambda.Function;
+  exportFunction?: lambda.Function;
+  sweepFunction?: lambda.Function;
+  api?: apigateway.LambdaRestApi;
 
   constructor(scope: cdk.Construct, id: string, retrospectorProps?: RetrospectorProps) {
     super(scope, id, retrospectorProps);
     const props = retrospectorProps || {};
     const crawlerSettings = props.crawler || {};
+    const combinedIngest = props.entityIngestMode === 'combined';
 
     // DynamoDB
     this.recordTable = new dynamodb.Table(this, "recordTable", {
@@ -80,7 +194,8 @@ export class RetrospectorStack extends cdk.Stack {
 
     // SQS
     const queues : {[key: string]: sqs.Queue} = {};
-    ['iocRecord', 'iocDetect', 'entityRecord', 'entityDetect'].forEach(queueName => {
+    const entityQueueNames = combinedIngest ? ['entityIngest'] : ['entityRecord', 'entityDetect'];
+    ['iocRecord', 'iocDetect', ...entityQueueNames].forEach(queueName => {
       const dlq = new sqs.Queue(this, queueName + 'DLQ');
       queues[queueName] = new sqs.Queue(this, queueName + 'Queue' ,{
         visibilityTimeout: cdk.Duration.seconds(300),
@@ -94,6 +209,7 @@ export class RetrospectorStack extends cdk.Stack {
     this.iocDetectQueue = queues['iocDetect'];
     this.entityRecordQueue = queues['entityRecord'];
     this.entityDetectQueue = queues['entityDetect'];
+    this.entityIngestQueue = queues['entityIngest'];
 
     // SNS
     this.iocTopic = new sns.Topic(this, "iocTopic", {});
@@ -105,8 +221,9 @@ export class RetrospectorStack extends cdk.Stack {
     } else {
       this.entityObjectTopic = new sns.Topic(this, "entityObjectTopic", {});
     }
-    this.entityObjectTopic.addSubscription(new SqsSubscription(this.entityRecordQueue));
-    this.entityObjectTopic.addSubscription(new SqsSubscription(this.entityDetectQueue));
+    entityQueueNames.forEach(queueName => {
+      this.entityObjectTopic.addSubscription(new SqsSubscription(queues[queueName]));
+    });
 
     // --------------------------------------
     // Lambda
@@ -123,6 +240,28 @@ export class RetrospectorStack extends cdk.Stack {
       SECRETS_ARN: crawlerSettings.secretsARN || "",
       SENTRY_DSN: props.sentryDSN || "",
       SENTRY_ENVIRONMENT: props.sentryEnv || "",
+      IOC_FILTER_BUCKET: props.iocFilterBucketName || "",
+      IOC_FILTER_KEY: props.iocFilterKey || "",
+      ENTITY_WINDOW_SIZE: props.entityWindowSize ? props.entityWindowSize.toString() : "0",
+      ENTITY_DEDUPE_SIZE: props.entityDedupeSize ? props.entityDedupeSize.toString() : "0",
+      ENTITY_FORMAT_RULES: props.entityFormatRules ? JSON.stringify(props.entityFormatRules) : "",
+      IOC_LOOKBACK_MARGIN: props.iocLookbackMargin || "",
+      ENRICHERS: props.enrichers ? props.enrichers.join(",") : "",
+      GEOIP_DB_PATH: props.geoIPDBPath || "",
+      ASN_DB_PATH: props.asnDBPath || "",
+      RDAP_BASE_URL: props.rdapBaseURL || "",
+      ENRICH_TIMEOUT: props.enrichTimeout || "",
+      SUPPRESS_BENIGN_ALERT: props.suppressBenignAlert ? "true" : "false",
+      REALERT_ON: props.realertOn ? (props.realertOn.length > 0 ? props.realertOn.join(",") : "none") : "",
+      REALERT_COOLDOWN: props.realertCooldown || "",
+      INTERNAL_CIDRS: props.internalCIDRs ? props.internalCIDRs.join(",") : "",
+      METRICS_WRITER: props.disableMetrics ? "none" : "emf",
+      OTEL_EXPORTER_OTLP_ENDPOINT: props.otlpEndpoint || "",
+      SWEEP_OVERLAP_WINDOW: props.sweepWindow || "",
+      RECORD_RECENT_VALUES: props.enableSweep ? "true" : "false",
+      EXPORT_BUCKET: props.exportBucketName || "",
+      EXPORT_PREFIX: props.exportPrefix || "",
+      EXPORT_FORMAT: props.exportFormat || "",
     }
 
     // Setup crawlers
@@ -165,23 +304,19 @@ export class RetrospectorStack extends cdk.Stack {
       {
         funcName: 'iocRecord',
         source: this.iocRecordQueue,
-        concurrent: props.iocLambdaConcurrency || 1,
+        // iocRecord updates IOC filter in S3 without conditional write, then it must not run concurrently if IOC filter is enabled.
+        concurrent: props.iocFilterBucketName ? 1 : (props.iocLambdaConcurrency || 1),
       },
       {
         funcName: 'iocDetect',
         source: this.iocDetectQueue,
         concurrent: props.iocLambdaConcurrency || 1,
       },
-      {
-        funcName: 'entityRecord',
-        source: this.entityRecordQueue,
+      ...entityQueueNames.map(queueName => ({
+        funcName: queueName,
+        source: queues[queueName],
         concurrent: props.entityLambdaConcurrency || 10,
-      },
-      {
-        funcName: 'entityDetect',
-        source: this.entityDetectQueue,
-        concurrent: props.entityLambdaConcurrency || 10,
-      },
+      })),
     ];
 
     this.handlers = {};
@@ -204,5 +339,95 @@ export class RetrospectorStack extends cdk.Stack {
         this.recordTable.grantReadWriteData(func);
       }
     })
+
+    // Setup HTTP API
+    if (props.enableAPI) {
+      this.apiFunction = new lambda.Function(this, 'api', {
+        runtime: providedAl2023,
+        handler: 'bootstrap',
+        code: lambda.Code.fromAsset(path.join(__dirname, '..', 'build', 'api')),
+        role: lambdaRole,
+        timeout: cdk.Duration.seconds(29),
+        memorySize: 1024,
+        environment: baseEnvVars,
+      });
+      if (lambdaRole === undefined) {
+        this.recordTable.grantReadData(this.apiFunction);
+        this.iocTopic.grantPublish(this.apiFunction);
+      }
+
+      const authorizationType = props.apiAuthorization === 'iam' ?
+        apigateway.AuthorizationType.IAM : apigateway.AuthorizationType.NONE;
+      this.api = new apigateway.LambdaRestApi(this, 'retrospectorAPI', {
+        handler: this.apiFunction,
+        defaultMethodOptions: { authorizationType },
+      });
+    }
+
+    // Setup hunt
+    if (props.enableHunt) {
+      this.huntFunction = new lambda.Function(this, 'hunt', {
+        runtime: providedAl2023,
+        handler: 'bootstrap',
+        code: lambda.Code.fromAsset(path.join(__dirname, '..', 'build', 'hunt')),
+        role: lambdaRole,
+        timeout: cdk.Duration.seconds(900),
+        memorySize: 1024,
+        environment: baseEnvVars,
+      });
+      if (lambdaRole === undefined) {
+        this.recordTable.grantReadWriteData(this.huntFunction);
+        if (props.huntBucketName !== undefined) {
+          s3.Bucket.fromBucketName(this, 'huntBucket', props.huntBucketName).grantReadWrite(this.huntFunction);
+        }
+      }
+    }
+
+    // Setup export
+    if (props.enableExport) {
+      this.exportFunction = new lambda.Function(this, 'export', {
+        runtime: providedAl2023,
+        handler: 'bootstrap',
+        code: lambda.Code.fromAsset(path.join(__dirname, '..', 'build', 'export')),
+        role: lambdaRole,
+        timeout: cdk.Duration.seconds(900),
+        memorySize: 2048,
+        environment: baseEnvVars,
+        reservedConcurrentExecutions: 1,
+      });
+      if (props.exportInterval !== undefined) {
+        new events.Rule(this, 'periodicInvokeExport', {
+          schedule: events.Schedule.rate(props.exportInterval),
+          targets: [new eventsTargets.LambdaFunction(this.exportFunction)],
+        });
+      }
+      if (lambdaRole === undefined) {
+        this.recordTable.grantReadData(this.exportFunction);
+        if (props.exportBucketName !== undefined) {
+          s3.Bucket.fromBucketName(this, 'exportBucket', props.exportBucketName).grantPut(this.exportFunction);
+        }
+      }
+    }
+
+    // Setup sweeper
+    if (props.enableSweep) {
+      this.sweepFunction = new lambda.Function(this, 'sweep', {
+        runtime: providedAl2023,
+        handler: 'bootstrap',
+        code: lambda.Code.fromAsset(path.join(__dirname, '..', 'build', 'sweep')),
+        role: lambdaRole,
+        timeout: cdk.Duration.seconds(900),
+        memorySize: 1024,
+        environment: baseEnvVars,
+        reservedConcurrentExecutions: 1,
+      });
+      new events.Rule(this, 'periodicInvokeSweep', {
+        schedule: events.Schedule.rate(props.sweepInterval || cdk.Duration.hours(1)),
+        targets: [new eventsTargets.LambdaFunction(this.sweepFunction)],
+      });
+      if (lambdaRole === undefined) {
+        this.recordTable.grantReadWriteData(this.sweepFunction);
+      }
+    }
   }
 }
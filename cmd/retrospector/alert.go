@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/cookpad/retrospector"
+	"github.com/cookpad/retrospector/pkg/arguments"
+	"github.com/cookpad/retrospector/pkg/usecase"
+	"github.com/m-mizutani/golambda"
+	"github.com/urfave/cli/v2"
+)
+
+// alertListPageSize is number of alert states queried at once by "alert list"
+const alertListPageSize = 100
+
+func alertCommand(newArgs func() *arguments.Arguments) *cli.Command {
+	valueFlags := []cli.Flag{
+		&cli.StringFlag{
+			Name:     "type",
+			Aliases:  []string{"t"},
+			Usage:    "Value type [ipaddr|domain|url|filehash.sha256|filehash.sha1|filehash.md5]",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:     "value",
+			Aliases:  []string{"v"},
+			Usage:    "Value of alert",
+			Required: true,
+		},
+	}
+	valueOf := func(c *cli.Context) *retrospector.Value {
+		return &retrospector.Value{
+			Type: retrospector.ValueType(c.String("type")),
+			Data: c.String("value"),
+		}
+	}
+
+	return &cli.Command{
+		Name:  "alert",
+		Usage: "Manage lifecycle of alerts",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "list",
+				Usage: "List alert states as JSONL in descending order of updated time",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "status",
+						Aliases: []string{"s"},
+						Usage:   "Show only alerts of the status [new|triaged|escalated|resolved|false_positive]",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					status := retrospector.AlertStatus(c.String("status"))
+					if status != "" && !status.IsValid() {
+						return golambda.NewError("Invalid alert status").With("status", status)
+					}
+
+					repo := newArgs().RepositoryService()
+					encoder := json.NewEncoder(c.App.Writer)
+					var cursor string
+					for {
+						states, next, err := repo.QueryAlertStates(status, alertListPageSize, cursor)
+						if err != nil {
+							return err
+						}
+						for _, state := range states {
+							if err := encoder.Encode(state); err != nil {
+								return err
+							}
+						}
+						if next == "" {
+							return nil
+						}
+						cursor = next
+					}
+				},
+			},
+			{
+				Name:  "reindex",
+				Usage: "Write list items of all alert states. Run once to migrate alert states stored without list items",
+				Action: func(c *cli.Context) error {
+					count, err := usecase.ReindexAlertStates(newArgs())
+					if err != nil {
+						return err
+					}
+					return json.NewEncoder(c.App.Writer).Encode(map[string]int{"alerts": count})
+				},
+			},
+			{
+				Name:  "show",
+				Usage: "Show alert state and transitions",
+				Flags: valueFlags,
+				Action: func(c *cli.Context) error {
+					repo := newArgs().RepositoryService()
+					value := valueOf(c)
+
+					state, err := repo.GetAlertState(value)
+					if err != nil {
+						return err
+					}
+					if state == nil {
+						return golambda.NewError("Alert is not found").With("value", value)
+					}
+					transitions, err := repo.GetAlertTransitions(value)
+					if err != nil {
+						return err
+					}
+
+					encoder := json.NewEncoder(c.App.Writer)
+					encoder.SetIndent("", "  ")
+					return encoder.Encode(struct {
+						*retrospector.AlertState
+						Transitions []*retrospector.AlertTransition `json:"transitions"`
+					}{state, transitions})
+				},
+			},
+			{
+				Name:  "transit",
+				Usage: "Change status of alert",
+				Flags: append(valueFlags,
+					&cli.StringFlag{
+						Name:     "status",
+						Aliases:  []string{"s"},
+						Usage:    "New status [new|triaged|escalated|resolved|false_positive]",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:    "actor",
+						Aliases: []string{"a"},
+						Usage:   "Who changes the status",
+						Value:   os.Getenv("USER"),
+					},
+					&cli.StringFlag{
+						Name:    "note",
+						Aliases: []string{"n"},
+						Usage:   "Note of the transition",
+					},
+				),
+				Action: func(c *cli.Context) error {
+					state, err := newArgs().LifecycleService().Transit(valueOf(c),
+						retrospector.AlertStatus(c.String("status")), c.String("actor"), c.String("note"))
+					if err != nil {
+						return err
+					}
+					return json.NewEncoder(c.App.Writer).Encode(state)
+				},
+			},
+		},
+	}
+}
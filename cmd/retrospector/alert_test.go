@@ -0,0 +1,62 @@
+package main_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/cookpad/retrospector"
+	main "github.com/cookpad/retrospector/cmd/retrospector"
+	"github.com/cookpad/retrospector/pkg/arguments"
+	"github.com/cookpad/retrospector/pkg/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlert(t *testing.T) {
+	args := &arguments.Arguments{Repository: mock.NewRepository()}
+	value := &retrospector.Value{Data: "example.com", Type: retrospector.ValueDomainName}
+	_, _, err := args.LifecycleService().OnDetection(value)
+	require.NoError(t, err)
+
+	run := func(argv ...string) (*bytes.Buffer, error) {
+		var out bytes.Buffer
+		app := main.NewAppWithArguments(func() *arguments.Arguments { return args })
+		app.Writer = &out
+		return &out, app.Run(append([]string{"retrospector", "alert"}, argv...))
+	}
+
+	out, err := run("transit", "-t", "domain", "-v", "example.com", "-s", "false_positive", "-a", "blue", "-n", "internal")
+	require.NoError(t, err)
+	var state retrospector.AlertState
+	require.NoError(t, json.Unmarshal(out.Bytes(), &state))
+	assert.Equal(t, retrospector.AlertFalsePositive, state.Status)
+
+	_, err = run("transit", "-t", "domain", "-v", "example.com", "-s", "resolved", "-a", "blue")
+	assert.Error(t, err)
+
+	out, err = run("list", "-s", "false_positive")
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(out.Bytes(), &state))
+	assert.Equal(t, "example.com", state.Data)
+
+	out, err = run("list", "-s", "new")
+	require.NoError(t, err)
+	assert.Empty(t, out.String())
+
+	out, err = run("reindex")
+	require.NoError(t, err)
+	assert.Equal(t, "{\"alerts\":1}\n", out.String())
+
+	out, err = run("show", "-t", "domain", "-v", "example.com")
+	require.NoError(t, err)
+	var shown struct {
+		Status      retrospector.AlertStatus        `json:"status"`
+		Transitions []*retrospector.AlertTransition `json:"transitions"`
+	}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &shown))
+	assert.Equal(t, retrospector.AlertFalsePositive, shown.Status)
+	require.Equal(t, 2, len(shown.Transitions))
+	assert.Equal(t, "blue", shown.Transitions[1].Actor)
+	assert.Equal(t, "internal", shown.Transitions[1].Note)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/cookpad/retrospector/pkg/arguments"
+	"github.com/cookpad/retrospector/pkg/usecase"
+	"github.com/m-mizutani/golambda"
+	"github.com/urfave/cli/v2"
+)
+
+func backfillCommand(newArgs func() *arguments.Arguments) *cli.Command {
+	return &cli.Command{
+		Name:  "backfill",
+		Usage: "Record entities in archived objects in S3 bucket",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "bucket",
+				Aliases:  []string{"b"},
+				Usage:    "S3 bucket of entity objects",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:    "prefix",
+				Aliases: []string{"p"},
+				Usage:   "Key prefix of entity objects",
+			},
+			&cli.StringFlag{
+				Name:  "region",
+				Usage: "AWS region of the bucket. AWS_REGION is used if not set",
+			},
+			&cli.StringFlag{
+				Name:  "since",
+				Usage: "Handle objects modified after the time in RFC3339, e.g. 2020-10-01T00:00:00Z",
+			},
+			&cli.StringFlag{
+				Name:  "until",
+				Usage: "Handle objects modified before the time in RFC3339",
+			},
+			&cli.DurationFlag{
+				Name:  "last",
+				Usage: "Handle objects modified in the last period, e.g. 720h. It overrides --since",
+			},
+			&cli.BoolFlag{
+				Name:  "detect",
+				Usage: "Also detect entities matched with IOC set",
+			},
+			&cli.IntFlag{
+				Name:    "parallel",
+				Aliases: []string{"n"},
+				Usage:   "Number of objects handled at once",
+				Value:   usecase.DefaultBackfillParallel,
+			},
+			&cli.StringFlag{
+				Name:    "checkpoint",
+				Aliases: []string{"c"},
+				Usage:   "Checkpoint file. Backfill resumes from it if exists",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			opt := &usecase.BackfillOptions{
+				Region:   c.String("region"),
+				Bucket:   c.String("bucket"),
+				Prefix:   c.String("prefix"),
+				Detect:   c.Bool("detect"),
+				Parallel: c.Int("parallel"),
+			}
+
+			var err error
+			if opt.Since, err = parseTimeFlag(c, "since"); err != nil {
+				return err
+			}
+			if opt.Until, err = parseTimeFlag(c, "until"); err != nil {
+				return err
+			}
+			if d := c.Duration("last"); d > 0 {
+				opt.Since = time.Now().Add(-d).Unix()
+			}
+
+			path := c.String("checkpoint")
+			checkpoint, err := loadCheckpoint(path)
+			if err != nil {
+				return err
+			}
+
+			report, err := usecase.Backfill(newArgs(), opt, checkpoint, func(cp *usecase.BackfillCheckpoint) error {
+				return saveCheckpoint(path, cp)
+			})
+			if err != nil {
+				return err
+			}
+
+			encoder := json.NewEncoder(c.App.Writer)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(report)
+		},
+	}
+}
+
+// loadCheckpoint reads checkpoint file. Empty checkpoint is returned if path is empty or the file does not exist.
+func loadCheckpoint(path string) (*usecase.BackfillCheckpoint, error) {
+	var checkpoint usecase.BackfillCheckpoint
+	if path == "" {
+		return &checkpoint, nil
+	}
+
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &checkpoint, nil
+	} else if err != nil {
+		return nil, golambda.WrapError(err, "Failed to read checkpoint").With("path", path)
+	}
+
+	if err := json.Unmarshal(raw, &checkpoint); err != nil {
+		return nil, golambda.WrapError(err, "Failed to parse checkpoint").With("path", path)
+	}
+	return &checkpoint, nil
+}
+
+// saveCheckpoint writes checkpoint to temporary file and renames it not to leave broken checkpoint on interruption
+func saveCheckpoint(path string, checkpoint *usecase.BackfillCheckpoint) error {
+	if path == "" {
+		return nil
+	}
+
+	raw, err := json.Marshal(checkpoint)
+	if err != nil {
+		return golambda.WrapError(err, "Failed to marshal checkpoint").With("checkpoint", checkpoint)
+	}
+
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, raw, 0644); err != nil {
+		return golambda.WrapError(err, "Failed to write checkpoint").With("path", tmp)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return golambda.WrapError(err, "Failed to rename checkpoint").With("path", path)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package main_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cookpad/retrospector"
+	main "github.com/cookpad/retrospector/cmd/retrospector"
+	"github.com/cookpad/retrospector/pkg/arguments"
+	"github.com/cookpad/retrospector/pkg/mock"
+	"github.com/cookpad/retrospector/pkg/service"
+	"github.com/cookpad/retrospector/pkg/usecase"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackfill(t *testing.T) {
+	newS3, s3Client := mock.NewS3Mock()
+	entitySvc := service.NewEntityService(newS3)
+	value := retrospector.Value{Data: "example.com", Type: retrospector.ValueDomainName}
+
+	for _, key := range []string{"logs/2020/09/01.json.gz", "logs/2020/10/01.json.gz", "logs/2020/10/02.json.gz", "other/2020/10/01.json.gz"} {
+		wq := entitySvc.NewWriteQueue("us-east-1", "archive-bucket", key)
+		wq.Write(&retrospector.Entity{Value: value, Subject: key, Source: "proxy", RecordedAt: 1600000000})
+		require.NoError(t, wq.Close())
+	}
+	s3Client.S3LastModified["archive-bucket"]["logs/2020/09/01.json.gz"] = time.Now().Add(-time.Hour * 24 * 45)
+
+	repo := mock.NewRepository()
+	args := &arguments.Arguments{Repository: repo, NewS3: newS3, AwsRegion: "us-east-1"}
+	app := main.NewAppWithArguments(func() *arguments.Arguments { return args })
+	checkpointPath := filepath.Join(t.TempDir(), "checkpoint.json")
+
+	// Resume from checkpoint that has done the last object
+	raw, err := json.Marshal(&usecase.BackfillCheckpoint{
+		Bucket: "archive-bucket",
+		Prefix: "logs/",
+		Done:   []string{"logs/2020/10/02.json.gz"},
+	})
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(checkpointPath, raw, 0644))
+
+	var out bytes.Buffer
+	app.Writer = &out
+	require.NoError(t, app.Run([]string{"retrospector", "backfill", "-b", "archive-bucket", "-p", "logs/", "--last", "720h", "-c", checkpointPath}))
+
+	var report usecase.BackfillReport
+	require.NoError(t, json.Unmarshal(out.Bytes(), &report))
+	assert.Equal(t, 2, report.Listed)
+	assert.Equal(t, 1, report.Skipped)
+	assert.Equal(t, 1, report.Processed)
+
+	entities, err := repo.BatchGetEntities([]*retrospector.Value{&value})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(entities))
+	assert.Equal(t, "logs/2020/10/01.json.gz", entities[0].Subject)
+
+	var checkpoint usecase.BackfillCheckpoint
+	raw, err = ioutil.ReadFile(checkpointPath)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(raw, &checkpoint))
+	assert.Equal(t, "logs/2020/10/01.json.gz", checkpoint.After)
+	assert.Equal(t, []string{"logs/2020/10/02.json.gz"}, checkpoint.Done)
+
+	t.Run("nothing is handled again", func(t *testing.T) {
+		out.Reset()
+		require.NoError(t, app.Run([]string{"retrospector", "backfill", "-b", "archive-bucket", "-p", "logs/", "--last", "720h", "-c", checkpointPath}))
+		require.NoError(t, json.Unmarshal(out.Bytes(), &report))
+		assert.Equal(t, 0, report.Processed)
+
+		entities, err := repo.BatchGetEntities([]*retrospector.Value{&value})
+		require.NoError(t, err)
+		require.Equal(t, 1, len(entities))
+		assert.Equal(t, int64(1), entities[0].Count)
+	})
+
+	t.Run("checkpoint of other prefix is rejected", func(t *testing.T) {
+		require.Error(t, app.Run([]string{"retrospector", "backfill", "-b", "archive-bucket", "-p", "other/", "-c", checkpointPath}))
+	})
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/cookpad/retrospector"
+	"github.com/cookpad/retrospector/pkg/arguments"
+	"github.com/cookpad/retrospector/pkg/service"
+	"github.com/cookpad/retrospector/pkg/usecase"
+	"github.com/m-mizutani/golambda"
+	"github.com/urfave/cli/v2"
+)
+
+func exportCommand(newArgs func() *arguments.Arguments) *cli.Command {
+	return &cli.Command{
+		Name:  "export",
+		Usage: "Export IOCs and entities in repository to S3 objects",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "bucket",
+				Aliases:  []string{"b"},
+				Usage:    "S3 bucket of exported objects",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:    "prefix",
+				Aliases: []string{"p"},
+				Usage:   "Key prefix of exported objects",
+			},
+			&cli.StringFlag{
+				Name:  "region",
+				Usage: "AWS region of the bucket. AWS_REGION is used if not set",
+			},
+			&cli.StringFlag{
+				Name:    "format",
+				Aliases: []string{"f"},
+				Usage:   "Export format: jsonl, csv or stix",
+				Value:   string(service.ExportJSONL),
+			},
+			&cli.StringSliceFlag{
+				Name:    "source",
+				Aliases: []string{"s"},
+				Usage:   "Export only IOCs and entities of the source",
+			},
+			&cli.StringSliceFlag{
+				Name:    "type",
+				Aliases: []string{"t"},
+				Usage:   "Export only values of the type",
+			},
+			&cli.StringFlag{
+				Name:  "since",
+				Usage: "Start of time range in RFC3339, e.g. 2020-10-01T00:00:00Z",
+			},
+			&cli.StringFlag{
+				Name:  "until",
+				Usage: "End of time range in RFC3339",
+			},
+			&cli.BoolFlag{
+				Name:  "matched-only",
+				Usage: "Export only entities that have been detected",
+			},
+			&cli.BoolFlag{
+				Name:  "skip-iocs",
+				Usage: "Do not export IOCs",
+			},
+			&cli.BoolFlag{
+				Name:  "skip-entities",
+				Usage: "Do not export entities",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			opt := &usecase.ExportOptions{
+				Region: c.String("region"),
+				Bucket: c.String("bucket"),
+				Prefix: c.String("prefix"),
+				Format: service.ExportFormat(c.String("format")),
+				Filter: service.ExportFilter{
+					Sources: c.StringSlice("source"),
+				},
+				MatchedOnly:  c.Bool("matched-only"),
+				SkipIOCs:     c.Bool("skip-iocs"),
+				SkipEntities: c.Bool("skip-entities"),
+			}
+			for _, t := range c.StringSlice("type") {
+				opt.Filter.Types = append(opt.Filter.Types, retrospector.ValueType(t))
+			}
+
+			var err error
+			if opt.Filter.Since, err = parseTimeFlag(c, "since"); err != nil {
+				return err
+			}
+			if opt.Filter.Until, err = parseTimeFlag(c, "until"); err != nil {
+				return err
+			}
+
+			report, err := usecase.Export(newArgs(), opt)
+			if err != nil {
+				return err
+			}
+
+			encoder := json.NewEncoder(c.App.Writer)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(report)
+		},
+	}
+}
+
+// parseTimeFlag returns unix seconds of RFC3339 flag value. Zero is returned if the flag is not set.
+func parseTimeFlag(c *cli.Context, name string) (int64, error) {
+	v := c.String(name)
+	if v == "" {
+		return 0, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return 0, golambda.WrapError(err, "Invalid time format").With(name, v)
+	}
+	return t.Unix(), nil
+}
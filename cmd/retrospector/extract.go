@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/cookpad/retrospector"
+	"github.com/cookpad/retrospector/pkg/extractor"
+	"github.com/cookpad/retrospector/pkg/reader"
+	"github.com/m-mizutani/golambda"
+	"github.com/urfave/cli/v2"
+)
+
+func extractCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "extract",
+		Usage:     "Extract entities from log files and output them as JSONL of retrospector.Entity",
+		ArgsUsage: "[FILE ...] (read stdin if no file)",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "config",
+				Aliases: []string{"c"},
+				Usage:   "Extractor config (JSON) file to extract entities from raw JSON log records",
+			},
+			&cli.StringFlag{
+				Name:    "rule",
+				Aliases: []string{"r"},
+				Usage:   "Format rule (JSON) file. Format is detected by file name and content if neither config nor rule is given",
+			},
+			&cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"o"},
+				Usage:   "Output file path. Stdout is used if not set",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			rule, err := loadExtractRule(c.String("config"), c.String("rule"))
+			if err != nil {
+				return err
+			}
+
+			var w io.Writer = c.App.Writer
+			if path := c.String("output"); path != "" {
+				fd, err := os.Create(path)
+				if err != nil {
+					return golambda.WrapError(err, "Failed to create output file").With("path", path)
+				}
+				defer fd.Close()
+				w = fd
+			}
+			bw := bufio.NewWriter(w)
+			defer bw.Flush()
+
+			encoder := json.NewEncoder(bw)
+			emit := func(entity *retrospector.Entity) error {
+				if err := encoder.Encode(entity); err != nil {
+					return golambda.WrapError(err, "Failed to write entity").With("entity", entity)
+				}
+				return nil
+			}
+
+			if c.NArg() == 0 {
+				return extractEntities(os.Stdin, "", rule, emit)
+			}
+
+			for _, path := range c.Args().Slice() {
+				if err := extractFile(path, rule, emit); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func loadExtractRule(configPath, rulePath string) (*reader.Rule, error) {
+	switch {
+	case rulePath != "":
+		raw, err := ioutil.ReadFile(rulePath)
+		if err != nil {
+			return nil, golambda.WrapError(err, "Failed to read rule file").With("path", rulePath)
+		}
+		var rule reader.Rule
+		if err := json.Unmarshal(raw, &rule); err != nil {
+			return nil, golambda.WrapError(err, "Failed to parse rule file").With("path", rulePath)
+		}
+		return &rule, nil
+
+	case configPath != "":
+		raw, err := ioutil.ReadFile(configPath)
+		if err != nil {
+			return nil, golambda.WrapError(err, "Failed to read config file").With("path", configPath)
+		}
+		var config extractor.Config
+		if err := json.Unmarshal(raw, &config); err != nil {
+			return nil, golambda.WrapError(err, "Failed to parse config file").With("path", configPath)
+		}
+		return &reader.Rule{Format: reader.FormatJSON, Extractor: &config}, nil
+	}
+
+	return nil, nil
+}
+
+func extractFile(path string, rule *reader.Rule, emit reader.Emit) error {
+	fd, err := os.Open(path)
+	if err != nil {
+		return golambda.WrapError(err, "Failed to open file").With("path", path)
+	}
+	defer fd.Close()
+
+	if err := extractEntities(fd, path, rule, emit); err != nil {
+		return golambda.WrapError(err).With("path", path)
+	}
+	return nil
+}
+
+func extractEntities(r io.Reader, name string, rule *reader.Rule, emit reader.Emit) error {
+	body, err := reader.Decompress(r)
+	if err != nil {
+		return err
+	}
+	br := bufio.NewReader(body)
+	head, _ := br.Peek(512)
+
+	format := reader.FormatAuto
+	if rule != nil {
+		format = rule.Format
+	}
+	if format == reader.FormatAuto {
+		format = reader.Detect(name, head)
+	}
+
+	rd, err := reader.New(format, rule)
+	if err != nil {
+		return err
+	}
+	return rd.Read(br, emit)
+}
@@ -0,0 +1,54 @@
+package main_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cookpad/retrospector"
+	main "github.com/cookpad/retrospector/cmd/retrospector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtract(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+	logPath := filepath.Join(dir, "log.json")
+
+	require.NoError(t, ioutil.WriteFile(configPath, []byte(`{
+		"source": "proxy",
+		"fields": {"$.client.ip": "ipaddr"},
+		"text_fields": ["$.message"],
+		"subject": "$.user",
+		"timestamp": "$.ts",
+		"time_format": "unix"
+	}`), 0644))
+	require.NoError(t, ioutil.WriteFile(logPath, []byte(
+		`{"client":{"ip":"10.1.2.3"},"user":"blue","ts":1600000000,"message":"access to orange.example.com"}`+"\n"+
+			`{"client":{"ip":"10.1.2.4"},"user":"red","ts":1600000001,"message":"nothing"}`+"\n"), 0644))
+
+	var out bytes.Buffer
+	app := main.NewApp()
+	app.Writer = &out
+	require.NoError(t, app.Run([]string{"retrospector", "extract", "-c", configPath, logPath}))
+
+	var entities []*retrospector.Entity
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var entity retrospector.Entity
+		require.NoError(t, json.Unmarshal([]byte(line), &entity))
+		entities = append(entities, &entity)
+	}
+
+	require.Equal(t, 3, len(entities))
+	assert.Equal(t, "10.1.2.3", entities[0].Value.Data)
+	assert.Equal(t, "blue", entities[0].Subject)
+	assert.Equal(t, "proxy", entities[0].Source)
+	assert.Equal(t, int64(1600000000), entities[0].RecordedAt)
+	assert.Equal(t, "orange.example.com", entities[1].Value.Data)
+	assert.Equal(t, retrospector.ValueDomainName, entities[1].Value.Type)
+	assert.Equal(t, "10.1.2.4", entities[2].Value.Data)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/cookpad/retrospector/pkg/arguments"
+	"github.com/cookpad/retrospector/pkg/usecase"
+	"github.com/m-mizutani/golambda"
+	"github.com/urfave/cli/v2"
+)
+
+func huntCommand(newArgs func() *arguments.Arguments) *cli.Command {
+	return &cli.Command{
+		Name:      "hunt",
+		Usage:     "Look up IOC list in entity history and output report as JSON",
+		ArgsUsage: "[FILE] (read stdin if no file)",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "source",
+				Aliases: []string{"s"},
+				Usage:   "Source of IOC in the list",
+				Value:   usecase.DefaultHuntSource,
+			},
+			&cli.BoolFlag{
+				Name:  "alert",
+				Usage: "Emit alert for matched values",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			var r io.Reader = os.Stdin
+			if c.NArg() > 0 {
+				fd, err := os.Open(c.Args().First())
+				if err != nil {
+					return golambda.WrapError(err, "Failed to open IOC list").With("path", c.Args().First())
+				}
+				defer fd.Close()
+				r = fd
+			}
+
+			iocChunk, err := usecase.ParseHuntInput(r, c.String("source"))
+			if err != nil {
+				return err
+			}
+
+			report, err := usecase.Hunt(newArgs(), iocChunk, &usecase.HuntOptions{Alert: c.Bool("alert")})
+			if err != nil {
+				return err
+			}
+
+			encoder := json.NewEncoder(c.App.Writer)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(report)
+		},
+	}
+}
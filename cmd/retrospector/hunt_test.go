@@ -0,0 +1,44 @@
+package main_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/cookpad/retrospector"
+	main "github.com/cookpad/retrospector/cmd/retrospector"
+	"github.com/cookpad/retrospector/pkg/arguments"
+	"github.com/cookpad/retrospector/pkg/mock"
+	"github.com/cookpad/retrospector/pkg/usecase"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHunt(t *testing.T) {
+	repo := mock.NewRepository()
+	require.NoError(t, repo.PutEntities([]*retrospector.Entity{
+		{
+			Value:      retrospector.Value{Data: "192.0.2.1", Type: retrospector.ValueIPAddr},
+			Subject:    "blue",
+			RecordedAt: 1600000000,
+		},
+	}))
+	args := &arguments.Arguments{Repository: repo}
+
+	path := filepath.Join(t.TempDir(), "iocs.txt")
+	require.NoError(t, ioutil.WriteFile(path, []byte("192.0.2.1\nexample.com\n"), 0644))
+
+	var out bytes.Buffer
+	app := main.NewAppWithArguments(func() *arguments.Arguments { return args })
+	app.Writer = &out
+	require.NoError(t, app.Run([]string{"retrospector", "hunt", "-s", "partner", path}))
+
+	var report usecase.HuntReport
+	require.NoError(t, json.Unmarshal(out.Bytes(), &report))
+	assert.Equal(t, 2, report.Values)
+	require.Equal(t, 1, len(report.Matches))
+	assert.Equal(t, "partner", report.Matches[0].IOC.Source)
+	assert.Equal(t, []string{"blue"}, report.Matches[0].Subjects)
+}
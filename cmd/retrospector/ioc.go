@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cookpad/retrospector"
+	"github.com/cookpad/retrospector/pkg/arguments"
+	"github.com/cookpad/retrospector/pkg/service"
+	"github.com/cookpad/retrospector/pkg/usecase"
+	"github.com/m-mizutani/golambda"
+	"github.com/urfave/cli/v2"
+)
+
+func iocCommand(newArgs func() *arguments.Arguments) *cli.Command {
+	return &cli.Command{
+		Name:  "ioc",
+		Usage: "Submit, revoke and reindex IOC manually",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "submit",
+				Usage:     "Submit values as IOC. Submitted IOC is published to IOC topic (IOC_TOPIC_ARN)",
+				ArgsUsage: "[VALUE ...]",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "type",
+						Aliases: []string{"t"},
+						Usage:   "Value type. Guessed by format of each value if not set",
+					},
+					&cli.StringFlag{
+						Name:    "file",
+						Aliases: []string{"f"},
+						Usage:   "File of values, one value per line",
+					},
+					&cli.StringFlag{
+						Name:     "ticket",
+						Usage:    "Ticket reference of the submission",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:    "submitter",
+						Aliases: []string{"u"},
+						Usage:   "Submitter identity",
+						Value:   os.Getenv("USER"),
+					},
+					&cli.StringFlag{
+						Name:    "reason",
+						Aliases: []string{"r"},
+						Usage:   "Reason of the submission",
+					},
+					&cli.StringFlag{
+						Name:    "description",
+						Aliases: []string{"d"},
+						Usage:   "Description of IOC",
+					},
+					&cli.DurationFlag{
+						Name:  "valid-for",
+						Usage: "Validity period of IOC, e.g. 720h. Validity has no end if not set, but IOC is removed from repository 30 days after submission like crawled IOC",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					data := c.Args().Slice()
+					if path := c.String("file"); path != "" {
+						lines, err := readLines(path)
+						if err != nil {
+							return err
+						}
+						data = append(data, lines...)
+					}
+
+					var values []*retrospector.Value
+					for _, d := range data {
+						values = append(values, &retrospector.Value{
+							Type: retrospector.ValueType(c.String("type")),
+							Data: d,
+						})
+					}
+
+					sub := &service.Submission{
+						Values:      values,
+						Submitter:   c.String("submitter"),
+						Ticket:      c.String("ticket"),
+						Reason:      c.String("reason"),
+						Description: c.String("description"),
+					}
+					if d := c.Duration("valid-for"); d > 0 {
+						sub.ValidUntil = time.Now().Add(d).Unix()
+					}
+
+					iocChunk, err := newArgs().SubmitService().Submit(sub)
+					if err != nil {
+						return err
+					}
+					return writeIOCChunk(c, iocChunk)
+				},
+			},
+			{
+				Name:  "revoke",
+				Usage: "Revoke IOC submitted for the ticket",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "type",
+						Aliases: []string{"t"},
+						Usage:   "Value type. Guessed by format of the value if not set",
+					},
+					&cli.StringFlag{
+						Name:     "value",
+						Aliases:  []string{"v"},
+						Usage:    "Value of IOC",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "ticket",
+						Usage:    "Ticket reference of the submission",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:    "actor",
+						Aliases: []string{"a"},
+						Usage:   "Who revokes IOC",
+						Value:   os.Getenv("USER"),
+					},
+				},
+				Action: func(c *cli.Context) error {
+					value := &retrospector.Value{
+						Type: retrospector.ValueType(c.String("type")),
+						Data: c.String("value"),
+					}
+					iocChunk, err := newArgs().SubmitService().Revoke(value, c.String("ticket"), c.String("actor"))
+					if err != nil {
+						return err
+					}
+					if len(iocChunk) == 0 {
+						return golambda.NewError("No submitted IOC to revoke").With("value", value).With("ticket", c.String("ticket"))
+					}
+					return writeIOCChunk(c, iocChunk)
+				},
+			},
+			{
+				Name:  "reindex",
+				Usage: "Write lookup index of all stored IOC. Run once to migrate IOC stored without index",
+				Action: func(c *cli.Context) error {
+					count, err := usecase.ReindexIOCSet(newArgs())
+					if err != nil {
+						return err
+					}
+					return json.NewEncoder(c.App.Writer).Encode(map[string]int{"iocs": count})
+				},
+			},
+		},
+	}
+}
+
+func writeIOCChunk(c *cli.Context, iocChunk retrospector.IOCChunk) error {
+	encoder := json.NewEncoder(c.App.Writer)
+	for _, ioc := range iocChunk {
+		if err := encoder.Encode(ioc); err != nil {
+			return golambda.WrapError(err, "Failed to write IOC").With("ioc", ioc)
+		}
+	}
+	return nil
+}
+
+func readLines(path string) ([]string, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, golambda.WrapError(err, "Failed to open file").With("path", path)
+	}
+	defer fd.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(fd)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, golambda.WrapError(err, "Failed to read file").With("path", path)
+	}
+	return lines, nil
+}
@@ -0,0 +1,57 @@
+package main_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/cookpad/retrospector"
+	main "github.com/cookpad/retrospector/cmd/retrospector"
+	"github.com/cookpad/retrospector/pkg/arguments"
+	"github.com/cookpad/retrospector/pkg/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIOCSubmit(t *testing.T) {
+	newSNS, snsClient := mock.NewSNSMock()
+	args := &arguments.Arguments{
+		Repository:  mock.NewRepository(),
+		NewSNS:      newSNS,
+		IOCTopicARN: "arn:aws:sns:us-east-1:111122223333:my-topic",
+	}
+
+	var out bytes.Buffer
+	app := main.NewAppWithArguments(func() *arguments.Arguments { return args })
+	app.Writer = &out
+	require.NoError(t, app.Run([]string{"retrospector", "ioc", "submit",
+		"--ticket", "SEC-1", "-u", "blue", "--valid-for", "720h", "192.0.2.1", "Example.COM"}))
+
+	require.Equal(t, 1, len(snsClient.PublishInput))
+	var iocChunk retrospector.IOCChunk
+	require.NoError(t, json.Unmarshal([]byte(*snsClient.PublishInput[0].Message), &iocChunk))
+	require.Equal(t, 2, len(iocChunk))
+	assert.Equal(t, retrospector.ValueIPAddr, iocChunk[0].Type)
+	assert.Equal(t, "example.com", iocChunk[1].Data)
+	assert.Equal(t, "manual:SEC-1:blue", iocChunk[1].Source)
+	assert.NotZero(t, iocChunk[1].ValidUntil)
+
+	require.Error(t, app.Run([]string{"retrospector", "ioc", "submit", "-u", "blue", "192.0.2.1"}))
+	require.Error(t, app.Run([]string{"retrospector", "ioc", "revoke", "-v", "192.0.2.1", "--ticket", "SEC-1"}))
+}
+
+func TestIOCReindex(t *testing.T) {
+	repo := mock.NewRepository()
+	require.NoError(t, repo.PutIOCSet([]*retrospector.IOC{
+		{Value: retrospector.Value{Data: "example.com", Type: retrospector.ValueDomainName}, Source: "blue"},
+		{Value: retrospector.Value{Data: "example.com", Type: retrospector.ValueDomainName}, Source: "orange"},
+		{Value: retrospector.Value{Data: "192.0.2.1", Type: retrospector.ValueIPAddr}, Source: "blue"},
+	}))
+	args := &arguments.Arguments{Repository: repo}
+
+	var out bytes.Buffer
+	app := main.NewAppWithArguments(func() *arguments.Arguments { return args })
+	app.Writer = &out
+	require.NoError(t, app.Run([]string{"retrospector", "ioc", "reindex"}))
+	assert.JSONEq(t, `{"iocs":3}`, out.String())
+}
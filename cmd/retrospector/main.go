@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+
+	"github.com/cookpad/retrospector/pkg/arguments"
+	"github.com/cookpad/retrospector/pkg/logging"
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+)
+
+var logger = logging.Logger
+
+// NewApp returns CLI application of retrospector. It is exported for test
+func NewApp() *cli.App {
+	return NewAppWithArguments(arguments.New)
+}
+
+// NewAppWithArguments returns CLI application that builds Arguments by newArgs. Arguments are built only when a command requires AWS resources
+func NewAppWithArguments(newArgs func() *arguments.Arguments) *cli.App {
+	return &cli.App{
+		Name:  "retrospector",
+		Usage: "Command line tool of retrospector",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "log-level",
+				Aliases: []string{"l"},
+				Usage:   "Log level [trace|debug|info|error]",
+				EnvVars: []string{"LOG_LEVEL"},
+				Value:   "info",
+			},
+		},
+		Before: func(c *cli.Context) error {
+			logging.Init(c.String("log-level"))
+			// Stdout is reserved for command output
+			logger = logging.Logger.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+			return nil
+		},
+		Commands: []*cli.Command{
+			extractCommand(),
+			alertCommand(newArgs),
+			huntCommand(newArgs),
+			exportCommand(newArgs),
+			backfillCommand(newArgs),
+			replayCommand(newArgs),
+			iocCommand(newArgs),
+			serveCommand(newArgs),
+		},
+	}
+}
+
+func main() {
+	if err := NewApp().Run(os.Args); err != nil {
+		logger.Error().Err(err).Msg("Failed")
+		os.Exit(1)
+	}
+}
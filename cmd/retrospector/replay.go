@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/cookpad/retrospector"
+	"github.com/cookpad/retrospector/pkg/arguments"
+	"github.com/cookpad/retrospector/pkg/service"
+	"github.com/cookpad/retrospector/pkg/usecase"
+	"github.com/urfave/cli/v2"
+)
+
+func replayCommand(newArgs func() *arguments.Arguments) *cli.Command {
+	return &cli.Command{
+		Name:  "replay",
+		Usage: "Look up stored IOC set against current entities and alert in the same way as IOC detection",
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:    "source",
+				Aliases: []string{"s"},
+				Usage:   "Replay only IOCs of the source",
+			},
+			&cli.StringSliceFlag{
+				Name:    "type",
+				Aliases: []string{"t"},
+				Usage:   "Replay only IOCs of the value type",
+			},
+			&cli.StringFlag{
+				Name:  "since",
+				Usage: "Replay only IOCs updated after the time in RFC3339",
+			},
+			&cli.StringFlag{
+				Name:  "until",
+				Usage: "Replay only IOCs updated before the time in RFC3339",
+			},
+			&cli.IntFlag{
+				Name:  "batch-size",
+				Usage: "Number of IOCs looked up at once",
+				Value: usecase.DefaultReplayBatchSize,
+			},
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Output matched IOCs without alert",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			opt := &usecase.ReplayOptions{
+				Filter: service.ExportFilter{
+					Sources: c.StringSlice("source"),
+				},
+				BatchSize: c.Int("batch-size"),
+				DryRun:    c.Bool("dry-run"),
+			}
+			for _, t := range c.StringSlice("type") {
+				opt.Filter.Types = append(opt.Filter.Types, retrospector.ValueType(t))
+			}
+
+			var err error
+			if opt.Filter.Since, err = parseTimeFlag(c, "since"); err != nil {
+				return err
+			}
+			if opt.Filter.Until, err = parseTimeFlag(c, "until"); err != nil {
+				return err
+			}
+
+			report, err := usecase.Replay(newArgs(), opt)
+			if err != nil {
+				return err
+			}
+
+			encoder := json.NewEncoder(c.App.Writer)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(report)
+		},
+	}
+}
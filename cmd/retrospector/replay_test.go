@@ -0,0 +1,70 @@
+package main_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/cookpad/retrospector"
+	main "github.com/cookpad/retrospector/cmd/retrospector"
+	"github.com/cookpad/retrospector/pkg/arguments"
+	"github.com/cookpad/retrospector/pkg/mock"
+	"github.com/cookpad/retrospector/pkg/usecase"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplay(t *testing.T) {
+	repo := mock.NewRepository()
+	domain := retrospector.Value{Data: "example.com", Type: retrospector.ValueDomainName}
+	ipaddr := retrospector.Value{Data: "192.0.2.1", Type: retrospector.ValueIPAddr}
+	require.NoError(t, repo.PutIOCSet([]*retrospector.IOC{
+		{Value: domain, Source: "blue", UpdatedAt: 1600000000},
+		{Value: ipaddr, Source: "orange", UpdatedAt: 1600000000},
+	}))
+	// Entities are recorded after IOC detection
+	require.NoError(t, repo.PutEntities([]*retrospector.Entity{
+		{Value: domain, Subject: "alice", Source: "proxy", RecordedAt: 1600000100},
+		{Value: ipaddr, Subject: "bob", Source: "flowlogs", RecordedAt: 1600000100},
+	}))
+
+	httpClient := &mock.HTTPClient{
+		RespCode: http.StatusOK,
+		RespBody: ioutil.NopCloser(strings.NewReader("")),
+	}
+	args := &arguments.Arguments{
+		Repository:      repo,
+		HTTP:            httpClient,
+		SlackWebhookURL: "https://test.example.com/slack",
+	}
+	run := func(argv ...string) *usecase.ReplayReport {
+		var out bytes.Buffer
+		app := main.NewAppWithArguments(func() *arguments.Arguments { return args })
+		app.Writer = &out
+		require.NoError(t, app.Run(append([]string{"retrospector", "replay"}, argv...)))
+
+		var report usecase.ReplayReport
+		require.NoError(t, json.Unmarshal(out.Bytes(), &report))
+		return &report
+	}
+
+	report := run("--dry-run")
+	assert.Equal(t, 2, report.IOCs)
+	assert.Equal(t, 2, report.Matched)
+	assert.Equal(t, 2, len(report.Matches))
+	assert.Equal(t, 0, len(httpClient.Requests))
+
+	report = run("-s", "blue")
+	assert.Equal(t, 1, report.IOCs)
+	assert.Equal(t, 1, report.Matched)
+	assert.Empty(t, report.Matches)
+	assert.Equal(t, 1, len(httpClient.Requests))
+
+	// Value already alerted for the subject is not alerted again
+	report = run()
+	assert.Equal(t, 2, report.Matched)
+	assert.Equal(t, 2, len(httpClient.Requests))
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/cookpad/retrospector/pkg/api"
+	"github.com/cookpad/retrospector/pkg/arguments"
+	"github.com/cookpad/retrospector/pkg/metrics"
+	"github.com/m-mizutani/golambda"
+	"github.com/urfave/cli/v2"
+)
+
+func serveCommand(newArgs func() *arguments.Arguments) *cli.Command {
+	return &cli.Command{
+		Name:  "serve",
+		Usage: "Run HTTP API server locally",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "addr",
+				Aliases: []string{"a"},
+				Usage:   "Listen address",
+				Value:   "127.0.0.1:8080",
+			},
+			&cli.StringSliceFlag{
+				Name:     "api-key",
+				Aliases:  []string{"k"},
+				Usage:    "API key in format of name:key",
+				EnvVars:  []string{"RETROSPECTOR_API_KEYS"},
+				Required: true,
+			},
+			&cli.BoolFlag{
+				Name:  "metrics",
+				Usage: "Expose metrics in Prometheus format at /metrics without authentication",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			var server http.Handler = api.New(newArgs(), api.NewAuthenticator(strings.Join(c.StringSlice("api-key"), ",")))
+
+			if c.Bool("metrics") {
+				metrics.Default.SetWriter(metrics.DefaultPrometheusWriter)
+				mux := http.NewServeMux()
+				mux.Handle("/metrics", metrics.DefaultPrometheusWriter)
+				mux.Handle("/", flushMetrics(server))
+				server = mux
+			}
+
+			logger.Info().Str("addr", c.String("addr")).Msg("Starting API server")
+			if err := http.ListenAndServe(c.String("addr"), server); err != nil {
+				return golambda.WrapError(err, "API server stopped").With("addr", c.String("addr"))
+			}
+			return nil
+		},
+	}
+}
+
+// flushMetrics writes metrics recorded in each request to Prometheus writer
+func flushMetrics(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r)
+		if err := metrics.Flush(); err != nil {
+			logger.Error().Err(err).Msg("Failed to flush metrics")
+		}
+	})
+}
@@ -0,0 +1,19 @@
+package retrospector
+
+// Detection is record of the latest alert of a value for a subject. Sources are IOC sources that have been alerted for the subject.
+type Detection struct {
+	Value
+	Subject    string   `json:"subject" dynamo:"subject"`
+	Sources    []string `json:"sources" dynamo:"sources,set"`
+	DetectedAt int64    `json:"detected_at" dynamo:"detected_at"`
+}
+
+// HasSource returns true if source has been alerted for the subject
+func (x *Detection) HasSource(source string) bool {
+	for _, s := range x.Sources {
+		if s == source {
+			return true
+		}
+	}
+	return false
+}
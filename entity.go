@@ -6,5 +6,74 @@ type Entity struct {
 	Subject     string `json:"subject" dynamo:"subject"`
 	RecordedAt  int64  `json:"recorded_at" dynamo:"recorded_at"`
 	Description string `json:"description" dynamo:"description"`
-	Detected    bool   `json:"detected" dynamo:"detected"`
+
+	// Aggregated figures of the entity per (value, subject, source). They are maintained by repository
+	FirstSeen int64 `json:"first_seen,omitempty" dynamo:"first_seen"`
+	LastSeen  int64 `json:"last_seen,omitempty" dynamo:"last_seen"`
+	Count     int64 `json:"count,omitempty" dynamo:"count"`
+}
+
+// EntityKey identifies aggregation unit of entity
+type EntityKey struct {
+	Value
+	Subject string
+	Source  string
+}
+
+// Key returns aggregation key of the entity
+func (x *Entity) Key() EntityKey {
+	return EntityKey{Value: x.Value, Subject: x.Subject, Source: x.Source}
+}
+
+// Seen returns FirstSeen, LastSeen and Count. RecordedAt and 1 are used for an entity that is not aggregated yet.
+func (x *Entity) Seen() (first, last, count int64) {
+	first, last, count = x.FirstSeen, x.LastSeen, x.Count
+	if count == 0 {
+		count = 1
+	}
+	if first == 0 {
+		first = x.RecordedAt
+	}
+	if last == 0 {
+		last = x.RecordedAt
+	}
+	return
+}
+
+// AggregateEntities merges entities that have same key. FirstSeen, LastSeen and Count of returned entities are set. Description of the latest entity is kept.
+func AggregateEntities(entities []*Entity) []*Entity {
+	var results []*Entity
+	index := make(map[EntityKey]*Entity)
+
+	for _, entity := range entities {
+		first, last, count := entity.Seen()
+		key := entity.Key()
+
+		agg, ok := index[key]
+		if !ok {
+			agg = &Entity{
+				Value:       entity.Value,
+				Source:      entity.Source,
+				Subject:     entity.Subject,
+				RecordedAt:  last,
+				Description: entity.Description,
+				FirstSeen:   first,
+				LastSeen:    last,
+			}
+			index[key] = agg
+			results = append(results, agg)
+		} else {
+			if first < agg.FirstSeen {
+				agg.FirstSeen = first
+			}
+			if last >= agg.LastSeen {
+				agg.LastSeen = last
+				agg.RecordedAt = last
+				agg.Description = entity.Description
+			}
+		}
+		agg.Count += count
+	}
+
+	return results
 }
@@ -6,7 +6,28 @@ type IOC struct {
 	UpdatedAt   int64  `json:"updated_at" dynamo:"updated_at"`
 	Reason      string `json:"reason" dynamo:"reason"`
 	Description string `json:"description" dynamo:"description"`
-	Detected    bool   `json:"detected" dynamo:"detected"`
+
+	// Validity of IOC in unix seconds. Zero means unknown (FirstSeen, ValidFrom) or no expiration (ValidUntil)
+	FirstSeen  int64 `json:"first_seen,omitempty" dynamo:"first_seen"`
+	ValidFrom  int64 `json:"valid_from,omitempty" dynamo:"valid_from"`
+	ValidUntil int64 `json:"valid_until,omitempty" dynamo:"valid_until"`
+
+	// Revocation of IOC. Revoked IOC is kept for provenance but never matches
+	RevokedAt int64  `json:"revoked_at,omitempty" dynamo:"revoked_at"`
+	RevokedBy string `json:"revoked_by,omitempty" dynamo:"revoked_by"`
 }
 
 type IOCChunk []*IOC
+
+// IsRevoked returns true if the IOC has been revoked
+func (x *IOC) IsRevoked() bool {
+	return x.RevokedAt > 0
+}
+
+// PublishedAt returns time when the IOC became valid. ValidFrom is preferred to FirstSeen. Zero is returned if both are unknown.
+func (x *IOC) PublishedAt() int64 {
+	if x.ValidFrom > 0 {
+		return x.ValidFrom
+	}
+	return x.FirstSeen
+}
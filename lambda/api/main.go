@@ -0,0 +1,47 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/cookpad/retrospector/pkg/api"
+	"github.com/cookpad/retrospector/pkg/arguments"
+	"github.com/m-mizutani/golambda"
+)
+
+// Handler is exporeted for test
+func Handler(args *arguments.Arguments, event golambda.Event) (interface{}, error) {
+	var req events.APIGatewayProxyRequest
+	if err := event.Bind(&req); err != nil {
+		return nil, err
+	}
+
+	server, err := serverOf(args)
+	if err != nil {
+		return nil, err
+	}
+	return api.HandleAPIGateway(event.Ctx, server, &req)
+}
+
+// servers caches *api.Server of each Arguments not to load API keys from Secrets Manager for every request
+var servers sync.Map
+
+func serverOf(args *arguments.Arguments) (*api.Server, error) {
+	if server, ok := servers.Load(args); ok {
+		return server.(*api.Server), nil
+	}
+
+	secrets, err := args.GetSecrets()
+	if err != nil {
+		return nil, err
+	}
+	server, _ := servers.LoadOrStore(args, api.New(args, api.NewAuthenticator(secrets.APIKeys)))
+	return server.(*api.Server), nil
+}
+
+func main() {
+	args := arguments.New()
+	arguments.StartLambda("api", args, func(event golambda.Event) (interface{}, error) {
+		return Handler(args, event)
+	})
+}
@@ -0,0 +1,91 @@
+package main_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/cookpad/retrospector"
+	"github.com/cookpad/retrospector/pkg/arguments"
+	"github.com/cookpad/retrospector/pkg/mock"
+	"github.com/m-mizutani/golambda"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	main "github.com/cookpad/retrospector/lambda/api"
+)
+
+type dummySM struct {
+	calls int
+}
+
+func (x *dummySM) GetSecretValue(req *secretsmanager.GetSecretValueInput) (*secretsmanager.GetSecretValueOutput, error) {
+	x.calls++
+	return &secretsmanager.GetSecretValueOutput{
+		SecretString: aws.String(`{"api_keys":"analyst:secret-key"}`),
+	}, nil
+}
+
+func TestAPI(t *testing.T) {
+	repo := mock.NewRepository()
+	require.NoError(t, repo.PutEntities([]*retrospector.Entity{
+		{
+			Value:   retrospector.Value{Data: "example.com", Type: retrospector.ValueDomainName},
+			Subject: "blue",
+		},
+	}))
+	sm := &dummySM{}
+	args := &arguments.Arguments{
+		Repository: repo,
+		NewSM:      func(region string) (golambda.SecretsManagerClient, error) { return sm, nil },
+		SecretsARN: "arn:aws:secretsmanager:ap-northeast-1:111122223333:secret:orange",
+	}
+
+	call := func(req events.APIGatewayProxyRequest) *events.APIGatewayProxyResponse {
+		resp, err := main.Handler(args, golambda.Event{Origin: req})
+		require.NoError(t, err)
+		return resp.(*events.APIGatewayProxyResponse)
+	}
+
+	t.Run("API key", func(t *testing.T) {
+		resp := call(events.APIGatewayProxyRequest{
+			HTTPMethod:            "GET",
+			Path:                  "/v1/entities",
+			Headers:               map[string]string{"x-api-key": "secret-key"},
+			QueryStringParameters: map[string]string{"type": "domain", "value": "example.com"},
+		})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var body struct {
+			Entities []*retrospector.Entity `json:"entities"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(resp.Body), &body))
+		require.Equal(t, 1, len(body.Entities))
+		assert.Equal(t, "blue", body.Entities[0].Subject)
+	})
+
+	t.Run("IAM", func(t *testing.T) {
+		req := events.APIGatewayProxyRequest{
+			HTTPMethod:            "GET",
+			Path:                  "/v1/entities",
+			QueryStringParameters: map[string]string{"type": "domain", "value": "example.com"},
+		}
+		req.RequestContext.Identity.UserArn = "arn:aws:iam::111122223333:user/blue"
+		assert.Equal(t, http.StatusOK, call(req).StatusCode)
+	})
+
+	t.Run("unauthorized", func(t *testing.T) {
+		resp := call(events.APIGatewayProxyRequest{
+			HTTPMethod: "GET",
+			Path:       "/v1/entities",
+		})
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("API keys are loaded once", func(t *testing.T) {
+		assert.Equal(t, 1, sm.calls)
+	})
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/m-mizutani/golambda"
 	"github.com/cookpad/retrospector"
 	"github.com/cookpad/retrospector/pkg/arguments"
+	"github.com/cookpad/retrospector/pkg/metrics"
 )
 
 var logger = golambda.Logger
@@ -23,6 +24,24 @@ type otxContent struct {
 	Indicator   string `json:"indicator"`
 	Title       string `json:"title"`
 	Type        string `json:"type"`
+	Created     string `json:"created"`
+	Expiration  string `json:"expiration"`
+}
+
+// otxTimeFormat is format of created and expiration in OTX indicator
+const otxTimeFormat = "2006-01-02T15:04:05"
+
+// parseOTXTime returns unix seconds of OTX timestamp, or zero if it is empty or invalid
+func parseOTXTime(ts string) int64 {
+	if ts == "" {
+		return 0
+	}
+	t, err := time.Parse(otxTimeFormat, ts)
+	if err != nil {
+		logger.With("ts", ts).With("err", err).Error("Invalid timestamp in OTX indicator")
+		return 0
+	}
+	return t.Unix()
 }
 
 type otxResponse struct {
@@ -110,6 +129,8 @@ func Handler(args *arguments.Arguments, event golambda.Event) (interface{}, erro
 					Reason:      content.Title,
 					UpdatedAt:   now.Unix(),
 					Description: fmt.Sprintf("id:%d", content.ID),
+					FirstSeen:   parseOTXTime(content.Created),
+					ValidUntil:  parseOTXTime(content.Expiration),
 				}
 				iocMap[*value] = ioc
 			} else if len(ioc.Description) < 1024 {
@@ -124,6 +145,7 @@ func Handler(args *arguments.Arguments, event golambda.Event) (interface{}, erro
 	for _, ioc := range iocMap {
 		iocChunk = append(iocChunk, ioc)
 	}
+	metrics.Count("IOCsFetched", len(iocChunk), metrics.Dimensions{"Source": "otx"})
 
 	snsSvc := args.SNSService()
 	if err := snsSvc.PublishIOC(args.IOCTopicARN, iocChunk); err != nil {
@@ -136,7 +158,8 @@ func Handler(args *arguments.Arguments, event golambda.Event) (interface{}, erro
 }
 
 func main() {
-	golambda.Start(func(event golambda.Event) (interface{}, error) {
-		return Handler(arguments.New(), event)
+	args := arguments.New()
+	arguments.StartLambda("crawlOTX", args, func(event golambda.Event) (interface{}, error) {
+		return Handler(args, event)
 	})
 }
@@ -7,6 +7,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/secretsmanager"
@@ -38,6 +39,8 @@ func TestCrawlOTX(t *testing.T) {
 		"id": 2711680570,
 		"indicator": "example.org",
 		"type": "hostname",
+		"created": "2020-12-10T03:04:05",
+		"expiration": "2021-01-09T00:00:00",
 		"title": null,
 		"description": null,
 		"content": ""
@@ -87,6 +90,15 @@ func TestCrawlOTX(t *testing.T) {
 	iocValues := []string{"example.org", "10.1.2.3"}
 	assert.Contains(t, iocValues, iocChunk[0].Data)
 	assert.Contains(t, iocValues, iocChunk[1].Data)
+
+	for _, ioc := range iocChunk {
+		if ioc.Data == "example.org" {
+			assert.Equal(t, time.Date(2020, 12, 10, 3, 4, 5, 0, time.UTC).Unix(), ioc.FirstSeen)
+			assert.Equal(t, time.Date(2021, 1, 9, 0, 0, 0, 0, time.UTC).Unix(), ioc.ValidUntil)
+		} else {
+			assert.Equal(t, int64(0), ioc.FirstSeen)
+		}
+	}
 }
 
 func TestCrawlOTXIntegration(t *testing.T) {
@@ -12,6 +12,7 @@ import (
 	"github.com/m-mizutani/golambda"
 	"github.com/cookpad/retrospector"
 	"github.com/cookpad/retrospector/pkg/arguments"
+	"github.com/cookpad/retrospector/pkg/metrics"
 )
 
 const (
@@ -82,6 +83,7 @@ func Handler(args *arguments.Arguments, event golambda.Event) (interface{}, erro
 				Value:       value,
 				Source:      "URLhaus",
 				UpdatedAt:   ts.Unix(),
+				FirstSeen:   ts.Unix(),
 				Reason:      row[4],
 				Description: fmt.Sprintf("%s: %s", row[0], row[2]),
 			}
@@ -95,6 +97,8 @@ func Handler(args *arguments.Arguments, event golambda.Event) (interface{}, erro
 	for _, ioc := range iocMap {
 		iocChunk = append(iocChunk, ioc)
 	}
+	metrics.Count("IOCsFetched", len(iocChunk), metrics.Dimensions{"Source": "URLhaus"})
+
 	if err := snsSvc.PublishIOC(args.IOCTopicARN, iocChunk); err != nil {
 		return nil, golambda.WrapError(err).With("topic", args.IOCTopicARN)
 	}
@@ -103,7 +107,8 @@ func Handler(args *arguments.Arguments, event golambda.Event) (interface{}, erro
 }
 
 func main() {
-	golambda.Start(func(event golambda.Event) (interface{}, error) {
-		return Handler(arguments.New(), event)
+	args := arguments.New()
+	arguments.StartLambda("crawlURLHaus", args, func(event golambda.Event) (interface{}, error) {
+		return Handler(args, event)
 	})
 }
@@ -3,9 +3,9 @@ package main
 import (
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/m-mizutani/golambda"
-	"github.com/cookpad/retrospector"
 	"github.com/cookpad/retrospector/pkg/arguments"
-	"github.com/cookpad/retrospector/pkg/service"
+	"github.com/cookpad/retrospector/pkg/tracing"
+	"github.com/cookpad/retrospector/pkg/usecase"
 )
 
 // Handler is exporeted for test
@@ -15,10 +15,6 @@ func Handler(args *arguments.Arguments, event golambda.Event) (interface{}, erro
 		return nil, err
 	}
 
-	alertSvc := args.AlertService()
-	repoSvc := args.RepositoryService()
-	entitySvc := args.EntityService()
-
 	for _, event := range recvEvents {
 		var s3Event events.S3Event
 		if err := event.Bind(&s3Event); err != nil {
@@ -26,49 +22,16 @@ func Handler(args *arguments.Arguments, event golambda.Event) (interface{}, erro
 		}
 
 		for _, s3Record := range s3Event.Records {
-			rq := entitySvc.NewReadQueue(s3Record.AWSRegion, s3Record.S3.Bucket.Name, s3Record.S3.Object.Key)
-			entityMap := make(map[retrospector.Value][]*retrospector.Entity)
-
-			for {
-				entity := rq.Read()
-				if entity == nil {
-					break
-				}
-
-				entityMap[entity.Value] = append(entityMap[entity.Value], entity)
-			}
-
-			if err := rq.Error(); err != nil {
+			obj := s3Record.S3.Object
+			span := tracing.StartTrace("DetectEntityObject", tracing.NewCorrelationID(s3Record.S3.Bucket.Name, obj.Key, obj.ETag), "", map[string]string{
+				"aws.s3.bucket": s3Record.S3.Bucket.Name,
+				"aws.s3.key":    obj.Key,
+			})
+			err := usecase.DetectEntityObject(args, s3Record.AWSRegion, s3Record.S3.Bucket.Name, obj.Key)
+			span.End(err)
+			if err != nil {
 				return nil, golambda.WrapError(err).With("s3", s3Record)
 			}
-
-			for value, entities := range entityMap {
-				matched, err := repoSvc.DetectIOCSet([]*retrospector.Entity{
-					{Value: value},
-				})
-				if err != nil {
-					return nil, golambda.WrapError(err).With("s3", s3Record)
-				}
-				if len(matched) == 0 {
-					continue
-				}
-
-				alert := &service.Alert{
-					Cause:    service.AlertCauseEntity,
-					Target:   &value,
-					Entities: entities,
-					IOCChunk: matched,
-				}
-				if err := alertSvc.EmitToSlack(alert); err != nil {
-					return nil, golambda.WrapError(err).With("alert", alert).With("s3", s3Record)
-				}
-
-				for _, ioc := range matched {
-					if err := repoSvc.UpdateIOCDetected(ioc); err != nil {
-						return nil, err
-					}
-				}
-			}
 		}
 	}
 
@@ -76,7 +39,8 @@ func Handler(args *arguments.Arguments, event golambda.Event) (interface{}, erro
 }
 
 func main() {
-	golambda.Start(func(event golambda.Event) (interface{}, error) {
-		return Handler(arguments.New(), event)
+	args := arguments.New()
+	arguments.StartLambda("entityDetect", args, func(event golambda.Event) (interface{}, error) {
+		return Handler(args, event)
 	})
 }
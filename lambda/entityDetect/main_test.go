@@ -8,9 +8,12 @@ import (
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
 	"github.com/m-mizutani/golambda"
 	"github.com/cookpad/retrospector"
 	"github.com/cookpad/retrospector/pkg/arguments"
+	"github.com/cookpad/retrospector/pkg/bloom"
 	"github.com/cookpad/retrospector/pkg/mock"
 	"github.com/cookpad/retrospector/pkg/service"
 	"github.com/stretchr/testify/assert"
@@ -19,6 +22,17 @@ import (
 	main "github.com/cookpad/retrospector/lambda/entityDetect"
 )
 
+type dummySM struct {
+	calls int
+}
+
+func (x *dummySM) GetSecretValue(req *secretsmanager.GetSecretValueInput) (*secretsmanager.GetSecretValueOutput, error) {
+	x.calls++
+	return &secretsmanager.GetSecretValueOutput{
+		SecretString: aws.String(`{"virustotal_api_key":"vt-key"}`),
+	}, nil
+}
+
 func TestEntityDetect(t *testing.T) {
 	// Setup test event
 	s3Event := events.S3Event{
@@ -81,10 +95,60 @@ func TestEntityDetect(t *testing.T) {
 		assert.Equal(t, "test.example.com", httpClient.Requests[0].URL.Host)
 		assert.Equal(t, "/slack", httpClient.Requests[0].URL.Path)
 
-		iocSet, err := repo.GetIOCSet([]*retrospector.Entity{{Value: iocData[0].Value}})
+		detections, err := repo.GetDetections(&iocData[0].Value)
+		require.NoError(t, err)
+		require.Equal(t, 1, len(detections))
+		assert.NotZero(t, detections[0].DetectedAt)
+	})
+
+	t.Run("benign alert is suppressed before updating alert state", func(t *testing.T) {
+		iocData := []*retrospector.IOC{
+			{
+				Value: retrospector.Value{
+					Data: "five",
+					Type: retrospector.ValueDomainName,
+				},
+			},
+		}
+		repo := mock.NewRepository()
+		require.NoError(t, repo.PutIOCSet(iocData))
+		require.NoError(t, repo.PutReputation(&retrospector.Reputation{
+			Value:     iocData[0].Value,
+			Source:    "VirusTotal",
+			Verdict:   retrospector.VerdictBenign,
+			CheckedAt: time.Now().Unix(),
+		}))
+		httpClient := &mock.HTTPClient{
+			RespCode: http.StatusOK,
+			RespBody: ioutil.NopCloser(strings.NewReader("")),
+		}
+		sm := &dummySM{}
+		args := &arguments.Arguments{
+			Repository:          repo,
+			NewS3:               newS3,
+			NewSM:               func(region string) (golambda.SecretsManagerClient, error) { return sm, nil },
+			SecretsARN:          "arn:aws:secretsmanager:us-east-5:111122223333:secret:orange",
+			HTTP:                httpClient,
+			SlackWebhookURL:     "https://test.example.com/slack",
+			Enrichers:           "virustotal",
+			SuppressBenignAlert: true,
+		}
+		_, err := main.Handler(args, event)
+		require.NoError(t, err)
+		assert.Equal(t, 0, len(httpClient.Requests))
+
+		state, err := repo.GetAlertState(&iocData[0].Value)
+		require.NoError(t, err)
+		assert.Nil(t, state)
+		detections, err := repo.GetDetections(&iocData[0].Value)
+		require.NoError(t, err)
+		assert.Equal(t, 0, len(detections))
+
+		// Enrichers are built once and shared by invocations
+		_, err = main.Handler(args, event)
 		require.NoError(t, err)
-		require.Equal(t, 1, len(iocSet))
-		assert.True(t, iocSet[0].Detected)
+		assert.Equal(t, 0, len(httpClient.Requests))
+		assert.Equal(t, 1, sm.calls)
 	})
 
 	t.Run("mismatched by data", func(t *testing.T) {
@@ -138,4 +202,54 @@ func TestEntityDetect(t *testing.T) {
 		require.NoError(t, err)
 		assert.Equal(t, 0, len(httpClient.Requests))
 	})
+
+	t.Run("skip lookup by IOC filter", func(t *testing.T) {
+		repo := mock.NewRepository()
+		require.NoError(t, repo.PutIOCSet([]*retrospector.IOC{
+			{
+				Value: retrospector.Value{
+					Data: "five",
+					Type: retrospector.ValueDomainName,
+				},
+			},
+		}))
+
+		// IOC filter that does not include "five"
+		filterSvc := service.NewIOCFilterService(newS3, "us-east-5", "blue", "ioc-filter/entityDetect")
+		filter := bloom.New(100, 0.01)
+		filter.Add(service.IOCFilterKey(&retrospector.Value{
+			Data: "six",
+			Type: retrospector.ValueDomainName,
+		}))
+		require.NoError(t, filterSvc.Save(filter))
+
+		httpClient := &mock.HTTPClient{
+			RespCode: http.StatusOK,
+			RespBody: ioutil.NopCloser(strings.NewReader("")),
+		}
+		args := &arguments.Arguments{
+			Repository:      repo,
+			NewS3:           newS3,
+			HTTP:            httpClient,
+			SlackWebhookURL: "https://test.example.com/slack",
+			AwsRegion:       "us-east-5",
+			IOCFilterBucket: "blue",
+			IOCFilterKey:    "ioc-filter/entityDetect",
+		}
+		_, err := main.Handler(args, event)
+		require.NoError(t, err)
+		assert.Equal(t, 0, len(httpClient.Requests))
+
+		t.Run("updated IOC filter is reloaded", func(t *testing.T) {
+			filter.Add(service.IOCFilterKey(&retrospector.Value{
+				Data: "five",
+				Type: retrospector.ValueDomainName,
+			}))
+			require.NoError(t, filterSvc.Save(filter))
+
+			_, err := main.Handler(args, event)
+			require.NoError(t, err)
+			assert.Equal(t, 1, len(httpClient.Requests))
+		})
+	})
 }
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/cookpad/retrospector/pkg/arguments"
+	"github.com/cookpad/retrospector/pkg/logging"
+	"github.com/cookpad/retrospector/pkg/tracing"
+	"github.com/cookpad/retrospector/pkg/usecase"
+	"github.com/m-mizutani/golambda"
+)
+
+var logger = logging.Logger
+
+// Handler is exporeted for test. It works as both of entityRecord and entityDetect with only one S3 GetObject per entity object
+func Handler(args *arguments.Arguments, event golambda.Event) (interface{}, error) {
+	recvEvents, err := event.DecapSNSonSQSMessage()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, event := range recvEvents {
+		var s3Event events.S3Event
+		if err := event.Bind(&s3Event); err != nil {
+			return nil, err
+		}
+
+		for _, s3Record := range s3Event.Records {
+			obj := s3Record.S3.Object
+			span := tracing.StartTrace("IngestEntityObject", tracing.NewCorrelationID(s3Record.S3.Bucket.Name, obj.Key, obj.ETag), "", map[string]string{
+				"aws.s3.bucket": s3Record.S3.Bucket.Name,
+				"aws.s3.key":    obj.Key,
+			})
+
+			logger.Info().Interface("s3record", s3Record).Msg("handle entity ingest")
+
+			err := usecase.IngestEntityObject(args, s3Record.AWSRegion, s3Record.S3.Bucket.Name, obj.Key)
+			span.End(err)
+			if err != nil {
+				return nil, golambda.WrapError(err).With("s3", s3Record)
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+func main() {
+	args := arguments.New()
+	arguments.StartLambda("entityIngest", args, func(event golambda.Event) (interface{}, error) {
+		return Handler(args, event)
+	})
+}
@@ -0,0 +1,248 @@
+package main_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/cookpad/retrospector"
+	"github.com/cookpad/retrospector/pkg/arguments"
+	"github.com/cookpad/retrospector/pkg/mock"
+	"github.com/cookpad/retrospector/pkg/service"
+	"github.com/m-mizutani/golambda"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	main "github.com/cookpad/retrospector/lambda/entityIngest"
+)
+
+func TestEntityIngest(t *testing.T) {
+	// Setup test event
+	s3Event := events.S3Event{
+		Records: []events.S3EventRecord{
+			{
+				AWSRegion: "us-east-5",
+				S3: events.S3Entity{
+					Bucket: events.S3Bucket{
+						Name: "blue",
+					},
+					Object: events.S3Object{
+						Key: "my/entity-ingest",
+					},
+				},
+			},
+		},
+	}
+	var event golambda.Event
+	require.NoError(t, event.EncapSNSonSQSMessage(s3Event))
+
+	newS3, _ := mock.NewS3Mock()
+	s3Svc := service.NewEntityService(newS3)
+	wq := s3Svc.NewWriteQueue("us-east-5", "blue", "my/entity-ingest")
+	entities := []*retrospector.Entity{
+		{
+			Value: retrospector.Value{
+				Data: "five",
+				Type: retrospector.ValueDomainName,
+			},
+			Source:     "timeless",
+			Subject:    "orange",
+			RecordedAt: time.Now().Unix(),
+		},
+		{
+			Value: retrospector.Value{
+				Data: "six",
+				Type: retrospector.ValueDomainName,
+			},
+			Source:     "timeless",
+			Subject:    "orange",
+			RecordedAt: time.Now().Unix(),
+		},
+	}
+	for _, entity := range entities {
+		wq.Write(entity)
+	}
+	require.NoError(t, wq.Close())
+
+	iocData := []*retrospector.IOC{
+		{
+			Value: retrospector.Value{
+				Data: "five",
+				Type: retrospector.ValueDomainName,
+			},
+		},
+	}
+	repo := mock.NewRepository()
+	require.NoError(t, repo.PutIOCSet(iocData))
+	httpClient := &mock.HTTPClient{
+		RespCode: http.StatusOK,
+		RespBody: ioutil.NopCloser(strings.NewReader("")),
+	}
+	args := &arguments.Arguments{
+		Repository:      repo,
+		NewS3:           newS3,
+		HTTP:            httpClient,
+		SlackWebhookURL: "https://test.example.com/slack",
+	}
+	_, err := main.Handler(args, event)
+	require.NoError(t, err)
+
+	t.Run("entities are recorded", func(t *testing.T) {
+		for _, entity := range entities {
+			resp, err := repo.GetEntities([]*retrospector.IOC{{Value: entity.Value}})
+			require.NoError(t, err)
+			require.Equal(t, 1, len(resp))
+			assert.Equal(t, entity.Subject, resp[0].Subject)
+		}
+	})
+
+	t.Run("matched entity is detected", func(t *testing.T) {
+		require.Equal(t, 1, len(httpClient.Requests))
+		assert.Equal(t, "test.example.com", httpClient.Requests[0].URL.Host)
+
+		detections, err := repo.GetDetections(&iocData[0].Value)
+		require.NoError(t, err)
+		require.Equal(t, 1, len(detections))
+		assert.NotZero(t, detections[0].DetectedAt)
+	})
+}
+
+func TestEntityIngestStreaming(t *testing.T) {
+	s3Event := events.S3Event{
+		Records: []events.S3EventRecord{
+			{
+				AWSRegion: "us-east-5",
+				S3: events.S3Entity{
+					Bucket: events.S3Bucket{Name: "blue"},
+					Object: events.S3Object{Key: "my/entity-stream"},
+				},
+			},
+		},
+	}
+	var event golambda.Event
+	require.NoError(t, event.EncapSNSonSQSMessage(s3Event))
+
+	newS3, _ := mock.NewS3Mock()
+	wq := service.NewEntityService(newS3).NewWriteQueue("us-east-5", "blue", "my/entity-stream")
+	// 10 distinct values appear 3 times each
+	for i := 0; i < 30; i++ {
+		wq.Write(&retrospector.Entity{
+			Value: retrospector.Value{
+				Data: fmt.Sprintf("v%d.example.com", i%10),
+				Type: retrospector.ValueDomainName,
+			},
+			Source:     "timeless",
+			Subject:    "orange",
+			RecordedAt: time.Now().Unix(),
+		})
+	}
+	require.NoError(t, wq.Close())
+
+	repo := mock.NewRepository()
+	require.NoError(t, repo.PutIOCSet([]*retrospector.IOC{
+		{
+			Value: retrospector.Value{
+				Data: "v3.example.com",
+				Type: retrospector.ValueDomainName,
+			},
+		},
+	}))
+	httpClient := &mock.HTTPClient{
+		RespCode: http.StatusOK,
+		RespBody: ioutil.NopCloser(strings.NewReader("")),
+	}
+	args := &arguments.Arguments{
+		Repository:       repo,
+		NewS3:            newS3,
+		HTTP:             httpClient,
+		SlackWebhookURL:  "https://test.example.com/slack",
+		EntityWindowSize: 4,
+		EntityDedupeSize: 5,
+	}
+	_, err := main.Handler(args, event)
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		resp, err := repo.GetEntities([]*retrospector.IOC{
+			{
+				Value: retrospector.Value{
+					Data: fmt.Sprintf("v%d.example.com", i),
+					Type: retrospector.ValueDomainName,
+				},
+			},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 1, len(resp))
+	}
+
+	// Alert is emitted only once even if the value appears in multiple windows
+	assert.Equal(t, 1, len(httpClient.Requests))
+}
+
+func TestEntityIngestStreamingNewSubject(t *testing.T) {
+	s3Event := events.S3Event{
+		Records: []events.S3EventRecord{
+			{
+				AWSRegion: "us-east-5",
+				S3: events.S3Entity{
+					Bucket: events.S3Bucket{Name: "blue"},
+					Object: events.S3Object{Key: "my/entity-stream-subject"},
+				},
+			},
+		},
+	}
+	var event golambda.Event
+	require.NoError(t, event.EncapSNSonSQSMessage(s3Event))
+
+	newS3, _ := mock.NewS3Mock()
+	wq := service.NewEntityService(newS3).NewWriteQueue("us-east-5", "blue", "my/entity-stream-subject")
+	// Matched value appears in first and last window with different subjects
+	subjects := []string{"orange", "", "", "", "", "", "", "blue"}
+	for i, subject := range subjects {
+		data := fmt.Sprintf("v%d.example.com", i)
+		if subject != "" {
+			data = "matched.example.com"
+		}
+		wq.Write(&retrospector.Entity{
+			Value: retrospector.Value{
+				Data: data,
+				Type: retrospector.ValueDomainName,
+			},
+			Source:     "timeless",
+			Subject:    subject,
+			RecordedAt: time.Now().Unix(),
+		})
+	}
+	require.NoError(t, wq.Close())
+
+	value := retrospector.Value{Data: "matched.example.com", Type: retrospector.ValueDomainName}
+	repo := mock.NewRepository()
+	require.NoError(t, repo.PutIOCSet([]*retrospector.IOC{{Value: value}}))
+	httpClient := &mock.HTTPClient{
+		RespCode: http.StatusOK,
+		RespBody: ioutil.NopCloser(strings.NewReader("")),
+	}
+	args := &arguments.Arguments{
+		Repository:       repo,
+		NewS3:            newS3,
+		HTTP:             httpClient,
+		SlackWebhookURL:  "https://test.example.com/slack",
+		EntityWindowSize: 4,
+	}
+	_, err := main.Handler(args, event)
+	require.NoError(t, err)
+
+	// Matched value is looked up again in later window, then new subject is alerted
+	assert.Equal(t, 2, len(httpClient.Requests))
+	detections, err := repo.GetDetections(&value)
+	require.NoError(t, err)
+	var detected []string
+	for _, detection := range detections {
+		detected = append(detected, detection.Subject)
+	}
+	assert.ElementsMatch(t, []string{"orange", "blue"}, detected)
+}
@@ -3,9 +3,10 @@ package main
 import (
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/m-mizutani/golambda"
-	"github.com/cookpad/retrospector"
 	"github.com/cookpad/retrospector/pkg/arguments"
 	"github.com/cookpad/retrospector/pkg/logging"
+	"github.com/cookpad/retrospector/pkg/tracing"
+	"github.com/cookpad/retrospector/pkg/usecase"
 )
 
 var logger = logging.Logger
@@ -17,9 +18,6 @@ func Handler(args *arguments.Arguments, event golambda.Event) (interface{}, erro
 		return nil, err
 	}
 
-	repoSvc := args.RepositoryService()
-	entitySvc := args.EntityService()
-
 	for _, event := range recvEvents {
 		var s3Event events.S3Event
 		if err := event.Bind(&s3Event); err != nil {
@@ -27,30 +25,17 @@ func Handler(args *arguments.Arguments, event golambda.Event) (interface{}, erro
 		}
 
 		for _, s3Record := range s3Event.Records {
-			logger.Info().Interface("s3record", s3Record).Msg("handle entity record")
-
-			rq := entitySvc.NewReadQueue(s3Record.AWSRegion, s3Record.S3.Bucket.Name, s3Record.S3.Object.Key)
-
-			// To avoid duplicated DynamoDB record
-			entityMap := make(map[retrospector.Value]*retrospector.Entity)
-			for {
-				entity := rq.Read()
-				if entity == nil {
-					break
-				}
-				entityMap[entity.Value] = entity
-			}
+			obj := s3Record.S3.Object
+			span := tracing.StartTrace("RecordEntityObject", tracing.NewCorrelationID(s3Record.S3.Bucket.Name, obj.Key, obj.ETag), "", map[string]string{
+				"aws.s3.bucket": s3Record.S3.Bucket.Name,
+				"aws.s3.key":    obj.Key,
+			})
 
-			if err := rq.Error(); err != nil {
-				return nil, golambda.WrapError(err).With("s3", s3Record)
-			}
-
-			var entities []*retrospector.Entity
-			for _, entity := range entityMap {
-				entities = append(entities, entity)
-			}
+			logger.Info().Interface("s3record", s3Record).Msg("handle entity record")
 
-			if err := repoSvc.PutEntities(entities); err != nil {
+			err := usecase.RecordEntityObject(args, s3Record.AWSRegion, s3Record.S3.Bucket.Name, obj.Key)
+			span.End(err)
+			if err != nil {
 				return nil, golambda.WrapError(err).With("s3", s3Record)
 			}
 		}
@@ -60,7 +45,8 @@ func Handler(args *arguments.Arguments, event golambda.Event) (interface{}, erro
 }
 
 func main() {
-	golambda.Start(func(event golambda.Event) (interface{}, error) {
-		return Handler(arguments.New(), event)
+	args := arguments.New()
+	arguments.StartLambda("entityRecord", args, func(event golambda.Event) (interface{}, error) {
+		return Handler(args, event)
 	})
 }
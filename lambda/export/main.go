@@ -0,0 +1,78 @@
+package main
+
+import (
+	"time"
+
+	"github.com/cookpad/retrospector"
+	"github.com/cookpad/retrospector/pkg/arguments"
+	"github.com/cookpad/retrospector/pkg/service"
+	"github.com/cookpad/retrospector/pkg/usecase"
+	"github.com/m-mizutani/golambda"
+)
+
+// exportEvent is event of direct invocation. Empty fields are filled by EXPORT_* environment variables, then scheduled event exports everything to daily prefix.
+type exportEvent struct {
+	Region       string   `json:"region"`
+	Bucket       string   `json:"bucket"`
+	Prefix       string   `json:"prefix"`
+	Format       string   `json:"format"`
+	Sources      []string `json:"sources"`
+	Types        []string `json:"types"`
+	Since        int64    `json:"since"`
+	Until        int64    `json:"until"`
+	MatchedOnly  bool     `json:"matched_only"`
+	SkipIOCs     bool     `json:"skip_iocs"`
+	SkipEntities bool     `json:"skip_entities"`
+}
+
+// Handler is exporeted for test
+func Handler(args *arguments.Arguments, event golambda.Event) (interface{}, error) {
+	var ev exportEvent
+	if err := event.Bind(&ev); err != nil {
+		return nil, err
+	}
+
+	opt := &usecase.ExportOptions{
+		Region: ev.Region,
+		Bucket: ev.Bucket,
+		Prefix: ev.Prefix,
+		Format: service.ExportFormat(ev.Format),
+		Filter: service.ExportFilter{
+			Sources: ev.Sources,
+			Since:   ev.Since,
+			Until:   ev.Until,
+		},
+		MatchedOnly:  ev.MatchedOnly,
+		SkipIOCs:     ev.SkipIOCs,
+		SkipEntities: ev.SkipEntities,
+	}
+	for _, t := range ev.Types {
+		opt.Filter.Types = append(opt.Filter.Types, retrospector.ValueType(t))
+	}
+
+	if opt.Bucket == "" {
+		opt.Bucket = args.ExportBucket
+	}
+	if opt.Prefix == "" {
+		opt.Prefix = args.ExportPrefix + time.Now().UTC().Format("2006/01/02/")
+	}
+	if opt.Format == "" {
+		opt.Format = service.ExportFormat(args.ExportFormat)
+	}
+	if opt.Format == "" {
+		opt.Format = service.ExportJSONL
+	}
+
+	report, err := usecase.Export(args, opt)
+	if err != nil {
+		return nil, golambda.WrapError(err).With("event", ev)
+	}
+	return report, nil
+}
+
+func main() {
+	args := arguments.New()
+	arguments.StartLambda("export", args, func(event golambda.Event) (interface{}, error) {
+		return Handler(args, event)
+	})
+}
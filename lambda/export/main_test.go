@@ -0,0 +1,100 @@
+package main_test
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"testing"
+
+	"github.com/cookpad/retrospector"
+	"github.com/cookpad/retrospector/pkg/arguments"
+	"github.com/cookpad/retrospector/pkg/mock"
+	"github.com/cookpad/retrospector/pkg/usecase"
+	"github.com/m-mizutani/golambda"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	main "github.com/cookpad/retrospector/lambda/export"
+)
+
+func readLines(t *testing.T, raw []byte) []string {
+	gz, err := gzip.NewReader(bytes.NewReader(raw))
+	require.NoError(t, err)
+
+	var lines []string
+	scanner := bufio.NewScanner(gz)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	require.NoError(t, scanner.Err())
+	return lines
+}
+
+func TestExport(t *testing.T) {
+	newS3, s3Client := mock.NewS3Mock()
+	repo := mock.NewRepository()
+
+	domain := retrospector.Value{Data: "example.com", Type: retrospector.ValueDomainName}
+	ipaddr := retrospector.Value{Data: "192.0.2.1", Type: retrospector.ValueIPAddr}
+	require.NoError(t, repo.PutIOCSet([]*retrospector.IOC{
+		{Value: domain, Source: "blue", UpdatedAt: 1600000000},
+		{Value: ipaddr, Source: "orange", UpdatedAt: 1600000000},
+	}))
+	require.NoError(t, repo.PutEntities([]*retrospector.Entity{
+		{Value: domain, Subject: "alice", Source: "proxy", RecordedAt: 1600000100},
+		{Value: domain, Subject: "bob", Source: "proxy", RecordedAt: 1600000200},
+	}))
+	require.NoError(t, repo.PutDetections([]*retrospector.Detection{
+		{Value: domain, Subject: "alice", Sources: []string{"blue"}, DetectedAt: 1600000300},
+	}))
+
+	args := &arguments.Arguments{
+		Repository:   repo,
+		NewS3:        newS3,
+		AwsRegion:    "us-east-1",
+		ExportBucket: "export-bucket",
+	}
+
+	t.Run("export with filter", func(t *testing.T) {
+		resp, err := main.Handler(args, golambda.Event{Origin: map[string]interface{}{
+			"prefix":  "audit/",
+			"sources": []string{"blue"},
+		}})
+		require.NoError(t, err)
+		report := resp.(*usecase.ExportReport)
+		assert.Equal(t, "audit/iocs.jsonl.gz", report.IOCKey)
+		assert.Equal(t, 1, report.IOCs)
+		assert.Equal(t, 0, report.Entities)
+
+		lines := readLines(t, s3Client.S3Objects["export-bucket"]["audit/iocs.jsonl.gz"])
+		require.Equal(t, 1, len(lines))
+		var ioc retrospector.IOC
+		require.NoError(t, json.Unmarshal([]byte(lines[0]), &ioc))
+		assert.Equal(t, domain, ioc.Value)
+	})
+
+	t.Run("export matched entities as CSV", func(t *testing.T) {
+		resp, err := main.Handler(args, golambda.Event{Origin: map[string]interface{}{
+			"prefix":       "matched/",
+			"format":       "csv",
+			"matched_only": true,
+			"skip_iocs":    true,
+		}})
+		require.NoError(t, err)
+		report := resp.(*usecase.ExportReport)
+		assert.Equal(t, "", report.IOCKey)
+		assert.Equal(t, 1, report.Entities)
+
+		lines := readLines(t, s3Client.S3Objects["export-bucket"]["matched/entities.csv.gz"])
+		require.Equal(t, 2, len(lines))
+		assert.Contains(t, lines[1], "alice")
+	})
+
+	t.Run("invalid format", func(t *testing.T) {
+		_, err := main.Handler(args, golambda.Event{Origin: map[string]interface{}{
+			"format": "xml",
+		}})
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/cookpad/retrospector/pkg/arguments"
+	"github.com/cookpad/retrospector/pkg/logging"
+	"github.com/cookpad/retrospector/pkg/usecase"
+	"github.com/m-mizutani/golambda"
+)
+
+var logger = logging.Logger
+
+// reportSuffix is appended to key of hunt input object to make key of report if report_key is not given
+const reportSuffix = ".report.json"
+
+// huntEvent is event of direct invocation. S3 event notification of hunt input object is also accepted.
+type huntEvent struct {
+	Region    string `json:"region"`
+	Bucket    string `json:"bucket"`
+	Key       string `json:"key"`
+	ReportKey string `json:"report_key"`
+	Alert     bool   `json:"alert"`
+
+	Records []events.S3EventRecord `json:"Records"`
+}
+
+// Handler is exporeted for test
+func Handler(args *arguments.Arguments, event golambda.Event) (interface{}, error) {
+	var ev huntEvent
+	if err := event.Bind(&ev); err != nil {
+		return nil, err
+	}
+
+	for _, record := range ev.Records {
+		key := record.S3.Object.Key
+		if strings.HasSuffix(key, reportSuffix) {
+			continue
+		}
+		logger.Info().Interface("s3record", record).Msg("handle hunt object")
+
+		if _, err := usecase.HuntObject(args, record.AWSRegion, record.S3.Bucket.Name, key, key+reportSuffix, &usecase.HuntOptions{}); err != nil {
+			return nil, golambda.WrapError(err).With("s3", record)
+		}
+	}
+
+	if ev.Bucket == "" || ev.Key == "" {
+		return nil, nil
+	}
+	if ev.Region == "" {
+		ev.Region = args.AwsRegion
+	}
+	if ev.ReportKey == "" {
+		ev.ReportKey = ev.Key + reportSuffix
+	}
+
+	report, err := usecase.HuntObject(args, ev.Region, ev.Bucket, ev.Key, ev.ReportKey, &usecase.HuntOptions{Alert: ev.Alert})
+	if err != nil {
+		return nil, golambda.WrapError(err).With("event", ev)
+	}
+	return report, nil
+}
+
+func main() {
+	args := arguments.New()
+	arguments.StartLambda("hunt", args, func(event golambda.Event) (interface{}, error) {
+		return Handler(args, event)
+	})
+}
@@ -0,0 +1,111 @@
+package main_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/cookpad/retrospector"
+	"github.com/cookpad/retrospector/pkg/arguments"
+	"github.com/cookpad/retrospector/pkg/mock"
+	"github.com/cookpad/retrospector/pkg/usecase"
+	"github.com/m-mizutani/golambda"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	main "github.com/cookpad/retrospector/lambda/hunt"
+)
+
+func putObject(t *testing.T, client *mock.S3Client, bucket, key, data string) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	_, err = client.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(buf.Bytes()),
+	})
+	require.NoError(t, err)
+}
+
+func TestHunt(t *testing.T) {
+	newS3, s3Client := mock.NewS3Mock()
+	_, err := newS3("us-east-1")
+	require.NoError(t, err)
+	putObject(t, s3Client, "hunt-bucket", "incident/iocs.txt", strings.Join([]string{
+		"# partner IOC list",
+		"example.com",
+		"ipaddr 192.0.2.1",
+		`{"type":"domain","value":"example.org","source":"partner"}`,
+	}, "\n"))
+
+	repo := mock.NewRepository()
+	require.NoError(t, repo.PutEntities([]*retrospector.Entity{
+		{
+			Value:      retrospector.Value{Data: "example.com", Type: retrospector.ValueDomainName},
+			Subject:    "blue",
+			RecordedAt: 1600000000,
+		},
+		{
+			Value:      retrospector.Value{Data: "192.0.2.1", Type: retrospector.ValueIPAddr},
+			Subject:    "orange",
+			RecordedAt: 1600000001,
+		},
+	}))
+
+	httpClient := &mock.HTTPClient{
+		RespCode: http.StatusOK,
+		RespBody: ioutil.NopCloser(strings.NewReader("")),
+	}
+	args := &arguments.Arguments{
+		Repository:      repo,
+		NewS3:           newS3,
+		HTTP:            httpClient,
+		SlackWebhookURL: "https://test.example.com/slack",
+		AwsRegion:       "us-east-1",
+	}
+
+	t.Run("report without alert", func(t *testing.T) {
+		resp, err := main.Handler(args, golambda.Event{Origin: map[string]interface{}{
+			"bucket": "hunt-bucket",
+			"key":    "incident/iocs.txt",
+		}})
+		require.NoError(t, err)
+		report := resp.(*usecase.HuntReport)
+		assert.Equal(t, 3, report.Values)
+		require.Equal(t, 2, len(report.Matches))
+		assert.Equal(t, usecase.DefaultHuntSource, report.Matches[0].IOC.Source)
+		assert.Equal(t, []string{"blue"}, report.Matches[0].Subjects)
+		assert.Equal(t, []string{"orange"}, report.Matches[1].Subjects)
+		assert.Equal(t, 0, len(httpClient.Requests))
+
+		var stored usecase.HuntReport
+		require.NoError(t, json.Unmarshal(s3Client.S3Objects["hunt-bucket"]["incident/iocs.txt.report.json"], &stored))
+		assert.Equal(t, 2, len(stored.Matches))
+
+		// IOC is not saved by hunt
+		iocSet, err := repo.BatchGetIOCSet([]*retrospector.Value{{Data: "example.com", Type: retrospector.ValueDomainName}})
+		require.NoError(t, err)
+		assert.Equal(t, 0, len(iocSet))
+	})
+
+	t.Run("alert", func(t *testing.T) {
+		_, err := main.Handler(args, golambda.Event{Origin: map[string]interface{}{
+			"bucket":     "hunt-bucket",
+			"key":        "incident/iocs.txt",
+			"report_key": "reports/1.json",
+			"alert":      true,
+		}})
+		require.NoError(t, err)
+		assert.Equal(t, 2, len(httpClient.Requests))
+		assert.NotNil(t, s3Client.S3Objects["hunt-bucket"]["reports/1.json"])
+	})
+}
@@ -4,51 +4,28 @@ import (
 	"github.com/m-mizutani/golambda"
 	"github.com/cookpad/retrospector"
 	"github.com/cookpad/retrospector/pkg/arguments"
-	"github.com/cookpad/retrospector/pkg/service"
+	"github.com/cookpad/retrospector/pkg/tracing"
+	"github.com/cookpad/retrospector/pkg/usecase"
 )
 
 //Handler is exporeted for test
 func Handler(args *arguments.Arguments, event golambda.Event) (interface{}, error) {
-	events, err := event.DecapSNSonSQSMessage()
+	messages, err := tracing.DecapSNSonSQSMessage(event)
 	if err != nil {
 		return nil, err
 	}
 
-	repo := args.RepositoryService()
-	alertSvc := args.AlertService()
-
-	for _, event := range events {
+	for _, msg := range messages {
 		var iocChunk retrospector.IOCChunk
-		if err := event.Bind(&iocChunk); err != nil {
-			return nil, golambda.WrapError(err).With("event", event)
+		if err := msg.Record.Bind(&iocChunk); err != nil {
+			return nil, golambda.WrapError(err).With("event", msg.Record)
 		}
 
-		for _, ioc := range iocChunk {
-			entities, err := repo.DetectEntities([]*retrospector.IOC{ioc})
-			if err != nil {
-				return nil, err
-			}
-
-			if len(entities) == 0 {
-				continue
-			}
-
-			alert := &service.Alert{
-				Cause:    service.AlertCauseIOC,
-				Target:   &ioc.Value,
-				Entities: entities,
-				IOCChunk: retrospector.IOCChunk{ioc},
-			}
-
-			if err := alertSvc.EmitToSlack(alert); err != nil {
-				return nil, golambda.WrapError(err).With("ioc", ioc).With("alert", alert)
-			}
-
-			for _, entity := range entities {
-				if err := repo.UpdateEntityDetected(entity); err != nil {
-					return nil, err
-				}
-			}
+		span := msg.StartTrace("Hunt", nil)
+		_, err := usecase.Hunt(args, iocChunk, &usecase.HuntOptions{Alert: true})
+		span.End(err)
+		if err != nil {
+			return nil, err
 		}
 	}
 
@@ -56,7 +33,8 @@ func Handler(args *arguments.Arguments, event golambda.Event) (interface{}, erro
 }
 
 func main() {
-	golambda.Start(func(event golambda.Event) (interface{}, error) {
-		return Handler(arguments.New(), event)
+	args := arguments.New()
+	arguments.StartLambda("iocDetect", args, func(event golambda.Event) (interface{}, error) {
+		return Handler(args, event)
 	})
 }
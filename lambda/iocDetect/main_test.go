@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/m-mizutani/golambda"
@@ -104,6 +105,132 @@ func TestIOCDetect(t *testing.T) {
 		assert.Equal(t, 1, len(httpClient.Requests))
 	})
 
+	t.Run("alert again after cooldown", func(t *testing.T) {
+		httpClient := &mock.HTTPClient{
+			RespCode: http.StatusOK,
+			RespBody: ioutil.NopCloser(strings.NewReader("")),
+		}
+
+		value := retrospector.Value{Data: "blue", Type: retrospector.ValueDomainName}
+		repo := mock.NewRepository()
+		require.NoError(t, repo.PutEntities([]*retrospector.Entity{{Value: value}}))
+		require.NoError(t, repo.PutDetections([]*retrospector.Detection{
+			{Value: value, Sources: []string{"one"}, DetectedAt: time.Now().Add(-time.Hour * 48).Unix()},
+		}))
+
+		args := &arguments.Arguments{
+			Repository:      repo,
+			HTTP:            httpClient,
+			SlackWebhookURL: "https://test.example.com/slack",
+		}
+		event := golambda.Event{Origin: sqsEvent}
+		_, err := main.Handler(args, event)
+		require.NoError(t, err)
+		require.Equal(t, 0, len(httpClient.Requests))
+
+		args.RealertCooldown = "24h"
+		_, err = main.Handler(args, event)
+		require.NoError(t, err)
+		require.Equal(t, 1, len(httpClient.Requests))
+
+		// Detection is updated by the alert
+		_, err = main.Handler(args, event)
+		require.NoError(t, err)
+		require.Equal(t, 1, len(httpClient.Requests))
+	})
+
+	t.Run("invalid re-alert policy", func(t *testing.T) {
+		repo := mock.NewRepository()
+		require.NoError(t, repo.PutEntities([]*retrospector.Entity{
+			{Value: retrospector.Value{Data: "blue", Type: retrospector.ValueDomainName}},
+		}))
+		event := golambda.Event{Origin: sqsEvent}
+
+		args := &arguments.Arguments{Repository: repo, RealertCooldown: "24hr"}
+		_, err := main.Handler(args, event)
+		assert.Error(t, err)
+
+		args = &arguments.Arguments{Repository: repo, RealertOn: "new_subjects"}
+		_, err = main.Handler(args, event)
+		assert.Error(t, err)
+	})
+
+	t.Run("revoked IOC is not alerted", func(t *testing.T) {
+		revoked := retrospector.IOCChunk{
+			{
+				Value:     retrospector.Value{Data: "blue", Type: retrospector.ValueDomainName},
+				Source:    "manual:SEC-1:orange",
+				RevokedAt: time.Now().Unix(),
+				RevokedBy: "orange",
+			},
+		}
+		rawEvent, err := json.Marshal(revoked)
+		require.NoError(t, err)
+		rawSNSEntity, err := json.Marshal(events.SNSEntity{Message: string(rawEvent)})
+		require.NoError(t, err)
+
+		httpClient := &mock.HTTPClient{
+			RespCode: http.StatusOK,
+			RespBody: ioutil.NopCloser(strings.NewReader("")),
+		}
+		repo := mock.NewRepository()
+		require.NoError(t, repo.PutEntities([]*retrospector.Entity{
+			{Value: retrospector.Value{Data: "blue", Type: retrospector.ValueDomainName}},
+		}))
+
+		args := &arguments.Arguments{
+			Repository:      repo,
+			HTTP:            httpClient,
+			SlackWebhookURL: "https://test.example.com/slack",
+		}
+		event := golambda.Event{Origin: events.SQSEvent{
+			Records: []events.SQSMessage{{Body: string(rawSNSEntity)}},
+		}}
+		_, err = main.Handler(args, event)
+		require.NoError(t, err)
+		assert.Equal(t, 0, len(httpClient.Requests))
+	})
+
+	t.Run("suppress alert of false positive", func(t *testing.T) {
+		httpClient := &mock.HTTPClient{
+			RespCode: http.StatusOK,
+			RespBody: ioutil.NopCloser(strings.NewReader("")),
+		}
+
+		repo := mock.NewRepository()
+		require.NoError(t, repo.PutEntities([]*retrospector.Entity{
+			{
+				Value: retrospector.Value{
+					Data: "blue",
+					Type: retrospector.ValueDomainName,
+				},
+			},
+		}))
+		require.NoError(t, repo.PutAlertState(&retrospector.AlertState{
+			Value:  retrospector.Value{Data: "blue", Type: retrospector.ValueDomainName},
+			Status: retrospector.AlertFalsePositive,
+		}))
+
+		args := &arguments.Arguments{
+			Repository:      repo,
+			HTTP:            httpClient,
+			SlackWebhookURL: "https://test.example.com/slack",
+		}
+		event := golambda.Event{Origin: sqsEvent}
+		_, err := main.Handler(args, event)
+		require.NoError(t, err)
+		require.Equal(t, 0, len(httpClient.Requests))
+
+		state, err := repo.GetAlertState(&retrospector.Value{Data: "blue", Type: retrospector.ValueDomainName})
+		require.NoError(t, err)
+		assert.Equal(t, retrospector.AlertFalsePositive, state.Status)
+		assert.Equal(t, int64(1), state.DetectionCount)
+
+		detections, err := repo.GetDetections(&retrospector.Value{Data: "blue", Type: retrospector.ValueDomainName})
+		require.NoError(t, err)
+		assert.Equal(t, 0, len(detections))
+	})
+
 	t.Run("not detect any entity by data", func(t *testing.T) {
 		httpClient := &mock.HTTPClient{
 			RespCode: http.StatusOK,
@@ -159,4 +286,58 @@ func TestIOCDetect(t *testing.T) {
 		require.Equal(t, 0, len(httpClient.Requests))
 	})
 
+	t.Run("not detect entity seen long before IOC publication", func(t *testing.T) {
+		now := time.Now()
+		iocSet := retrospector.IOCChunk{
+			{
+				Value:     retrospector.Value{Data: "blue", Type: retrospector.ValueDomainName},
+				Source:    "one",
+				UpdatedAt: now.Unix(),
+				ValidFrom: now.Add(-time.Hour * 24).Unix(),
+			},
+		}
+		rawEvent, err := json.Marshal(iocSet)
+		require.NoError(t, err)
+		rawSNSEntity, err := json.Marshal(events.SNSEntity{Message: string(rawEvent)})
+		require.NoError(t, err)
+
+		httpClient := &mock.HTTPClient{
+			RespCode: http.StatusOK,
+			RespBody: ioutil.NopCloser(strings.NewReader("")),
+		}
+
+		repo := mock.NewRepository()
+		require.NoError(t, repo.PutEntities([]*retrospector.Entity{
+			{
+				Value:      retrospector.Value{Data: "blue", Type: retrospector.ValueDomainName},
+				Subject:    "old",
+				RecordedAt: now.Add(-time.Hour * 24 * 25).Unix(),
+			},
+		}))
+
+		args := &arguments.Arguments{
+			Repository:        repo,
+			HTTP:              httpClient,
+			SlackWebhookURL:   "https://test.example.com/slack",
+			IOCLookbackMargin: "72h",
+		}
+		event := golambda.Event{Origin: events.SQSEvent{
+			Records: []events.SQSMessage{{Body: string(rawSNSEntity)}},
+		}}
+		_, err = main.Handler(args, event)
+		require.NoError(t, err)
+		assert.Equal(t, 0, len(httpClient.Requests))
+
+		// Entity within look-back margin is detected
+		require.NoError(t, repo.PutEntities([]*retrospector.Entity{
+			{
+				Value:      retrospector.Value{Data: "blue", Type: retrospector.ValueDomainName},
+				Subject:    "recent",
+				RecordedAt: now.Add(-time.Hour * 48).Unix(),
+			},
+		}))
+		_, err = main.Handler(args, event)
+		require.NoError(t, err)
+		assert.Equal(t, 1, len(httpClient.Requests))
+	})
 }
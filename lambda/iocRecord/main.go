@@ -4,24 +4,38 @@ import (
 	"github.com/m-mizutani/golambda"
 	"github.com/cookpad/retrospector"
 	"github.com/cookpad/retrospector/pkg/arguments"
+	"github.com/cookpad/retrospector/pkg/metrics"
+	"github.com/cookpad/retrospector/pkg/tracing"
 )
 
 //Handler is exporeted for test
 func Handler(args *arguments.Arguments, event golambda.Event) (interface{}, error) {
-	events, err := event.DecapSNSonSQSMessage()
+	messages, err := tracing.DecapSNSonSQSMessage(event)
 	if err != nil {
 		return nil, err
 	}
 
 	repo := args.RepositoryService()
 
-	for _, event := range events {
+	var recorded []*retrospector.IOC
+	for _, msg := range messages {
 		var iocChunk retrospector.IOCChunk
-		if err := event.Bind(&iocChunk); err != nil {
+		if err := msg.Record.Bind(&iocChunk); err != nil {
 			return nil, err
 		}
 
-		if err := repo.PutIOCSet(iocChunk); err != nil {
+		span := msg.StartTrace("PutIOCSet", nil)
+		err := repo.PutIOCSet(iocChunk)
+		span.End(err)
+		if err != nil {
+			return nil, err
+		}
+		recorded = append(recorded, iocChunk...)
+	}
+	metrics.Count("IOCsRecorded", len(recorded), nil)
+
+	if filterSvc := args.IOCFilterService(); filterSvc != nil {
+		if err := filterSvc.Update(repo, recorded); err != nil {
 			return nil, err
 		}
 	}
@@ -31,7 +45,7 @@ func Handler(args *arguments.Arguments, event golambda.Event) (interface{}, erro
 
 func main() {
 	args := arguments.New()
-	golambda.Start(func(event golambda.Event) (interface{}, error) {
+	arguments.StartLambda("iocRecord", args, func(event golambda.Event) (interface{}, error) {
 		return Handler(args, event)
 	})
 }
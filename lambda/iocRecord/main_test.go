@@ -9,6 +9,7 @@ import (
 	"github.com/cookpad/retrospector"
 	"github.com/cookpad/retrospector/pkg/arguments"
 	"github.com/cookpad/retrospector/pkg/mock"
+	"github.com/cookpad/retrospector/pkg/service"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -149,4 +150,47 @@ func TestIOCRecord(t *testing.T) {
 		assert.Contains(t, iocSet, resp[2])
 	})
 
+
+	t.Run("update IOC filter", func(t *testing.T) {
+		rawEvent, err := json.Marshal(iocSet)
+		require.NoError(t, err)
+		rawSNSEntity, err := json.Marshal(events.SNSEntity{
+			Message: string(rawEvent),
+		})
+		require.NoError(t, err)
+		event := golambda.Event{
+			Origin: events.SQSEvent{
+				Records: []events.SQSMessage{
+					{Body: string(rawSNSEntity)},
+				},
+			},
+		}
+
+		newS3, _ := mock.NewS3Mock()
+		// Create bucket by putting an empty entity object
+		require.NoError(t, service.NewEntityService(newS3).NewWriteQueue("us-east-5", "blue", "ioc-filter/dummy").Close())
+
+		repo := mock.NewRepository()
+		args := &arguments.Arguments{
+			Repository:      repo,
+			NewS3:           newS3,
+			AwsRegion:       "us-east-5",
+			IOCFilterBucket: "blue",
+			IOCFilterKey:    "ioc-filter/iocRecord",
+		}
+		_, err = main.Handler(args, event)
+		require.NoError(t, err)
+
+		filterSvc := args.IOCFilterService()
+		filter, err := filterSvc.Load()
+		require.NoError(t, err)
+		require.NotNil(t, filter)
+		for _, ioc := range iocSet {
+			assert.True(t, filter.Test(service.IOCFilterKey(&ioc.Value)))
+		}
+		assert.False(t, filter.Test(service.IOCFilterKey(&retrospector.Value{
+			Data: "blue",
+			Type: retrospector.ValueIPAddr,
+		})))
+	})
 }
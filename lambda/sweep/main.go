@@ -0,0 +1,21 @@
+package main
+
+import (
+	"time"
+
+	"github.com/cookpad/retrospector/pkg/arguments"
+	"github.com/cookpad/retrospector/pkg/usecase"
+	"github.com/m-mizutani/golambda"
+)
+
+// Handler is exporeted for test
+func Handler(args *arguments.Arguments, event golambda.Event) (interface{}, error) {
+	return usecase.Sweep(args, time.Now())
+}
+
+func main() {
+	args := arguments.New()
+	arguments.StartLambda("sweep", args, func(event golambda.Event) (interface{}, error) {
+		return Handler(args, event)
+	})
+}
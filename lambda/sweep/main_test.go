@@ -0,0 +1,65 @@
+package main_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cookpad/retrospector"
+	"github.com/cookpad/retrospector/pkg/arguments"
+	"github.com/cookpad/retrospector/pkg/mock"
+	"github.com/cookpad/retrospector/pkg/usecase"
+	"github.com/m-mizutani/golambda"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	main "github.com/cookpad/retrospector/lambda/sweep"
+)
+
+func TestSweep(t *testing.T) {
+	repo := mock.NewRepository()
+	now := time.Now()
+	domain := retrospector.Value{Data: "example.com", Type: retrospector.ValueDomainName}
+	ipaddr := retrospector.Value{Data: "192.0.2.1", Type: retrospector.ValueIPAddr}
+
+	// IOC and entity are recorded concurrently and neither detector has matched them
+	require.NoError(t, repo.PutIOCSet([]*retrospector.IOC{
+		{Value: domain, Source: "blue", UpdatedAt: now.Unix()},
+	}))
+	require.NoError(t, repo.PutEntities([]*retrospector.Entity{
+		{Value: domain, Subject: "alice", Source: "proxy", RecordedAt: now.Unix()},
+		{Value: ipaddr, Subject: "bob", Source: "flowlogs", RecordedAt: now.Unix()},
+	}))
+
+	httpClient := &mock.HTTPClient{
+		RespCode: http.StatusOK,
+		RespBody: ioutil.NopCloser(strings.NewReader("")),
+	}
+	args := &arguments.Arguments{
+		Repository:         repo,
+		HTTP:               httpClient,
+		SlackWebhookURL:    "https://test.example.com/slack",
+		SweepOverlapWindow: "1h",
+	}
+
+	resp, err := main.Handler(args, golambda.Event{})
+	require.NoError(t, err)
+	report := resp.(*usecase.SweepReport)
+	assert.Equal(t, 1, report.IOCValues)
+	assert.Equal(t, 2, report.EntityValues)
+	assert.Equal(t, 1, report.IOCMatched)
+	require.Equal(t, 1, len(httpClient.Requests))
+
+	detections, err := repo.GetDetections(&domain)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(detections))
+	assert.Equal(t, "alice", detections[0].Subject)
+
+	t.Run("swept match is not alerted again", func(t *testing.T) {
+		_, err := main.Handler(args, golambda.Event{})
+		require.NoError(t, err)
+		assert.Equal(t, 1, len(httpClient.Requests))
+	})
+}
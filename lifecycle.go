@@ -0,0 +1,62 @@
+package retrospector
+
+// AlertStatus is state of alert lifecycle
+type AlertStatus string
+
+const (
+	AlertNew           AlertStatus = "new"
+	AlertTriaged       AlertStatus = "triaged"
+	AlertEscalated     AlertStatus = "escalated"
+	AlertResolved      AlertStatus = "resolved"
+	AlertFalsePositive AlertStatus = "false_positive"
+)
+
+// alertTransitions is allowed transitions of alert status. Resolved alert is re-opened to new when it is detected again.
+var alertTransitions = map[AlertStatus][]AlertStatus{
+	AlertNew:           {AlertTriaged, AlertEscalated, AlertResolved, AlertFalsePositive},
+	AlertTriaged:       {AlertEscalated, AlertResolved, AlertFalsePositive},
+	AlertEscalated:     {AlertTriaged, AlertResolved, AlertFalsePositive},
+	AlertResolved:      {AlertNew, AlertTriaged},
+	AlertFalsePositive: {AlertTriaged},
+}
+
+// IsValid returns true if the status is defined
+func (x AlertStatus) IsValid() bool {
+	_, ok := alertTransitions[x]
+	return ok
+}
+
+// IsOpen returns true if the alert is not resolved yet
+func (x AlertStatus) IsOpen() bool {
+	return x == AlertNew || x == AlertTriaged || x == AlertEscalated
+}
+
+// CanTransitTo returns true if transition from x to next is allowed
+func (x AlertStatus) CanTransitTo(next AlertStatus) bool {
+	for _, s := range alertTransitions[x] {
+		if s == next {
+			return true
+		}
+	}
+	return false
+}
+
+// AlertState is current lifecycle state of alert for a value. One alert exists per value and it is re-opened on re-detection.
+type AlertState struct {
+	Value
+	Status         AlertStatus `json:"status" dynamo:"status"`
+	CreatedAt      int64       `json:"created_at" dynamo:"created_at"`
+	UpdatedAt      int64       `json:"updated_at" dynamo:"updated_at"`
+	LastDetectedAt int64       `json:"last_detected_at" dynamo:"last_detected_at"`
+	DetectionCount int64       `json:"detection_count" dynamo:"detection_count"`
+}
+
+// AlertTransition is a record of alert status change
+type AlertTransition struct {
+	Value
+	From  AlertStatus `json:"from" dynamo:"from"`
+	To    AlertStatus `json:"to" dynamo:"to"`
+	Actor string      `json:"actor" dynamo:"actor"`
+	Note  string      `json:"note" dynamo:"note"`
+	At    int64       `json:"at" dynamo:"at"`
+}
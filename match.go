@@ -0,0 +1,53 @@
+package retrospector
+
+import "time"
+
+// TemporalRelation is time relationship between entity and IOC publication
+type TemporalRelation string
+
+const (
+	// RelationUnknown means publication time of IOC is unknown
+	RelationUnknown TemporalRelation = "unknown"
+	// RelationBeforePublication means the entity was seen only before the IOC was published
+	RelationBeforePublication TemporalRelation = "before_publication"
+	// RelationAfterPublication means the entity was seen only after the IOC was published
+	RelationAfterPublication TemporalRelation = "after_publication"
+	// RelationAcrossPublication means the entity was seen both before and after the IOC was published
+	RelationAcrossPublication TemporalRelation = "across_publication"
+)
+
+// RelationOf returns time relationship between the entity and the IOC
+func RelationOf(entity *Entity, ioc *IOC) TemporalRelation {
+	published := ioc.PublishedAt()
+	if published == 0 {
+		return RelationUnknown
+	}
+
+	first, last, _ := entity.Seen()
+	switch {
+	case last < published:
+		return RelationBeforePublication
+	case published <= first:
+		return RelationAfterPublication
+	default:
+		return RelationAcrossPublication
+	}
+}
+
+// MatchTime returns true if the entity was seen while the IOC was valid. Entities seen within lookback before publication of the IOC also match because malicious infrastructure is usually active before it is reported. IOC without validity matches any entity.
+func MatchTime(entity *Entity, ioc *IOC, lookback time.Duration) bool {
+	first, last, _ := entity.Seen()
+	if last == 0 { // Time of the entity is unknown
+		return true
+	}
+
+	if published := ioc.PublishedAt(); published > 0 {
+		if last < published-int64(lookback/time.Second) {
+			return false
+		}
+	}
+	if ioc.ValidUntil > 0 && ioc.ValidUntil < first {
+		return false
+	}
+	return true
+}
@@ -2,6 +2,8 @@ package adaptor
 
 import (
 	"fmt"
+	"hash/fnv"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -15,15 +17,45 @@ import (
 type Repository interface {
 	PutEntities(entities []*retrospector.Entity) error
 	GetEntities(iocSet []*retrospector.IOC) ([]*retrospector.Entity, error)
-	UpdateEntityDetected(entity *retrospector.Entity) error
 	PutIOCSet(iocSet []*retrospector.IOC) error
 	GetIOCSet(entities []*retrospector.Entity) ([]*retrospector.IOC, error)
-	UpdateIOCDetected(ioc *retrospector.IOC) error
+	// PutIOCIndex writes index items that BatchGetIOCSet looks up. PutIOCSet writes them, then it is required only to migrate IOC set stored without index.
+	PutIOCIndex(iocSet []*retrospector.IOC) error
+
+	// Batch lookup methods to handle a large number of values at once
+	BatchGetEntities(values []*retrospector.Value) ([]*retrospector.Entity, error)
+	BatchGetIOCSet(values []*retrospector.Value) ([]*retrospector.IOC, error)
+
+	// ScanIOCSet calls callback for each IOC in repository. It stops scan if callback returns error.
+	ScanIOCSet(callback func(ioc *retrospector.IOC) error) error
+	// ScanEntities calls callback for each aggregated entity in repository. It stops scan if callback returns error.
+	ScanEntities(callback func(entity *retrospector.Entity) error) error
+
+	// Values of IOC set and entities stored after since (unix seconds). They are kept for a day to reconcile detection
+	GetRecentIOCValues(since int64) ([]*retrospector.Value, error)
+	GetRecentEntityValues(since int64) ([]*retrospector.Value, error)
+
+	// Detection history of values per subject to decide re-alert
+	GetDetections(value *retrospector.Value) ([]*retrospector.Detection, error)
+	PutDetections(detections []*retrospector.Detection) error
+
+	// Cache of reputation service results
+	PutReputation(rep *retrospector.Reputation) error
+	GetReputation(value *retrospector.Value, source string) (*retrospector.Reputation, error)
+
+	// Alert lifecycle
+	GetAlertState(value *retrospector.Value) (*retrospector.AlertState, error)
+	PutAlertState(state *retrospector.AlertState) error
+	PutAlertTransition(transition *retrospector.AlertTransition) error
+	GetAlertTransitions(value *retrospector.Value) ([]*retrospector.AlertTransition, error)
+	ScanAlertStates(callback func(state *retrospector.AlertState) error) error
+	// QueryAlertStates returns up to limit alert states of the status (all statuses if empty) in descending order of updated_at. Pass returned cursor to get next page. Cursor is empty at the last page.
+	QueryAlertStates(status retrospector.AlertStatus, limit int, cursor string) ([]*retrospector.AlertState, string, error)
 }
 
 type RepositoryFactory func(region, tableName string) (Repository, error)
 
-func NewDynamoRepository(region, tableName string) (Repository, error) {
+func NewDynamoRepository(region, tableName string) (*DynamoRepository, error) {
 	ssn, err := session.NewSession(&aws.Config{
 		Region: aws.String(region),
 	})
@@ -32,19 +64,45 @@ func NewDynamoRepository(region, tableName string) (Repository, error) {
 	}
 
 	return &DynamoRepository{
-		table: dynamo.New(ssn).Table(tableName),
+		table:            dynamo.New(ssn).Table(tableName),
+		queryConcurrency: defaultQueryConcurrency,
 	}, nil
 }
 
 type DynamoRepository struct {
-	table dynamo.Table
+	table            dynamo.Table
+	queryConcurrency int
+	// recordRecent enables recent items of stored values that are used by reconciliation sweeper
+	recordRecent bool
 }
 
+// WithRecentValues enables recording values of stored IOC set and entities by stored time for GetRecentIOCValues and GetRecentEntityValues. It adds writes to every PutIOCSet and PutEntities, then enable it only if reconciliation sweeper is deployed.
+func (x *DynamoRepository) WithRecentValues() *DynamoRepository {
+	x.recordRecent = true
+	return x
+}
+
+// RecentValueTimeToLive is period to keep stored time of values for GetRecentIOCValues and GetRecentEntityValues. Values stored before it can not be found.
+const RecentValueTimeToLive = time.Hour * 24
+
 const (
 	dynamoHashKey    = "pk"
 	dynamoRangeKey   = "sk"
 	entityTimeToLive = time.Hour * 24 * 30
 	iocTimeToLive    = time.Hour * 24 * 30
+	// reputationTimeToLive is max period to keep reputation. Freshness of cached reputation is checked by caller.
+	reputationTimeToLive = time.Hour * 24 * 7
+
+	// defaultQueryConcurrency is number of workers that issue Query in parallel for batch lookup
+	defaultQueryConcurrency = 16
+	// Recent items index values of IOC set and entities by stored time to find them without scan. Items of a time bucket are sharded by value to distribute writes over partitions.
+	recentBucketSize = time.Minute * 10
+	recentShards     = 16
+	recentKindIOC    = "ioc"
+	recentKindEntity = "entity"
+
+	// iocIndexSKey is sort key of IOC index item. The index item exists only to check existence of IOC for a value by BatchGetItem because sort key of IOC item (source) is unknown at lookup.
+	iocIndexSKey = "-"
 )
 
 type dynamoItem struct {
@@ -66,35 +124,125 @@ type iocItem struct {
 	retrospector.IOC
 }
 
+type detectionItem struct {
+	dynamoItem
+	retrospector.Detection
+}
+
+type recentItem struct {
+	dynamoItem
+	retrospector.Value
+	StoredAt int64 `dynamo:"stored_at"`
+}
+
+type reputationItem struct {
+	dynamoItem
+	retrospector.Reputation
+}
+
 func makeEntityPKey(value *retrospector.Value) string {
 	return fmt.Sprintf("entity/%s/%s", value.Type, value.Data)
 }
 
+// makeEntitySKey returns sort key of entity. Entities of same subject and source are aggregated into one item.
 func makeEntitySKey(entity *retrospector.Entity) string {
-	sk := entity.Subject
-	if sk == "" {
-		sk = time.Unix(entity.RecordedAt, 0).Format("20060102_150405")
+	return entity.Subject + "|" + entity.Source
+}
+
+// toEntities returns entities of items of one value. Items written by older versions are keyed by subject only, then they are merged with the item of same subject and source not to count the entity twice until they expire.
+func toEntities(items []*entityItem) []*retrospector.Entity {
+	entities := make([]*retrospector.Entity, len(items))
+	legacy := false
+	for i, item := range items {
+		entities[i] = &item.Entity
+		if item.SK != makeEntitySKey(&item.Entity) {
+			legacy = true
+		}
+	}
+	if legacy {
+		return retrospector.AggregateEntities(entities)
 	}
-	return sk
+	return entities
 }
 
+// PutEntities aggregates entities and updates first_seen, last_seen and count of entity items. Items are updated in parallel because UpdateItem can not be batched.
 func (x *DynamoRepository) PutEntities(entities []*retrospector.Entity) error {
-	var items []interface{}
-	for _, entity := range entities {
-		items = append(items, &entityItem{
-			dynamoItem: dynamoItem{
-				PK:        makeEntityPKey(&entity.Value),
-				SK:        makeEntitySKey(entity),
-				ExpiresAt: time.Unix(entity.RecordedAt, 0).Add(entityTimeToLive).Unix(),
-			},
-			Entity: *entity,
-		})
+	aggregated := retrospector.AggregateEntities(entities)
+	if err := x.runConcurrently(len(aggregated), func(i int) error {
+		return x.putEntity(aggregated[i])
+	}); err != nil {
+		return err
 	}
 
-	if n, err := x.table.Batch().Write().Put(items...).Run(); err != nil {
-		return golambda.WrapError(err, "PutEntities").With("items", items)
-	} else if n != len(items) {
-		return golambda.NewError("A number of wrote items is mismatched").With("n", n).With("items", items)
+	if !x.recordRecent {
+		return nil
+	}
+
+	var values []*retrospector.Value
+	for _, entity := range aggregated {
+		values = append(values, &entity.Value)
+	}
+	items := makeRecentItems(recentKindEntity, values, time.Now())
+	if len(items) == 0 {
+		return nil
+	}
+	if _, err := x.table.Batch().Write().Put(items...).Run(); err != nil {
+		return golambda.WrapError(err, "Failed to put recent entity values").With("count", len(items))
+	}
+	return nil
+}
+
+func (x *DynamoRepository) putEntity(entity *retrospector.Entity) error {
+	pk := makeEntityPKey(&entity.Value)
+	sk := makeEntitySKey(entity)
+	first, last, count := entity.Seen()
+	expiresAt := time.Unix(last, 0).Add(entityTimeToLive).Unix()
+
+	// Create the item if not exists and increment count. first_seen and last_seen are fixed up below because update expression has no min/max function.
+	q := x.table.Update(dynamoHashKey, pk).
+		Range(dynamoRangeKey, sk).
+		Set("value", entity.Data).
+		Set("type", entity.Type).
+		Set("subject", entity.Subject).
+		Set("source", entity.Source).
+		SetIfNotExists("first_seen", first).
+		SetIfNotExists("last_seen", last).
+		SetIfNotExists("recorded_at", last).
+		SetIfNotExists("expires_at", expiresAt).
+		Add("count", count)
+	if entity.Description != "" {
+		q = q.SetIfNotExists("description", entity.Description)
+	}
+
+	var updated entityItem
+	if err := q.Value(&updated); err != nil {
+		return golambda.WrapError(err, "Failed to update entity").With("entity", entity).With("pk", pk).With("sk", sk)
+	}
+
+	if first < updated.FirstSeen {
+		err := x.table.Update(dynamoHashKey, pk).
+			Range(dynamoRangeKey, sk).
+			Set("first_seen", first).
+			If("$ > ?", "first_seen", first).
+			Run()
+		if err != nil && !dynamo.IsCondCheckFailed(err) {
+			return golambda.WrapError(err, "Failed to update first_seen of entity").With("entity", entity)
+		}
+	}
+
+	if updated.LastSeen < last {
+		q := x.table.Update(dynamoHashKey, pk).
+			Range(dynamoRangeKey, sk).
+			Set("last_seen", last).
+			Set("recorded_at", last).
+			Set("expires_at", expiresAt).
+			If("$ < ?", "last_seen", last)
+		if entity.Description != "" {
+			q = q.Set("description", entity.Description)
+		}
+		if err := q.Run(); err != nil && !dynamo.IsCondCheckFailed(err) {
+			return golambda.WrapError(err, "Failed to update last_seen of entity").With("entity", entity)
+		}
 	}
 
 	return nil
@@ -110,30 +258,12 @@ func (x *DynamoRepository) GetEntities(iocSet []*retrospector.IOC) ([]*retrospec
 			return nil, golambda.WrapError(err, "Batch get entities").With("pk", pk).With("ioc", ioc)
 		}
 
-		for _, item := range entityItems {
-			entities = append(entities, &item.Entity)
-		}
+		entities = append(entities, toEntities(entityItems)...)
 	}
 
 	return entities, nil
 }
 
-func (x *DynamoRepository) UpdateEntityDetected(entity *retrospector.Entity) error {
-	pk := makeEntityPKey(&entity.Value)
-	sk := makeEntitySKey(entity)
-
-	q := x.table.Update(dynamoHashKey, pk).
-		Range(dynamoRangeKey, sk).
-		Set("detected", true)
-
-	if err := q.Run(); err != nil {
-		return golambda.WrapError(err, "Failed to update entity to detected").
-			With("entity", entity).With("pk", pk).With("sk", sk)
-	}
-
-	return nil
-}
-
 func makeIOCPKey(value *retrospector.Value) string {
 	return fmt.Sprintf("ioc/%s/%s", value.Type, value.Data)
 }
@@ -142,20 +272,40 @@ func makeIOCSKey(ioc *retrospector.IOC) string {
 	return ioc.Source
 }
 
+func makeIOCIndexPKey(value *retrospector.Value) string {
+	return fmt.Sprintf("iocidx/%s/%s", value.Type, value.Data)
+}
+
+func iocExpiresAt(ioc *retrospector.IOC) int64 {
+	return time.Unix(ioc.UpdatedAt, 0).Add(iocTimeToLive).Unix()
+}
+
+// PutIOCSet writes index items before IOC items. An index item without IOC item is harmless, but IOC item without index item can not be found by BatchGetIOCSet.
 func (x *DynamoRepository) PutIOCSet(iocSet []*retrospector.IOC) error {
+	if err := x.PutIOCIndex(iocSet); err != nil {
+		return err
+	}
+
 	var items []interface{}
 	for _, ioc := range iocSet {
-		ts := time.Unix(ioc.UpdatedAt, 0)
 		items = append(items, &iocItem{
 			dynamoItem: dynamoItem{
 				PK:        makeIOCPKey(&ioc.Value),
 				SK:        makeIOCSKey(ioc),
-				ExpiresAt: ts.Add(iocTimeToLive).Unix(),
+				ExpiresAt: iocExpiresAt(ioc),
 			},
 			IOC: *ioc,
 		})
 	}
 
+	if x.recordRecent {
+		var values []*retrospector.Value
+		for _, ioc := range iocSet {
+			values = append(values, &ioc.Value)
+		}
+		items = append(items, makeRecentItems(recentKindIOC, values, time.Now())...)
+	}
+
 	if n, err := x.table.Batch().Write().Put(items...).Run(); err != nil {
 		return golambda.WrapError(err, "PutIOCSet").With("items", items)
 	} else if n != len(items) {
@@ -165,6 +315,34 @@ func (x *DynamoRepository) PutIOCSet(iocSet []*retrospector.IOC) error {
 	return nil
 }
 
+// PutIOCIndex updates index items of values in IOC set. expires_at of index item is only extended, then the index item outlives all IOC items of the value even if another source publishes the value with shorter validity.
+func (x *DynamoRepository) PutIOCIndex(iocSet []*retrospector.IOC) error {
+	expiresMap := make(map[string]int64)
+	for _, ioc := range iocSet {
+		pk := makeIOCIndexPKey(&ioc.Value)
+		if expiresAt := iocExpiresAt(ioc); expiresMap[pk] < expiresAt {
+			expiresMap[pk] = expiresAt
+		}
+	}
+	var pkList []string
+	for pk := range expiresMap {
+		pkList = append(pkList, pk)
+	}
+
+	return x.runConcurrently(len(pkList), func(i int) error {
+		pk, expiresAt := pkList[i], expiresMap[pkList[i]]
+		err := x.table.Update(dynamoHashKey, pk).
+			Range(dynamoRangeKey, iocIndexSKey).
+			Set("expires_at", expiresAt).
+			If("attribute_not_exists($) OR $ < ?", "expires_at", "expires_at", expiresAt).
+			Run()
+		if err != nil && !dynamo.IsCondCheckFailed(err) {
+			return golambda.WrapError(err, "Failed to update IOC index").With("pk", pk)
+		}
+		return nil
+	})
+}
+
 func (x *DynamoRepository) GetIOCSet(entities []*retrospector.Entity) ([]*retrospector.IOC, error) {
 
 	var iocSet []*retrospector.IOC
@@ -184,18 +362,534 @@ func (x *DynamoRepository) GetIOCSet(entities []*retrospector.Entity) ([]*retros
 	return iocSet, nil
 }
 
-func (x *DynamoRepository) UpdateIOCDetected(ioc *retrospector.IOC) error {
-	pk := makeIOCPKey(&ioc.Value)
-	sk := makeIOCSKey(ioc)
+// runConcurrently calls task(0) ... task(n-1) with up to queryConcurrency workers and returns the first error
+func (x *DynamoRepository) runConcurrently(n int, task func(i int) error) error {
+	concurrency := x.queryConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultQueryConcurrency
+	}
 
-	q := x.table.Update(dynamoHashKey, pk).
-		Range(dynamoRangeKey, sk).
-		Set("detected", true)
+	idxCh := make(chan int)
+	errCh := make(chan error, concurrency)
+	var wg sync.WaitGroup
+
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range idxCh {
+				if err := task(i); err != nil {
+					errCh <- err
+					return
+				}
+			}
+		}()
+	}
+
+	var err error
+feed:
+	for i := 0; i < n; i++ {
+		select {
+		case idxCh <- i:
+		case err = <-errCh:
+			break feed
+		}
+	}
+	close(idxCh)
+	wg.Wait()
+	close(errCh)
+
+	if err != nil {
+		return err
+	}
+	return <-errCh
+}
+
+// dynamoBatchGetLimit is max number of keys in one BatchGetItem request
+const dynamoBatchGetLimit = 100
+
+func (x *DynamoRepository) BatchGetEntities(values []*retrospector.Value) ([]*retrospector.Entity, error) {
+	var entities []*retrospector.Entity
+	var mutex sync.Mutex
+	err := x.runConcurrently(len(values), func(i int) error {
+		pk := makeEntityPKey(values[i])
+		var entityItems []*entityItem
+		if err := x.table.Get(dynamoHashKey, pk).All(&entityItems); err != nil {
+			return golambda.WrapError(err, "Query entities").With("pk", pk)
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		entities = append(entities, toEntities(entityItems)...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
-	if err := q.Run(); err != nil {
-		return golambda.WrapError(err, "Failed to update IOC to detected").
-			With("ioc", ioc).With("pk", pk).With("sk", sk)
+	return entities, nil
+}
+
+func (x *DynamoRepository) BatchGetIOCSet(values []*retrospector.Value) ([]*retrospector.IOC, error) {
+	// Check existence of IOC by BatchGetItem at first because most values do not match any IOC.
+	// Then only values that have IOC are queried.
+	keyMap := make(map[string]*retrospector.Value)
+	var keys []dynamo.Keyed
+	for _, value := range values {
+		pk := makeIOCIndexPKey(value)
+		if _, ok := keyMap[pk]; ok {
+			continue
+		}
+		keyMap[pk] = value
+		keys = append(keys, dynamo.Keys{pk, iocIndexSKey})
+	}
+
+	var matched []*retrospector.Value
+	var mutex sync.Mutex
+	chunks := (len(keys) + dynamoBatchGetLimit - 1) / dynamoBatchGetLimit
+	err := x.runConcurrently(chunks, func(i int) error {
+		ep := (i + 1) * dynamoBatchGetLimit
+		if len(keys) < ep {
+			ep = len(keys)
+		}
+		target := keys[i*dynamoBatchGetLimit : ep]
+
+		var indexItems []*dynamoItem
+		if err := x.table.Batch(dynamoHashKey, dynamoRangeKey).Get(target...).All(&indexItems); err != nil {
+			if err == dynamo.ErrNotFound {
+				return nil
+			}
+			return golambda.WrapError(err, "BatchGetItem IOC index").With("keys", target)
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		for _, idx := range indexItems {
+			if value, ok := keyMap[idx.PK]; ok {
+				matched = append(matched, value)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var iocSet []*retrospector.IOC
+	err = x.runConcurrently(len(matched), func(i int) error {
+		pk := makeIOCPKey(matched[i])
+		var iocItems []*iocItem
+		if err := x.table.Get(dynamoHashKey, pk).All(&iocItems); err != nil {
+			return golambda.WrapError(err, "Query IOC set").With("pk", pk)
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		for _, item := range iocItems {
+			iocSet = append(iocSet, &item.IOC)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return iocSet, nil
+}
+
+func (x *DynamoRepository) ScanIOCSet(callback func(ioc *retrospector.IOC) error) error {
+	itr := x.table.Scan().Filter("begins_with($, ?)", dynamoHashKey, "ioc/").Iter()
+
+	var item iocItem
+	for itr.Next(&item) {
+		ioc := item.IOC
+		if err := callback(&ioc); err != nil {
+			return err
+		}
+		item = iocItem{}
+	}
+	if err := itr.Err(); err != nil {
+		return golambda.WrapError(err, "Failed to scan IOC set")
 	}
 
 	return nil
 }
+
+func (x *DynamoRepository) ScanEntities(callback func(entity *retrospector.Entity) error) error {
+	itr := x.table.Scan().Filter("begins_with($, ?)", dynamoHashKey, "entity/").Iter()
+
+	// Items of same value are scanned in a row. They are buffered to merge items written by older versions
+	var items []*entityItem
+	flush := func() error {
+		for _, entity := range toEntities(items) {
+			if err := callback(entity); err != nil {
+				return err
+			}
+		}
+		items = nil
+		return nil
+	}
+
+	for {
+		item := &entityItem{}
+		if !itr.Next(item) {
+			break
+		}
+		if len(items) > 0 && items[0].PK != item.PK {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		items = append(items, item)
+	}
+	if err := itr.Err(); err != nil {
+		return golambda.WrapError(err, "Failed to scan entities")
+	}
+
+	return flush()
+}
+
+func makeRecentPKey(kind string, bucket int64, shard uint32) string {
+	return fmt.Sprintf("recent/%s/%d/%02d", kind, bucket, shard)
+}
+
+func recentBucketOf(ts int64) int64 {
+	size := int64(recentBucketSize / time.Second)
+	return ts - ts%size
+}
+
+func recentShardOf(value *retrospector.Value) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(string(value.Type) + "/" + value.Data))
+	return h.Sum32() % recentShards
+}
+
+// makeRecentItems returns recent items of values. Duplicated values are merged because BatchWriteItem does not allow duplicated keys in one request.
+func makeRecentItems(kind string, values []*retrospector.Value, now time.Time) []interface{} {
+	bucket := recentBucketOf(now.Unix())
+	done := make(map[retrospector.Value]bool)
+
+	var items []interface{}
+	for _, value := range values {
+		if done[*value] {
+			continue
+		}
+		done[*value] = true
+
+		items = append(items, &recentItem{
+			dynamoItem: dynamoItem{
+				PK:        makeRecentPKey(kind, bucket, recentShardOf(value)),
+				SK:        fmt.Sprintf("%s/%s", value.Type, value.Data),
+				ExpiresAt: now.Add(RecentValueTimeToLive).Unix(),
+			},
+			Value:    *value,
+			StoredAt: now.Unix(),
+		})
+	}
+	return items
+}
+
+func (x *DynamoRepository) getRecentValues(kind string, since int64) ([]*retrospector.Value, error) {
+	var pkList []string
+	for bucket := recentBucketOf(since); bucket <= time.Now().Unix(); bucket += int64(recentBucketSize / time.Second) {
+		for shard := uint32(0); shard < recentShards; shard++ {
+			pkList = append(pkList, makeRecentPKey(kind, bucket, shard))
+		}
+	}
+
+	var mutex sync.Mutex
+	found := make(map[retrospector.Value]struct{})
+	err := x.runConcurrently(len(pkList), func(i int) error {
+		var items []*recentItem
+		if err := x.table.Get(dynamoHashKey, pkList[i]).Filter("$ >= ?", "stored_at", since).All(&items); err != nil {
+			return golambda.WrapError(err, "Failed to get recent values").With("pk", pkList[i])
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		for _, item := range items {
+			found[item.Value] = struct{}{}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var values []*retrospector.Value
+	for value := range found {
+		value := value
+		values = append(values, &value)
+	}
+	return values, nil
+}
+
+func (x *DynamoRepository) GetRecentIOCValues(since int64) ([]*retrospector.Value, error) {
+	return x.getRecentValues(recentKindIOC, since)
+}
+
+func (x *DynamoRepository) GetRecentEntityValues(since int64) ([]*retrospector.Value, error) {
+	return x.getRecentValues(recentKindEntity, since)
+}
+
+func makeReputationPKey(value *retrospector.Value) string {
+	return fmt.Sprintf("reputation/%s/%s", value.Type, value.Data)
+}
+
+func (x *DynamoRepository) PutReputation(rep *retrospector.Reputation) error {
+	item := &reputationItem{
+		dynamoItem: dynamoItem{
+			PK:        makeReputationPKey(&rep.Value),
+			SK:        rep.Source,
+			ExpiresAt: time.Unix(rep.CheckedAt, 0).Add(reputationTimeToLive).Unix(),
+		},
+		Reputation: *rep,
+	}
+
+	if err := x.table.Put(item).Run(); err != nil {
+		return golambda.WrapError(err, "Failed to put reputation").With("item", item)
+	}
+	return nil
+}
+
+// GetReputation returns cached reputation or nil if not found
+func (x *DynamoRepository) GetReputation(value *retrospector.Value, source string) (*retrospector.Reputation, error) {
+	pk := makeReputationPKey(value)
+
+	var item reputationItem
+	if err := x.table.Get(dynamoHashKey, pk).Range(dynamoRangeKey, dynamo.Equal, source).One(&item); err != nil {
+		if err == dynamo.ErrNotFound {
+			return nil, nil
+		}
+		return nil, golambda.WrapError(err, "Failed to get reputation").With("pk", pk).With("source", source)
+	}
+
+	return &item.Reputation, nil
+}
+
+func makeDetectionPKey(value *retrospector.Value) string {
+	return fmt.Sprintf("detection/%s/%s", value.Type, value.Data)
+}
+
+// makeDetectionSKey returns sort key of detection. Prefix is required because subject can be empty but key attribute can not.
+func makeDetectionSKey(subject string) string {
+	return "subject/" + subject
+}
+
+// GetDetections returns detection history of the value
+func (x *DynamoRepository) GetDetections(value *retrospector.Value) ([]*retrospector.Detection, error) {
+	pk := makeDetectionPKey(value)
+
+	var items []*detectionItem
+	if err := x.table.Get(dynamoHashKey, pk).All(&items); err != nil {
+		return nil, golambda.WrapError(err, "Failed to get detections").With("pk", pk)
+	}
+
+	var detections []*retrospector.Detection
+	for _, item := range items {
+		detections = append(detections, &item.Detection)
+	}
+	return detections, nil
+}
+
+// PutDetections overwrites detection history. Detection expires with entities of the subject.
+func (x *DynamoRepository) PutDetections(detections []*retrospector.Detection) error {
+	var items []interface{}
+	for _, detection := range detections {
+		items = append(items, &detectionItem{
+			dynamoItem: dynamoItem{
+				PK:        makeDetectionPKey(&detection.Value),
+				SK:        makeDetectionSKey(detection.Subject),
+				ExpiresAt: time.Unix(detection.DetectedAt, 0).Add(entityTimeToLive).Unix(),
+			},
+			Detection: *detection,
+		})
+	}
+
+	if n, err := x.table.Batch().Write().Put(items...).Run(); err != nil {
+		return golambda.WrapError(err, "PutDetections").With("items", items)
+	} else if n != len(items) {
+		return golambda.NewError("A number of wrote items is mismatched").With("n", n).With("items", items)
+	}
+	return nil
+}
+
+// Alert items have no expiration because lifecycle of alert (e.g. false positive) must be kept
+type alertStateItem struct {
+	PK string `dynamo:"pk,hash"`
+	SK string `dynamo:"sk,range"`
+	retrospector.AlertState
+}
+
+type alertTransitionItem struct {
+	PK string `dynamo:"pk,hash"`
+	SK string `dynamo:"sk,range"`
+	retrospector.AlertTransition
+}
+
+const (
+	alertStateSKey            = "state"
+	alertTransitionSKeyPrefix = "transition/"
+)
+
+func makeAlertPKey(value *retrospector.Value) string {
+	return fmt.Sprintf("alert/%s/%s", value.Type, value.Data)
+}
+
+// alertListPKeyAll is partition of list items of all alert states. List items of each status are also in partition of makeAlertListPKey(status).
+const alertListPKeyAll = "alerts/all"
+
+func makeAlertListPKey(status retrospector.AlertStatus) string {
+	return "alerts/status/" + string(status)
+}
+
+// makeAlertListSKey returns sort key of list item to query alert states in order of updated_at
+func makeAlertListSKey(state *retrospector.AlertState) string {
+	return fmt.Sprintf("%020d/%s/%s", state.UpdatedAt, state.Type, state.Data)
+}
+
+// alertListKeys returns keys of list items of the alert state
+func alertListKeys(state *retrospector.AlertState) []dynamo.Keys {
+	sk := makeAlertListSKey(state)
+	return []dynamo.Keys{
+		{alertListPKeyAll, sk},
+		{makeAlertListPKey(state.Status), sk},
+	}
+}
+
+// GetAlertState returns alert state of the value or nil if not found
+func (x *DynamoRepository) GetAlertState(value *retrospector.Value) (*retrospector.AlertState, error) {
+	pk := makeAlertPKey(value)
+
+	var item alertStateItem
+	if err := x.table.Get(dynamoHashKey, pk).Range(dynamoRangeKey, dynamo.Equal, alertStateSKey).One(&item); err != nil {
+		if err == dynamo.ErrNotFound {
+			return nil, nil
+		}
+		return nil, golambda.WrapError(err, "Failed to get alert state").With("pk", pk)
+	}
+
+	return &item.AlertState, nil
+}
+
+// PutAlertState puts alert state and list items to query it by status and updated_at. List items of previous state are deleted.
+func (x *DynamoRepository) PutAlertState(state *retrospector.AlertState) error {
+	prev, err := x.GetAlertState(&state.Value)
+	if err != nil {
+		return err
+	}
+
+	items := []interface{}{
+		&alertStateItem{
+			PK:         makeAlertPKey(&state.Value),
+			SK:         alertStateSKey,
+			AlertState: *state,
+		},
+	}
+	newKeys := make(map[dynamo.Keys]bool)
+	for _, keys := range alertListKeys(state) {
+		newKeys[keys] = true
+		items = append(items, &alertStateItem{
+			PK:         keys[0].(string),
+			SK:         keys[1].(string),
+			AlertState: *state,
+		})
+	}
+
+	var staleKeys []dynamo.Keyed
+	if prev != nil {
+		for _, keys := range alertListKeys(prev) {
+			if !newKeys[keys] {
+				staleKeys = append(staleKeys, keys)
+			}
+		}
+	}
+
+	if _, err := x.table.Batch(dynamoHashKey, dynamoRangeKey).Write().Put(items...).Delete(staleKeys...).Run(); err != nil {
+		return golambda.WrapError(err, "Failed to put alert state").With("state", state)
+	}
+	return nil
+}
+
+func (x *DynamoRepository) PutAlertTransition(transition *retrospector.AlertTransition) error {
+	item := &alertTransitionItem{
+		PK:              makeAlertPKey(&transition.Value),
+		SK:              fmt.Sprintf("%s%020d", alertTransitionSKeyPrefix, time.Now().UnixNano()),
+		AlertTransition: *transition,
+	}
+	if err := x.table.Put(item).Run(); err != nil {
+		return golambda.WrapError(err, "Failed to put alert transition").With("item", item)
+	}
+	return nil
+}
+
+// GetAlertTransitions returns transitions of alert in chronological order
+func (x *DynamoRepository) GetAlertTransitions(value *retrospector.Value) ([]*retrospector.AlertTransition, error) {
+	pk := makeAlertPKey(value)
+
+	var items []*alertTransitionItem
+	if err := x.table.Get(dynamoHashKey, pk).
+		Range(dynamoRangeKey, dynamo.BeginsWith, alertTransitionSKeyPrefix).
+		Order(dynamo.Ascending).All(&items); err != nil {
+		return nil, golambda.WrapError(err, "Failed to get alert transitions").With("pk", pk)
+	}
+
+	var transitions []*retrospector.AlertTransition
+	for _, item := range items {
+		transitions = append(transitions, &item.AlertTransition)
+	}
+	return transitions, nil
+}
+
+func (x *DynamoRepository) ScanAlertStates(callback func(state *retrospector.AlertState) error) error {
+	itr := x.table.Scan().
+		Filter("begins_with($, ?) AND $ = ?", dynamoHashKey, "alert/", dynamoRangeKey, alertStateSKey).
+		Iter()
+
+	var item alertStateItem
+	for itr.Next(&item) {
+		state := item.AlertState
+		if err := callback(&state); err != nil {
+			return err
+		}
+		item = alertStateItem{}
+	}
+	if err := itr.Err(); err != nil {
+		return golambda.WrapError(err, "Failed to scan alert states")
+	}
+
+	return nil
+}
+
+// QueryAlertStates queries list items of alert states in descending order of updated_at
+func (x *DynamoRepository) QueryAlertStates(status retrospector.AlertStatus, limit int, cursor string) ([]*retrospector.AlertState, string, error) {
+	pk := alertListPKeyAll
+	if status != "" {
+		pk = makeAlertListPKey(status)
+	}
+
+	query := x.table.Get(dynamoHashKey, pk).Order(dynamo.Descending).Limit(int64(limit))
+	if cursor != "" {
+		query = query.StartFrom(dynamo.PagingKey{
+			dynamoHashKey:  {S: aws.String(pk)},
+			dynamoRangeKey: {S: aws.String(cursor)},
+		})
+	}
+
+	var items []*alertStateItem
+	last, err := query.AllWithLastEvaluatedKey(&items)
+	if err != nil {
+		return nil, "", golambda.WrapError(err, "Failed to query alert states").With("pk", pk).With("cursor", cursor)
+	}
+
+	states := make([]*retrospector.AlertState, len(items))
+	for i, item := range items {
+		states[i] = &item.AlertState
+	}
+
+	var next string
+	if sk, ok := last[dynamoRangeKey]; ok && sk.S != nil {
+		next = *sk.S
+	}
+	return states, next, nil
+}
@@ -4,11 +4,16 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 )
 
 type S3Client interface {
 	GetObject(*s3.GetObjectInput) (*s3.GetObjectOutput, error)
+	HeadObject(*s3.HeadObjectInput) (*s3.HeadObjectOutput, error)
 	PutObject(*s3.PutObjectInput) (*s3.PutObjectOutput, error)
+	ListObjectsV2Pages(*s3.ListObjectsV2Input, func(*s3.ListObjectsV2Output, bool) bool) error
+	// Upload streams Body to S3 object by s3manager. Object is not created if reading Body fails.
+	Upload(*s3manager.UploadInput) (*s3manager.UploadOutput, error)
 }
 
 type S3ClientFactory func(region string) (S3Client, error)
@@ -20,5 +25,18 @@ func NewS3Client(region string) (S3Client, error) {
 	if err != nil {
 		return nil, err
 	}
-	return s3.New(ssn), nil
+	client := s3.New(ssn)
+	return &s3Client{
+		S3:       client,
+		uploader: s3manager.NewUploaderWithClient(client),
+	}, nil
+}
+
+type s3Client struct {
+	*s3.S3
+	uploader *s3manager.Uploader
+}
+
+func (x *s3Client) Upload(input *s3manager.UploadInput) (*s3manager.UploadOutput, error) {
+	return x.uploader.Upload(input)
 }
@@ -0,0 +1,205 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/cookpad/retrospector"
+	"github.com/cookpad/retrospector/pkg/arguments"
+	"github.com/cookpad/retrospector/pkg/logging"
+	"github.com/cookpad/retrospector/pkg/service"
+)
+
+var logger = logging.Logger
+
+// Server is HTTP API to query retrospector. It runs on Lambda behind API Gateway and as local server by CLI.
+type Server struct {
+	args *arguments.Arguments
+	auth *Authenticator
+	mux  *http.ServeMux
+}
+
+// New is constructor of Server
+func New(args *arguments.Arguments, auth *Authenticator) *Server {
+	x := &Server{
+		args: args,
+		auth: auth,
+		mux:  http.NewServeMux(),
+	}
+
+	x.mux.HandleFunc("/v1/entities", x.route(routes{http.MethodGet: x.getEntities}))
+	x.mux.HandleFunc("/v1/iocs", x.route(routes{
+		http.MethodGet:    x.getIOCSet,
+		http.MethodPost:   x.postIOCSet,
+		http.MethodDelete: x.deleteIOCSet,
+	}))
+	x.mux.HandleFunc("/v1/alerts", x.route(routes{http.MethodGet: x.getAlerts}))
+	x.mux.HandleFunc("/v1/alert", x.route(routes{http.MethodGet: x.getAlert}))
+	x.mux.HandleFunc("/v1/hunts", x.route(routes{http.MethodPost: x.postHunt}))
+
+	return x
+}
+
+// ServeHTTP authenticates request and dispatches it
+func (x *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	principal, ok := x.auth.Authenticate(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	logger.Info().Str("principal", principal).Str("method", r.Method).Str("path", r.URL.Path).Msg("API request")
+	x.mux.ServeHTTP(w, r.WithContext(withPrincipal(r.Context(), principal)))
+}
+
+type handlerFunc func(r *http.Request) (int, interface{})
+
+// routes is map of HTTP method to handler of a path
+type routes map[string]handlerFunc
+
+func (x *Server) route(handlers routes) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		handler, ok := handlers[r.Method]
+		if !ok {
+			writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		code, resp := handler(r)
+		writeJSON(w, code, resp)
+	}
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, &errorResponse{Error: msg})
+}
+
+func writeJSON(w http.ResponseWriter, code int, resp interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logger.Error().Err(err).Msg("Failed to write response")
+	}
+}
+
+func internalError(err error) (int, interface{}) {
+	logger.Error().Interface("error", err).Msg("API internal error")
+	return http.StatusInternalServerError, &errorResponse{Error: "Internal server error"}
+}
+
+func badRequest(msg string) (int, interface{}) {
+	return http.StatusBadRequest, &errorResponse{Error: msg}
+}
+
+// valueOf returns normalized value in query parameters "type" and "value". Type is guessed if "type" is not given.
+func valueOf(r *http.Request) (*retrospector.Value, string) {
+	value := &retrospector.Value{
+		Type: retrospector.ValueType(r.URL.Query().Get("type")),
+		Data: r.URL.Query().Get("value"),
+	}
+	if value.Data == "" {
+		return nil, "value is required"
+	}
+	normalized, err := service.NormalizeValue(value)
+	if err != nil {
+		return nil, "Invalid value"
+	}
+	return normalized, ""
+}
+
+type entitiesResponse struct {
+	Entities []*retrospector.Entity `json:"entities"`
+}
+
+func (x *Server) getEntities(r *http.Request) (int, interface{}) {
+	value, msg := valueOf(r)
+	if value == nil {
+		return badRequest(msg)
+	}
+
+	entities, err := x.args.RepositoryService().BatchGetEntities([]*retrospector.Value{value})
+	if err != nil {
+		return internalError(err)
+	}
+	return http.StatusOK, &entitiesResponse{Entities: entities}
+}
+
+type iocSetResponse struct {
+	IOCSet []*retrospector.IOC `json:"iocs"`
+}
+
+func (x *Server) getIOCSet(r *http.Request) (int, interface{}) {
+	value, msg := valueOf(r)
+	if value == nil {
+		return badRequest(msg)
+	}
+
+	iocSet, err := x.args.RepositoryService().BatchGetIOCSet([]*retrospector.Value{value})
+	if err != nil {
+		return internalError(err)
+	}
+	return http.StatusOK, &iocSetResponse{IOCSet: iocSet}
+}
+
+const defaultAlertLimit = 100
+
+type alertsResponse struct {
+	Alerts []*retrospector.AlertState `json:"alerts"`
+	// NextCursor is passed as "cursor" to get next page. It is empty at the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// getAlerts returns recently updated alerts. They can be filtered by "status", limited by "limit" and paged by "cursor"
+func (x *Server) getAlerts(r *http.Request) (int, interface{}) {
+	status := retrospector.AlertStatus(r.URL.Query().Get("status"))
+	if status != "" && !status.IsValid() {
+		return badRequest("Invalid alert status")
+	}
+	limit := defaultAlertLimit
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return badRequest("Invalid limit")
+		}
+		limit = n
+	}
+
+	alerts, next, err := x.args.RepositoryService().QueryAlertStates(status, limit, r.URL.Query().Get("cursor"))
+	if err != nil {
+		return internalError(err)
+	}
+	if alerts == nil {
+		alerts = []*retrospector.AlertState{}
+	}
+	return http.StatusOK, &alertsResponse{Alerts: alerts, NextCursor: next}
+}
+
+type alertResponse struct {
+	*retrospector.AlertState
+	Transitions []*retrospector.AlertTransition `json:"transitions"`
+}
+
+func (x *Server) getAlert(r *http.Request) (int, interface{}) {
+	value, msg := valueOf(r)
+	if value == nil {
+		return badRequest(msg)
+	}
+
+	repo := x.args.RepositoryService()
+	state, err := repo.GetAlertState(value)
+	if err != nil {
+		return internalError(err)
+	}
+	if state == nil {
+		return http.StatusNotFound, &errorResponse{Error: "Alert is not found"}
+	}
+	transitions, err := repo.GetAlertTransitions(value)
+	if err != nil {
+		return internalError(err)
+	}
+	return http.StatusOK, &alertResponse{AlertState: state, Transitions: transitions}
+}
@@ -0,0 +1,231 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/cookpad/retrospector"
+	"github.com/cookpad/retrospector/pkg/api"
+	"github.com/cookpad/retrospector/pkg/arguments"
+	"github.com/cookpad/retrospector/pkg/mock"
+	"github.com/cookpad/retrospector/pkg/usecase"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupServer(t *testing.T) *api.Server {
+	repo := mock.NewRepository()
+	require.NoError(t, repo.PutEntities([]*retrospector.Entity{
+		{
+			Value:      retrospector.Value{Data: "example.com", Type: retrospector.ValueDomainName},
+			Subject:    "blue",
+			Source:     "proxy",
+			RecordedAt: 1600000000,
+		},
+	}))
+	require.NoError(t, repo.PutIOCSet([]*retrospector.IOC{
+		{
+			Value:  retrospector.Value{Data: "example.com", Type: retrospector.ValueDomainName},
+			Source: "otx",
+		},
+	}))
+	require.NoError(t, repo.PutAlertState(&retrospector.AlertState{
+		Value:     retrospector.Value{Data: "example.com", Type: retrospector.ValueDomainName},
+		Status:    retrospector.AlertNew,
+		UpdatedAt: 1600000000,
+	}))
+	require.NoError(t, repo.PutAlertState(&retrospector.AlertState{
+		Value:     retrospector.Value{Data: "192.0.2.1", Type: retrospector.ValueIPAddr},
+		Status:    retrospector.AlertResolved,
+		UpdatedAt: 1600000001,
+	}))
+
+	args := &arguments.Arguments{Repository: repo}
+	return api.New(args, api.NewAuthenticator("analyst:secret-key"))
+}
+
+func request(t *testing.T, server *api.Server, method, path, body string, out interface{}) int {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.Header.Set(api.APIKeyHeader, "secret-key")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	if out != nil {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), out))
+	}
+	return w.Code
+}
+
+func TestAPIAuthentication(t *testing.T) {
+	server := setupServer(t)
+
+	t.Run("no API key", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", "/v1/alerts", nil))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("wrong API key", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "/v1/alerts", nil)
+		r.Header.Set(api.APIKeyHeader, "wrong")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("IAM principal", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "/v1/alerts", nil)
+		r = r.WithContext(api.WithIAMPrincipal(r.Context(), "arn:aws:iam::111122223333:user/blue"))
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+}
+
+func TestAPILookup(t *testing.T) {
+	server := setupServer(t)
+	query := "?" + url.Values{"type": {"domain"}, "value": {"example.com"}}.Encode()
+
+	t.Run("entities", func(t *testing.T) {
+		var resp struct {
+			Entities []*retrospector.Entity `json:"entities"`
+		}
+		require.Equal(t, http.StatusOK, request(t, server, "GET", "/v1/entities"+query, "", &resp))
+		require.Equal(t, 1, len(resp.Entities))
+		assert.Equal(t, "blue", resp.Entities[0].Subject)
+	})
+
+	t.Run("IOC set", func(t *testing.T) {
+		var resp struct {
+			IOCSet []*retrospector.IOC `json:"iocs"`
+		}
+		require.Equal(t, http.StatusOK, request(t, server, "GET", "/v1/iocs"+query, "", &resp))
+		require.Equal(t, 1, len(resp.IOCSet))
+		assert.Equal(t, "otx", resp.IOCSet[0].Source)
+	})
+
+	t.Run("invalid value type", func(t *testing.T) {
+		code := request(t, server, "GET", "/v1/entities?type=blue&value=example.com", "", nil)
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+
+	t.Run("method not allowed", func(t *testing.T) {
+		code := request(t, server, "POST", "/v1/entities"+query, "", nil)
+		assert.Equal(t, http.StatusMethodNotAllowed, code)
+	})
+}
+
+func TestAPIAlerts(t *testing.T) {
+	server := setupServer(t)
+
+	t.Run("recent alerts first", func(t *testing.T) {
+		var resp struct {
+			Alerts []*retrospector.AlertState `json:"alerts"`
+		}
+		require.Equal(t, http.StatusOK, request(t, server, "GET", "/v1/alerts", "", &resp))
+		require.Equal(t, 2, len(resp.Alerts))
+		assert.Equal(t, "192.0.2.1", resp.Alerts[0].Data)
+	})
+
+	t.Run("filter by status", func(t *testing.T) {
+		var resp struct {
+			Alerts []*retrospector.AlertState `json:"alerts"`
+		}
+		require.Equal(t, http.StatusOK, request(t, server, "GET", "/v1/alerts?status=new", "", &resp))
+		require.Equal(t, 1, len(resp.Alerts))
+		assert.Equal(t, "example.com", resp.Alerts[0].Data)
+	})
+
+	t.Run("paginated by cursor", func(t *testing.T) {
+		var resp struct {
+			Alerts     []*retrospector.AlertState `json:"alerts"`
+			NextCursor string                     `json:"next_cursor"`
+		}
+		require.Equal(t, http.StatusOK, request(t, server, "GET", "/v1/alerts?limit=1", "", &resp))
+		require.Equal(t, 1, len(resp.Alerts))
+		assert.Equal(t, "192.0.2.1", resp.Alerts[0].Data)
+		require.NotEmpty(t, resp.NextCursor)
+
+		cursor := resp.NextCursor
+		resp.Alerts, resp.NextCursor = nil, ""
+		require.Equal(t, http.StatusOK, request(t, server, "GET", "/v1/alerts?limit=1&cursor="+url.QueryEscape(cursor), "", &resp))
+		require.Equal(t, 1, len(resp.Alerts))
+		assert.Equal(t, "example.com", resp.Alerts[0].Data)
+		assert.Empty(t, resp.NextCursor)
+	})
+
+	t.Run("alert not found", func(t *testing.T) {
+		code := request(t, server, "GET", "/v1/alert?type=domain&value=example.org", "", nil)
+		assert.Equal(t, http.StatusNotFound, code)
+	})
+}
+
+func TestAPIHunt(t *testing.T) {
+	server := setupServer(t)
+
+	var report usecase.HuntReport
+	code := request(t, server, "POST", "/v1/hunts", `{"values":[
+		{"type":"domain","value":"example.com"},
+		{"value":"example.org"}
+	], "source":"partner"}`, &report)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 2, report.Values)
+	require.Equal(t, 1, len(report.Matches))
+	assert.Equal(t, "example.com", report.Matches[0].IOC.Data)
+	assert.Equal(t, "partner", report.Matches[0].IOC.Source)
+	assert.Equal(t, []string{"blue"}, report.Matches[0].Subjects)
+	assert.Equal(t, int64(1600000000), report.Matches[0].FirstSeen)
+
+	code = request(t, server, "POST", "/v1/hunts", `{"values":[]}`, nil)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code = request(t, server, "POST", "/v1/hunts", `{"values":[{"value":"not a value"}]}`, nil)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code = request(t, server, "POST", "/v1/hunts", `{"values":[{"value":"example.com"}],"alert":true}`, nil)
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestAPISubmitIOC(t *testing.T) {
+	newSNS, snsClient := mock.NewSNSMock()
+	repo := mock.NewRepository()
+	args := &arguments.Arguments{
+		Repository:  repo,
+		NewSNS:      newSNS,
+		IOCTopicARN: "arn:aws:sns:us-east-1:111122223333:my-topic",
+	}
+	server := api.New(args, api.NewAuthenticator("analyst:secret-key"))
+
+	t.Run("submit", func(t *testing.T) {
+		var resp struct {
+			IOCSet retrospector.IOCChunk `json:"iocs"`
+		}
+		code := request(t, server, "POST", "/v1/iocs", `{"values":[{"value":"evil[.]example.com"}],"ticket":"SEC-1"}`, &resp)
+		require.Equal(t, http.StatusCreated, code)
+		require.Equal(t, 1, len(resp.IOCSet))
+		assert.Equal(t, "evil.example.com", resp.IOCSet[0].Data)
+		assert.Equal(t, "manual:SEC-1:analyst", resp.IOCSet[0].Source)
+		require.Equal(t, 1, len(snsClient.PublishInput))
+		require.NoError(t, repo.PutIOCSet(resp.IOCSet))
+	})
+
+	t.Run("ticket is required", func(t *testing.T) {
+		code := request(t, server, "POST", "/v1/iocs", `{"values":[{"value":"evil.example.com"}]}`, nil)
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+
+	t.Run("revoke", func(t *testing.T) {
+		code := request(t, server, "DELETE", "/v1/iocs?value=evil.example.com&ticket=SEC-2", "", nil)
+		assert.Equal(t, http.StatusNotFound, code)
+
+		var resp struct {
+			IOCSet retrospector.IOCChunk `json:"iocs"`
+		}
+		code = request(t, server, "DELETE", "/v1/iocs?value=evil.example.com&ticket=SEC-1", "", &resp)
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, 1, len(resp.IOCSet))
+		assert.Equal(t, "analyst", resp.IOCSet[0].RevokedBy)
+		assert.Equal(t, 2, len(snsClient.PublishInput))
+	})
+}
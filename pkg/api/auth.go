@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// APIKeyHeader is HTTP header of API key
+const APIKeyHeader = "X-API-Key"
+
+// Authenticator authenticates request by API key or IAM principal that API Gateway has already verified
+type Authenticator struct {
+	// keys is map of API key to its name
+	keys map[string]string
+}
+
+// NewAuthenticator creates Authenticator from keys in format of "name:key,name:key". A key without name is named "apikey".
+func NewAuthenticator(keys string) *Authenticator {
+	x := &Authenticator{keys: make(map[string]string)}
+	for _, entry := range strings.Split(keys, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, key := "apikey", entry
+		if i := strings.Index(entry, ":"); i >= 0 {
+			name, key = entry[:i], entry[i+1:]
+		}
+		x.keys[key] = name
+	}
+	return x
+}
+
+type iamPrincipalKey struct{}
+
+// WithIAMPrincipal returns context having IAM principal ARN that API Gateway authenticated by AWS_IAM authorization
+func WithIAMPrincipal(ctx context.Context, arn string) context.Context {
+	return context.WithValue(ctx, iamPrincipalKey{}, arn)
+}
+
+// Authenticate returns principal of the request. IAM principal is preferred to API key.
+func (x *Authenticator) Authenticate(r *http.Request) (string, bool) {
+	if arn, ok := r.Context().Value(iamPrincipalKey{}).(string); ok && arn != "" {
+		return arn, true
+	}
+
+	given := r.Header.Get(APIKeyHeader)
+	if given == "" {
+		return "", false
+	}
+	for key, name := range x.keys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(given)) == 1 {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+type principalKey struct{}
+
+func withPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// Principal returns authenticated principal of the request
+func Principal(r *http.Request) string {
+	principal, _ := r.Context().Value(principalKey{}).(string)
+	return principal
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/cookpad/retrospector"
+	"github.com/cookpad/retrospector/pkg/usecase"
+)
+
+// maxHuntValues is max number of values in one hunt request to finish it in timeout of API Gateway
+const maxHuntValues = 1000
+
+type huntRequest struct {
+	// Values are IOC to hunt. Type is guessed if empty
+	Values retrospector.IOCChunk `json:"values"`
+	// Source is set to IOC without source. usecase.DefaultHuntSource is used if empty
+	Source string `json:"source"`
+	// Alert is rejected because API function has no write access to repository. Alerting hunt runs in hunt function
+	Alert bool `json:"alert"`
+}
+
+// postHunt runs hunt for submitted values and returns report of matched entities
+func (x *Server) postHunt(r *http.Request) (int, interface{}) {
+	var req huntRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return badRequest("Invalid JSON body")
+	}
+	if len(req.Values) == 0 {
+		return badRequest("values is required")
+	}
+	if len(req.Values) > maxHuntValues {
+		return badRequest("Too many values")
+	}
+	if req.Alert {
+		return badRequest("alert is not supported in API, invoke hunt function instead")
+	}
+	if req.Source == "" {
+		req.Source = usecase.DefaultHuntSource
+	}
+
+	for _, ioc := range req.Values {
+		if ioc.Type == "" {
+			ioc.Type = retrospector.GuessValueType(ioc.Data)
+		}
+		if !ioc.Type.IsValid() || ioc.Data == "" {
+			return badRequest("Invalid value: " + ioc.Data)
+		}
+		if ioc.Source == "" {
+			ioc.Source = req.Source
+		}
+	}
+
+	logger.Info().Str("principal", Principal(r)).Int("values", len(req.Values)).Msg("Hunt requested")
+	report, err := usecase.Hunt(x.args, req.Values, &usecase.HuntOptions{})
+	if err != nil {
+		return internalError(err)
+	}
+	return http.StatusOK, report
+}
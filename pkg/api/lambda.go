@@ -0,0 +1,62 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/m-mizutani/golambda"
+)
+
+// HandleAPIGateway converts API Gateway proxy request to HTTP request, serves it by handler and converts the response
+func HandleAPIGateway(ctx context.Context, handler http.Handler, req *events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+	body := []byte(req.Body)
+	if req.IsBase64Encoded {
+		decoded, err := base64.StdEncoding.DecodeString(req.Body)
+		if err != nil {
+			return nil, golambda.WrapError(err, "Failed to decode request body")
+		}
+		body = decoded
+	}
+
+	query := url.Values{}
+	for k, v := range req.QueryStringParameters {
+		query.Set(k, v)
+	}
+	for k, values := range req.MultiValueQueryStringParameters {
+		query[k] = values
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if arn := req.RequestContext.Identity.UserArn; arn != "" {
+		ctx = WithIAMPrincipal(ctx, arn)
+	}
+	r, err := http.NewRequestWithContext(ctx, req.HTTPMethod, req.Path, bytes.NewReader(body))
+	if err != nil {
+		return nil, golambda.WrapError(err, "Failed to create HTTP request").With("req", req)
+	}
+	r.URL.RawQuery = query.Encode()
+	for k, v := range req.Headers {
+		r.Header.Set(k, v)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	headers := make(map[string]string)
+	for k, v := range w.Header() {
+		headers[k] = strings.Join(v, ",")
+	}
+	return &events.APIGatewayProxyResponse{
+		StatusCode: w.Code,
+		Headers:    headers,
+		Body:       w.Body.String(),
+	}, nil
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/cookpad/retrospector"
+	"github.com/cookpad/retrospector/pkg/service"
+)
+
+type submitRequest struct {
+	Values      []*retrospector.Value `json:"values"`
+	Ticket      string                `json:"ticket"`
+	Reason      string                `json:"reason"`
+	Description string                `json:"description"`
+	ValidUntil  int64                 `json:"valid_until"`
+}
+
+// postIOCSet submits IOC set on behalf of the principal
+func (x *Server) postIOCSet(r *http.Request) (int, interface{}) {
+	var req submitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return badRequest("Invalid JSON body")
+	}
+	if len(req.Values) == 0 {
+		return badRequest("values is required")
+	}
+	if err := service.ValidateTicket(req.Ticket); err != nil {
+		return badRequest("Invalid ticket")
+	}
+	for _, value := range req.Values {
+		if _, err := service.NormalizeValue(value); err != nil {
+			return badRequest("Invalid value: " + value.Data)
+		}
+	}
+
+	iocChunk, err := x.args.SubmitService().Submit(&service.Submission{
+		Values:      req.Values,
+		Submitter:   Principal(r),
+		Ticket:      req.Ticket,
+		Reason:      req.Reason,
+		Description: req.Description,
+		ValidUntil:  req.ValidUntil,
+	})
+	if err != nil {
+		return internalError(err)
+	}
+	return http.StatusCreated, &iocSetResponse{IOCSet: iocChunk}
+}
+
+// deleteIOCSet revokes IOC of the value submitted for ticket
+func (x *Server) deleteIOCSet(r *http.Request) (int, interface{}) {
+	value, msg := valueOf(r)
+	if value == nil {
+		return badRequest(msg)
+	}
+	ticket := r.URL.Query().Get("ticket")
+	if err := service.ValidateTicket(ticket); err != nil {
+		return badRequest("Invalid ticket")
+	}
+
+	iocChunk, err := x.args.SubmitService().Revoke(value, ticket, Principal(r))
+	if err != nil {
+		return internalError(err)
+	}
+	if len(iocChunk) == 0 {
+		return http.StatusNotFound, &errorResponse{Error: "No submitted IOC to revoke"}
+	}
+	return http.StatusOK, &iocSetResponse{IOCSet: iocChunk}
+}
@@ -1,11 +1,18 @@
 package arguments
 
 import (
+	"encoding/json"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/Netflix/go-env"
 	"github.com/m-mizutani/golambda"
 	"github.com/cookpad/retrospector/pkg/adaptor"
+	"github.com/cookpad/retrospector/pkg/enrich"
+	"github.com/cookpad/retrospector/pkg/reader"
+	"github.com/cookpad/retrospector/pkg/reporting"
 	"github.com/cookpad/retrospector/pkg/service"
 )
 
@@ -17,22 +24,83 @@ type Arguments struct {
 	AwsRegion       string `env:"AWS_REGION"`
 	SecretsARN      string `env:"SECRETS_ARN"`
 
+	// S3 object of IOC Bloom filter. IOC filter is disabled if IOCFilterBucket is empty
+	IOCFilterBucket string `env:"IOC_FILTER_BUCKET"`
+	IOCFilterKey    string `env:"IOC_FILTER_KEY"`
+
+	// Streaming mode of entity object. Entities are handled in windows of EntityWindowSize entities if it is set
+	EntityWindowSize int `env:"ENTITY_WINDOW_SIZE"`
+	EntityDedupeSize int `env:"ENTITY_DEDUPE_SIZE"`
+
+	// EntityFormatRules is JSON array of reader.Rule to specify format of entity objects
+	EntityFormatRules string `env:"ENTITY_FORMAT_RULES"`
+
+	// IOCLookbackMargin is period before IOC publication in which entities still match the IOC, e.g. "72h". service.DefaultLookbackMargin is used if empty
+	IOCLookbackMargin string `env:"IOC_LOOKBACK_MARGIN"`
+
+	// Enrichers is comma separated list of alert enrichers: geoip, asn, rdap, rdns, virustotal, abuseipdb and greynoise
+	Enrichers     string `env:"ENRICHERS"`
+	GeoIPDBPath   string `env:"GEOIP_DB_PATH"`
+	ASNDBPath     string `env:"ASN_DB_PATH"`
+	RDAPBaseURL   string `env:"RDAP_BASE_URL"`
+	EnrichTimeout string `env:"ENRICH_TIMEOUT"`
+	// SuppressBenignAlert drops alert of value that reputation enrichers judge benign
+	SuppressBenignAlert bool `env:"SUPPRESS_BENIGN_ALERT"`
+
+	// RealertOn is comma separated list of conditions to alert a value again: new_subject and new_source. "none" disables them. Only new_subject is enabled if empty
+	RealertOn string `env:"REALERT_ON"`
+	// RealertCooldown is period after which the same subject is alerted again, e.g. "168h". Same subject is never alerted again if empty
+	RealertCooldown string `env:"REALERT_COOLDOWN"`
+
+	// SweepOverlapWindow is overlap window of reconciliation sweeper, e.g. "2h". service.DefaultSweepWindow is used if empty. It must be positive and not longer than adaptor.RecentValueTimeToLive (24h) because older values are not found by sweeper
+	SweepOverlapWindow string `env:"SWEEP_OVERLAP_WINDOW"`
+	// RecordRecentValues enables recording values of stored IOC set and entities for reconciliation sweeper
+	RecordRecentValues bool `env:"RECORD_RECENT_VALUES"`
+
+	// Default destination and format of export. Scheduled export writes objects under ExportPrefix + "YYYY/MM/DD/"
+	ExportBucket string `env:"EXPORT_BUCKET"`
+	ExportPrefix string `env:"EXPORT_PREFIX"`
+	ExportFormat string `env:"EXPORT_FORMAT"`
+
+	// Errors and panics of Lambda functions are reported to Sentry or compatible endpoint if SentryDSN is set
+	SentryDSN         string `env:"SENTRY_DSN"`
+	SentryEnvironment string `env:"SENTRY_ENVIRONMENT"`
+	SentryRelease     string `env:"SENTRY_RELEASE"`
+
+	// InternalCIDRs is comma separated list of internal networks that are not recorded from network logs. RFC1918 networks are always internal
+	InternalCIDRs string `env:"INTERNAL_CIDRS"`
+
 	// Do not change them in each lambda Function. They must be accessed in only pkg/lambda
 	Repository adaptor.Repository             `env:"-"`
 	NewS3      adaptor.S3ClientFactory        `env:"-"`
 	NewSNS     adaptor.SNSClientFactory       `env:"-"`
 	NewSM      golambda.SecretsManagerFactory `env:"-"`
 	HTTP       adaptor.HTTPClient             `env:"-"`
+
+	// FormatRules is parsed EntityFormatRules
+	FormatRules []*reader.Rule `env:"-"`
+
+	// enrichSvc is built once and shared by alerts because enrichers open GeoIP databases and fetch API keys
+	enrichOnce sync.Once
+	enrichSvc  *service.EnrichService
 }
 
 type Secrets struct {
 	OTXToken string `json:"otx_token"`
+
+	// API keys of reputation services
+	VirusTotalAPIKey string `json:"virustotal_api_key"`
+	AbuseIPDBAPIKey  string `json:"abuseipdb_api_key"`
+	GreyNoiseAPIKey  string `json:"greynoise_api_key"`
+
+	// APIKeys is comma separated API keys of HTTP API in format of "name:key"
+	APIKeys string `json:"api_keys"`
 }
 
 // -----------------------
 // Data binding
 
-// New is constructor of Arguments
+// New is constructor of Arguments. Lambda functions create Arguments once in main and share it by invocations to reuse alert enrichers in warm Lambda.
 func New() *Arguments {
 	args := &Arguments{}
 
@@ -41,12 +109,48 @@ func New() *Arguments {
 		panic(err)
 	}
 
+	if args.EntityFormatRules != "" {
+		if err := json.Unmarshal([]byte(args.EntityFormatRules), &args.FormatRules); err != nil {
+			golambda.Logger.With("err", err).With("rules", args.EntityFormatRules).Error("Failed to parse ENTITY_FORMAT_RULES")
+			panic(err)
+		}
+	}
+
+	if args.IOCLookbackMargin != "" {
+		if _, err := time.ParseDuration(args.IOCLookbackMargin); err != nil {
+			golambda.Logger.With("err", err).With("margin", args.IOCLookbackMargin).Error("Failed to parse IOC_LOOKBACK_MARGIN")
+			panic(err)
+		}
+	}
+
+	if _, err := args.RealertPolicy(); err != nil {
+		golambda.Logger.With("err", err).Error("Invalid REALERT_ON or REALERT_COOLDOWN")
+		panic(err)
+	}
+
+	if args.SweepOverlapWindow != "" {
+		window, err := time.ParseDuration(args.SweepOverlapWindow)
+		if err != nil {
+			golambda.Logger.With("err", err).With("window", args.SweepOverlapWindow).Error("Failed to parse SWEEP_OVERLAP_WINDOW")
+			panic(err)
+		}
+		if window <= 0 || adaptor.RecentValueTimeToLive < window {
+			err := golambda.NewError("SWEEP_OVERLAP_WINDOW must be positive and not longer than stored time of values is kept").With("window", window).With("max", adaptor.RecentValueTimeToLive)
+			golambda.Logger.With("err", err).Error("Invalid SWEEP_OVERLAP_WINDOW")
+			panic(err)
+		}
+	}
+
 	repo, err := adaptor.NewDynamoRepository(args.AwsRegion, args.RecordTableName)
 	if err != nil {
 		golambda.Logger.With("err", err).Error("Failed NewDynamoRepository")
 		panic(err)
 	}
 
+	if args.RecordRecentValues {
+		repo.WithRecentValues()
+	}
+
 	args.Repository = repo
 	args.NewS3 = adaptor.NewS3Client
 	args.NewSNS = adaptor.NewSNSClient
@@ -54,6 +158,67 @@ func New() *Arguments {
 	return args
 }
 
+// LookbackMargin returns parsed IOCLookbackMargin
+func (x *Arguments) LookbackMargin() time.Duration {
+	if x.IOCLookbackMargin == "" {
+		return service.DefaultLookbackMargin
+	}
+	margin, err := time.ParseDuration(x.IOCLookbackMargin)
+	if err != nil {
+		golambda.Logger.With("err", err).With("margin", x.IOCLookbackMargin).Error("Invalid IOC_LOOKBACK_MARGIN, use default")
+		return service.DefaultLookbackMargin
+	}
+	return margin
+}
+
+// SweepWindow returns parsed SweepOverlapWindow. It is clamped to adaptor.RecentValueTimeToLive
+func (x *Arguments) SweepWindow() time.Duration {
+	if x.SweepOverlapWindow == "" {
+		return service.DefaultSweepWindow
+	}
+	window, err := time.ParseDuration(x.SweepOverlapWindow)
+	if err != nil {
+		golambda.Logger.With("err", err).With("window", x.SweepOverlapWindow).Error("Invalid SWEEP_OVERLAP_WINDOW, use default")
+		return service.DefaultSweepWindow
+	}
+	if adaptor.RecentValueTimeToLive < window {
+		golambda.Logger.With("window", window).Error("SWEEP_OVERLAP_WINDOW is longer than stored time of values is kept, clamp it")
+		return adaptor.RecentValueTimeToLive
+	}
+	return window
+}
+
+// Reporter returns reporter of errors to Sentry configured by SentryDSN, SentryEnvironment and SentryRelease. It returns nil if SentryDSN is empty.
+func (x *Arguments) Reporter() (*reporting.Reporter, error) {
+	return reporting.NewReporter(&reporting.Options{
+		DSN:         x.SentryDSN,
+		Environment: x.SentryEnvironment,
+		Release:     x.SentryRelease,
+	})
+}
+
+// reputationSource returns reputation source of the name with API key in secrets and its rate limit per minute
+func (x *Arguments) reputationSource(name string, secrets *Secrets) (enrich.ReputationSource, int, error) {
+	switch name {
+	case "virustotal":
+		if secrets.VirusTotalAPIKey == "" {
+			return nil, 0, golambda.NewError("virustotal_api_key is not set in secrets")
+		}
+		return enrich.NewVirusTotal(x.HTTPClient(), secrets.VirusTotalAPIKey), enrich.VirusTotalRateLimit, nil
+	case "abuseipdb":
+		if secrets.AbuseIPDBAPIKey == "" {
+			return nil, 0, golambda.NewError("abuseipdb_api_key is not set in secrets")
+		}
+		return enrich.NewAbuseIPDB(x.HTTPClient(), secrets.AbuseIPDBAPIKey), enrich.AbuseIPDBRateLimit, nil
+	case "greynoise":
+		if secrets.GreyNoiseAPIKey == "" {
+			return nil, 0, golambda.NewError("greynoise_api_key is not set in secrets")
+		}
+		return enrich.NewGreyNoise(x.HTTPClient(), secrets.GreyNoiseAPIKey), enrich.GreyNoiseRateLimit, nil
+	}
+	return nil, 0, golambda.NewError("Unknown reputation source").With("name", name)
+}
+
 // -----------------------
 // Services
 
@@ -62,6 +227,42 @@ func (x *Arguments) RepositoryService() *service.RepositoryService {
 	return service.NewRepositoryService(x.Repository)
 }
 
+// RealertPolicy returns re-alert policy built from RealertOn and RealertCooldown. Error is returned if a condition is not supported or cooldown is not a valid duration.
+func (x *Arguments) RealertPolicy() (*service.RealertPolicy, error) {
+	if x.RealertOn == "" && x.RealertCooldown == "" {
+		return service.DefaultRealertPolicy(), nil
+	}
+
+	policy := &service.RealertPolicy{}
+	if x.RealertOn == "" {
+		policy.NewSubject = true
+	}
+	for _, cond := range strings.Split(x.RealertOn, ",") {
+		switch strings.TrimSpace(cond) {
+		case "new_subject":
+			policy.NewSubject = true
+		case "new_source":
+			policy.NewSource = true
+		case "none", "":
+		default:
+			return nil, golambda.NewError("Unsupported re-alert condition").With("condition", cond)
+		}
+	}
+	if x.RealertCooldown != "" {
+		cooldown, err := time.ParseDuration(x.RealertCooldown)
+		if err != nil {
+			return nil, golambda.WrapError(err, "Invalid re-alert cooldown").With("cooldown", x.RealertCooldown)
+		}
+		policy.Cooldown = cooldown
+	}
+	return policy, nil
+}
+
+// LifecycleService returns *service.LifecycleService that manages alert status in Arguments.Repository
+func (x *Arguments) LifecycleService() *service.LifecycleService {
+	return service.NewLifecycleService(x.RepositoryService())
+}
+
 // SNSService returns a new *service.SNSService based on Arguments.IOCTopicARN
 func (x *Arguments) SNSService() *service.SNSService {
 	factory := x.NewSNS
@@ -71,6 +272,20 @@ func (x *Arguments) SNSService() *service.SNSService {
 	return service.NewSNSService(factory)
 }
 
+// S3Client returns S3 client of the region by NewS3
+func (x *Arguments) S3Client(region string) (adaptor.S3Client, error) {
+	factory := x.NewS3
+	if factory == nil {
+		factory = adaptor.NewS3Client
+	}
+	return factory(region)
+}
+
+// SubmitService returns service to publish manually submitted IOC to Arguments.IOCTopicARN
+func (x *Arguments) SubmitService() *service.SubmitService {
+	return service.NewSubmitService(x.SNSService(), x.RepositoryService(), x.IOCTopicARN)
+}
+
 func (x *Arguments) HTTPClient() adaptor.HTTPClient {
 	client := x.HTTP
 	if client == nil {
@@ -84,7 +299,28 @@ func (x *Arguments) EntityService() *service.EntityService {
 	if newS3 == nil {
 		newS3 = adaptor.NewS3Client
 	}
-	return service.NewEntityService(newS3)
+	svc := service.NewEntityService(newS3, x.FormatRules...)
+	if x.InternalCIDRs != "" {
+		svc.WithInternalCIDRs(strings.Split(x.InternalCIDRs, ","))
+	}
+	return svc
+}
+
+// IOCFilterService returns *service.IOCFilterService. It returns nil if IOC filter is not configured.
+func (x *Arguments) IOCFilterService() *service.IOCFilterService {
+	if x.IOCFilterBucket == "" {
+		return nil
+	}
+
+	newS3 := x.NewS3
+	if newS3 == nil {
+		newS3 = adaptor.NewS3Client
+	}
+	key := x.IOCFilterKey
+	if key == "" {
+		key = "retrospector/ioc-filter.bin.gz"
+	}
+	return service.NewIOCFilterService(newS3, x.AwsRegion, x.IOCFilterBucket, key)
 }
 
 func (x *Arguments) AlertService() *service.AlertService {
@@ -92,9 +328,80 @@ func (x *Arguments) AlertService() *service.AlertService {
 	return service.NewAlertService(&service.AlertServiceArguments{
 		HTTPClient:              httpClient,
 		SlackIncomingWebhookURL: x.SlackWebhookURL,
+		EnrichService:           x.EnrichService(),
+		SuppressBenign:          x.SuppressBenignAlert,
 	})
 }
 
+// EnrichService returns *service.EnrichService with enrichers specified by Enrichers. It returns nil if no enricher is available. An enricher that fails to initialize is skipped with error log not to stop alert. The service is built at the first call and shared by later calls.
+func (x *Arguments) EnrichService() *service.EnrichService {
+	x.enrichOnce.Do(func() {
+		x.enrichSvc = x.newEnrichService()
+	})
+	return x.enrichSvc
+}
+
+func (x *Arguments) newEnrichService() *service.EnrichService {
+	var enrichers []service.Enricher
+	var secrets *Secrets
+	for _, name := range strings.Split(x.Enrichers, ",") {
+		switch strings.TrimSpace(name) {
+		case "":
+			continue
+		case "geoip":
+			db, err := enrich.OpenMaxMindDB(x.GeoIPDBPath)
+			if err != nil {
+				golambda.Logger.With("err", err).Error("Skip GeoIP enricher")
+				continue
+			}
+			enrichers = append(enrichers, enrich.NewGeoIP(db))
+		case "asn":
+			db, err := enrich.OpenMaxMindDB(x.ASNDBPath)
+			if err != nil {
+				golambda.Logger.With("err", err).Error("Skip ASN enricher")
+				continue
+			}
+			enrichers = append(enrichers, enrich.NewASN(db))
+		case "rdap":
+			enrichers = append(enrichers, enrich.NewRDAP(x.HTTPClient(), x.RDAPBaseURL))
+		case "rdns":
+			enrichers = append(enrichers, enrich.NewReverseDNS(nil))
+		case "virustotal", "abuseipdb", "greynoise":
+			if secrets == nil {
+				s, err := x.GetSecrets()
+				if err != nil {
+					golambda.Logger.With("err", err).Error("Skip reputation enrichers")
+					continue
+				}
+				secrets = s
+			}
+			source, limit, err := x.reputationSource(strings.TrimSpace(name), secrets)
+			if err != nil {
+				golambda.Logger.With("err", err).With("enricher", name).Error("Skip reputation enricher")
+				continue
+			}
+			limiter := enrich.SharedRateLimiter(source.Name(), limit)
+			enrichers = append(enrichers, enrich.NewReputation(source, x.RepositoryService(), limiter))
+		default:
+			golambda.Logger.With("enricher", name).Error("Unknown enricher")
+		}
+	}
+	if len(enrichers) == 0 {
+		return nil
+	}
+
+	var timeout time.Duration
+	if x.EnrichTimeout != "" {
+		t, err := time.ParseDuration(x.EnrichTimeout)
+		if err != nil {
+			golambda.Logger.With("err", err).With("timeout", x.EnrichTimeout).Error("Invalid ENRICH_TIMEOUT, use default")
+		} else {
+			timeout = t
+		}
+	}
+	return service.NewEnrichService(timeout, enrichers...)
+}
+
 func (x *Arguments) GetSecrets() (*Secrets, error) {
 	var secrets Secrets
 	if err := golambda.GetSecretValuesWithFactory(x.SecretsARN, &secrets, x.NewSM); err != nil {
@@ -1 +1,26 @@
 package arguments
+
+import (
+	"github.com/cookpad/retrospector/pkg/metrics"
+	"github.com/cookpad/retrospector/pkg/tracing"
+	"github.com/m-mizutani/golambda"
+)
+
+// StartLambda starts Lambda function of the name. callback is called for each invocation with metrics, tracing and error reporting to Sentry configured by args.
+func StartLambda(function string, args *Arguments, callback golambda.Callback) {
+	reporter, err := args.Reporter()
+	if err != nil {
+		golambda.Logger.With("err", err).Error("Failed to set up error reporter")
+		panic(err)
+	}
+
+	golambda.Start(func(event golambda.Event) (interface{}, error) {
+		return metrics.Invoke(function, func() (interface{}, error) {
+			return tracing.Invoke(function, event, func() (interface{}, error) {
+				return reporter.Invoke(function, event, func() (interface{}, error) {
+					return callback(event)
+				})
+			})
+		})
+	})
+}
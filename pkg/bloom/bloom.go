@@ -0,0 +1,131 @@
+package bloom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+
+	"github.com/m-mizutani/golambda"
+)
+
+// Filter is Bloom filter. Test never returns false for added data, but may return true for data that has not been added (false positive).
+type Filter struct {
+	bits     []uint64
+	m        uint64 // number of bits
+	k        uint64 // number of hash functions
+	count    uint64 // number of added items
+	capacity uint64 // expected number of items
+}
+
+const (
+	magic   = "RBF1"
+	minBits = 64
+)
+
+// New creates a Filter sized for capacity items with false positive rate fpRate
+func New(capacity uint64, fpRate float64) *Filter {
+	if capacity == 0 {
+		capacity = 1
+	}
+	if fpRate <= 0 || fpRate >= 1 {
+		fpRate = 0.01
+	}
+
+	m := uint64(math.Ceil(-float64(capacity) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	if m < minBits {
+		m = minBits
+	}
+	k := uint64(math.Round(float64(m) / float64(capacity) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+
+	return &Filter{
+		bits:     make([]uint64, (m+63)/64),
+		m:        m,
+		k:        k,
+		capacity: capacity,
+	}
+}
+
+// hashes returns 2 hash values for double hashing
+func hashes(data []byte) (uint64, uint64) {
+	h := fnv.New128a()
+	_, _ = h.Write(data)
+	sum := h.Sum(nil)
+	return binary.BigEndian.Uint64(sum[0:8]), binary.BigEndian.Uint64(sum[8:16]) | 1
+}
+
+// Add inserts data to the filter
+func (x *Filter) Add(data []byte) {
+	h1, h2 := hashes(data)
+	for i := uint64(0); i < x.k; i++ {
+		pos := (h1 + i*h2) % x.m
+		x.bits[pos/64] |= 1 << (pos % 64)
+	}
+	x.count++
+}
+
+// Test returns false if data is definitely not in the filter
+func (x *Filter) Test(data []byte) bool {
+	h1, h2 := hashes(data)
+	for i := uint64(0); i < x.k; i++ {
+		pos := (h1 + i*h2) % x.m
+		if x.bits[pos/64]&(1<<(pos%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Count returns number of added items. Adding same data twice is counted twice.
+func (x *Filter) Count() uint64 { return x.count }
+
+// Capacity returns expected number of items given to New
+func (x *Filter) Capacity() uint64 { return x.capacity }
+
+// Saturated returns true if more items than capacity have been added and false positive rate exceeds the designed rate
+func (x *Filter) Saturated() bool { return x.count > x.capacity }
+
+// MarshalBinary encodes the filter
+func (x *Filter) MarshalBinary() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteString(magic)
+	for _, v := range []uint64{x.m, x.k, x.count, x.capacity} {
+		if err := binary.Write(buf, binary.BigEndian, v); err != nil {
+			return nil, golambda.WrapError(err, "Failed to write bloom filter header")
+		}
+	}
+	if err := binary.Write(buf, binary.BigEndian, x.bits); err != nil {
+		return nil, golambda.WrapError(err, "Failed to write bloom filter bits")
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes the filter encoded by MarshalBinary
+func (x *Filter) UnmarshalBinary(data []byte) error {
+	if len(data) < len(magic) || string(data[:len(magic)]) != magic {
+		return golambda.NewError("Invalid bloom filter format")
+	}
+
+	rd := bytes.NewReader(data[len(magic):])
+	header := make([]uint64, 4)
+	if err := binary.Read(rd, binary.BigEndian, header); err != nil {
+		return golambda.WrapError(err, "Failed to read bloom filter header")
+	}
+
+	m, k := header[0], header[1]
+	if m < minBits || k < 1 || uint64(rd.Len()) != (m+63)/64*8 {
+		return golambda.NewError("Invalid bloom filter size").With("m", m).With("k", k).With("remain", rd.Len())
+	}
+
+	bits := make([]uint64, (m+63)/64)
+	if err := binary.Read(rd, binary.BigEndian, bits); err != nil {
+		return golambda.WrapError(err, "Failed to read bloom filter bits")
+	}
+
+	x.m, x.k, x.count, x.capacity = m, k, header[2], header[3]
+	x.bits = bits
+	return nil
+}
@@ -0,0 +1,58 @@
+package bloom_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/cookpad/retrospector/pkg/bloom"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBloomFilter(t *testing.T) {
+	f := bloom.New(1000, 0.01)
+	for i := 0; i < 1000; i++ {
+		f.Add([]byte(fmt.Sprintf("added-%d", i)))
+	}
+
+	t.Run("no false negative", func(t *testing.T) {
+		for i := 0; i < 1000; i++ {
+			assert.True(t, f.Test([]byte(fmt.Sprintf("added-%d", i))))
+		}
+	})
+
+	t.Run("false positive rate is around designed rate", func(t *testing.T) {
+		fp := 0
+		for i := 0; i < 10000; i++ {
+			if f.Test([]byte(fmt.Sprintf("not-added-%d", i))) {
+				fp++
+			}
+		}
+		assert.Less(t, fp, 300)
+	})
+
+	t.Run("marshal and unmarshal", func(t *testing.T) {
+		raw, err := f.MarshalBinary()
+		require.NoError(t, err)
+
+		var restored bloom.Filter
+		require.NoError(t, restored.UnmarshalBinary(raw))
+		assert.Equal(t, f.Count(), restored.Count())
+		assert.Equal(t, f.Capacity(), restored.Capacity())
+		for i := 0; i < 1000; i++ {
+			assert.True(t, restored.Test([]byte(fmt.Sprintf("added-%d", i))))
+		}
+	})
+
+	t.Run("reject broken data", func(t *testing.T) {
+		var restored bloom.Filter
+		assert.Error(t, restored.UnmarshalBinary([]byte("RBF1xxxx")))
+		assert.Error(t, restored.UnmarshalBinary([]byte("blue")))
+	})
+
+	t.Run("saturated", func(t *testing.T) {
+		assert.False(t, f.Saturated())
+		f.Add([]byte("one more"))
+		assert.True(t, f.Saturated())
+	})
+}
@@ -0,0 +1,79 @@
+package enrich
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/cookpad/retrospector"
+	"github.com/cookpad/retrospector/pkg/adaptor"
+)
+
+// AbuseIPDB is ReputationSource of AbuseIPDB API v2. Only IP address is supported.
+// https://docs.abuseipdb.com/#check-endpoint
+type AbuseIPDB struct {
+	client  adaptor.HTTPClient
+	apiKey  string
+	baseURL string
+}
+
+// AbuseIPDBRateLimit is requests per minute for AbuseIPDB
+const AbuseIPDBRateLimit = 60
+
+// NewAbuseIPDB is constructor of AbuseIPDB
+func NewAbuseIPDB(client adaptor.HTTPClient, apiKey string) *AbuseIPDB {
+	return &AbuseIPDB{
+		client:  client,
+		apiKey:  apiKey,
+		baseURL: "https://api.abuseipdb.com/api/v2",
+	}
+}
+
+// Name returns "AbuseIPDB"
+func (x *AbuseIPDB) Name() string { return "AbuseIPDB" }
+
+type abuseIPDBResponse struct {
+	Data struct {
+		IsWhitelisted        bool   `json:"isWhitelisted"`
+		AbuseConfidenceScore int64  `json:"abuseConfidenceScore"`
+		TotalReports         int64  `json:"totalReports"`
+		UsageType            string `json:"usageType"`
+	} `json:"data"`
+}
+
+// Check looks up abuse confidence score (0-100) of IP address
+func (x *AbuseIPDB) Check(ctx context.Context, value *retrospector.Value) (*retrospector.Reputation, error) {
+	ip, _ := hostOf(value)
+	if ip == nil || value.Type != retrospector.ValueIPAddr {
+		return nil, nil
+	}
+
+	q := url.Values{}
+	q.Add("ipAddress", ip.String())
+	q.Add("maxAgeInDays", "90")
+
+	var resp abuseIPDBResponse
+	found, err := getJSON(ctx, x.client, x.baseURL+"/check?"+q.Encode(), http.Header{"Key": {x.apiKey}}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return &retrospector.Reputation{Verdict: retrospector.VerdictUnknown, Detail: "not found"}, nil
+	}
+
+	rep := &retrospector.Reputation{
+		Verdict: retrospector.VerdictUnknown,
+		Score:   resp.Data.AbuseConfidenceScore,
+		Detail:  fmt.Sprintf("reports:%d, usage:%s", resp.Data.TotalReports, resp.Data.UsageType),
+	}
+	switch {
+	case resp.Data.IsWhitelisted:
+		rep.Verdict = retrospector.VerdictBenign
+	case resp.Data.AbuseConfidenceScore >= 75:
+		rep.Verdict = retrospector.VerdictMalicious
+	case resp.Data.AbuseConfidenceScore >= 25:
+		rep.Verdict = retrospector.VerdictSuspicious
+	}
+	return rep, nil
+}
@@ -0,0 +1,30 @@
+// Package enrich provides implementations of service.Enricher
+package enrich
+
+import (
+	"net"
+	"net/url"
+
+	"github.com/cookpad/retrospector"
+)
+
+// hostOf returns IP address or domain name of the value. URL is converted to its host.
+func hostOf(value *retrospector.Value) (net.IP, string) {
+	host := value.Data
+	switch value.Type {
+	case retrospector.ValueIPAddr, retrospector.ValueDomainName:
+	case retrospector.ValueURL:
+		u, err := url.Parse(value.Data)
+		if err != nil {
+			return nil, ""
+		}
+		host = u.Hostname()
+	default:
+		return nil, ""
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		return ip, ""
+	}
+	return nil, host
+}
@@ -0,0 +1,158 @@
+package enrich_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cookpad/retrospector"
+	"github.com/cookpad/retrospector/pkg/enrich"
+	"github.com/cookpad/retrospector/pkg/mock"
+	"github.com/cookpad/retrospector/pkg/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeMaxMindDB decodes records to result by maxminddb tag as maxminddb.Reader does
+type fakeMaxMindDB map[string]map[string]interface{}
+
+func (x fakeMaxMindDB) Lookup(ip net.IP, result interface{}) error {
+	if record, ok := x[ip.String()]; ok {
+		decodeByTag(record, reflect.ValueOf(result).Elem())
+	}
+	return nil
+}
+
+func decodeByTag(src interface{}, dst reflect.Value) {
+	switch dst.Kind() {
+	case reflect.Struct:
+		m, _ := src.(map[string]interface{})
+		for i := 0; i < dst.NumField(); i++ {
+			if v, ok := m[dst.Type().Field(i).Tag.Get("maxminddb")]; ok {
+				decodeByTag(v, dst.Field(i))
+			}
+		}
+	case reflect.Map:
+		dst.Set(reflect.ValueOf(src))
+	default:
+		dst.Set(reflect.ValueOf(src).Convert(dst.Type()))
+	}
+}
+
+func fieldMap(enrichment *service.Enrichment) map[string]string {
+	m := make(map[string]string)
+	for _, f := range enrichment.Fields {
+		m[f.Key] = f.Value
+	}
+	return m
+}
+
+func TestGeoIP(t *testing.T) {
+	db := fakeMaxMindDB{
+		"192.0.2.1": {
+			"country": map[string]interface{}{
+				"iso_code": "JP",
+				"names":    map[string]string{"en": "Japan"},
+			},
+			"city": map[string]interface{}{
+				"names": map[string]string{"en": "Tokyo"},
+			},
+			"autonomous_system_number":       64496,
+			"autonomous_system_organization": "Example Net",
+		},
+	}
+
+	t.Run("GeoIP", func(t *testing.T) {
+		resp, err := enrich.NewGeoIP(db).Enrich(context.Background(), &retrospector.Value{Data: "192.0.2.1", Type: retrospector.ValueIPAddr})
+		require.NoError(t, err)
+		require.NotNil(t, resp)
+		fields := fieldMap(resp)
+		assert.Equal(t, "Japan (JP)", fields["Country"])
+		assert.Equal(t, "Tokyo", fields["City"])
+	})
+
+	t.Run("ASN", func(t *testing.T) {
+		resp, err := enrich.NewASN(db).Enrich(context.Background(), &retrospector.Value{Data: "http://192.0.2.1:8080/x", Type: retrospector.ValueURL})
+		require.NoError(t, err)
+		require.NotNil(t, resp)
+		fields := fieldMap(resp)
+		assert.Equal(t, "AS64496", fields["AS"])
+		assert.Equal(t, "Example Net", fields["Organization"])
+	})
+
+	t.Run("domain name is not supported", func(t *testing.T) {
+		resp, err := enrich.NewGeoIP(db).Enrich(context.Background(), &retrospector.Value{Data: "example.com", Type: retrospector.ValueDomainName})
+		require.NoError(t, err)
+		assert.Nil(t, resp)
+	})
+}
+
+func TestRDAP(t *testing.T) {
+	body := `{
+	"objectClassName": "domain",
+	"ldhName": "EXAMPLE.COM",
+	"events": [
+		{"eventAction": "registration", "eventDate": "1995-08-14T04:00:00Z"},
+		{"eventAction": "expiration", "eventDate": "2030-08-13T04:00:00Z"}
+	],
+	"entities": [
+		{"roles": ["registrar"], "vcardArray": ["vcard", [["version", {}, "text", "4.0"], ["fn", {}, "text", "Example Registrar, Inc."]]]}
+	]
+}`
+	httpClient := &mock.HTTPClient{
+		RespCode: http.StatusOK,
+		RespBody: ioutil.NopCloser(strings.NewReader(body)),
+	}
+
+	resp, err := enrich.NewRDAP(httpClient, "https://rdap.example.net/").Enrich(context.Background(),
+		&retrospector.Value{Data: "www.Example.com", Type: retrospector.ValueDomainName})
+	require.NoError(t, err)
+	require.NotNil(t, resp)
+
+	require.Equal(t, 1, len(httpClient.Requests))
+	assert.Equal(t, "https://rdap.example.net/domain/example.com", httpClient.Requests[0].URL.String())
+
+	fields := fieldMap(resp)
+	assert.Equal(t, "example.com", fields["Domain"])
+	assert.Contains(t, fields["Registered"], "1995-08-14")
+	assert.Equal(t, "2030-08-13", fields["Expires"])
+	assert.Equal(t, "Example Registrar, Inc.", fields["Registrar"])
+
+	t.Run("not found", func(t *testing.T) {
+		httpClient := &mock.HTTPClient{
+			RespCode: http.StatusNotFound,
+			RespBody: ioutil.NopCloser(strings.NewReader("")),
+		}
+		resp, err := enrich.NewRDAP(httpClient, "").Enrich(context.Background(),
+			&retrospector.Value{Data: "example.invalid", Type: retrospector.ValueDomainName})
+		require.NoError(t, err)
+		assert.Nil(t, resp)
+	})
+}
+
+type fakeResolver map[string][]string
+
+func (x fakeResolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	names, ok := x[addr]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: addr, IsNotFound: true}
+	}
+	return names, nil
+}
+
+func TestReverseDNS(t *testing.T) {
+	rdns := enrich.NewReverseDNS(fakeResolver{"192.0.2.1": {"host1.example.com."}})
+
+	resp, err := rdns.Enrich(context.Background(), &retrospector.Value{Data: "192.0.2.1", Type: retrospector.ValueIPAddr})
+	require.NoError(t, err)
+	require.NotNil(t, resp)
+	assert.Equal(t, "host1.example.com", fieldMap(resp)["PTR"])
+
+	resp, err = rdns.Enrich(context.Background(), &retrospector.Value{Data: "192.0.2.2", Type: retrospector.ValueIPAddr})
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+}
@@ -0,0 +1,122 @@
+package enrich
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/cookpad/retrospector"
+	"github.com/cookpad/retrospector/pkg/service"
+	"github.com/m-mizutani/golambda"
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// MaxMindDB is interface of *maxminddb.Reader
+type MaxMindDB interface {
+	Lookup(ip net.IP, result interface{}) error
+}
+
+var maxMindDBCache = struct {
+	sync.Mutex
+	readers map[string]*maxminddb.Reader
+}{readers: make(map[string]*maxminddb.Reader)}
+
+// OpenMaxMindDB opens MaxMind DB file such as GeoLite2-City.mmdb. The reader is kept open and shared in the process.
+func OpenMaxMindDB(path string) (MaxMindDB, error) {
+	maxMindDBCache.Lock()
+	defer maxMindDBCache.Unlock()
+
+	if reader, ok := maxMindDBCache.readers[path]; ok {
+		return reader, nil
+	}
+
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, golambda.WrapError(err, "Failed to open MaxMind DB").With("path", path)
+	}
+	maxMindDBCache.readers[path] = reader
+	return reader, nil
+}
+
+// GeoIP is enricher of country and city of IP address by GeoIP2/GeoLite2 City or Country database
+type GeoIP struct {
+	db MaxMindDB
+}
+
+// NewGeoIP is constructor of GeoIP
+func NewGeoIP(db MaxMindDB) *GeoIP {
+	return &GeoIP{db: db}
+}
+
+// Name returns "GeoIP"
+func (x *GeoIP) Name() string { return "GeoIP" }
+
+type geoIPRecord struct {
+	Country struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+}
+
+// Enrich looks up country and city of IP address. Domain name is not supported.
+func (x *GeoIP) Enrich(ctx context.Context, value *retrospector.Value) (*service.Enrichment, error) {
+	ip, _ := hostOf(value)
+	if ip == nil {
+		return nil, nil
+	}
+
+	var record geoIPRecord
+	if err := x.db.Lookup(ip, &record); err != nil {
+		return nil, golambda.WrapError(err, "Failed to lookup GeoIP").With("ip", ip.String())
+	}
+
+	enrichment := &service.Enrichment{}
+	if record.Country.ISOCode != "" {
+		enrichment.Add("Country", fmt.Sprintf("%s (%s)", record.Country.Names["en"], record.Country.ISOCode))
+	}
+	enrichment.Add("City", record.City.Names["en"])
+	return enrichment, nil
+}
+
+// ASN is enricher of autonomous system of IP address by GeoIP2/GeoLite2 ASN database
+type ASN struct {
+	db MaxMindDB
+}
+
+// NewASN is constructor of ASN
+func NewASN(db MaxMindDB) *ASN {
+	return &ASN{db: db}
+}
+
+// Name returns "ASN"
+func (x *ASN) Name() string { return "ASN" }
+
+type asnRecord struct {
+	Number       uint   `maxminddb:"autonomous_system_number"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
+
+// Enrich looks up AS number and organization of IP address. Domain name is not supported.
+func (x *ASN) Enrich(ctx context.Context, value *retrospector.Value) (*service.Enrichment, error) {
+	ip, _ := hostOf(value)
+	if ip == nil {
+		return nil, nil
+	}
+
+	var record asnRecord
+	if err := x.db.Lookup(ip, &record); err != nil {
+		return nil, golambda.WrapError(err, "Failed to lookup ASN").With("ip", ip.String())
+	}
+	if record.Number == 0 {
+		return nil, nil
+	}
+
+	enrichment := &service.Enrichment{}
+	enrichment.Add("AS", fmt.Sprintf("AS%d", record.Number))
+	enrichment.Add("Organization", record.Organization)
+	return enrichment, nil
+}
@@ -0,0 +1,71 @@
+package enrich
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/cookpad/retrospector"
+	"github.com/cookpad/retrospector/pkg/adaptor"
+)
+
+// GreyNoise is ReputationSource of GreyNoise Community API. Only IP address is supported.
+// https://docs.greynoise.io/reference/get_v3-community-ip
+type GreyNoise struct {
+	client  adaptor.HTTPClient
+	apiKey  string
+	baseURL string
+}
+
+// GreyNoiseRateLimit is requests per minute for GreyNoise Community API
+const GreyNoiseRateLimit = 10
+
+// NewGreyNoise is constructor of GreyNoise
+func NewGreyNoise(client adaptor.HTTPClient, apiKey string) *GreyNoise {
+	return &GreyNoise{
+		client:  client,
+		apiKey:  apiKey,
+		baseURL: "https://api.greynoise.io/v3/community",
+	}
+}
+
+// Name returns "GreyNoise"
+func (x *GreyNoise) Name() string { return "GreyNoise" }
+
+type greyNoiseResponse struct {
+	Noise          bool   `json:"noise"`
+	RIOT           bool   `json:"riot"`
+	Classification string `json:"classification"`
+	Name           string `json:"name"`
+	LastSeen       string `json:"last_seen"`
+}
+
+// Check looks up classification of IP address. IP address of common business services (RIOT) is benign.
+func (x *GreyNoise) Check(ctx context.Context, value *retrospector.Value) (*retrospector.Reputation, error) {
+	ip, _ := hostOf(value)
+	if ip == nil || value.Type != retrospector.ValueIPAddr {
+		return nil, nil
+	}
+
+	var resp greyNoiseResponse
+	found, err := getJSON(ctx, x.client, x.baseURL+"/"+ip.String(), http.Header{"key": {x.apiKey}}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return &retrospector.Reputation{Verdict: retrospector.VerdictUnknown, Detail: "not observed"}, nil
+	}
+
+	rep := &retrospector.Reputation{
+		Verdict: retrospector.VerdictUnknown,
+		Detail: fmt.Sprintf("classification:%s, name:%s, noise:%v, riot:%v",
+			resp.Classification, resp.Name, resp.Noise, resp.RIOT),
+	}
+	switch {
+	case resp.Classification == "malicious":
+		rep.Verdict = retrospector.VerdictMalicious
+	case resp.RIOT || resp.Classification == "benign":
+		rep.Verdict = retrospector.VerdictBenign
+	}
+	return rep, nil
+}
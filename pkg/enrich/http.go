@@ -0,0 +1,45 @@
+package enrich
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/cookpad/retrospector/pkg/adaptor"
+	"github.com/m-mizutani/golambda"
+)
+
+// getJSON sends GET request and decodes JSON response to out. It returns false if the resource is not found.
+func getJSON(ctx context.Context, client adaptor.HTTPClient, url string, header http.Header, out interface{}) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return false, golambda.WrapError(err, "Failed to create request").With("url", url)
+	}
+	for key, values := range header {
+		for _, v := range values {
+			req.Header.Add(key, v)
+		}
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, golambda.WrapError(err, "Failed HTTP request").With("url", url)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return false, golambda.NewError("Unexpected HTTP status").With("url", url).
+			With("code", resp.StatusCode).With("body", string(body))
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return false, golambda.WrapError(err, "Failed to decode JSON response").With("url", url)
+	}
+	return true, nil
+}
@@ -0,0 +1,138 @@
+package enrich
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cookpad/retrospector"
+	"github.com/cookpad/retrospector/pkg/adaptor"
+	"github.com/cookpad/retrospector/pkg/service"
+	"github.com/m-mizutani/golambda"
+	"golang.org/x/net/publicsuffix"
+)
+
+// DefaultRDAPBaseURL is bootstrap service of RDAP that redirects to RDAP server of each TLD
+const DefaultRDAPBaseURL = "https://rdap.org"
+
+// RDAP is enricher of registration date (domain age) and registrar of domain name by RDAP, successor of WHOIS
+type RDAP struct {
+	client  adaptor.HTTPClient
+	baseURL string
+	now     func() time.Time
+}
+
+// NewRDAP is constructor of RDAP. DefaultRDAPBaseURL is used if baseURL is empty.
+func NewRDAP(client adaptor.HTTPClient, baseURL string) *RDAP {
+	if baseURL == "" {
+		baseURL = DefaultRDAPBaseURL
+	}
+	return &RDAP{
+		client:  client,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		now:     time.Now,
+	}
+}
+
+// Name returns "RDAP"
+func (x *RDAP) Name() string { return "RDAP" }
+
+type rdapDomain struct {
+	Events []struct {
+		Action string `json:"eventAction"`
+		Date   string `json:"eventDate"`
+	} `json:"events"`
+	Entities []struct {
+		Roles      []string      `json:"roles"`
+		VCardArray []interface{} `json:"vcardArray"`
+	} `json:"entities"`
+}
+
+// vcardName returns "fn" property of jCard: ["vcard", [["fn", {}, "text", "Name"], ...]]
+func vcardName(vcard []interface{}) string {
+	if len(vcard) < 2 {
+		return ""
+	}
+	props, ok := vcard[1].([]interface{})
+	if !ok {
+		return ""
+	}
+	for _, p := range props {
+		prop, ok := p.([]interface{})
+		if !ok || len(prop) < 4 || prop[0] != "fn" {
+			continue
+		}
+		if name, ok := prop[3].(string); ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// Enrich queries RDAP for registered domain of the value. IP address is not supported.
+func (x *RDAP) Enrich(ctx context.Context, value *retrospector.Value) (*service.Enrichment, error) {
+	_, domain := hostOf(value)
+	if domain == "" {
+		return nil, nil
+	}
+	registered, err := publicsuffix.EffectiveTLDPlusOne(strings.ToLower(domain))
+	if err != nil {
+		return nil, nil // Not a registrable domain such as TLD itself
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", x.baseURL+"/domain/"+registered, nil)
+	if err != nil {
+		return nil, golambda.WrapError(err, "Failed to create RDAP request").With("domain", registered)
+	}
+	req.Header.Set("Accept", "application/rdap+json")
+
+	resp, err := x.client.Do(req)
+	if err != nil {
+		return nil, golambda.WrapError(err, "Failed RDAP request").With("domain", registered)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, golambda.NewError("RDAP server error").With("domain", registered).
+			With("code", resp.StatusCode).With("body", string(body))
+	}
+
+	var domainResp rdapDomain
+	if err := json.NewDecoder(resp.Body).Decode(&domainResp); err != nil {
+		return nil, golambda.WrapError(err, "Failed to decode RDAP response").With("domain", registered)
+	}
+
+	enrichment := &service.Enrichment{}
+	enrichment.Add("Domain", registered)
+	for _, event := range domainResp.Events {
+		ts, err := time.Parse(time.RFC3339, event.Date)
+		if err != nil {
+			continue
+		}
+
+		switch event.Action {
+		case "registration":
+			days := int(x.now().Sub(ts).Hours() / 24)
+			enrichment.Add("Registered", fmt.Sprintf("%s (%d days ago)", ts.Format("2006-01-02"), days))
+		case "expiration":
+			enrichment.Add("Expires", ts.Format("2006-01-02"))
+		}
+	}
+	for _, entity := range domainResp.Entities {
+		for _, role := range entity.Roles {
+			if role == "registrar" {
+				enrichment.Add("Registrar", vcardName(entity.VCardArray))
+			}
+		}
+	}
+
+	return enrichment, nil
+}
@@ -0,0 +1,59 @@
+package enrich
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/cookpad/retrospector"
+	"github.com/cookpad/retrospector/pkg/service"
+	"github.com/m-mizutani/golambda"
+)
+
+// Resolver is interface of *net.Resolver for reverse lookup
+type Resolver interface {
+	LookupAddr(ctx context.Context, addr string) ([]string, error)
+}
+
+// ReverseDNS is enricher of PTR record of IP address
+type ReverseDNS struct {
+	resolver Resolver
+}
+
+// NewReverseDNS is constructor of ReverseDNS. net.DefaultResolver is used if resolver is nil.
+func NewReverseDNS(resolver Resolver) *ReverseDNS {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	return &ReverseDNS{resolver: resolver}
+}
+
+// Name returns "Reverse DNS"
+func (x *ReverseDNS) Name() string { return "Reverse DNS" }
+
+// Enrich looks up PTR record of IP address. Domain name is not supported.
+func (x *ReverseDNS) Enrich(ctx context.Context, value *retrospector.Value) (*service.Enrichment, error) {
+	ip, _ := hostOf(value)
+	if ip == nil {
+		return nil, nil
+	}
+
+	names, err := x.resolver.LookupAddr(ctx, ip.String())
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return nil, nil
+		}
+		return nil, golambda.WrapError(err, "Failed reverse DNS lookup").With("ip", ip.String())
+	}
+
+	var hosts []string
+	for _, name := range names {
+		hosts = append(hosts, strings.TrimSuffix(name, "."))
+	}
+
+	enrichment := &service.Enrichment{}
+	enrichment.Add("PTR", strings.Join(hosts, ", "))
+	return enrichment, nil
+}
@@ -0,0 +1,147 @@
+package enrich
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cookpad/retrospector"
+	"github.com/cookpad/retrospector/pkg/service"
+)
+
+// ReputationSource queries reputation service such as VirusTotal. Check returns nil if the service does not support the value type.
+type ReputationSource interface {
+	Name() string
+	Check(ctx context.Context, value *retrospector.Value) (*retrospector.Reputation, error)
+}
+
+// DefaultReputationCacheTTL is period to reuse reputation cached in repository
+const DefaultReputationCacheTTL = time.Hour * 24
+
+// Reputation is enricher that converts result of ReputationSource to enrichment with verdict. Results are cached in repository and requests to the service are rate limited.
+type Reputation struct {
+	source   ReputationSource
+	repo     *service.RepositoryService
+	limiter  *RateLimiter
+	cacheTTL time.Duration
+	now      func() time.Time
+}
+
+// NewReputation is constructor of Reputation. repo and limiter are optional.
+func NewReputation(source ReputationSource, repo *service.RepositoryService, limiter *RateLimiter) *Reputation {
+	return &Reputation{
+		source:   source,
+		repo:     repo,
+		limiter:  limiter,
+		cacheTTL: DefaultReputationCacheTTL,
+		now:      time.Now,
+	}
+}
+
+// Name returns name of the reputation source
+func (x *Reputation) Name() string { return x.source.Name() }
+
+// Enrich returns cached reputation if it is fresh, or queries reputation service
+func (x *Reputation) Enrich(ctx context.Context, value *retrospector.Value) (*service.Enrichment, error) {
+	now := x.now()
+
+	if x.repo != nil {
+		cached, err := x.repo.GetReputation(value, x.source.Name())
+		if err != nil {
+			return nil, err
+		}
+		if cached != nil && now.Sub(time.Unix(cached.CheckedAt, 0)) < x.cacheTTL {
+			return toEnrichment(cached), nil
+		}
+	}
+
+	if x.limiter != nil {
+		if err := x.limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	rep, err := x.source.Check(ctx, value)
+	if err != nil {
+		return nil, err
+	}
+	if rep == nil {
+		return nil, nil
+	}
+	rep.Value = *value
+	rep.Source = x.source.Name()
+	rep.CheckedAt = now.Unix()
+
+	if x.repo != nil {
+		if err := x.repo.PutReputation(rep); err != nil {
+			return nil, err
+		}
+	}
+
+	return toEnrichment(rep), nil
+}
+
+func toEnrichment(rep *retrospector.Reputation) *service.Enrichment {
+	enrichment := &service.Enrichment{Verdict: rep.Verdict}
+	enrichment.Add("Score", fmt.Sprintf("%d", rep.Score))
+	enrichment.Add("Detail", rep.Detail)
+	enrichment.Add("CheckedAt", time.Unix(rep.CheckedAt, 0).Format("2006-01-02 15:04:05"))
+	return enrichment
+}
+
+// RateLimiter allows one request per interval. It is shared among goroutines.
+type RateLimiter struct {
+	interval time.Duration
+	mutex    sync.Mutex
+	next     time.Time
+}
+
+// NewRateLimiter returns RateLimiter that allows perMinute requests in a minute. Requests are not limited if perMinute is 0 or less.
+func NewRateLimiter(perMinute int) *RateLimiter {
+	if perMinute <= 0 {
+		return &RateLimiter{}
+	}
+	return &RateLimiter{interval: time.Minute / time.Duration(perMinute)}
+}
+
+// Wait blocks until next request is allowed or ctx is done. A slot is taken only when the request is allowed, so a caller that gives up by ctx does not delay other callers.
+func (x *RateLimiter) Wait(ctx context.Context) error {
+	for {
+		x.mutex.Lock()
+		now := time.Now()
+		if !now.Before(x.next) {
+			x.next = now.Add(x.interval)
+			x.mutex.Unlock()
+			return nil
+		}
+		wait := x.next.Sub(now)
+		x.mutex.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+var sharedRateLimiters = struct {
+	sync.Mutex
+	limiters map[string]*RateLimiter
+}{limiters: make(map[string]*RateLimiter)}
+
+// SharedRateLimiter returns RateLimiter of the name shared in the process to keep rate limit over invocations of warm Lambda function
+func SharedRateLimiter(name string, perMinute int) *RateLimiter {
+	sharedRateLimiters.Lock()
+	defer sharedRateLimiters.Unlock()
+
+	if limiter, ok := sharedRateLimiters.limiters[name]; ok {
+		return limiter
+	}
+	limiter := NewRateLimiter(perMinute)
+	sharedRateLimiters.limiters[name] = limiter
+	return limiter
+}
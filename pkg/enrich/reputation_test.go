@@ -0,0 +1,151 @@
+package enrich_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cookpad/retrospector"
+	"github.com/cookpad/retrospector/pkg/enrich"
+	"github.com/cookpad/retrospector/pkg/mock"
+	"github.com/cookpad/retrospector/pkg/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newHTTPClient(code int, body string) *mock.HTTPClient {
+	return &mock.HTTPClient{
+		RespCode: code,
+		RespBody: ioutil.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func TestVirusTotal(t *testing.T) {
+	client := newHTTPClient(http.StatusOK, `{"data":{"attributes":{"last_analysis_stats":{"harmless":60,"malicious":5,"suspicious":1,"undetected":10}}}}`)
+	rep, err := enrich.NewVirusTotal(client, "vt-key").Check(context.Background(),
+		&retrospector.Value{Data: "example.com", Type: retrospector.ValueDomainName})
+	require.NoError(t, err)
+	require.NotNil(t, rep)
+	assert.Equal(t, retrospector.VerdictMalicious, rep.Verdict)
+	assert.Equal(t, int64(5), rep.Score)
+
+	require.Equal(t, 1, len(client.Requests))
+	assert.Equal(t, "https://www.virustotal.com/api/v3/domains/example.com", client.Requests[0].URL.String())
+	assert.Equal(t, "vt-key", client.Requests[0].Header.Get("x-apikey"))
+}
+
+func TestAbuseIPDB(t *testing.T) {
+	t.Run("malicious", func(t *testing.T) {
+		client := newHTTPClient(http.StatusOK, `{"data":{"isWhitelisted":false,"abuseConfidenceScore":100,"totalReports":42}}`)
+		rep, err := enrich.NewAbuseIPDB(client, "abuse-key").Check(context.Background(),
+			&retrospector.Value{Data: "192.0.2.1", Type: retrospector.ValueIPAddr})
+		require.NoError(t, err)
+		require.NotNil(t, rep)
+		assert.Equal(t, retrospector.VerdictMalicious, rep.Verdict)
+		assert.Equal(t, int64(100), rep.Score)
+		assert.Equal(t, "abuse-key", client.Requests[0].Header.Get("Key"))
+		assert.Equal(t, "192.0.2.1", client.Requests[0].URL.Query().Get("ipAddress"))
+	})
+
+	t.Run("whitelisted", func(t *testing.T) {
+		client := newHTTPClient(http.StatusOK, `{"data":{"isWhitelisted":true,"abuseConfidenceScore":0}}`)
+		rep, err := enrich.NewAbuseIPDB(client, "abuse-key").Check(context.Background(),
+			&retrospector.Value{Data: "192.0.2.1", Type: retrospector.ValueIPAddr})
+		require.NoError(t, err)
+		assert.Equal(t, retrospector.VerdictBenign, rep.Verdict)
+	})
+
+	t.Run("domain is not supported", func(t *testing.T) {
+		client := newHTTPClient(http.StatusOK, `{}`)
+		rep, err := enrich.NewAbuseIPDB(client, "abuse-key").Check(context.Background(),
+			&retrospector.Value{Data: "example.com", Type: retrospector.ValueDomainName})
+		require.NoError(t, err)
+		assert.Nil(t, rep)
+		assert.Equal(t, 0, len(client.Requests))
+	})
+}
+
+func TestGreyNoise(t *testing.T) {
+	client := newHTTPClient(http.StatusOK, `{"ip":"192.0.2.1","noise":false,"riot":true,"classification":"benign","name":"Example CDN"}`)
+	rep, err := enrich.NewGreyNoise(client, "gn-key").Check(context.Background(),
+		&retrospector.Value{Data: "192.0.2.1", Type: retrospector.ValueIPAddr})
+	require.NoError(t, err)
+	require.NotNil(t, rep)
+	assert.Equal(t, retrospector.VerdictBenign, rep.Verdict)
+	assert.Equal(t, "https://api.greynoise.io/v3/community/192.0.2.1", client.Requests[0].URL.String())
+}
+
+type dummySource struct {
+	calls int
+}
+
+func (x *dummySource) Name() string { return "dummy" }
+
+func (x *dummySource) Check(ctx context.Context, value *retrospector.Value) (*retrospector.Reputation, error) {
+	x.calls++
+	return &retrospector.Reputation{Verdict: retrospector.VerdictSuspicious, Score: 7}, nil
+}
+
+func TestReputation(t *testing.T) {
+	repo := service.NewRepositoryService(mock.NewRepository())
+	source := &dummySource{}
+	value := &retrospector.Value{Data: "192.0.2.1", Type: retrospector.ValueIPAddr}
+
+	rep := enrich.NewReputation(source, repo, enrich.NewRateLimiter(600))
+	e1, err := rep.Enrich(context.Background(), value)
+	require.NoError(t, err)
+	require.NotNil(t, e1)
+	assert.Equal(t, retrospector.VerdictSuspicious, e1.Verdict)
+
+	// Result is cached in repository
+	cached, err := repo.GetReputation(value, "dummy")
+	require.NoError(t, err)
+	require.NotNil(t, cached)
+	assert.Equal(t, int64(7), cached.Score)
+
+	e2, err := enrich.NewReputation(source, repo, nil).Enrich(context.Background(), value)
+	require.NoError(t, err)
+	assert.Equal(t, e1, e2)
+	assert.Equal(t, 1, source.calls)
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter := enrich.NewRateLimiter(600) // 100ms interval
+
+	started := time.Now()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, limiter.Wait(context.Background()))
+	}
+	assert.GreaterOrEqual(t, int64(time.Since(started)), int64(time.Millisecond*200))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	limiter.Wait(context.Background())
+	assert.Error(t, limiter.Wait(ctx))
+
+	t.Run("cancelled wait does not delay others", func(t *testing.T) {
+		limiter := enrich.NewRateLimiter(600)
+		require.NoError(t, limiter.Wait(context.Background()))
+		for i := 0; i < 10; i++ {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+			assert.Error(t, limiter.Wait(ctx))
+			cancel()
+		}
+
+		started := time.Now()
+		require.NoError(t, limiter.Wait(context.Background()))
+		assert.Less(t, int64(time.Since(started)), int64(time.Millisecond*150))
+	})
+
+	t.Run("no limit by zero", func(t *testing.T) {
+		limiter := enrich.NewRateLimiter(0)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+		defer cancel()
+		for i := 0; i < 10; i++ {
+			require.NoError(t, limiter.Wait(ctx))
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package enrich
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/cookpad/retrospector"
+	"github.com/cookpad/retrospector/pkg/adaptor"
+)
+
+// VirusTotal is ReputationSource of VirusTotal API v3
+// https://developers.virustotal.com/reference/overview
+type VirusTotal struct {
+	client  adaptor.HTTPClient
+	apiKey  string
+	baseURL string
+}
+
+// VirusTotalRateLimit is requests per minute of VirusTotal public API
+const VirusTotalRateLimit = 4
+
+// virusTotalMaliciousThreshold is number of engines to judge a value malicious
+const virusTotalMaliciousThreshold = 3
+
+// NewVirusTotal is constructor of VirusTotal
+func NewVirusTotal(client adaptor.HTTPClient, apiKey string) *VirusTotal {
+	return &VirusTotal{
+		client:  client,
+		apiKey:  apiKey,
+		baseURL: "https://www.virustotal.com/api/v3",
+	}
+}
+
+// Name returns "VirusTotal"
+func (x *VirusTotal) Name() string { return "VirusTotal" }
+
+type virusTotalResponse struct {
+	Data struct {
+		Attributes struct {
+			LastAnalysisStats struct {
+				Harmless   int64 `json:"harmless"`
+				Malicious  int64 `json:"malicious"`
+				Suspicious int64 `json:"suspicious"`
+				Undetected int64 `json:"undetected"`
+			} `json:"last_analysis_stats"`
+			Reputation int64 `json:"reputation"`
+		} `json:"attributes"`
+	} `json:"data"`
+}
+
+// Check looks up analysis stats of the value. Score is number of engines that detected the value as malicious.
+func (x *VirusTotal) Check(ctx context.Context, value *retrospector.Value) (*retrospector.Reputation, error) {
+	var path string
+	switch value.Type {
+	case retrospector.ValueIPAddr:
+		path = "/ip_addresses/" + url.PathEscape(value.Data)
+	case retrospector.ValueDomainName:
+		path = "/domains/" + url.PathEscape(value.Data)
+	case retrospector.ValueURL:
+		path = "/urls/" + base64.RawURLEncoding.EncodeToString([]byte(value.Data))
+	case retrospector.ValueFileHashSha256, retrospector.ValueFileHashSha1, retrospector.ValueFileHashMD5:
+		path = "/files/" + url.PathEscape(value.Data)
+	default:
+		return nil, nil
+	}
+
+	var resp virusTotalResponse
+	found, err := getJSON(ctx, x.client, x.baseURL+path, http.Header{"x-apikey": {x.apiKey}}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return &retrospector.Reputation{Verdict: retrospector.VerdictUnknown, Detail: "not found"}, nil
+	}
+
+	stats := resp.Data.Attributes.LastAnalysisStats
+	rep := &retrospector.Reputation{
+		Verdict: retrospector.VerdictUnknown,
+		Score:   stats.Malicious,
+		Detail: fmt.Sprintf("malicious:%d, suspicious:%d, harmless:%d, undetected:%d",
+			stats.Malicious, stats.Suspicious, stats.Harmless, stats.Undetected),
+	}
+	switch {
+	case stats.Malicious >= virusTotalMaliciousThreshold:
+		rep.Verdict = retrospector.VerdictMalicious
+	case stats.Malicious > 0 || stats.Suspicious > 0:
+		rep.Verdict = retrospector.VerdictSuspicious
+	}
+	return rep, nil
+}
@@ -0,0 +1,180 @@
+package extractor
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/cookpad/retrospector"
+	"github.com/m-mizutani/golambda"
+)
+
+// Config is per-source mapping from fields of raw log record to entities
+type Config struct {
+	// Source is Entity.Source of extracted entities
+	Source string `json:"source"`
+	// Fields is map of JSONPath and value type of the field
+	Fields map[string]retrospector.ValueType `json:"fields"`
+	// TextFields is list of JSONPath of free text fields. IP addresses, domain names, URLs and file hashes are extracted automatically from them.
+	TextFields []string `json:"text_fields"`
+	// Subject is JSONPath of Entity.Subject
+	Subject string `json:"subject"`
+	// Timestamp is JSONPath of Entity.RecordedAt
+	Timestamp string `json:"timestamp"`
+	// TimeFormat is format of Timestamp. See ParseTime
+	TimeFormat string `json:"time_format"`
+	// Description is JSONPath of Entity.Description
+	Description string `json:"description"`
+}
+
+type fieldPath struct {
+	path      *Path
+	valueType retrospector.ValueType
+}
+
+// Extractor converts raw log record to entities by Config
+type Extractor struct {
+	source      string
+	fields      []*fieldPath
+	textFields  []*Path
+	subject     *Path
+	timestamp   *Path
+	timeFormat  string
+	description *Path
+}
+
+func compileOptionalPath(raw string) (*Path, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	return CompilePath(raw)
+}
+
+// New compiles Config to Extractor
+func New(config *Config) (*Extractor, error) {
+	x := &Extractor{
+		source:     config.Source,
+		timeFormat: config.TimeFormat,
+	}
+
+	// Sort fields to keep order of extracted entities stable
+	var fieldKeys []string
+	for raw := range config.Fields {
+		fieldKeys = append(fieldKeys, raw)
+	}
+	sort.Strings(fieldKeys)
+
+	for _, raw := range fieldKeys {
+		p, err := CompilePath(raw)
+		if err != nil {
+			return nil, err
+		}
+		x.fields = append(x.fields, &fieldPath{path: p, valueType: config.Fields[raw]})
+	}
+	for _, raw := range config.TextFields {
+		p, err := CompilePath(raw)
+		if err != nil {
+			return nil, err
+		}
+		x.textFields = append(x.textFields, p)
+	}
+
+	var err error
+	if x.subject, err = compileOptionalPath(config.Subject); err != nil {
+		return nil, err
+	}
+	if x.timestamp, err = compileOptionalPath(config.Timestamp); err != nil {
+		return nil, err
+	}
+	if x.description, err = compileOptionalPath(config.Description); err != nil {
+		return nil, err
+	}
+
+	return x, nil
+}
+
+func firstString(p *Path, record interface{}) string {
+	if p == nil {
+		return ""
+	}
+	if values := p.GetStrings(record); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// Extract returns entities in a record decoded by encoding/json. Same value is returned only once in a record.
+func (x *Extractor) Extract(record interface{}) ([]*retrospector.Entity, error) {
+	var recordedAt int64
+	if ts := firstString(x.timestamp, record); ts != "" {
+		t, err := ParseTime(x.timeFormat, ts)
+		if err != nil {
+			return nil, err
+		}
+		recordedAt = t
+	}
+	subject := firstString(x.subject, record)
+	description := firstString(x.description, record)
+
+	var entities []*retrospector.Entity
+	seen := make(map[retrospector.Value]struct{})
+	add := func(value retrospector.Value) {
+		if _, ok := seen[value]; ok {
+			return
+		}
+		seen[value] = struct{}{}
+		entities = append(entities, &retrospector.Entity{
+			Value:       value,
+			Source:      x.source,
+			Subject:     subject,
+			RecordedAt:  recordedAt,
+			Description: description,
+		})
+	}
+
+	for _, f := range x.fields {
+		for _, data := range f.path.GetStrings(record) {
+			add(retrospector.Value{Data: data, Type: f.valueType})
+		}
+	}
+	for _, p := range x.textFields {
+		for _, text := range p.GetStrings(record) {
+			for _, value := range ExtractText(text) {
+				add(value)
+			}
+		}
+	}
+
+	return entities, nil
+}
+
+// ParseTime converts timestamp string to unix seconds. format is "unix", "unixms" or layout of time.Parse. Unix seconds or RFC3339 is accepted if format is empty.
+func ParseTime(format, ts string) (int64, error) {
+	switch format {
+	case "unix":
+		v, err := strconv.ParseFloat(ts, 64)
+		if err != nil {
+			return 0, golambda.WrapError(err, "Invalid unix timestamp").With("ts", ts)
+		}
+		return int64(v), nil
+
+	case "unixms":
+		v, err := strconv.ParseFloat(ts, 64)
+		if err != nil {
+			return 0, golambda.WrapError(err, "Invalid unix milliseconds timestamp").With("ts", ts)
+		}
+		return int64(v / 1000), nil
+
+	case "":
+		if v, err := strconv.ParseFloat(ts, 64); err == nil {
+			return int64(v), nil
+		}
+		format = time.RFC3339Nano
+	}
+
+	t, err := time.Parse(format, ts)
+	if err != nil {
+		return 0, golambda.WrapError(err, "Failed to parse timestamp").With("ts", ts).With("format", format)
+	}
+	return t.Unix(), nil
+}
@@ -0,0 +1,142 @@
+package extractor_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/cookpad/retrospector"
+	"github.com/cookpad/retrospector/pkg/extractor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decode(t *testing.T, raw string) interface{} {
+	var record interface{}
+	require.NoError(t, json.Unmarshal([]byte(raw), &record))
+	return record
+}
+
+func TestPath(t *testing.T) {
+	record := decode(t, `{
+		"a": {"b": "blue", "c.d": "orange"},
+		"list": [{"ip": "10.0.0.1"}, {"ip": "10.0.0.2"}],
+		"num": 1606816800,
+		"tags": ["x", "y"]
+	}`)
+
+	testCases := []struct {
+		path   string
+		expect []string
+	}{
+		{"$.a.b", []string{"blue"}},
+		{"a.b", []string{"blue"}},
+		{`a["c.d"]`, []string{"orange"}},
+		{"list[0].ip", []string{"10.0.0.1"}},
+		{"list[-1].ip", []string{"10.0.0.2"}},
+		{"list[*].ip", []string{"10.0.0.1", "10.0.0.2"}},
+		{"num", []string{"1606816800"}},
+		{"tags", []string{"x", "y"}},
+		{"a.missing", nil},
+		{"list[5].ip", nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			p, err := extractor.CompilePath(tc.path)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expect, p.GetStrings(record))
+		})
+	}
+
+	t.Run("invalid path", func(t *testing.T) {
+		_, err := extractor.CompilePath("a[0")
+		assert.Error(t, err)
+		_, err = extractor.CompilePath("a[x]")
+		assert.Error(t, err)
+		_, err = extractor.CompilePath("$")
+		assert.Error(t, err)
+	})
+}
+
+func TestExtractText(t *testing.T) {
+	text := "Blocked https://Evil.example.com/path/a.php?x=1, from 192.0.2.10 and 2001:db8::1 " +
+		"resolving bad.example.org; wrote config.json with hash " +
+		"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855 " +
+		"and d41d8cd98f00b204e9800998ecf8427e version 1.2.3"
+
+	values := extractor.ExtractText(text)
+	assert.Contains(t, values, retrospector.Value{Data: "https://Evil.example.com/path/a.php?x=1", Type: retrospector.ValueURL})
+	assert.Contains(t, values, retrospector.Value{Data: "evil.example.com", Type: retrospector.ValueDomainName})
+	assert.Contains(t, values, retrospector.Value{Data: "192.0.2.10", Type: retrospector.ValueIPAddr})
+	assert.Contains(t, values, retrospector.Value{Data: "2001:db8::1", Type: retrospector.ValueIPAddr})
+	assert.Contains(t, values, retrospector.Value{Data: "bad.example.org", Type: retrospector.ValueDomainName})
+	assert.Contains(t, values, retrospector.Value{Data: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", Type: retrospector.ValueFileHashSha256})
+	assert.Contains(t, values, retrospector.Value{Data: "d41d8cd98f00b204e9800998ecf8427e", Type: retrospector.ValueFileHashMD5})
+	assert.Equal(t, 7, len(values))
+}
+
+func TestExtractor(t *testing.T) {
+	ext, err := extractor.New(&extractor.Config{
+		Source: "proxy",
+		Fields: map[string]retrospector.ValueType{
+			"$.dst.host":   retrospector.ValueDomainName,
+			"$.dst.ips[*]": retrospector.ValueIPAddr,
+		},
+		TextFields:  []string{"$.message"},
+		Subject:     "$.src.user",
+		Timestamp:   "$.time",
+		TimeFormat:  "2006-01-02 15:04:05",
+		Description: "$.action",
+	})
+	require.NoError(t, err)
+
+	record := decode(t, `{
+		"time": "2020-12-01 10:00:00",
+		"src": {"user": "blue"},
+		"dst": {"host": "example.com", "ips": ["192.0.2.1", "192.0.2.2"]},
+		"action": "allow",
+		"message": "connected to example.com (192.0.2.1) after redirect from http://other.example.net/"
+	}`)
+
+	entities, err := ext.Extract(record)
+	require.NoError(t, err)
+
+	var values []retrospector.Value
+	for _, entity := range entities {
+		values = append(values, entity.Value)
+		assert.Equal(t, "proxy", entity.Source)
+		assert.Equal(t, "blue", entity.Subject)
+		assert.Equal(t, "allow", entity.Description)
+		assert.Equal(t, time.Date(2020, 12, 1, 10, 0, 0, 0, time.UTC).Unix(), entity.RecordedAt)
+	}
+
+	assert.Equal(t, 5, len(values))
+	assert.Contains(t, values, retrospector.Value{Data: "example.com", Type: retrospector.ValueDomainName})
+	assert.Contains(t, values, retrospector.Value{Data: "192.0.2.1", Type: retrospector.ValueIPAddr})
+	assert.Contains(t, values, retrospector.Value{Data: "192.0.2.2", Type: retrospector.ValueIPAddr})
+	assert.Contains(t, values, retrospector.Value{Data: "http://other.example.net/", Type: retrospector.ValueURL})
+	assert.Contains(t, values, retrospector.Value{Data: "other.example.net", Type: retrospector.ValueDomainName})
+
+	t.Run("invalid timestamp", func(t *testing.T) {
+		_, err := ext.Extract(decode(t, `{"time": "yesterday"}`))
+		assert.Error(t, err)
+	})
+}
+
+func TestParseTime(t *testing.T) {
+	ts, err := extractor.ParseTime("", "1606816800")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1606816800), ts)
+
+	ts, err = extractor.ParseTime("", "2020-12-01T10:00:00Z")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1606816800), ts)
+
+	ts, err = extractor.ParseTime("unixms", "1606816800123")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1606816800), ts)
+
+	_, err = extractor.ParseTime("unix", "x")
+	assert.Error(t, err)
+}
@@ -0,0 +1,147 @@
+package extractor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/m-mizutani/golambda"
+)
+
+// Path is compiled subset of JSONPath. Supported syntax is:
+//   - $.a.b (leading "$." is optional)
+//   - a[0], a[*] for array
+//   - a["key.with.dot"] or a['key'] for key including special characters
+type Path struct {
+	raw   string
+	steps []pathStep
+}
+
+type pathStep struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// CompilePath parses JSONPath string
+func CompilePath(raw string) (*Path, error) {
+	p := strings.TrimPrefix(strings.TrimPrefix(raw, "$"), ".")
+	path := &Path{raw: raw}
+
+	for len(p) > 0 {
+		switch p[0] {
+		case '.':
+			p = p[1:]
+
+		case '[':
+			end := strings.IndexByte(p, ']')
+			if end < 0 {
+				return nil, golambda.NewError("Unclosed bracket in path").With("path", raw)
+			}
+			inner := p[1:end]
+			p = p[end+1:]
+
+			switch {
+			case inner == "*":
+				path.steps = append(path.steps, pathStep{wildcard: true})
+			case len(inner) >= 2 && (inner[0] == '"' || inner[0] == '\'') && inner[len(inner)-1] == inner[0]:
+				path.steps = append(path.steps, pathStep{key: inner[1 : len(inner)-1]})
+			default:
+				idx, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, golambda.WrapError(err, "Invalid index in path").With("path", raw)
+				}
+				path.steps = append(path.steps, pathStep{index: idx, isIndex: true})
+			}
+
+		default:
+			end := strings.IndexAny(p, ".[")
+			if end < 0 {
+				end = len(p)
+			}
+			path.steps = append(path.steps, pathStep{key: p[:end]})
+			p = p[end:]
+		}
+	}
+
+	if len(path.steps) == 0 {
+		return nil, golambda.NewError("Empty path").With("path", raw)
+	}
+	return path, nil
+}
+
+// String returns original path string
+func (x *Path) String() string { return x.raw }
+
+// Get returns all values matched with the path in record decoded by encoding/json
+func (x *Path) Get(record interface{}) []interface{} {
+	current := []interface{}{record}
+	for _, step := range x.steps {
+		var next []interface{}
+		for _, v := range current {
+			switch {
+			case step.wildcard:
+				switch t := v.(type) {
+				case []interface{}:
+					next = append(next, t...)
+				case map[string]interface{}:
+					for _, child := range t {
+						next = append(next, child)
+					}
+				}
+
+			case step.isIndex:
+				if arr, ok := v.([]interface{}); ok {
+					idx := step.index
+					if idx < 0 {
+						idx += len(arr)
+					}
+					if 0 <= idx && idx < len(arr) {
+						next = append(next, arr[idx])
+					}
+				}
+
+			default:
+				if obj, ok := v.(map[string]interface{}); ok {
+					if child, ok := obj[step.key]; ok {
+						next = append(next, child)
+					}
+				}
+			}
+		}
+		current = next
+	}
+
+	return current
+}
+
+// GetStrings returns string representation of scalar values matched with the path. Array in the last step is flattened.
+func (x *Path) GetStrings(record interface{}) []string {
+	var results []string
+	var appendValue func(v interface{})
+	appendValue = func(v interface{}) {
+		switch t := v.(type) {
+		case nil:
+		case string:
+			if t != "" {
+				results = append(results, t)
+			}
+		case float64:
+			results = append(results, strconv.FormatFloat(t, 'f', -1, 64))
+		case bool:
+			results = append(results, strconv.FormatBool(t))
+		case []interface{}:
+			for _, child := range t {
+				appendValue(child)
+			}
+		default:
+			results = append(results, fmt.Sprintf("%v", t))
+		}
+	}
+
+	for _, v := range x.Get(record) {
+		appendValue(v)
+	}
+	return results
+}
@@ -0,0 +1,103 @@
+package extractor
+
+import (
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/cookpad/retrospector"
+)
+
+var (
+	urlPattern    = regexp.MustCompile(`\bhttps?://[^\s"'<>\\]+`)
+	ipv4Pattern   = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+	ipv6Pattern   = regexp.MustCompile(`\b[0-9a-fA-F]{0,4}(?::[0-9a-fA-F]{0,4}){2,7}\b`)
+	domainPattern = regexp.MustCompile(`\b(?:[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?\.)+[a-zA-Z][a-zA-Z0-9-]{0,61}[a-zA-Z0-9]\b`)
+	hashPattern   = regexp.MustCompile(`\b[a-fA-F0-9]{32,64}\b`)
+)
+
+// notTLD is list of file extensions that look like domain name in free text (e.g. "config.json")
+var notTLD = map[string]struct{}{
+	"bak": {}, "bat": {}, "bin": {}, "c": {}, "cfg": {}, "conf": {}, "css": {}, "csv": {},
+	"dat": {}, "dll": {}, "doc": {}, "docx": {}, "exe": {}, "gif": {}, "go": {}, "gz": {},
+	"h": {}, "html": {}, "ini": {}, "jar": {}, "java": {}, "jpeg": {}, "jpg": {}, "js": {},
+	"json": {}, "log": {}, "md": {}, "php": {}, "png": {}, "ps1": {}, "py": {}, "rb": {},
+	"sh": {}, "so": {}, "svg": {}, "tar": {}, "tmp": {}, "ts": {}, "txt": {}, "xls": {},
+	"xlsx": {}, "xml": {}, "yaml": {}, "yml": {}, "zip": {},
+}
+
+func isDomainName(v string) bool {
+	labels := strings.Split(v, ".")
+	tld := strings.ToLower(labels[len(labels)-1])
+	if _, ok := notTLD[tld]; ok {
+		return false
+	}
+	// TLD must not be numeric only
+	for _, c := range tld {
+		if c < '0' || '9' < c {
+			return true
+		}
+	}
+	return false
+}
+
+// ExtractText finds IP addresses, domain names, URLs and file hashes in free text. Each value is returned only once.
+func ExtractText(text string) []retrospector.Value {
+	var values []retrospector.Value
+	seen := make(map[retrospector.Value]struct{})
+	add := func(data string, valueType retrospector.ValueType) {
+		v := retrospector.Value{Data: data, Type: valueType}
+		if _, ok := seen[v]; ok {
+			return
+		}
+		seen[v] = struct{}{}
+		values = append(values, v)
+	}
+
+	// Remove URLs from text after extraction to avoid extracting path of URL as domain name
+	rest := urlPattern.ReplaceAllStringFunc(text, func(s string) string {
+		s = strings.TrimRight(s, ".,;:)]}")
+		add(s, retrospector.ValueURL)
+		if u, err := url.Parse(s); err == nil && u.Hostname() != "" {
+			host := strings.ToLower(u.Hostname())
+			if net.ParseIP(host) != nil {
+				add(host, retrospector.ValueIPAddr)
+			} else {
+				add(host, retrospector.ValueDomainName)
+			}
+		}
+		return " "
+	})
+
+	for _, s := range ipv4Pattern.FindAllString(rest, -1) {
+		if net.ParseIP(s) != nil {
+			add(s, retrospector.ValueIPAddr)
+		}
+	}
+	for _, s := range ipv6Pattern.FindAllString(rest, -1) {
+		if strings.Count(s, ":") >= 2 && net.ParseIP(s) != nil {
+			add(net.ParseIP(s).String(), retrospector.ValueIPAddr)
+		}
+	}
+
+	rest = ipv4Pattern.ReplaceAllString(rest, " ")
+	for _, s := range domainPattern.FindAllString(rest, -1) {
+		if isDomainName(s) {
+			add(strings.ToLower(s), retrospector.ValueDomainName)
+		}
+	}
+
+	for _, s := range hashPattern.FindAllString(rest, -1) {
+		switch len(s) {
+		case 64:
+			add(strings.ToLower(s), retrospector.ValueFileHashSha256)
+		case 40:
+			add(strings.ToLower(s), retrospector.ValueFileHashSha1)
+		case 32:
+			add(strings.ToLower(s), retrospector.ValueFileHashMD5)
+		}
+	}
+
+	return values
+}
@@ -4,6 +4,7 @@ import (
 	"io"
 	"os"
 	"strings"
+	"sync"
 
 	"github.com/rs/zerolog"
 )
@@ -37,6 +38,33 @@ func Init(logLevel string) {
 		writer = os.Stdout
 	}
 
-	logger := zerolog.New(writer).Level(zeroLogLevel).With().Timestamp().Logger()
+	logger := zerolog.New(writer).Level(zeroLogLevel).With().Timestamp().Logger().Hook(correlationHook{})
 	Logger = logger
 }
+
+var (
+	correlationMutex sync.RWMutex
+	correlationID    string
+)
+
+// SetCorrelationID sets ID that ties log lines of the same S3 object, crawler run or invocation. It is added to every log line as "correlation_id" until changed. Empty ID removes it.
+func SetCorrelationID(id string) {
+	correlationMutex.Lock()
+	defer correlationMutex.Unlock()
+	correlationID = id
+}
+
+// CorrelationID returns current correlation ID or empty string if not set
+func CorrelationID() string {
+	correlationMutex.RLock()
+	defer correlationMutex.RUnlock()
+	return correlationID
+}
+
+type correlationHook struct{}
+
+func (x correlationHook) Run(e *zerolog.Event, level zerolog.Level, msg string) {
+	if id := CorrelationID(); id != "" {
+		e.Str("correlation_id", id)
+	}
+}
@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/m-mizutani/golambda"
+)
+
+// DefaultNamespace is CloudWatch namespace of metrics
+const DefaultNamespace = "Retrospector"
+
+// emfMaxValues is max number of values of a metric in one EMF document
+const emfMaxValues = 100
+
+// EMFWriter writes metrics as CloudWatch Embedded Metric Format. Each metric is written as one JSON line to be extracted by CloudWatch Logs.
+type EMFWriter struct {
+	mutex     sync.Mutex
+	out       io.Writer
+	namespace string
+}
+
+// NewEMFWriter is constructor of EMFWriter
+func NewEMFWriter(out io.Writer, namespace string) *EMFWriter {
+	return &EMFWriter{
+		out:       out,
+		namespace: namespace,
+	}
+}
+
+type emfMetricDefinition struct {
+	Name string `json:"Name"`
+	Unit Unit   `json:"Unit"`
+}
+
+type emfDirective struct {
+	Namespace  string                `json:"Namespace"`
+	Dimensions [][]string            `json:"Dimensions"`
+	Metrics    []emfMetricDefinition `json:"Metrics"`
+}
+
+type emfMetadata struct {
+	Timestamp         int64          `json:"Timestamp"`
+	CloudWatchMetrics []emfDirective `json:"CloudWatchMetrics"`
+}
+
+// Write outputs metrics. Values more than 100 are split into multiple documents by EMF limitation.
+func (x *EMFWriter) Write(metrics []*Metric) error {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	ts := time.Now().UnixNano() / int64(time.Millisecond)
+	encoder := json.NewEncoder(x.out)
+
+	for _, metric := range metrics {
+		var dimNames []string
+		for name := range metric.Dimensions {
+			dimNames = append(dimNames, name)
+		}
+		sort.Strings(dimNames)
+
+		for i := 0; i < len(metric.Values); i += emfMaxValues {
+			end := i + emfMaxValues
+			if end > len(metric.Values) {
+				end = len(metric.Values)
+			}
+
+			doc := map[string]interface{}{
+				"_aws": emfMetadata{
+					Timestamp: ts,
+					CloudWatchMetrics: []emfDirective{
+						{
+							Namespace:  x.namespace,
+							Dimensions: [][]string{dimNames},
+							Metrics:    []emfMetricDefinition{{Name: metric.Name, Unit: metric.Unit}},
+						},
+					},
+				},
+			}
+			for k, v := range metric.Dimensions {
+				doc[k] = v
+			}
+			if values := metric.Values[i:end]; len(values) == 1 {
+				doc[metric.Name] = values[0]
+			} else {
+				doc[metric.Name] = values
+			}
+
+			if err := encoder.Encode(doc); err != nil {
+				return golambda.WrapError(err, "Failed to write EMF").With("metric", metric.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// NopWriter discards metrics
+type NopWriter struct{}
+
+// Write does nothing
+func (x *NopWriter) Write(metrics []*Metric) error { return nil }
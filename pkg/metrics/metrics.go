@@ -0,0 +1,195 @@
+package metrics
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cookpad/retrospector/pkg/logging"
+)
+
+var logger = logging.Logger
+
+// Unit of metric value
+type Unit string
+
+const (
+	UnitCount        Unit = "Count"
+	UnitMilliseconds Unit = "Milliseconds"
+)
+
+// Dimensions are names and values that classify a metric, e.g. {"Source": "otx"}
+type Dimensions map[string]string
+
+// Metric is values of a metric recorded since last flush. Count has one value of total and latency has all observed values.
+type Metric struct {
+	Name       string
+	Unit       Unit
+	Dimensions Dimensions
+	Values     []float64
+}
+
+// Writer outputs metrics. It is called by Recorder.Flush.
+type Writer interface {
+	Write(metrics []*Metric) error
+}
+
+// Recorder buffers metrics until Flush. It is safe for concurrent use.
+type Recorder struct {
+	mutex   sync.Mutex
+	writer  Writer
+	dims    Dimensions
+	metrics map[string]*Metric
+	keys    []string
+}
+
+// NewRecorder is constructor of Recorder
+func NewRecorder(writer Writer) *Recorder {
+	return &Recorder{
+		writer:  writer,
+		dims:    Dimensions{},
+		metrics: make(map[string]*Metric),
+	}
+}
+
+// SetWriter replaces writer of the recorder
+func (x *Recorder) SetWriter(writer Writer) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.writer = writer
+}
+
+// SetDimension sets dimension that is added to all metrics, e.g. name of Lambda function
+func (x *Recorder) SetDimension(name, value string) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.dims[name] = value
+}
+
+func metricKey(name string, unit Unit, dims Dimensions) string {
+	var pairs []string
+	for k, v := range dims {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return name + "|" + string(unit) + "|" + strings.Join(pairs, ",")
+}
+
+func (x *Recorder) record(name string, unit Unit, value float64, dims Dimensions, sum bool) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	// Metrics are not buffered if they are discarded anyway
+	if _, ok := x.writer.(*NopWriter); ok {
+		return
+	}
+
+	merged := Dimensions{}
+	for k, v := range x.dims {
+		merged[k] = v
+	}
+	for k, v := range dims {
+		merged[k] = v
+	}
+
+	key := metricKey(name, unit, merged)
+	metric, ok := x.metrics[key]
+	if !ok {
+		metric = &Metric{Name: name, Unit: unit, Dimensions: merged}
+		x.metrics[key] = metric
+		x.keys = append(x.keys, key)
+	}
+
+	if sum && len(metric.Values) > 0 {
+		metric.Values[0] += value
+	} else {
+		metric.Values = append(metric.Values, value)
+	}
+}
+
+// Count adds n to counter metric
+func (x *Recorder) Count(name string, n int, dims Dimensions) {
+	x.record(name, UnitCount, float64(n), dims, true)
+}
+
+// Latency records a duration in milliseconds
+func (x *Recorder) Latency(name string, d time.Duration, dims Dimensions) {
+	x.record(name, UnitMilliseconds, float64(d)/float64(time.Millisecond), dims, false)
+}
+
+// Flush writes buffered metrics in order of first record and clears them
+func (x *Recorder) Flush() error {
+	x.mutex.Lock()
+	var metrics []*Metric
+	for _, key := range x.keys {
+		metrics = append(metrics, x.metrics[key])
+	}
+	x.metrics = make(map[string]*Metric)
+	x.keys = nil
+	writer := x.writer
+	x.mutex.Unlock()
+
+	if len(metrics) == 0 || writer == nil {
+		return nil
+	}
+	return writer.Write(metrics)
+}
+
+// Default is recorder used by package level functions. Writer is chosen by METRICS_WRITER environment variable: "emf", "prometheus" or "none". EMF is used on AWS Lambda and none is used otherwise if not set.
+var Default *Recorder
+
+func init() {
+	Default = NewRecorder(NewWriter(os.Getenv("METRICS_WRITER")))
+}
+
+// NewWriter returns writer of the name. Prometheus writer is shared in process to accumulate metrics across flushes.
+func NewWriter(name string) Writer {
+	switch strings.ToLower(name) {
+	case "emf":
+		return NewEMFWriter(os.Stdout, DefaultNamespace)
+	case "prometheus":
+		return DefaultPrometheusWriter
+	case "none":
+		return &NopWriter{}
+	}
+
+	if _, ok := os.LookupEnv("AWS_LAMBDA_FUNCTION_NAME"); ok {
+		return NewEMFWriter(os.Stdout, DefaultNamespace)
+	}
+	return &NopWriter{}
+}
+
+// Count adds n to counter metric of Default recorder
+func Count(name string, n int, dims Dimensions) {
+	Default.Count(name, n, dims)
+}
+
+// Latency records a duration in Default recorder
+func Latency(name string, d time.Duration, dims Dimensions) {
+	Default.Latency(name, d, dims)
+}
+
+// Flush writes metrics buffered in Default recorder
+func Flush() error {
+	return Default.Flush()
+}
+
+// Invoke calls handler of Lambda function with Function dimension, records its latency and error, then flushes metrics. Error of flush is only logged not to fail the invocation.
+func Invoke(function string, handler func() (interface{}, error)) (interface{}, error) {
+	Default.SetDimension("Function", function)
+	started := time.Now()
+
+	resp, err := handler()
+
+	Latency("HandlerLatency", time.Since(started), nil)
+	if err != nil {
+		Count("HandlerErrors", 1, nil)
+	}
+	if flushErr := Flush(); flushErr != nil {
+		logger.Error().Err(flushErr).Msg("Failed to flush metrics")
+	}
+
+	return resp, err
+}
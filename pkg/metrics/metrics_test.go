@@ -0,0 +1,115 @@
+package metrics_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cookpad/retrospector/pkg/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryWriter struct {
+	metrics []*metrics.Metric
+}
+
+func (x *memoryWriter) Write(m []*metrics.Metric) error {
+	x.metrics = append(x.metrics, m...)
+	return nil
+}
+
+func TestRecorder(t *testing.T) {
+	w := &memoryWriter{}
+	rec := metrics.NewRecorder(w)
+	rec.SetDimension("Function", "iocRecord")
+
+	rec.Count("IOCsFetched", 3, metrics.Dimensions{"Source": "otx"})
+	rec.Count("IOCsFetched", 2, metrics.Dimensions{"Source": "otx"})
+	rec.Count("IOCsFetched", 1, metrics.Dimensions{"Source": "URLhaus"})
+	rec.Latency("HandlerLatency", time.Millisecond*5, nil)
+	rec.Latency("HandlerLatency", time.Millisecond*7, nil)
+	require.NoError(t, rec.Flush())
+
+	require.Equal(t, 3, len(w.metrics))
+	assert.Equal(t, "IOCsFetched", w.metrics[0].Name)
+	assert.Equal(t, metrics.Dimensions{"Function": "iocRecord", "Source": "otx"}, w.metrics[0].Dimensions)
+	assert.Equal(t, []float64{5}, w.metrics[0].Values)
+	assert.Equal(t, []float64{1}, w.metrics[1].Values)
+	assert.Equal(t, metrics.UnitMilliseconds, w.metrics[2].Unit)
+	assert.Equal(t, []float64{5, 7}, w.metrics[2].Values)
+
+	// Buffer is cleared by flush
+	require.NoError(t, rec.Flush())
+	assert.Equal(t, 3, len(w.metrics))
+}
+
+func TestEMFWriter(t *testing.T) {
+	var buf bytes.Buffer
+	rec := metrics.NewRecorder(metrics.NewEMFWriter(&buf, "Test"))
+	rec.Count("AlertsEmitted", 2, metrics.Dimensions{"Sink": "slack"})
+	rec.Latency("HandlerLatency", time.Millisecond*5, nil)
+	rec.Latency("HandlerLatency", time.Millisecond*7, nil)
+	require.NoError(t, rec.Flush())
+
+	var docs []map[string]interface{}
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var doc map[string]interface{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &doc))
+		docs = append(docs, doc)
+	}
+	require.Equal(t, 2, len(docs))
+
+	assert.Equal(t, float64(2), docs[0]["AlertsEmitted"])
+	assert.Equal(t, "slack", docs[0]["Sink"])
+	meta := docs[0]["_aws"].(map[string]interface{})
+	directive := meta["CloudWatchMetrics"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "Test", directive["Namespace"])
+	assert.Equal(t, []interface{}{[]interface{}{"Sink"}}, directive["Dimensions"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"Name": "AlertsEmitted", "Unit": "Count"}}, directive["Metrics"])
+
+	assert.Equal(t, []interface{}{float64(5), float64(7)}, docs[1]["HandlerLatency"])
+}
+
+func TestPrometheusWriter(t *testing.T) {
+	w := metrics.NewPrometheusWriter()
+	rec := metrics.NewRecorder(w)
+	for i := 0; i < 2; i++ {
+		rec.Count("IOCsPublished", 10, nil)
+		rec.Latency("RepositoryLookupLatency", time.Millisecond*3, metrics.Dimensions{"Target": "ioc"})
+		require.NoError(t, rec.Flush())
+	}
+
+	resp := httptest.NewRecorder()
+	w.ServeHTTP(resp, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, `# TYPE retrospector_iocs_published_total counter
+retrospector_iocs_published_total 20
+# TYPE retrospector_repository_lookup_latency_milliseconds summary
+retrospector_repository_lookup_latency_milliseconds_sum{target="ioc"} 6
+retrospector_repository_lookup_latency_milliseconds_count{target="ioc"} 2
+`, resp.Body.String())
+}
+
+func TestInvoke(t *testing.T) {
+	w := &memoryWriter{}
+	metrics.Default.SetWriter(w)
+	defer metrics.Default.SetWriter(&metrics.NopWriter{})
+
+	_, err := metrics.Invoke("hunt", func() (interface{}, error) {
+		metrics.Count("Matches", 1, nil)
+		return nil, errors.New("failed")
+	})
+	require.Error(t, err)
+
+	var names []string
+	for _, m := range w.metrics {
+		names = append(names, m.Name)
+		assert.Equal(t, "hunt", m.Dimensions["Function"])
+	}
+	assert.Equal(t, []string{"Matches", "HandlerLatency", "HandlerErrors"}, names)
+}
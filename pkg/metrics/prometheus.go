@@ -0,0 +1,138 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// PrometheusWriter accumulates metrics in memory and exposes them in Prometheus text format. Counts are exposed as counter and latencies are exposed as summary of sum and count.
+type PrometheusWriter struct {
+	mutex  sync.Mutex
+	series map[string]*promSeries
+}
+
+type promSeries struct {
+	name   string
+	labels string
+	unit   Unit
+	sum    float64
+	count  int
+}
+
+// DefaultPrometheusWriter is writer selected by METRICS_WRITER=prometheus
+var DefaultPrometheusWriter = NewPrometheusWriter()
+
+// NewPrometheusWriter is constructor of PrometheusWriter
+func NewPrometheusWriter() *PrometheusWriter {
+	return &PrometheusWriter{
+		series: make(map[string]*promSeries),
+	}
+}
+
+var camelBoundary = regexp.MustCompile(`([a-z0-9])([A-Z])`)
+
+// promName converts metric name such as "IOCsFetched" to "retrospector_iocs_fetched"
+func promName(name string) string {
+	return "retrospector_" + strings.ToLower(camelBoundary.ReplaceAllString(name, "${1}_${2}"))
+}
+
+func promLabels(dims Dimensions) string {
+	var pairs []string
+	for k, v := range dims {
+		v = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, strings.ToLower(k), v))
+	}
+	sort.Strings(pairs)
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Write adds metrics to accumulated series
+func (x *PrometheusWriter) Write(metrics []*Metric) error {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	for _, metric := range metrics {
+		name := promName(metric.Name)
+		labels := promLabels(metric.Dimensions)
+		key := name + labels
+
+		series, ok := x.series[key]
+		if !ok {
+			series = &promSeries{name: name, labels: labels, unit: metric.Unit}
+			x.series[key] = series
+		}
+		for _, v := range metric.Values {
+			series.sum += v
+			series.count++
+		}
+	}
+	return nil
+}
+
+// WriteTo outputs accumulated series in Prometheus text format
+func (x *PrometheusWriter) WriteTo(w io.Writer) (int64, error) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	var keys []string
+	for key := range x.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var total int64
+	write := func(format string, args ...interface{}) error {
+		n, err := fmt.Fprintf(w, format, args...)
+		total += int64(n)
+		return err
+	}
+
+	typed := make(map[string]bool)
+	for _, key := range keys {
+		s := x.series[key]
+		var err error
+		switch s.unit {
+		case UnitMilliseconds:
+			name := s.name + "_milliseconds"
+			if !typed[name] {
+				if err = write("# TYPE %s summary\n", name); err != nil {
+					return total, err
+				}
+				typed[name] = true
+			}
+			if err = write("%s_sum%s %g\n", name, s.labels, s.sum); err == nil {
+				err = write("%s_count%s %d\n", name, s.labels, s.count)
+			}
+		default:
+			name := s.name + "_total"
+			if !typed[name] {
+				if err = write("# TYPE %s counter\n", name); err != nil {
+					return total, err
+				}
+				typed[name] = true
+			}
+			err = write("%s%s %g\n", name, s.labels, s.sum)
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+
+	return total, nil
+}
+
+// ServeHTTP exposes metrics for Prometheus scraper
+func (x *PrometheusWriter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if _, err := x.WriteTo(w); err != nil {
+		logger.Error().Err(err).Msg("Failed to write Prometheus metrics")
+	}
+}
@@ -2,6 +2,7 @@ package mock
 
 import (
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/cookpad/retrospector"
@@ -28,21 +29,29 @@ func makeIOCPKey(value *retrospector.Value) string {
 	return fmt.Sprintf("ioc/%s/%s", value.Type, value.Data)
 }
 
+func makeIOCIndexPKey(value *retrospector.Value) string {
+	return fmt.Sprintf("iocidx/%s/%s", value.Type, value.Data)
+}
+
+// iocIndex is index item of IOC. Only values that have index are found by BatchGetIOCSet in the same way as DynamoRepository.
+type iocIndex struct {
+	ExpiresAt int64
+}
+
+// iocIndexTimeToLive is same as TTL of IOC in DynamoRepository
+const iocIndexTimeToLive = time.Hour * 24 * 30
+
 func makeIOCSKey(ioc *retrospector.IOC) string {
 	return ioc.Source
 }
 
 func makeEntitySKey(entity *retrospector.Entity) string {
-	sk := entity.Subject
-	if sk == "" {
-		sk = time.Unix(entity.RecordedAt, 0).Format("20060102_150405")
-	}
-	return sk
+	return entity.Subject + "|" + entity.Source
 }
 
-// PutEntities puts entity set to memory
+// PutEntities aggregates entity set into memory
 func (x *Repository) PutEntities(entities []*retrospector.Entity) error {
-	for _, entity := range entities {
+	for _, entity := range retrospector.AggregateEntities(entities) {
 		pk := makeEntityPKey(&entity.Value)
 		sk := makeEntitySKey(entity)
 
@@ -51,8 +60,14 @@ func (x *Repository) PutEntities(entities []*retrospector.Entity) error {
 			smap = make(map[string]interface{})
 			x.data[pk] = smap
 		}
+
+		if stored, ok := smap[sk].(*retrospector.Entity); ok {
+			*stored = *retrospector.AggregateEntities([]*retrospector.Entity{stored, entity})[0]
+			continue
+		}
 		smap[sk] = entity
 	}
+	x.putRecent(recentKindEntity, entityValues(entities))
 
 	return nil
 }
@@ -75,35 +90,48 @@ func (x *Repository) GetEntities(iocSet []*retrospector.IOC) ([]*retrospector.En
 	return results, nil
 }
 
-func (x *Repository) UpdateEntityDetected(target *retrospector.Entity) error {
-	pk := makeEntityPKey(&target.Value)
-	sk := makeEntitySKey(target)
+// PutIOCSet puts IOC set to memory
+func (x *Repository) PutIOCSet(iocSet []*retrospector.IOC) error {
+	if err := x.PutIOCIndex(iocSet); err != nil {
+		return err
+	}
 
-	if p, ok := x.data[pk]; ok {
-		if s, ok := p[sk]; ok {
-			if entity, ok := s.(*retrospector.Entity); ok {
-				entity.Detected = true
-			}
+	for _, ioc := range iocSet {
+		pk := makeIOCPKey(&ioc.Value)
+		sk := makeIOCSKey(ioc)
+
+		smap, ok := x.data[pk]
+		if !ok {
+			smap = make(map[string]interface{})
+			x.data[pk] = smap
 		}
+		smap[sk] = ioc
 	}
 
+	var values []*retrospector.Value
+	for _, ioc := range iocSet {
+		values = append(values, &ioc.Value)
+	}
+	x.putRecent(recentKindIOC, values)
+
 	return nil
 }
 
-// PutIOCSet puts IOC set to memory
-func (x *Repository) PutIOCSet(iocSet []*retrospector.IOC) error {
+// PutIOCIndex puts index of values in IOC set. Expiration of index is only extended.
+func (x *Repository) PutIOCIndex(iocSet []*retrospector.IOC) error {
 	for _, ioc := range iocSet {
-		pk := makeIOCPKey(&ioc.Value)
-		sk := makeIOCSKey(ioc)
+		pk := makeIOCIndexPKey(&ioc.Value)
+		expiresAt := time.Unix(ioc.UpdatedAt, 0).Add(iocIndexTimeToLive).Unix()
 
 		smap, ok := x.data[pk]
 		if !ok {
 			smap = make(map[string]interface{})
 			x.data[pk] = smap
 		}
-		smap[sk] = ioc
+		if idx, ok := smap["-"].(*iocIndex); !ok || idx.ExpiresAt < expiresAt {
+			smap["-"] = &iocIndex{ExpiresAt: expiresAt}
+		}
 	}
-
 	return nil
 }
 
@@ -125,17 +153,290 @@ func (x *Repository) GetIOCSet(entities []*retrospector.Entity) ([]*retrospector
 	return results, nil
 }
 
-func (x *Repository) UpdateIOCDetected(target *retrospector.IOC) error {
-	pk := makeIOCPKey(&target.Value)
-	sk := makeIOCSKey(target)
+// BatchGetEntities fetches entity set from memory by values
+func (x *Repository) BatchGetEntities(values []*retrospector.Value) ([]*retrospector.Entity, error) {
+	var iocSet []*retrospector.IOC
+	for _, value := range values {
+		iocSet = append(iocSet, &retrospector.IOC{Value: *value})
+	}
+	return x.GetEntities(iocSet)
+}
 
-	if p, ok := x.data[pk]; ok {
-		if s, ok := p[sk]; ok {
-			if ioc, ok := s.(*retrospector.IOC); ok {
-				ioc.Detected = true
+// BatchGetIOCSet fetches IOC set from memory by values that have index. Expiration is not checked because TTL of DynamoDB deletes items lazily.
+func (x *Repository) BatchGetIOCSet(values []*retrospector.Value) ([]*retrospector.IOC, error) {
+	var entities []*retrospector.Entity
+	for _, value := range values {
+		if _, ok := x.data[makeIOCIndexPKey(value)]["-"].(*iocIndex); !ok {
+			continue
+		}
+		entities = append(entities, &retrospector.Entity{Value: *value})
+	}
+	return x.GetIOCSet(entities)
+}
+
+// ScanIOCSet calls callback for all IOC in memory in order of key
+func (x *Repository) ScanIOCSet(callback func(ioc *retrospector.IOC) error) error {
+	var pkList []string
+	for pk := range x.data {
+		pkList = append(pkList, pk)
+	}
+	sort.Strings(pkList)
+
+	for _, pk := range pkList {
+		for _, v := range x.data[pk] {
+			ioc, ok := v.(*retrospector.IOC)
+			if !ok {
+				continue
+			}
+			if err := callback(ioc); err != nil {
+				return err
 			}
 		}
 	}
 
 	return nil
 }
+
+// ScanEntities calls callback for all entities in memory in order of key
+func (x *Repository) ScanEntities(callback func(entity *retrospector.Entity) error) error {
+	var pkList []string
+	for pk := range x.data {
+		pkList = append(pkList, pk)
+	}
+	sort.Strings(pkList)
+
+	for _, pk := range pkList {
+		var skList []string
+		for sk := range x.data[pk] {
+			skList = append(skList, sk)
+		}
+		sort.Strings(skList)
+
+		for _, sk := range skList {
+			entity, ok := x.data[pk][sk].(*retrospector.Entity)
+			if !ok {
+				continue
+			}
+			if err := callback(entity); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+const (
+	recentKindIOC    = "ioc"
+	recentKindEntity = "entity"
+)
+
+// recentValue is stored time of value
+type recentValue struct {
+	retrospector.Value
+	StoredAt int64
+}
+
+func makeRecentPKey(kind string) string {
+	return "recent/" + kind
+}
+
+func entityValues(entities []*retrospector.Entity) []*retrospector.Value {
+	var values []*retrospector.Value
+	for _, entity := range entities {
+		values = append(values, &entity.Value)
+	}
+	return values
+}
+
+func (x *Repository) putRecent(kind string, values []*retrospector.Value) {
+	pk := makeRecentPKey(kind)
+	smap, ok := x.data[pk]
+	if !ok {
+		smap = make(map[string]interface{})
+		x.data[pk] = smap
+	}
+
+	now := time.Now().Unix()
+	for _, value := range values {
+		smap[fmt.Sprintf("%s/%s", value.Type, value.Data)] = &recentValue{Value: *value, StoredAt: now}
+	}
+}
+
+func (x *Repository) getRecent(kind string, since int64) ([]*retrospector.Value, error) {
+	smap := x.data[makeRecentPKey(kind)]
+	var skList []string
+	for sk := range smap {
+		skList = append(skList, sk)
+	}
+	sort.Strings(skList)
+
+	var values []*retrospector.Value
+	for _, sk := range skList {
+		if recent := smap[sk].(*recentValue); recent.StoredAt >= since {
+			value := recent.Value
+			values = append(values, &value)
+		}
+	}
+	return values, nil
+}
+
+// GetRecentIOCValues returns values of IOC set stored after since in order of key
+func (x *Repository) GetRecentIOCValues(since int64) ([]*retrospector.Value, error) {
+	return x.getRecent(recentKindIOC, since)
+}
+
+// GetRecentEntityValues returns values of entities stored after since in order of key
+func (x *Repository) GetRecentEntityValues(since int64) ([]*retrospector.Value, error) {
+	return x.getRecent(recentKindEntity, since)
+}
+
+func makeReputationPKey(value *retrospector.Value) string {
+	return fmt.Sprintf("reputation/%s/%s", value.Type, value.Data)
+}
+
+// PutReputation puts reputation to memory
+func (x *Repository) PutReputation(rep *retrospector.Reputation) error {
+	pk := makeReputationPKey(&rep.Value)
+	smap, ok := x.data[pk]
+	if !ok {
+		smap = make(map[string]interface{})
+		x.data[pk] = smap
+	}
+	stored := *rep
+	smap[rep.Source] = &stored
+	return nil
+}
+
+// GetReputation fetches reputation from memory
+func (x *Repository) GetReputation(value *retrospector.Value, source string) (*retrospector.Reputation, error) {
+	if rep, ok := x.data[makeReputationPKey(value)][source].(*retrospector.Reputation); ok {
+		copied := *rep
+		return &copied, nil
+	}
+	return nil, nil
+}
+
+func makeAlertPKey(value *retrospector.Value) string {
+	return fmt.Sprintf("alert/%s/%s", value.Type, value.Data)
+}
+
+// GetAlertState fetches alert state from memory
+func (x *Repository) GetAlertState(value *retrospector.Value) (*retrospector.AlertState, error) {
+	if state, ok := x.data[makeAlertPKey(value)]["state"].(*retrospector.AlertState); ok {
+		copied := *state
+		return &copied, nil
+	}
+	return nil, nil
+}
+
+// PutAlertState puts alert state to memory
+func (x *Repository) PutAlertState(state *retrospector.AlertState) error {
+	pk := makeAlertPKey(&state.Value)
+	smap, ok := x.data[pk]
+	if !ok {
+		smap = make(map[string]interface{})
+		x.data[pk] = smap
+	}
+	stored := *state
+	smap["state"] = &stored
+	return nil
+}
+
+// PutAlertTransition appends alert transition in memory
+func (x *Repository) PutAlertTransition(transition *retrospector.AlertTransition) error {
+	pk := makeAlertPKey(&transition.Value)
+	smap, ok := x.data[pk]
+	if !ok {
+		smap = make(map[string]interface{})
+		x.data[pk] = smap
+	}
+	transitions, _ := smap["transitions"].([]*retrospector.AlertTransition)
+	stored := *transition
+	smap["transitions"] = append(transitions, &stored)
+	return nil
+}
+
+// GetAlertTransitions fetches alert transitions from memory in order of insertion
+func (x *Repository) GetAlertTransitions(value *retrospector.Value) ([]*retrospector.AlertTransition, error) {
+	transitions, _ := x.data[makeAlertPKey(value)]["transitions"].([]*retrospector.AlertTransition)
+	return transitions, nil
+}
+
+// ScanAlertStates calls callback for all alert states in memory in order of key
+func (x *Repository) ScanAlertStates(callback func(state *retrospector.AlertState) error) error {
+	var pkList []string
+	for pk := range x.data {
+		pkList = append(pkList, pk)
+	}
+	sort.Strings(pkList)
+
+	for _, pk := range pkList {
+		if state, ok := x.data[pk]["state"].(*retrospector.AlertState); ok {
+			if err := callback(state); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// QueryAlertStates returns alert states in memory in descending order of updated_at. Cursor has same format as DynamoRepository.
+func (x *Repository) QueryAlertStates(status retrospector.AlertStatus, limit int, cursor string) ([]*retrospector.AlertState, string, error) {
+	listKey := func(state *retrospector.AlertState) string {
+		return fmt.Sprintf("%020d/%s/%s", state.UpdatedAt, state.Type, state.Data)
+	}
+
+	var states []*retrospector.AlertState
+	for _, smap := range x.data {
+		state, ok := smap["state"].(*retrospector.AlertState)
+		if !ok || (status != "" && state.Status != status) {
+			continue
+		}
+		if cursor != "" && listKey(state) >= cursor {
+			continue
+		}
+		copied := *state
+		states = append(states, &copied)
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return listKey(states[i]) > listKey(states[j])
+	})
+
+	if len(states) <= limit {
+		return states, "", nil
+	}
+	states = states[:limit]
+	return states, listKey(states[limit-1]), nil
+}
+
+func makeDetectionPKey(value *retrospector.Value) string {
+	return fmt.Sprintf("detection/%s/%s", value.Type, value.Data)
+}
+
+// GetDetections fetches detection history from memory
+func (x *Repository) GetDetections(value *retrospector.Value) ([]*retrospector.Detection, error) {
+	var results []*retrospector.Detection
+	for _, v := range x.data[makeDetectionPKey(value)] {
+		if detection, ok := v.(*retrospector.Detection); ok {
+			copied := *detection
+			results = append(results, &copied)
+		}
+	}
+	return results, nil
+}
+
+// PutDetections puts detection history to memory
+func (x *Repository) PutDetections(detections []*retrospector.Detection) error {
+	for _, detection := range detections {
+		pk := makeDetectionPKey(&detection.Value)
+		smap, ok := x.data[pk]
+		if !ok {
+			smap = make(map[string]interface{})
+			x.data[pk] = smap
+		}
+		stored := *detection
+		smap["subject/"+detection.Subject] = &stored
+	}
+	return nil
+}
@@ -3,23 +3,34 @@ package mock
 import (
 	"bytes"
 	"compress/gzip"
+	"crypto/md5"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"log"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/cookpad/retrospector/pkg/adaptor"
 )
 
 var s3Objects map[string]map[string][]byte
+var s3LastModified map[string]map[string]time.Time
 
 func init() {
 	s3Objects = make(map[string]map[string][]byte)
+	s3LastModified = make(map[string]map[string]time.Time)
 }
 
 type S3Client struct {
 	Region    string
 	S3Objects map[string]map[string][]byte
+	// S3LastModified has time when each object was put. It can be overwritten in test
+	S3LastModified map[string]map[string]time.Time
 }
 
 func NewS3Mock() (adaptor.S3ClientFactory, *S3Client) {
@@ -27,6 +38,7 @@ func NewS3Mock() (adaptor.S3ClientFactory, *S3Client) {
 	return func(region string) (adaptor.S3Client, error) {
 		client.Region = region
 		client.S3Objects = s3Objects
+		client.S3LastModified = s3LastModified
 		return client, nil
 	}, client
 }
@@ -53,20 +65,97 @@ func (x *S3Client) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, err
 
 	return &s3.GetObjectOutput{
 		Body: gz,
+		ETag: aws.String(makeETag(obj)),
 	}, nil
 }
 
-func (x *S3Client) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
-	memBucket, ok := s3Objects[*input.Bucket]
+// makeETag returns MD5 of object data in the same way as S3 for object uploaded by single PutObject
+func makeETag(data []byte) string {
+	return fmt.Sprintf(`"%x"`, md5.Sum(data))
+}
+
+// HeadObject is mock of S3.HeadObject
+func (x *S3Client) HeadObject(input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	bucket, ok := s3Objects[*input.Bucket]
 	if !ok {
-		memBucket = make(map[string][]byte)
-		s3Objects[*input.Bucket] = memBucket
+		return nil, errors.New(s3.ErrCodeNoSuchBucket)
+	}
+
+	obj, ok := bucket[*input.Key]
+	if !ok {
+		return nil, errors.New("NotFound")
+	}
+
+	output := &s3.HeadObjectOutput{
+		ContentLength: aws.Int64(int64(len(obj))),
+		ETag:          aws.String(makeETag(obj)),
 	}
+	if ts, ok := s3LastModified[*input.Bucket][*input.Key]; ok {
+		output.LastModified = aws.Time(ts)
+	}
+	return output, nil
+}
 
+func (x *S3Client) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
 	data, err := ioutil.ReadAll(input.Body)
 	if err != nil {
 		return &s3.PutObjectOutput{}, err
 	}
-	memBucket[*input.Key] = data
-	return &s3.PutObjectOutput{}, nil
+	putObject(*input.Bucket, *input.Key, data)
+
+	return &s3.PutObjectOutput{ETag: aws.String(makeETag(data))}, nil
+}
+
+// Upload is mock of s3manager.Uploader.Upload. Object is not created if reading Body fails.
+func (x *S3Client) Upload(input *s3manager.UploadInput) (*s3manager.UploadOutput, error) {
+	data, err := ioutil.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+	putObject(*input.Bucket, *input.Key, data)
+
+	return &s3manager.UploadOutput{ETag: aws.String(makeETag(data))}, nil
+}
+
+func putObject(bucket, key string, data []byte) {
+	memBucket, ok := s3Objects[bucket]
+	if !ok {
+		memBucket = make(map[string][]byte)
+		s3Objects[bucket] = memBucket
+	}
+	memBucket[key] = data
+
+	if _, ok := s3LastModified[bucket]; !ok {
+		s3LastModified[bucket] = make(map[string]time.Time)
+	}
+	s3LastModified[bucket][key] = time.Now()
+}
+
+// ListObjectsV2Pages calls fn with objects in memory in order of key. All objects are returned in one page.
+func (x *S3Client) ListObjectsV2Pages(input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool) error {
+	memBucket, ok := s3Objects[*input.Bucket]
+	if !ok {
+		return errors.New(s3.ErrCodeNoSuchBucket)
+	}
+
+	prefix := aws.StringValue(input.Prefix)
+	startAfter := aws.StringValue(input.StartAfter)
+	var keys []string
+	for key := range memBucket {
+		if strings.HasPrefix(key, prefix) && key > startAfter {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	output := &s3.ListObjectsV2Output{}
+	for _, key := range keys {
+		output.Contents = append(output.Contents, &s3.Object{
+			Key:          aws.String(key),
+			Size:         aws.Int64(int64(len(memBucket[key]))),
+			LastModified: aws.Time(s3LastModified[*input.Bucket][key]),
+		})
+	}
+	fn(output, true)
+	return nil
 }
@@ -0,0 +1,69 @@
+package reader
+
+import (
+	"encoding/csv"
+	"io"
+	"net"
+	"time"
+
+	"github.com/cookpad/retrospector"
+	"github.com/m-mizutani/golambda"
+)
+
+// albReader reads access log of Application Load Balancer and emits client IP address as entity. Subject is name of load balancer.
+// https://docs.aws.amazon.com/elasticloadbalancing/latest/application/load-balancer-access-logs.html
+type albReader struct {
+	source string
+}
+
+const (
+	albFieldTime      = 1
+	albFieldELB       = 2
+	albFieldClient    = 3
+	albFieldRequest   = 12
+	albMinFieldNumber = 13
+)
+
+func (x *albReader) Read(r io.Reader, emit Emit) error {
+	reader := csv.NewReader(r)
+	reader.Comma = ' '
+	reader.LazyQuotes = true
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return golambda.WrapError(err, "Failed to read ALB log")
+		}
+		if len(row) < albMinFieldNumber {
+			continue
+		}
+
+		host, _, err := net.SplitHostPort(row[albFieldClient])
+		if err != nil || net.ParseIP(host) == nil {
+			continue
+		}
+
+		ts, err := time.Parse(time.RFC3339Nano, row[albFieldTime])
+		if err != nil {
+			return golambda.WrapError(err, "Failed to parse timestamp of ALB log").With("row", row)
+		}
+
+		entity := &retrospector.Entity{
+			Value: retrospector.Value{
+				Data: host,
+				Type: retrospector.ValueIPAddr,
+			},
+			Source:      x.source,
+			Subject:     row[albFieldELB],
+			RecordedAt:  ts.Unix(),
+			Description: row[albFieldRequest],
+		}
+		if err := emit(entity); err != nil {
+			return err
+		}
+	}
+}
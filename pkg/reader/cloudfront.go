@@ -0,0 +1,75 @@
+package reader
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/cookpad/retrospector"
+	"github.com/m-mizutani/golambda"
+)
+
+// cloudFrontReader reads standard access log of CloudFront and emits client IP address as entity. Subject is domain name of the distribution.
+// https://docs.aws.amazon.com/AmazonCloudFront/latest/DeveloperGuide/AccessLogs.html
+type cloudFrontReader struct {
+	source string
+}
+
+func (x *cloudFrontReader) Read(r io.Reader, emit Emit) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	columns := make(map[string]int)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#Fields:") {
+			for i, name := range strings.Fields(strings.TrimPrefix(line, "#Fields:")) {
+				columns[name] = i
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "#") || line == "" {
+			continue
+		}
+
+		row := strings.Split(line, "\t")
+		get := func(field string) string {
+			idx, ok := columns[field]
+			if !ok || len(row) <= idx {
+				return ""
+			}
+			return row[idx]
+		}
+
+		clientIP := get("c-ip")
+		if net.ParseIP(clientIP) == nil {
+			continue
+		}
+
+		ts, err := time.Parse("2006-01-02 15:04:05", get("date")+" "+get("time"))
+		if err != nil {
+			return golambda.WrapError(err, "Failed to parse timestamp of CloudFront log").With("line", line)
+		}
+
+		entity := &retrospector.Entity{
+			Value: retrospector.Value{
+				Data: clientIP,
+				Type: retrospector.ValueIPAddr,
+			},
+			Source:      x.source,
+			Subject:     get("cs(Host)"),
+			RecordedAt:  ts.Unix(),
+			Description: get("cs-method") + " " + get("cs-uri-stem"),
+		}
+		if err := emit(entity); err != nil {
+			return err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return golambda.WrapError(err, "Failed to read CloudFront log")
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package reader
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"time"
+
+	"github.com/cookpad/retrospector"
+	"github.com/m-mizutani/golambda"
+)
+
+// cloudTrailRecord is an event in CloudTrail log file
+// https://docs.aws.amazon.com/awscloudtrail/latest/userguide/cloudtrail-event-reference-record-contents.html
+type cloudTrailRecord struct {
+	EventTime       string `json:"eventTime"`
+	EventSource     string `json:"eventSource"`
+	EventName       string `json:"eventName"`
+	SourceIPAddress string `json:"sourceIPAddress"`
+	UserIdentity    struct {
+		Type        string `json:"type"`
+		PrincipalID string `json:"principalId"`
+		ARN         string `json:"arn"`
+		AccountID   string `json:"accountId"`
+		InvokedBy   string `json:"invokedBy"`
+	} `json:"userIdentity"`
+}
+
+// cloudTrailReader reads CloudTrail log file and emits sourceIPAddress as entity. Subject is ARN of IAM principal and Description is event name. Events by AWS services are skipped because their source is not IP address of the caller.
+type cloudTrailReader struct {
+	source string
+}
+
+func (x *cloudTrailReader) Read(r io.Reader, emit Emit) error {
+	decoder := json.NewDecoder(r)
+
+	// Read {"Records":[...]} element by element to avoid loading whole log file
+	if err := expectDelim(decoder, '{'); err != nil {
+		return err
+	}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return golambda.WrapError(err, "Failed to read CloudTrail log")
+		}
+
+		if token != "Records" {
+			var skip json.RawMessage
+			if err := decoder.Decode(&skip); err != nil {
+				return golambda.WrapError(err, "Failed to read CloudTrail log").With("key", token)
+			}
+			continue
+		}
+
+		if err := expectDelim(decoder, '['); err != nil {
+			return err
+		}
+		for decoder.More() {
+			var record cloudTrailRecord
+			if err := decoder.Decode(&record); err != nil {
+				return golambda.WrapError(err, "Failed to decode CloudTrail record").With("offset", decoder.InputOffset())
+			}
+
+			entity, err := x.toEntity(&record)
+			if err != nil {
+				return err
+			}
+			if entity == nil {
+				continue
+			}
+			if err := emit(entity); err != nil {
+				return err
+			}
+		}
+		if err := expectDelim(decoder, ']'); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (x *cloudTrailReader) toEntity(record *cloudTrailRecord) (*retrospector.Entity, error) {
+	if record.UserIdentity.Type == "AWSService" || record.UserIdentity.InvokedBy != "" {
+		return nil, nil
+	}
+	// sourceIPAddress can be service name such as "ec2.amazonaws.com" or "AWS Internal"
+	if net.ParseIP(record.SourceIPAddress) == nil {
+		return nil, nil
+	}
+
+	ts, err := time.Parse(time.RFC3339, record.EventTime)
+	if err != nil {
+		return nil, golambda.WrapError(err, "Failed to parse eventTime").With("record", record)
+	}
+
+	subject := record.UserIdentity.ARN
+	if subject == "" {
+		subject = record.UserIdentity.PrincipalID
+	}
+
+	return &retrospector.Entity{
+		Value: retrospector.Value{
+			Data: record.SourceIPAddress,
+			Type: retrospector.ValueIPAddr,
+		},
+		Source:      x.source,
+		Subject:     subject,
+		RecordedAt:  ts.Unix(),
+		Description: record.EventName,
+	}, nil
+}
+
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return golambda.WrapError(err, "Failed to read JSON token").With("expected", delim.String())
+	}
+	if token != delim {
+		return golambda.NewError("Unexpected JSON token").With("expected", delim.String()).With("actual", token)
+	}
+	return nil
+}
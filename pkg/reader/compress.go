@@ -0,0 +1,43 @@
+package reader
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/m-mizutani/golambda"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// Decompress returns reader of decompressed data if r is gzip or zstd compressed. Otherwise, data of r is returned as it is. Compression is detected by magic bytes instead of object metadata because S3 may or may not decode object with Content-Encoding.
+func Decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return nil, golambda.WrapError(err, "Failed to read head of data")
+	}
+
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, golambda.WrapError(err, "Failed to open gzip stream")
+		}
+		return gz, nil
+
+	case bytes.HasPrefix(head, zstdMagic):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, golambda.WrapError(err, "Failed to open zstd stream")
+		}
+		return zr.IOReadCloser(), nil
+	}
+
+	return br, nil
+}
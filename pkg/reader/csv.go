@@ -0,0 +1,85 @@
+package reader
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+
+	"github.com/m-mizutani/golambda"
+)
+
+// CSVOption is option of CSV format
+type CSVOption struct {
+	// HasHeader indicates that the first row is header. If false, fields are named by 0-origin column index ("0", "1", ...)
+	HasHeader bool `json:"has_header"`
+	// Delimiter is field delimiter. Default is comma
+	Delimiter string `json:"delimiter"`
+}
+
+type csvReader struct {
+	option  *CSVOption
+	mapping *Mapping
+	source  string
+}
+
+func (x *csvReader) Read(r io.Reader, emit Emit) error {
+	option := x.option
+	if option == nil {
+		option = &CSVOption{}
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	if option.Delimiter != "" {
+		reader.Comma = []rune(option.Delimiter)[0]
+	}
+
+	columns := make(map[string]int)
+	if option.HasHeader {
+		header, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return golambda.WrapError(err, "Failed to read CSV header")
+		}
+		for i, name := range header {
+			columns[name] = i
+		}
+	}
+
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return golambda.WrapError(err, "Failed to read CSV row")
+		}
+
+		get := func(field string) string {
+			idx, ok := columns[field]
+			if !ok {
+				if option.HasHeader {
+					return ""
+				}
+				if idx, err = strconv.Atoi(field); err != nil {
+					return ""
+				}
+			}
+			if idx < 0 || len(row) <= idx {
+				return ""
+			}
+			return row[idx]
+		}
+
+		entities, err := x.mapping.Entities(get, x.source)
+		if err != nil {
+			return golambda.WrapError(err).With("row", row)
+		}
+		for _, entity := range entities {
+			if err := emit(entity); err != nil {
+				return err
+			}
+		}
+	}
+}
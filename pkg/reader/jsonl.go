@@ -0,0 +1,61 @@
+package reader
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/cookpad/retrospector"
+	"github.com/cookpad/retrospector/pkg/extractor"
+	"github.com/m-mizutani/golambda"
+)
+
+// jsonlReader reads newline delimited JSON of retrospector.Entity
+type jsonlReader struct {
+	source string
+}
+
+func (x *jsonlReader) Read(r io.Reader, emit Emit) error {
+	decoder := json.NewDecoder(r)
+	for {
+		entity := &retrospector.Entity{}
+		if err := decoder.Decode(entity); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return golambda.WrapError(err, "Failed to decode JSON entity").With("offset", decoder.InputOffset())
+		}
+
+		if x.source != "" {
+			entity.Source = x.source
+		}
+		if err := emit(entity); err != nil {
+			return err
+		}
+	}
+}
+
+// jsonReader reads raw JSON log records and extracts entities by extractor
+type jsonReader struct {
+	extractor *extractor.Extractor
+}
+
+func (x *jsonReader) Read(r io.Reader, emit Emit) error {
+	decoder := json.NewDecoder(r)
+	for {
+		var record interface{}
+		if err := decoder.Decode(&record); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return golambda.WrapError(err, "Failed to decode JSON log record").With("offset", decoder.InputOffset())
+		}
+
+		entities, err := x.extractor.Extract(record)
+		if err != nil {
+			return golambda.WrapError(err).With("record", record)
+		}
+		for _, entity := range entities {
+			if err := emit(entity); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package reader
+
+import (
+	"github.com/cookpad/retrospector"
+	"github.com/cookpad/retrospector/pkg/extractor"
+)
+
+// Mapping specifies fields of a record that are converted to entities. One entity is created for each non-empty field in Values.
+type Mapping struct {
+	// Values is map of field name and value type of the field
+	Values map[string]retrospector.ValueType `json:"values"`
+	// Subject is field name of Entity.Subject
+	Subject string `json:"subject"`
+	// Timestamp is field name of Entity.RecordedAt
+	Timestamp string `json:"timestamp"`
+	// TimeFormat is format of Timestamp. See extractor.ParseTime
+	TimeFormat string `json:"time_format"`
+	// Description is field name of Entity.Description
+	Description string `json:"description"`
+}
+
+// Entities creates entities from a record. get returns string value of the field and empty string if the field does not exist.
+func (x *Mapping) Entities(get func(field string) string, source string) ([]*retrospector.Entity, error) {
+	var recordedAt int64
+	if x.Timestamp != "" {
+		if ts := get(x.Timestamp); ts != "" {
+			t, err := extractor.ParseTime(x.TimeFormat, ts)
+			if err != nil {
+				return nil, err
+			}
+			recordedAt = t
+		}
+	}
+
+	var subject, description string
+	if x.Subject != "" {
+		subject = get(x.Subject)
+	}
+	if x.Description != "" {
+		description = get(x.Description)
+	}
+
+	var entities []*retrospector.Entity
+	for field, valueType := range x.Values {
+		data := get(field)
+		if data == "" {
+			continue
+		}
+
+		entities = append(entities, &retrospector.Entity{
+			Value: retrospector.Value{
+				Data: data,
+				Type: valueType,
+			},
+			Source:      source,
+			Subject:     subject,
+			RecordedAt:  recordedAt,
+			Description: description,
+		})
+	}
+
+	return entities, nil
+}
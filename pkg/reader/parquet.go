@@ -0,0 +1,98 @@
+package reader
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/m-mizutani/golambda"
+	"github.com/parquet-go/parquet-go"
+)
+
+const parquetMagic = "PAR1"
+
+type parquetReader struct {
+	mapping *Mapping
+	source  string
+}
+
+// sizedReaderAt is io.ReaderAt with size such as *bytes.Reader and *strings.Reader
+type sizedReaderAt interface {
+	io.ReaderAt
+	Size() int64
+}
+
+// spool writes data of r into temporary file to read it randomly without holding whole data in memory. Returned function closes and removes the file.
+func spool(r io.Reader) (*os.File, int64, func(), error) {
+	tmp, err := ioutil.TempFile("", "retrospector-parquet-")
+	if err != nil {
+		return nil, 0, nil, golambda.WrapError(err, "Failed to create temp file for Parquet data")
+	}
+	cleanup := func() {
+		if err := tmp.Close(); err != nil {
+			golambda.Logger.With("err", err).With("path", tmp.Name()).Error("Failed to close temp file")
+		}
+		if err := os.Remove(tmp.Name()); err != nil {
+			golambda.Logger.With("err", err).With("path", tmp.Name()).Error("Failed to remove temp file")
+		}
+	}
+
+	size, err := io.Copy(tmp, r)
+	if err != nil {
+		cleanup()
+		return nil, 0, nil, golambda.WrapError(err, "Failed to read Parquet data")
+	}
+	return tmp, size, cleanup, nil
+}
+
+func (x *parquetReader) Read(r io.Reader, emit Emit) error {
+	// Parquet requires random access because metadata is in footer of the file. Data is spooled into temp file unless r supports random access
+	var src io.ReaderAt
+	var size int64
+	if sr, ok := r.(sizedReaderAt); ok {
+		src, size = sr, sr.Size()
+	} else {
+		tmp, n, cleanup, err := spool(r)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		src, size = tmp, n
+	}
+
+	file, err := parquet.OpenFile(src, size)
+	if err != nil {
+		return golambda.WrapError(err, "Failed to open Parquet file")
+	}
+
+	reader := parquet.NewReader(file)
+	defer reader.Close()
+
+	for {
+		row := make(map[string]interface{})
+		if err := reader.Read(&row); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return golambda.WrapError(err, "Failed to read Parquet row")
+		}
+
+		get := func(field string) string {
+			v, ok := row[field]
+			if !ok || v == nil {
+				return ""
+			}
+			return fmt.Sprintf("%v", v)
+		}
+
+		entities, err := x.mapping.Entities(get, x.source)
+		if err != nil {
+			return golambda.WrapError(err).With("row", row)
+		}
+		for _, entity := range entities {
+			if err := emit(entity); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package reader
+
+import (
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/cookpad/retrospector"
+	"github.com/cookpad/retrospector/pkg/extractor"
+	"github.com/m-mizutani/golambda"
+)
+
+// Emit is called for each entity extracted from an object. Reader stops reading if Emit returns error.
+type Emit func(entity *retrospector.Entity) error
+
+// Reader extracts entities from decompressed object data
+type Reader interface {
+	Read(r io.Reader, emit Emit) error
+}
+
+// Format is data format of an entity object
+type Format string
+
+const (
+	// FormatAuto detects format by object key and data
+	FormatAuto Format = ""
+	// FormatJSONL is newline delimited JSON of retrospector.Entity
+	FormatJSONL Format = "jsonl"
+	// FormatJSON is stream of raw JSON log records that requires Rule.Extractor
+	FormatJSON Format = "json"
+	// FormatCSV is CSV that requires Rule.Mapping
+	FormatCSV Format = "csv"
+	// FormatParquet is Apache Parquet that requires Rule.Mapping
+	FormatParquet Format = "parquet"
+	// FormatALB is access log of Application Load Balancer
+	FormatALB Format = "alb"
+	// FormatCloudFront is standard access log of CloudFront
+	FormatCloudFront Format = "cloudfront"
+	// FormatRoute53Resolver is query log of Route 53 Resolver
+	FormatRoute53Resolver Format = "route53resolver"
+	// FormatVPCFlowLog is VPC Flow Logs version 2 or later
+	FormatVPCFlowLog Format = "vpcflowlog"
+	// FormatCloudTrail is log file of AWS CloudTrail
+	FormatCloudTrail Format = "cloudtrail"
+)
+
+// Rule specifies format of objects that match Bucket and Prefix of key
+type Rule struct {
+	Bucket  string     `json:"bucket"`
+	Prefix  string     `json:"prefix"`
+	Format  Format     `json:"format"`
+	Source  string     `json:"source"`
+	CSV     *CSVOption `json:"csv"`
+	Mapping *Mapping   `json:"mapping"`
+
+	Extractor *extractor.Config `json:"extractor"`
+
+	// InternalCIDRs is list of internal networks. Addresses in them are not entity of network logs such as VPC Flow Logs
+	InternalCIDRs []string `json:"internal_cidrs"`
+}
+
+// Match returns true if the rule is applied to the object. Empty Bucket matches any bucket.
+func (x *Rule) Match(bucket, key string) bool {
+	if x.Bucket != "" && x.Bucket != bucket {
+		return false
+	}
+	return strings.HasPrefix(key, x.Prefix)
+}
+
+// FindRule returns the first rule that matches the object or nil
+func FindRule(rules []*Rule, bucket, key string) *Rule {
+	for _, rule := range rules {
+		if rule.Match(bucket, key) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// New returns Reader for the format. rule can be nil for formats that do not require options.
+func New(format Format, rule *Rule) (Reader, error) {
+	if rule == nil {
+		rule = &Rule{}
+	}
+	source := rule.Source
+	if source == "" {
+		source = string(format)
+	}
+
+	switch format {
+	case FormatJSONL:
+		return &jsonlReader{source: rule.Source}, nil
+
+	case FormatJSON:
+		if rule.Extractor == nil {
+			return nil, golambda.NewError("extractor is required for JSON format").With("rule", rule)
+		}
+		config := *rule.Extractor
+		if config.Source == "" {
+			config.Source = source
+		}
+		ext, err := extractor.New(&config)
+		if err != nil {
+			return nil, err
+		}
+		return &jsonReader{extractor: ext}, nil
+
+	case FormatCSV:
+		if rule.Mapping == nil {
+			return nil, golambda.NewError("mapping is required for CSV format").With("rule", rule)
+		}
+		return &csvReader{option: rule.CSV, mapping: rule.Mapping, source: source}, nil
+
+	case FormatParquet:
+		if rule.Mapping == nil {
+			return nil, golambda.NewError("mapping is required for Parquet format").With("rule", rule)
+		}
+		return &parquetReader{mapping: rule.Mapping, source: source}, nil
+
+	case FormatALB:
+		return &albReader{source: source}, nil
+
+	case FormatCloudFront:
+		return &cloudFrontReader{source: source}, nil
+
+	case FormatRoute53Resolver:
+		return &route53ResolverReader{source: source}, nil
+
+	case FormatVPCFlowLog:
+		internal, err := parseCIDRs(rule.InternalCIDRs)
+		if err != nil {
+			return nil, err
+		}
+		return &vpcFlowLogReader{source: source, internal: internal}, nil
+
+	case FormatCloudTrail:
+		return &cloudTrailReader{source: source}, nil
+
+	default:
+		return nil, golambda.NewError("Unsupported entity object format").With("format", format)
+	}
+}
+
+var (
+	albKeyPattern             = regexp.MustCompile(`AWSLogs/\d+/elasticloadbalancing/`)
+	route53ResolverKeyPattern = regexp.MustCompile(`AWSLogs/\d+/vpcdnsquerylogs/`)
+	vpcFlowLogKeyPattern      = regexp.MustCompile(`AWSLogs/\d+/vpcflowlogs/`)
+	cloudTrailKeyPattern      = regexp.MustCompile(`AWSLogs/(o-[a-z0-9]+/)?\d+/CloudTrail/`)
+	cloudFrontKeyPattern      = regexp.MustCompile(`(^|/)[A-Z0-9]+\.\d{4}-\d{2}-\d{2}-\d{2}\.[0-9A-Za-z]+(\.gz)?$`)
+)
+
+// Detect guesses format of an object by key and head of decompressed data. FormatJSONL is returned if no other format matches.
+func Detect(key string, head []byte) Format {
+	switch {
+	case strings.HasPrefix(string(head), parquetMagic):
+		return FormatParquet
+	case strings.HasPrefix(string(head), "#Version:"), cloudFrontKeyPattern.MatchString(key):
+		return FormatCloudFront
+	case albKeyPattern.MatchString(key):
+		return FormatALB
+	case route53ResolverKeyPattern.MatchString(key),
+		strings.HasPrefix(string(head), "{") && strings.Contains(string(head), `"query_timestamp"`):
+		return FormatRoute53Resolver
+	case vpcFlowLogKeyPattern.MatchString(key),
+		strings.HasPrefix(string(head), "version ") && strings.Contains(string(head), "srcaddr"):
+		return FormatVPCFlowLog
+	case cloudTrailKeyPattern.MatchString(key),
+		strings.HasPrefix(string(head), `{"Records":[`):
+		return FormatCloudTrail
+	}
+
+	return FormatJSONL
+}
@@ -0,0 +1,365 @@
+package reader_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cookpad/retrospector"
+	"github.com/cookpad/retrospector/pkg/extractor"
+	"github.com/cookpad/retrospector/pkg/reader"
+	"github.com/klauspost/compress/zstd"
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readAll(t *testing.T, format reader.Format, rule *reader.Rule, data string) []*retrospector.Entity {
+	rd, err := reader.New(format, rule)
+	require.NoError(t, err)
+
+	var entities []*retrospector.Entity
+	require.NoError(t, rd.Read(strings.NewReader(data), func(entity *retrospector.Entity) error {
+		entities = append(entities, entity)
+		return nil
+	}))
+	return entities
+}
+
+func TestDecompress(t *testing.T) {
+	data := []byte(`{"value":"example.com","type":"domain"}`)
+
+	t.Run("gzip", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		gz := gzip.NewWriter(buf)
+		_, err := gz.Write(data)
+		require.NoError(t, err)
+		require.NoError(t, gz.Close())
+
+		r, err := reader.Decompress(buf)
+		require.NoError(t, err)
+		raw, err := ioutil.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, data, raw)
+	})
+
+	t.Run("zstd", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		zw, err := zstd.NewWriter(buf)
+		require.NoError(t, err)
+		_, err = zw.Write(data)
+		require.NoError(t, err)
+		require.NoError(t, zw.Close())
+
+		r, err := reader.Decompress(buf)
+		require.NoError(t, err)
+		raw, err := ioutil.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, data, raw)
+	})
+
+	t.Run("not compressed", func(t *testing.T) {
+		r, err := reader.Decompress(bytes.NewReader(data))
+		require.NoError(t, err)
+		raw, err := ioutil.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, data, raw)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		r, err := reader.Decompress(bytes.NewReader(nil))
+		require.NoError(t, err)
+		raw, err := ioutil.ReadAll(r)
+		require.NoError(t, err)
+		assert.Empty(t, raw)
+	})
+}
+
+func TestDetect(t *testing.T) {
+	assert.Equal(t, reader.FormatParquet, reader.Detect("data/x.bin", []byte("PAR1xxxx")))
+	assert.Equal(t, reader.FormatCloudFront, reader.Detect("logs/x", []byte("#Version: 1.0\n")))
+	assert.Equal(t, reader.FormatCloudFront, reader.Detect("cf/EMLARXS9EXAMPLE.2019-11-14-20.RT4KCN4SGK9.gz", nil))
+	assert.Equal(t, reader.FormatALB, reader.Detect("AWSLogs/123456789012/elasticloadbalancing/us-east-2/2020/01/01/x.log.gz", nil))
+	assert.Equal(t, reader.FormatRoute53Resolver, reader.Detect("AWSLogs/123456789012/vpcdnsquerylogs/vpc-0123/2021/01/01/x.log.gz", nil))
+	assert.Equal(t, reader.FormatRoute53Resolver, reader.Detect("dns/x.log.gz", []byte(`{"version":"1.100000","query_timestamp":"2021-01-01T00:00:00Z"}`)))
+	assert.Equal(t, reader.FormatVPCFlowLog, reader.Detect("AWSLogs/123456789012/vpcflowlogs/ap-northeast-1/2020/01/01/x.log.gz", nil))
+	assert.Equal(t, reader.FormatVPCFlowLog, reader.Detect("flow/x.log.gz", []byte("version account-id interface-id srcaddr dstaddr\n")))
+	assert.Equal(t, reader.FormatCloudTrail, reader.Detect("AWSLogs/123456789012/CloudTrail/ap-northeast-1/2020/01/01/x.json.gz", nil))
+	assert.Equal(t, reader.FormatCloudTrail, reader.Detect("AWSLogs/o-abc123/123456789012/CloudTrail/ap-northeast-1/2020/01/01/x.json.gz", nil))
+	assert.Equal(t, reader.FormatCloudTrail, reader.Detect("trail/x.json.gz", []byte(`{"Records":[{"eventVersion":"1.08"}]}`)))
+	assert.Equal(t, reader.FormatJSONL, reader.Detect("entities/x.json.gz", []byte(`{"value":"x"}`)))
+}
+
+func TestFindRule(t *testing.T) {
+	rules := []*reader.Rule{
+		{Bucket: "blue", Prefix: "csv/", Format: reader.FormatCSV},
+		{Prefix: "alb/", Format: reader.FormatALB},
+	}
+	assert.Equal(t, rules[0], reader.FindRule(rules, "blue", "csv/x.csv"))
+	assert.Nil(t, reader.FindRule(rules, "orange", "csv/x.csv"))
+	assert.Equal(t, rules[1], reader.FindRule(rules, "orange", "alb/x.log"))
+	assert.Nil(t, reader.FindRule(rules, "orange", "other/x.log"))
+}
+
+func TestJSONL(t *testing.T) {
+	data := `{"value":"example.com","type":"domain","subject":"blue","recorded_at":1600000000}
+{"value":"10.1.2.3","type":"ipaddr","source":"orange"}
+`
+	t.Run("keep source in data", func(t *testing.T) {
+		entities := readAll(t, reader.FormatJSONL, nil, data)
+		require.Equal(t, 2, len(entities))
+		assert.Equal(t, "example.com", entities[0].Data)
+		assert.Equal(t, "blue", entities[0].Subject)
+		assert.Equal(t, int64(1600000000), entities[0].RecordedAt)
+		assert.Equal(t, "orange", entities[1].Source)
+	})
+
+	t.Run("overwrite source by rule", func(t *testing.T) {
+		entities := readAll(t, reader.FormatJSONL, &reader.Rule{Source: "red"}, data)
+		require.Equal(t, 2, len(entities))
+		assert.Equal(t, "red", entities[0].Source)
+		assert.Equal(t, "red", entities[1].Source)
+	})
+
+	t.Run("broken JSON", func(t *testing.T) {
+		rd, err := reader.New(reader.FormatJSONL, nil)
+		require.NoError(t, err)
+		assert.Error(t, rd.Read(strings.NewReader(`{"value":`), func(*retrospector.Entity) error { return nil }))
+	})
+}
+
+func TestCSV(t *testing.T) {
+	mapping := &reader.Mapping{
+		Values: map[string]retrospector.ValueType{
+			"query": retrospector.ValueDomainName,
+		},
+		Subject:    "host",
+		Timestamp:  "ts",
+		TimeFormat: "2006-01-02 15:04:05",
+	}
+
+	t.Run("with header", func(t *testing.T) {
+		data := "ts,host,query\n2020-12-01 10:00:00,blue,example.com\n2020-12-01 10:00:01,orange,\n"
+		entities := readAll(t, reader.FormatCSV, &reader.Rule{
+			Source:  "dns",
+			CSV:     &reader.CSVOption{HasHeader: true},
+			Mapping: mapping,
+		}, data)
+		require.Equal(t, 1, len(entities))
+		assert.Equal(t, "example.com", entities[0].Data)
+		assert.Equal(t, retrospector.ValueDomainName, entities[0].Type)
+		assert.Equal(t, "blue", entities[0].Subject)
+		assert.Equal(t, "dns", entities[0].Source)
+		assert.Equal(t, time.Date(2020, 12, 1, 10, 0, 0, 0, time.UTC).Unix(), entities[0].RecordedAt)
+	})
+
+	t.Run("without header", func(t *testing.T) {
+		data := "1606816800\tblue\t10.1.2.3\n"
+		entities := readAll(t, reader.FormatCSV, &reader.Rule{
+			CSV: &reader.CSVOption{Delimiter: "\t"},
+			Mapping: &reader.Mapping{
+				Values:    map[string]retrospector.ValueType{"2": retrospector.ValueIPAddr},
+				Subject:   "1",
+				Timestamp: "0",
+			},
+		}, data)
+		require.Equal(t, 1, len(entities))
+		assert.Equal(t, "10.1.2.3", entities[0].Data)
+		assert.Equal(t, "blue", entities[0].Subject)
+		assert.Equal(t, "csv", entities[0].Source)
+		assert.Equal(t, int64(1606816800), entities[0].RecordedAt)
+	})
+
+	t.Run("mapping is required", func(t *testing.T) {
+		_, err := reader.New(reader.FormatCSV, &reader.Rule{})
+		assert.Error(t, err)
+	})
+}
+
+func TestParquet(t *testing.T) {
+	type row struct {
+		Timestamp int64  `parquet:"ts"`
+		Host      string `parquet:"host"`
+		Remote    string `parquet:"remote,optional"`
+	}
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, parquet.Write(buf, []row{
+		{Timestamp: 1606816800, Host: "blue", Remote: "10.1.2.3"},
+		{Timestamp: 1606816801, Host: "orange"},
+	}))
+
+	entities := readAll(t, reader.FormatParquet, &reader.Rule{
+		Mapping: &reader.Mapping{
+			Values:     map[string]retrospector.ValueType{"remote": retrospector.ValueIPAddr},
+			Subject:    "host",
+			Timestamp:  "ts",
+			TimeFormat: "unix",
+		},
+	}, buf.String())
+	require.Equal(t, 1, len(entities))
+	assert.Equal(t, "10.1.2.3", entities[0].Data)
+	assert.Equal(t, "blue", entities[0].Subject)
+	assert.Equal(t, int64(1606816800), entities[0].RecordedAt)
+
+	t.Run("stream without random access is spooled", func(t *testing.T) {
+		rd, err := reader.New(reader.FormatParquet, &reader.Rule{
+			Mapping: &reader.Mapping{
+				Values:  map[string]retrospector.ValueType{"remote": retrospector.ValueIPAddr},
+				Subject: "host",
+			},
+		})
+		require.NoError(t, err)
+
+		var spooled []*retrospector.Entity
+		require.NoError(t, rd.Read(ioutil.NopCloser(bytes.NewReader(buf.Bytes())), func(entity *retrospector.Entity) error {
+			spooled = append(spooled, entity)
+			return nil
+		}))
+		require.Equal(t, 1, len(spooled))
+		assert.Equal(t, "10.1.2.3", spooled[0].Data)
+	})
+}
+
+func TestALB(t *testing.T) {
+	data := `http 2018-07-02T22:23:00.186641Z app/my-loadbalancer/50dc6c495c0c9188 192.168.131.39:2817 10.0.0.1:80 0.000 0.001 0.000 200 200 34 366 "GET http://www.example.com:80/ HTTP/1.1" "curl/7.46.0" - - arn:aws:elasticloadbalancing:us-east-2:123456789012:targetgroup/my-targets/73e2d6bc24d8a067 "Root=1-58337262-36d228ad5d99923122bbe354" "-" "-" 0 2018-07-02T22:22:48.364000Z "forward" "-" "-" "10.0.0.1:80" "200" "-" "-"
+https 2018-07-02T22:23:00.186641Z app/my-loadbalancer/50dc6c495c0c9188 - 10.0.0.1:80 -1 -1 -1 400 - 0 0 "- - - " "-" - - - "-" "-" "-" - 2018-07-02T22:22:48.364000Z "-" "-" "-" "-" "-" "-" "-"
+`
+	entities := readAll(t, reader.FormatALB, nil, data)
+	require.Equal(t, 1, len(entities))
+	assert.Equal(t, "192.168.131.39", entities[0].Data)
+	assert.Equal(t, retrospector.ValueIPAddr, entities[0].Type)
+	assert.Equal(t, "app/my-loadbalancer/50dc6c495c0c9188", entities[0].Subject)
+	assert.Equal(t, "GET http://www.example.com:80/ HTTP/1.1", entities[0].Description)
+	assert.Equal(t, "alb", entities[0].Source)
+}
+
+func TestCloudFront(t *testing.T) {
+	data := "#Version: 1.0\n" +
+		"#Fields: date time x-edge-location sc-bytes c-ip cs-method cs(Host) cs-uri-stem sc-status\n" +
+		"2019-12-04\t21:02:31\tLAX1\t392\t192.0.2.100\tGET\td111111abcdef8.cloudfront.net\t/index.html\t200\n" +
+		"2019-12-04\t21:02:31\tLAX1\t392\t-\tGET\td111111abcdef8.cloudfront.net\t/index.html\t200\n"
+
+	entities := readAll(t, reader.FormatCloudFront, &reader.Rule{Source: "cdn"}, data)
+	require.Equal(t, 1, len(entities))
+	assert.Equal(t, "192.0.2.100", entities[0].Data)
+	assert.Equal(t, "d111111abcdef8.cloudfront.net", entities[0].Subject)
+	assert.Equal(t, "GET /index.html", entities[0].Description)
+	assert.Equal(t, "cdn", entities[0].Source)
+	assert.Equal(t, time.Date(2019, 12, 4, 21, 2, 31, 0, time.UTC).Unix(), entities[0].RecordedAt)
+}
+
+func TestRoute53Resolver(t *testing.T) {
+	data := `{"version":"1.100000","account_id":"123456789012","region":"ap-northeast-1","vpc_id":"vpc-0123","query_timestamp":"2021-02-04T17:51:55Z","query_name":"Example.com.","query_type":"A","query_class":"IN","rcode":"NOERROR","answers":[{"Rdata":"192.0.2.1","Type":"A","Class":"IN"},{"Rdata":"cdn.example.net.","Type":"CNAME","Class":"IN"}],"srcaddr":"10.0.0.1","srcport":"53","transport":"UDP","srcids":{"instance":"i-0123456789abcdef0"}}
+{"version":"1.100000","account_id":"123456789012","region":"ap-northeast-1","vpc_id":"vpc-0123","query_timestamp":"2021-02-04T17:51:56Z","query_name":"example.org.","query_type":"AAAA","query_class":"IN","rcode":"NXDOMAIN","answers":[],"srcaddr":"10.0.0.2","srcport":"53","transport":"UDP","srcids":{"resolver_endpoint":"rslvr-in-0123"}}
+`
+	entities := readAll(t, reader.FormatRoute53Resolver, nil, data)
+	require.Equal(t, 3, len(entities))
+
+	assert.Equal(t, "example.com", entities[0].Data)
+	assert.Equal(t, retrospector.ValueDomainName, entities[0].Type)
+	assert.Equal(t, "i-0123456789abcdef0", entities[0].Subject)
+	assert.Equal(t, "route53resolver", entities[0].Source)
+	assert.Equal(t, time.Date(2021, 2, 4, 17, 51, 55, 0, time.UTC).Unix(), entities[0].RecordedAt)
+
+	assert.Equal(t, "192.0.2.1", entities[1].Data)
+	assert.Equal(t, retrospector.ValueIPAddr, entities[1].Type)
+	assert.Equal(t, "i-0123456789abcdef0", entities[1].Subject)
+
+	assert.Equal(t, "example.org", entities[2].Data)
+	assert.Equal(t, "vpc-0123", entities[2].Subject)
+}
+
+func TestVPCFlowLog(t *testing.T) {
+	data := "version account-id interface-id instance-id srcaddr dstaddr srcport dstport protocol packets bytes start end action log-status\n" +
+		"5 123456789012 eni-0123 i-0123 10.0.0.1 198.51.100.1 49152 443 6 10 840 1600000000 1600000060 ACCEPT OK\n" +
+		"5 123456789012 eni-0123 - 203.0.113.5 172.16.0.1 49152 22 6 10 840 1600000001 1600000060 REJECT OK\n" +
+		"5 123456789012 eni-0123 i-0123 100.64.0.1 10.0.0.1 49152 22 6 10 840 1600000002 1600000060 ACCEPT OK\n" +
+		"5 123456789012 eni-0123 - - - - - - - - 1600000003 1600000060 - NODATA\n"
+
+	entities := readAll(t, reader.FormatVPCFlowLog, &reader.Rule{InternalCIDRs: []string{"100.64.0.0/10"}}, data)
+	require.Equal(t, 2, len(entities))
+
+	assert.Equal(t, "198.51.100.1", entities[0].Data)
+	assert.Equal(t, retrospector.ValueIPAddr, entities[0].Type)
+	assert.Equal(t, "i-0123", entities[0].Subject)
+	assert.Equal(t, int64(1600000000), entities[0].RecordedAt)
+	assert.Equal(t, "ACCEPT 10.0.0.1:49152 -> 198.51.100.1:443", entities[0].Description)
+	assert.Equal(t, "vpcflowlog", entities[0].Source)
+
+	assert.Equal(t, "203.0.113.5", entities[1].Data)
+	assert.Equal(t, "eni-0123", entities[1].Subject)
+
+	t.Run("default format without header", func(t *testing.T) {
+		entities := readAll(t, reader.FormatVPCFlowLog, nil,
+			"2 123456789012 eni-0123 198.51.100.2 10.0.0.1 443 49152 6 10 840 1600000000 1600000060 ACCEPT OK\n")
+		require.Equal(t, 1, len(entities))
+		assert.Equal(t, "198.51.100.2", entities[0].Data)
+		assert.Equal(t, "eni-0123", entities[0].Subject)
+	})
+
+	t.Run("invalid internal CIDR", func(t *testing.T) {
+		_, err := reader.New(reader.FormatVPCFlowLog, &reader.Rule{InternalCIDRs: []string{"10.0.0.0/33"}})
+		assert.Error(t, err)
+	})
+}
+
+func TestCloudTrail(t *testing.T) {
+	data := `{"Records":[
+	{"eventVersion":"1.08","userIdentity":{"type":"IAMUser","principalId":"AIDAEXAMPLE","arn":"arn:aws:iam::123456789012:user/blue","accountId":"123456789012"},"eventTime":"2020-09-13T12:26:40Z","eventSource":"s3.amazonaws.com","eventName":"ListBuckets","sourceIPAddress":"198.51.100.1"},
+	{"eventVersion":"1.08","userIdentity":{"type":"AWSService","invokedBy":"ec2.amazonaws.com"},"eventTime":"2020-09-13T12:26:41Z","eventSource":"sts.amazonaws.com","eventName":"AssumeRole","sourceIPAddress":"ec2.amazonaws.com"},
+	{"eventVersion":"1.08","userIdentity":{"type":"AssumedRole","principalId":"AROAEXAMPLE:orange","arn":"arn:aws:sts::123456789012:assumed-role/admin/orange","invokedBy":"cloudformation.amazonaws.com"},"eventTime":"2020-09-13T12:26:42Z","eventSource":"iam.amazonaws.com","eventName":"CreateRole","sourceIPAddress":"cloudformation.amazonaws.com"},
+	{"eventVersion":"1.08","userIdentity":{"type":"Root","principalId":"123456789012","accountId":"123456789012"},"eventTime":"2020-09-13T12:26:43Z","eventSource":"signin.amazonaws.com","eventName":"ConsoleLogin","sourceIPAddress":"2001:db8::1"}
+]}`
+
+	entities := readAll(t, reader.FormatCloudTrail, nil, data)
+	require.Equal(t, 2, len(entities))
+
+	assert.Equal(t, "198.51.100.1", entities[0].Data)
+	assert.Equal(t, retrospector.ValueIPAddr, entities[0].Type)
+	assert.Equal(t, "arn:aws:iam::123456789012:user/blue", entities[0].Subject)
+	assert.Equal(t, "ListBuckets", entities[0].Description)
+	assert.Equal(t, "cloudtrail", entities[0].Source)
+	assert.Equal(t, time.Date(2020, 9, 13, 12, 26, 40, 0, time.UTC).Unix(), entities[0].RecordedAt)
+
+	assert.Equal(t, "2001:db8::1", entities[1].Data)
+	assert.Equal(t, "123456789012", entities[1].Subject)
+	assert.Equal(t, "ConsoleLogin", entities[1].Description)
+
+	t.Run("invalid log file", func(t *testing.T) {
+		rd, err := reader.New(reader.FormatCloudTrail, nil)
+		require.NoError(t, err)
+		assert.Error(t, rd.Read(strings.NewReader(`[]`), func(*retrospector.Entity) error { return nil }))
+	})
+}
+
+func TestJSON(t *testing.T) {
+	data := `{"ts":"2020-12-01T10:00:00Z","host":"blue","query":"example.com","msg":"resolved to 192.0.2.1"}
+{"ts":"2020-12-01T10:00:01Z","host":"orange","query":"example.org"}`
+
+	entities := readAll(t, reader.FormatJSON, &reader.Rule{
+		Source: "dns",
+		Extractor: &extractor.Config{
+			Fields:     map[string]retrospector.ValueType{"query": retrospector.ValueDomainName},
+			TextFields: []string{"msg"},
+			Subject:    "host",
+			Timestamp:  "ts",
+		},
+	}, data)
+
+	require.Equal(t, 3, len(entities))
+	assert.Equal(t, "example.com", entities[0].Data)
+	assert.Equal(t, "dns", entities[0].Source)
+	assert.Equal(t, "192.0.2.1", entities[1].Data)
+	assert.Equal(t, "blue", entities[1].Subject)
+	assert.Equal(t, "example.org", entities[2].Data)
+	assert.Equal(t, "orange", entities[2].Subject)
+
+	t.Run("extractor is required", func(t *testing.T) {
+		_, err := reader.New(reader.FormatJSON, &reader.Rule{})
+		assert.Error(t, err)
+	})
+}
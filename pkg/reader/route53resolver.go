@@ -0,0 +1,94 @@
+package reader
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/cookpad/retrospector"
+	"github.com/m-mizutani/golambda"
+)
+
+// route53ResolverLog is a record of Route 53 Resolver query log
+// https://docs.aws.amazon.com/Route53/latest/DeveloperGuide/resolver-query-logs-format.html
+type route53ResolverLog struct {
+	VpcID          string `json:"vpc_id"`
+	QueryTimestamp string `json:"query_timestamp"`
+	QueryName      string `json:"query_name"`
+	QueryType      string `json:"query_type"`
+	Rcode          string `json:"rcode"`
+	Answers        []struct {
+		Rdata string `json:"Rdata"`
+		Type  string `json:"Type"`
+	} `json:"answers"`
+	SrcAddr string `json:"srcaddr"`
+	SrcIDs  struct {
+		Instance         string `json:"instance"`
+		ResolverEndpoint string `json:"resolver_endpoint"`
+	} `json:"srcids"`
+}
+
+// route53ResolverReader reads Route 53 Resolver query log and emits query name and IP addresses in answers as entities. Subject is source instance ID, or VPC ID if the query does not come from an instance.
+type route53ResolverReader struct {
+	source string
+}
+
+func (x *route53ResolverReader) Read(r io.Reader, emit Emit) error {
+	decoder := json.NewDecoder(r)
+	for {
+		var log route53ResolverLog
+		if err := decoder.Decode(&log); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return golambda.WrapError(err, "Failed to decode Route 53 Resolver query log").With("offset", decoder.InputOffset())
+		}
+
+		ts, err := time.Parse(time.RFC3339Nano, log.QueryTimestamp)
+		if err != nil {
+			return golambda.WrapError(err, "Failed to parse query_timestamp").With("log", log)
+		}
+
+		subject := log.SrcIDs.Instance
+		if subject == "" {
+			subject = log.VpcID
+		}
+
+		newEntity := func(value retrospector.Value) *retrospector.Entity {
+			return &retrospector.Entity{
+				Value:       value,
+				Source:      x.source,
+				Subject:     subject,
+				RecordedAt:  ts.Unix(),
+				Description: log.QueryType + " " + log.QueryName + " " + log.Rcode,
+			}
+		}
+
+		var entities []*retrospector.Entity
+		if name := strings.TrimSuffix(log.QueryName, "."); name != "" {
+			entities = append(entities, newEntity(retrospector.Value{
+				Data: strings.ToLower(name),
+				Type: retrospector.ValueDomainName,
+			}))
+		}
+		for _, answer := range log.Answers {
+			if answer.Type != "A" && answer.Type != "AAAA" {
+				continue
+			}
+			if net.ParseIP(answer.Rdata) == nil {
+				continue
+			}
+			entities = append(entities, newEntity(retrospector.Value{
+				Data: answer.Rdata,
+				Type: retrospector.ValueIPAddr,
+			}))
+		}
+
+		for _, entity := range entities {
+			if err := emit(entity); err != nil {
+				return err
+			}
+		}
+	}
+}
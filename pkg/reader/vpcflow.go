@@ -0,0 +1,136 @@
+package reader
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/cookpad/retrospector"
+	"github.com/m-mizutani/golambda"
+)
+
+// vpcFlowLogReader reads VPC Flow Logs (version 2 or later) and emits remote addresses in srcaddr and dstaddr as entities. Subject is instance ID, or ENI ID if instance-id is not in the log. Private (RFC1918) addresses and addresses in internal networks are skipped.
+// https://docs.aws.amazon.com/vpc/latest/userguide/flow-logs.html
+type vpcFlowLogReader struct {
+	source   string
+	internal []*net.IPNet
+}
+
+// parseCIDRs converts CIDR strings to networks
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, golambda.WrapError(err, "Invalid internal CIDR").With("cidr", cidr)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func (x *vpcFlowLogReader) isRemote(ip net.IP) bool {
+	if ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, network := range x.internal {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// vpcFlowLogDefaultFields is field list of default format (version 2). It is used if an object has no header line.
+var vpcFlowLogDefaultFields = []string{
+	"version", "account-id", "interface-id", "srcaddr", "dstaddr", "srcport", "dstport",
+	"protocol", "packets", "bytes", "start", "end", "action", "log-status",
+}
+
+func (x *vpcFlowLogReader) Read(r io.Reader, emit Emit) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	columns := make(map[string]int)
+	setColumns := func(fields []string) {
+		for i, name := range fields {
+			columns[name] = i
+		}
+	}
+
+	for first := true; scanner.Scan(); first = false {
+		row := strings.Fields(scanner.Text())
+		if len(row) == 0 {
+			continue
+		}
+		if first {
+			if row[0] == "version" {
+				setColumns(row)
+				continue
+			}
+			setColumns(vpcFlowLogDefaultFields)
+		}
+
+		get := func(field string) string {
+			idx, ok := columns[field]
+			if !ok || len(row) <= idx || row[idx] == "-" {
+				return ""
+			}
+			return row[idx]
+		}
+
+		subject := get("instance-id")
+		if subject == "" {
+			subject = get("interface-id")
+		}
+
+		var recordedAt int64
+		if start := get("start"); start != "" {
+			ts, err := strconv.ParseInt(start, 10, 64)
+			if err != nil {
+				return golambda.WrapError(err, "Invalid start of VPC Flow Log").With("row", row)
+			}
+			recordedAt = ts
+		}
+
+		description := strings.Join([]string{
+			get("action"),
+			get("srcaddr") + ":" + get("srcport"),
+			"->",
+			get("dstaddr") + ":" + get("dstport"),
+		}, " ")
+
+		for _, field := range []string{"srcaddr", "dstaddr"} {
+			addr := get(field)
+			ip := net.ParseIP(addr)
+			if ip == nil || !x.isRemote(ip) {
+				continue
+			}
+
+			entity := &retrospector.Entity{
+				Value: retrospector.Value{
+					Data: addr,
+					Type: retrospector.ValueIPAddr,
+				},
+				Source:      x.source,
+				Subject:     subject,
+				RecordedAt:  recordedAt,
+				Description: description,
+			}
+			if err := emit(entity); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return golambda.WrapError(err, "Failed to read VPC Flow Log")
+	}
+	return nil
+}
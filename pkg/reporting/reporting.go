@@ -0,0 +1,162 @@
+package reporting
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cookpad/retrospector/pkg/logging"
+	"github.com/getsentry/sentry-go"
+	"github.com/m-mizutani/golambda"
+)
+
+var logger = logging.Logger
+
+// flushTimeout is max time to wait sending events at end of invocation
+const flushTimeout = 2 * time.Second
+
+// Options configures Reporter. Reporter is disabled if DSN is empty.
+type Options struct {
+	// DSN of Sentry or compatible endpoint, e.g. "http://key@localhost:9000/1"
+	DSN         string
+	Environment string
+	Release     string
+	// Transport is used for test. HTTP transport of Sentry is used if nil
+	Transport sentry.Transport
+}
+
+// Reporter sends errors and panics of Lambda functions to Sentry. Nil Reporter does not send anything, but still recovers panics in Invoke.
+type Reporter struct {
+	hub *sentry.Hub
+}
+
+// NewReporter is constructor of Reporter. It returns nil if opt.DSN is empty.
+func NewReporter(opt *Options) (*Reporter, error) {
+	if opt.DSN == "" {
+		return nil, nil
+	}
+
+	client, err := sentry.NewClient(sentry.ClientOptions{
+		Dsn:         opt.DSN,
+		Environment: opt.Environment,
+		Release:     opt.Release,
+		Transport:   opt.Transport,
+	})
+	if err != nil {
+		return nil, golambda.WrapError(err, "Failed to create Sentry client").With("environment", opt.Environment)
+	}
+
+	// golambda.Start also reports errors by global hub if SENTRY_DSN is set, but without context of the error. Errors are reported only by Reporter to avoid duplicated events.
+	sentry.CurrentHub().BindClient(nil)
+
+	return &Reporter{hub: sentry.NewHub(client, sentry.NewScope())}, nil
+}
+
+// Values returns values set by With of all golambda.Error in error chain. Values of outer error take precedence.
+func Values(err error) map[string]interface{} {
+	values := make(map[string]interface{})
+	for err != nil {
+		var e *golambda.Error
+		if !errors.As(err, &e) {
+			break
+		}
+		for k, v := range e.Values() {
+			if _, ok := values[k]; !ok {
+				values[k] = v
+			}
+		}
+		err = e.Unwrap()
+	}
+	return values
+}
+
+// extra converts value to be serialized in Sentry event. Value that can not be marshaled is converted to string.
+func extra(value interface{}) interface{} {
+	if _, err := json.Marshal(value); err != nil {
+		return fmt.Sprintf("%+v", value)
+	}
+	return value
+}
+
+// Capture sends err with values of golambda.Error as extras and tags. It returns ID of Sentry event or empty string if not sent.
+func (x *Reporter) Capture(err error, tags map[string]string) string {
+	if x == nil || err == nil {
+		return ""
+	}
+
+	hub := x.hub.Clone()
+	scope := hub.Scope()
+	scope.SetTags(tags)
+	if id := logging.CorrelationID(); id != "" {
+		scope.SetTag("correlation_id", id)
+	}
+	for k, v := range Values(err) {
+		scope.SetExtra(k, extra(v))
+	}
+
+	eventID := hub.CaptureException(err)
+	if eventID == nil {
+		return ""
+	}
+	return string(*eventID)
+}
+
+// Flush waits until events are sent
+func (x *Reporter) Flush() {
+	if x == nil {
+		return
+	}
+	if !x.hub.Flush(flushTimeout) {
+		logger.Error().Msg("Timeout to send events to Sentry")
+	}
+}
+
+// Invoke calls handler of Lambda function and reports error returned by the handler. Panic in the handler is recovered and reported as error, then returned to Lambda. Events are tagged with function name and event source.
+func (x *Reporter) Invoke(function string, event golambda.Event, handler func() (interface{}, error)) (resp interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = golambda.NewError("Panic in Lambda function").With("panic", fmt.Sprintf("%v", r))
+			resp = nil
+		}
+
+		if err != nil {
+			eventID := x.Capture(err, map[string]string{
+				"function": function,
+				"source":   EventSource(event),
+			})
+			x.Flush()
+			if eventID != "" {
+				logger.Info().Str("sentry_event_id", eventID).Msg("Reported error to Sentry")
+			}
+		}
+	}()
+
+	return handler()
+}
+
+// EventSource returns source of Lambda event, e.g. "aws:sqs", "aws:sns", "aws.events" or "aws:apigateway". "direct" is returned for direct invocation.
+func EventSource(event golambda.Event) string {
+	var ev struct {
+		// Case of key is "eventSource" in SQS and "EventSource" in SNS
+		Records []struct {
+			EventSource string `json:"eventSource"`
+		} `json:"Records"`
+		Source         string          `json:"source"`
+		RequestContext json.RawMessage `json:"requestContext"`
+	}
+	if err := event.Bind(&ev); err != nil {
+		return "unknown"
+	}
+
+	switch {
+	case len(ev.Records) > 0 && ev.Records[0].EventSource != "":
+		return ev.Records[0].EventSource
+	case ev.Source != "":
+		return ev.Source
+	case len(ev.RequestContext) > 0:
+		return "aws:apigateway"
+	default:
+		return "direct"
+	}
+}
@@ -0,0 +1,122 @@
+package reporting_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/cookpad/retrospector/pkg/reporting"
+	"github.com/m-mizutani/golambda"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sentryServer is local endpoint compatible with Sentry store API
+type sentryServer struct {
+	mutex  sync.Mutex
+	events []map[string]interface{}
+	server *httptest.Server
+}
+
+func newSentryServer(t *testing.T) *sentryServer {
+	s := &sentryServer{}
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/1/store/", r.URL.Path)
+		var ev map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&ev))
+
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		s.events = append(s.events, ev)
+	}))
+	return s
+}
+
+func (x *sentryServer) DSN() string {
+	return strings.Replace(x.server.URL, "http://", "http://public@", 1) + "/1"
+}
+
+func TestReporter(t *testing.T) {
+	server := newSentryServer(t)
+	defer server.server.Close()
+
+	reporter, err := reporting.NewReporter(&reporting.Options{DSN: server.DSN(), Environment: "test"})
+	require.NoError(t, err)
+
+	event := golambda.Event{Origin: events.SQSEvent{
+		Records: []events.SQSMessage{{MessageId: "1", EventSource: "aws:sqs", Body: "blue"}},
+	}}
+
+	t.Run("error with values", func(t *testing.T) {
+		_, err := reporter.Invoke("iocDetect", event, func() (interface{}, error) {
+			cause := golambda.NewError("Failed BatchGetItem").With("table", "records")
+			return nil, golambda.WrapError(cause, "Failed to look up").With("values", 3)
+		})
+		require.Error(t, err)
+
+		require.Equal(t, 1, len(server.events))
+		ev := server.events[0]
+		assert.Equal(t, "test", ev["environment"])
+		assert.Equal(t, map[string]interface{}{"function": "iocDetect", "source": "aws:sqs"}, ev["tags"])
+		assert.Equal(t, map[string]interface{}{"table": "records", "values": float64(3)}, ev["extra"])
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		resp, err := reporter.Invoke("entityDetect", event, func() (interface{}, error) {
+			var m map[string]int
+			m["x"] = 1
+			return "ok", nil
+		})
+		require.Error(t, err)
+		assert.Nil(t, resp)
+
+		require.Equal(t, 2, len(server.events))
+		extra := server.events[1]["extra"].(map[string]interface{})
+		assert.Contains(t, extra["panic"], "assignment to entry in nil map")
+	})
+
+	t.Run("no report without error", func(t *testing.T) {
+		resp, err := reporter.Invoke("entityDetect", event, func() (interface{}, error) {
+			return "ok", nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "ok", resp)
+		assert.Equal(t, 2, len(server.events))
+	})
+}
+
+func TestNilReporter(t *testing.T) {
+	reporter, err := reporting.NewReporter(&reporting.Options{})
+	require.NoError(t, err)
+	require.Nil(t, reporter)
+
+	// Panic is recovered even if Sentry is not configured
+	_, err = reporter.Invoke("api", golambda.Event{}, func() (interface{}, error) {
+		panic("boom")
+	})
+	require.Error(t, err)
+}
+
+func TestEventSource(t *testing.T) {
+	testCases := []struct {
+		title  string
+		origin interface{}
+		source string
+	}{
+		{"sqs", events.SQSEvent{Records: []events.SQSMessage{{EventSource: "aws:sqs"}}}, "aws:sqs"},
+		{"sns", events.SNSEvent{Records: []events.SNSEventRecord{{EventSource: "aws:sns"}}}, "aws:sns"},
+		{"schedule", events.CloudWatchEvent{Source: "aws.events"}, "aws.events"},
+		{"api gateway", map[string]interface{}{"requestContext": map[string]interface{}{"stage": "prod"}}, "aws:apigateway"},
+		{"direct", map[string]interface{}{"bucket": "blue"}, "direct"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			assert.Equal(t, tc.source, reporting.EventSource(golambda.Event{Origin: tc.origin}))
+		})
+	}
+}
@@ -12,12 +12,17 @@ import (
 	"github.com/m-mizutani/golambda"
 	"github.com/cookpad/retrospector"
 	"github.com/cookpad/retrospector/pkg/adaptor"
+	"github.com/cookpad/retrospector/pkg/metrics"
 	"github.com/slack-go/slack"
 )
 
 type AlertServiceArguments struct {
 	SlackIncomingWebhookURL string
 	HTTPClient              adaptor.HTTPClient
+	// EnrichService is optional. Alert is enriched before emitting if it is set
+	EnrichService *EnrichService
+	// SuppressBenign drops alert if reputation enrichers judge the value as benign and none judges it as malicious or suspicious
+	SuppressBenign bool
 }
 
 type AlertService struct {
@@ -36,6 +41,41 @@ type Alert struct {
 	Target   *retrospector.Value
 	Entities []*retrospector.Entity
 	IOCChunk retrospector.IOCChunk
+
+	Enrichments []*Enrichment
+	Severity    Severity
+	// State is lifecycle state of the alert. It is optional
+	State *retrospector.AlertState
+	// CorrelationID ties the alert to log lines of S3 object or IOC chunk that caused it. It is optional
+	CorrelationID string
+}
+
+// Severity of alert. It is decided by verdicts of reputation enrichers
+type Severity string
+
+const (
+	SeverityLow    Severity = "low"
+	SeverityMedium Severity = "medium"
+	SeverityHigh   Severity = "high"
+)
+
+// EvaluateSeverity decides severity by verdicts in enrichments. Alert is benign if at least one verdict is benign and no verdict is malicious or suspicious.
+func (x *Alert) EvaluateSeverity() (severity Severity, benign bool) {
+	verdicts := make(map[retrospector.Verdict]bool)
+	for _, enrichment := range x.Enrichments {
+		verdicts[enrichment.Verdict] = true
+	}
+
+	switch {
+	case verdicts[retrospector.VerdictMalicious]:
+		return SeverityHigh, false
+	case verdicts[retrospector.VerdictSuspicious]:
+		return SeverityMedium, false
+	case verdicts[retrospector.VerdictBenign]:
+		return SeverityLow, true
+	default:
+		return SeverityMedium, false
+	}
 }
 
 // AlertCause shows type of alert
@@ -51,6 +91,59 @@ const (
 // Up to 3 IOC/entity items in slack message
 const maxItemDisplaySlack = 3
 
+// Slack allows up to 10 fields in a section block
+const maxFieldsSlack = 10
+
+func formatUnixTime(ts int64) string {
+	if ts == 0 {
+		return "unknown"
+	}
+	return time.Unix(ts, 0).Format("2006-01-02 15:04:05")
+}
+
+// relationText describes when the entity was seen compared with the earliest publication in IOC set
+func relationText(entity *retrospector.Entity, iocChunk retrospector.IOCChunk) string {
+	var earliest *retrospector.IOC
+	for _, ioc := range iocChunk {
+		if ioc.PublishedAt() > 0 && (earliest == nil || ioc.PublishedAt() < earliest.PublishedAt()) {
+			earliest = ioc
+		}
+	}
+	if earliest == nil {
+		return "IOC publication time is unknown"
+	}
+
+	switch retrospector.RelationOf(entity, earliest) {
+	case retrospector.RelationBeforePublication:
+		return "Seen before IOC publication"
+	case retrospector.RelationAfterPublication:
+		return "Seen after IOC publication"
+	case retrospector.RelationAcrossPublication:
+		return "Seen before and after IOC publication"
+	default:
+		return "unknown"
+	}
+}
+
+// Evaluate enriches alert and decides its severity. It returns true if the alert should be suppressed because reputation enrichers judge the value benign.
+func (x *AlertService) Evaluate(alert *Alert) (suppress bool) {
+	if x.args.EnrichService != nil && alert.Enrichments == nil {
+		alert.Enrichments = x.args.EnrichService.Enrich(alert.Target)
+	}
+
+	severity, benign := alert.EvaluateSeverity()
+	if benign && x.args.SuppressBenign {
+		logger.Info().Interface("target", alert.Target).Interface("enrichments", alert.Enrichments).Msg("Suppressed alert of benign value")
+		metrics.Count("AlertsSuppressed", 1, metrics.Dimensions{"Reason": "benign"})
+		return true
+	}
+	if alert.Severity == "" {
+		alert.Severity = severity
+	}
+	return false
+}
+
+// EmitToSlack posts alert to Slack. Severity is decided by enrichments if Evaluate has not been called.
 func (x *AlertService) EmitToSlack(alert *Alert) error {
 	if x.args.HTTPClient == nil {
 		return golambda.NewError("HTTPClient is required in AlertServiceArguments to emit Slack, but not set")
@@ -59,6 +152,10 @@ func (x *AlertService) EmitToSlack(alert *Alert) error {
 		return golambda.NewError("SlackIncomingWebhookURL is required in AlertServiceArguments to emit Slack, but not set")
 	}
 
+	if alert.Severity == "" {
+		alert.Severity, _ = alert.EvaluateSeverity()
+	}
+
 	newField := func(title, value string) *slack.TextBlockObject {
 		return slack.NewTextBlockObject("mrkdwn", fmt.Sprintf("*%s*\n%s", title, value), false, false)
 	}
@@ -67,8 +164,23 @@ func (x *AlertService) EmitToSlack(alert *Alert) error {
 		strings.Replace(alert.Target.Data, ".", "[.]", -1),
 		alert.Target.Type,
 	)
+	context := []slack.MixedElement{
+		slack.NewTextBlockObject("mrkdwn", fmt.Sprintf("Severity: *%s*", alert.Severity), false, false),
+	}
+	if alert.State != nil {
+		context = append(context,
+			slack.NewTextBlockObject("mrkdwn", fmt.Sprintf("Status: *%s*", alert.State.Status), false, false),
+			slack.NewTextBlockObject("mrkdwn", fmt.Sprintf("Detections: *%d*", alert.State.DetectionCount), false, false),
+		)
+	}
+	if alert.CorrelationID != "" {
+		context = append(context,
+			slack.NewTextBlockObject("mrkdwn", fmt.Sprintf("Correlation ID: `%s`", alert.CorrelationID), false, false),
+		)
+	}
 	blocks := []slack.Block{
 		slack.NewHeaderBlock(slack.NewTextBlockObject("plain_text", title, true, false)),
+		slack.NewContextBlock("", context...),
 	}
 
 	blocks = append(blocks, slack.NewDividerBlock())
@@ -85,6 +197,7 @@ func (x *AlertService) EmitToSlack(alert *Alert) error {
 			[]*slack.TextBlockObject{
 				newField("Reason", ioc.Reason),
 				newField("UpdatedAt", time.Unix(ioc.UpdatedAt, 0).Format("2006-01-02 15:04:05")),
+				newField("PublishedAt", formatUnixTime(ioc.PublishedAt())),
 				newField("Description", strings.Replace(ioc.Description, ".", "[.]", -1)),
 			}, nil),
 		)
@@ -99,15 +212,43 @@ func (x *AlertService) EmitToSlack(alert *Alert) error {
 			break
 		}
 
+		first, last, count := entity.Seen()
 		blocks = append(blocks, slack.NewSectionBlock(
 			slack.NewTextBlockObject("mrkdwn", fmt.Sprintf("*%s*", entity.Source), false, false),
 			[]*slack.TextBlockObject{
+				newField("Subject", entity.Subject),
 				newField("Description", entity.Description),
-				newField("RecordedAt", time.Unix(entity.RecordedAt, 0).Format("2006-01-02 15:04:05")),
+				newField("FirstSeen", time.Unix(first, 0).Format("2006-01-02 15:04:05")),
+				newField("LastSeen", time.Unix(last, 0).Format("2006-01-02 15:04:05")),
+				newField("Count", fmt.Sprintf("%d", count)),
+				newField("Timing", relationText(entity, alert.IOCChunk)),
 			}, nil,
 		))
 	}
 
+	if len(alert.Enrichments) > 0 {
+		blocks = append(blocks, slack.NewDividerBlock())
+		blocks = append(blocks, slack.NewSectionBlock(
+			slack.NewTextBlockObject("mrkdwn", "*Enrichment*", false, false), nil, nil))
+
+		for _, enrichment := range alert.Enrichments {
+			var fields []*slack.TextBlockObject
+			for i, field := range enrichment.Fields {
+				if i >= maxFieldsSlack {
+					break
+				}
+				fields = append(fields, newField(field.Key, strings.Replace(field.Value, ".", "[.]", -1)))
+			}
+			if enrichment.Verdict != "" && len(fields) < maxFieldsSlack {
+				fields = append(fields, newField("Verdict", string(enrichment.Verdict)))
+			}
+			blocks = append(blocks, slack.NewSectionBlock(
+				slack.NewTextBlockObject("mrkdwn", fmt.Sprintf("*%s*", enrichment.Name), false, false),
+				fields, nil,
+			))
+		}
+	}
+
 	msg := slack.NewBlockMessage(blocks...)
 	raw, err := json.Marshal(msg)
 	if err != nil {
@@ -129,5 +270,6 @@ func (x *AlertService) EmitToSlack(alert *Alert) error {
 			With("msg", msg).With("code", resp.StatusCode).With("body", string(body))
 	}
 
+	metrics.Count("AlertsEmitted", 1, metrics.Dimensions{"Sink": "slack"})
 	return nil
 }
@@ -1,13 +1,17 @@
 package service_test
 
 import (
+	"io/ioutil"
 	"net/http"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/cookpad/retrospector"
+	"github.com/cookpad/retrospector/pkg/mock"
 	"github.com/cookpad/retrospector/pkg/service"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -47,3 +51,78 @@ func TestAlertServiceSlackIntegration(t *testing.T) {
 
 	require.NoError(t, err)
 }
+
+func TestAlertSeverity(t *testing.T) {
+	newAlert := func(verdicts ...retrospector.Verdict) *service.Alert {
+		alert := &service.Alert{
+			Cause:  service.AlertCauseEntity,
+			Target: &retrospector.Value{Data: "192.0.2.1", Type: retrospector.ValueIPAddr},
+		}
+		for _, v := range verdicts {
+			alert.Enrichments = append(alert.Enrichments, &service.Enrichment{Name: "dummy", Verdict: v})
+		}
+		return alert
+	}
+
+	testCases := []struct {
+		title    string
+		alert    *service.Alert
+		severity service.Severity
+		benign   bool
+	}{
+		{"no verdict", newAlert(), service.SeverityMedium, false},
+		{"malicious", newAlert(retrospector.VerdictBenign, retrospector.VerdictMalicious), service.SeverityHigh, false},
+		{"suspicious", newAlert(retrospector.VerdictUnknown, retrospector.VerdictSuspicious), service.SeverityMedium, false},
+		{"benign", newAlert(retrospector.VerdictUnknown, retrospector.VerdictBenign), service.SeverityLow, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			severity, benign := tc.alert.EvaluateSeverity()
+			assert.Equal(t, tc.severity, severity)
+			assert.Equal(t, tc.benign, benign)
+		})
+	}
+
+	t.Run("suppress benign alert", func(t *testing.T) {
+		httpClient := &mock.HTTPClient{
+			RespCode: http.StatusOK,
+			RespBody: ioutil.NopCloser(strings.NewReader("")),
+		}
+		alertSvc := service.NewAlertService(&service.AlertServiceArguments{
+			SlackIncomingWebhookURL: "https://slack.example.com/hook",
+			HTTPClient:              httpClient,
+			SuppressBenign:          true,
+		})
+
+		assert.True(t, alertSvc.Evaluate(newAlert(retrospector.VerdictBenign)))
+
+		alert := newAlert(retrospector.VerdictMalicious)
+		assert.False(t, alertSvc.Evaluate(alert))
+		require.NoError(t, alertSvc.EmitToSlack(alert))
+		assert.Equal(t, 1, len(httpClient.Requests))
+		assert.Equal(t, service.SeverityHigh, alert.Severity)
+	})
+}
+
+func TestAlertCorrelationID(t *testing.T) {
+	httpClient := &mock.HTTPClient{
+		RespCode: http.StatusOK,
+		RespBody: ioutil.NopCloser(strings.NewReader("")),
+	}
+	alertSvc := service.NewAlertService(&service.AlertServiceArguments{
+		SlackIncomingWebhookURL: "https://slack.example.com/hook",
+		HTTPClient:              httpClient,
+	})
+
+	require.NoError(t, alertSvc.EmitToSlack(&service.Alert{
+		Cause:         service.AlertCauseEntity,
+		Target:        &retrospector.Value{Data: "example.com", Type: retrospector.ValueDomainName},
+		Entities:      []*retrospector.Entity{{Source: "proxy", Subject: "alice"}},
+		CorrelationID: "0123456789abcdef0123456789abcdef",
+	}))
+	require.Equal(t, 1, len(httpClient.Requests))
+	body, err := ioutil.ReadAll(httpClient.Requests[0].Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), "Correlation ID: `0123456789abcdef0123456789abcdef`")
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cookpad/retrospector"
+)
+
+// EnrichmentField is a key-value pair of enrichment
+type EnrichmentField struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// Enrichment is context of a value provided by an Enricher. Verdict is set by reputation enrichers and used to decide alert severity.
+type Enrichment struct {
+	Name    string               `json:"name"`
+	Fields  []*EnrichmentField   `json:"fields"`
+	Verdict retrospector.Verdict `json:"verdict,omitempty"`
+}
+
+// Add appends a field to the enrichment. Empty value is ignored.
+func (x *Enrichment) Add(key, value string) *Enrichment {
+	if value != "" {
+		x.Fields = append(x.Fields, &EnrichmentField{Key: key, Value: value})
+	}
+	return x
+}
+
+// Enricher provides context of a value for alert. Enrich returns nil if the enricher has nothing about the value (e.g. GeoIP for a domain name).
+type Enricher interface {
+	Name() string
+	Enrich(ctx context.Context, value *retrospector.Value) (*Enrichment, error)
+}
+
+const (
+	defaultEnrichTimeout  = time.Second * 5
+	defaultEnrichCacheTTL = time.Hour
+)
+
+// EnrichService runs enrichers with timeout and cache. An error of enricher is logged and does not stop alert.
+type EnrichService struct {
+	enrichers []Enricher
+	timeout   time.Duration
+}
+
+// NewEnrichService is constructor of EnrichService. Default timeout (5 seconds) is used if timeout is zero.
+func NewEnrichService(timeout time.Duration, enrichers ...Enricher) *EnrichService {
+	if timeout <= 0 {
+		timeout = defaultEnrichTimeout
+	}
+	return &EnrichService{
+		enrichers: enrichers,
+		timeout:   timeout,
+	}
+}
+
+type enrichCacheKey struct {
+	name  string
+	value retrospector.Value
+}
+
+type enrichCacheEntry struct {
+	enrichment *Enrichment
+	expiresAt  time.Time
+}
+
+// enrichCache is shared among EnrichService instances in the process to reuse results over invocations of warm Lambda function
+var enrichCache = struct {
+	sync.Mutex
+	entries map[enrichCacheKey]*enrichCacheEntry
+}{entries: make(map[enrichCacheKey]*enrichCacheEntry)}
+
+func getEnrichCache(key enrichCacheKey, now time.Time) (*Enrichment, bool) {
+	enrichCache.Lock()
+	defer enrichCache.Unlock()
+
+	entry, ok := enrichCache.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if entry.expiresAt.Before(now) {
+		delete(enrichCache.entries, key)
+		return nil, false
+	}
+	return entry.enrichment, true
+}
+
+func putEnrichCache(key enrichCacheKey, enrichment *Enrichment, now time.Time) {
+	enrichCache.Lock()
+	defer enrichCache.Unlock()
+	enrichCache.entries[key] = &enrichCacheEntry{
+		enrichment: enrichment,
+		expiresAt:  now.Add(defaultEnrichCacheTTL),
+	}
+}
+
+// Enrich runs all enrichers in parallel for the value and returns results in order of enrichers
+func (x *EnrichService) Enrich(value *retrospector.Value) []*Enrichment {
+	results := make([]*Enrichment, len(x.enrichers))
+	var wg sync.WaitGroup
+
+	for i, enricher := range x.enrichers {
+		wg.Add(1)
+		go func(i int, enricher Enricher) {
+			defer wg.Done()
+			results[i] = x.run(enricher, value)
+		}(i, enricher)
+	}
+	wg.Wait()
+
+	var enrichments []*Enrichment
+	for _, result := range results {
+		if result != nil && len(result.Fields) > 0 {
+			enrichments = append(enrichments, result)
+		}
+	}
+	return enrichments
+}
+
+func (x *EnrichService) run(enricher Enricher, value *retrospector.Value) *Enrichment {
+	key := enrichCacheKey{name: enricher.Name(), value: *value}
+	if enrichment, ok := getEnrichCache(key, time.Now()); ok {
+		return enrichment
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), x.timeout)
+	defer cancel()
+
+	enrichment, err := enricher.Enrich(ctx, value)
+	if err != nil {
+		// Failed result is not cached to retry in next alert
+		logger.Error().Err(err).Str("enricher", enricher.Name()).Interface("value", value).Msg("Failed to enrich")
+		return nil
+	}
+	if enrichment != nil && enrichment.Name == "" {
+		enrichment.Name = enricher.Name()
+	}
+
+	putEnrichCache(key, enrichment, time.Now())
+	return enrichment
+}
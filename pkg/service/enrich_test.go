@@ -0,0 +1,61 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cookpad/retrospector"
+	"github.com/cookpad/retrospector/pkg/service"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type dummyEnricher struct {
+	name  string
+	calls int32
+	delay time.Duration
+	err   error
+}
+
+func (x *dummyEnricher) Name() string { return x.name }
+
+func (x *dummyEnricher) Enrich(ctx context.Context, value *retrospector.Value) (*service.Enrichment, error) {
+	atomic.AddInt32(&x.calls, 1)
+	if x.err != nil {
+		return nil, x.err
+	}
+	select {
+	case <-time.After(x.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return (&service.Enrichment{}).Add("Value", value.Data), nil
+}
+
+func TestEnrichService(t *testing.T) {
+	ok := &dummyEnricher{name: "ok-" + uuid.New().String()}
+	slow := &dummyEnricher{name: "slow-" + uuid.New().String(), delay: time.Second * 10}
+	failed := &dummyEnricher{name: "failed-" + uuid.New().String(), err: errors.New("failed")}
+
+	svc := service.NewEnrichService(time.Millisecond*100, ok, slow, failed)
+	value := &retrospector.Value{Data: "example.com", Type: retrospector.ValueDomainName}
+
+	started := time.Now()
+	resp := svc.Enrich(value)
+	assert.Less(t, int64(time.Since(started)), int64(time.Second), "slow enricher should time out")
+
+	// Only successful result is returned
+	require.Equal(t, 1, len(resp))
+	assert.Equal(t, ok.name, resp[0].Name)
+	assert.Equal(t, "example.com", resp[0].Fields[0].Value)
+
+	// Successful result is cached, but failed one is not
+	svc.Enrich(value)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&ok.calls))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&slow.calls))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&failed.calls))
+}
@@ -2,37 +2,67 @@ package service
 
 import (
 	"bufio"
-	"bytes"
 	"compress/gzip"
 	"encoding/json"
+	"io"
 	"sync"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/m-mizutani/golambda"
 	"github.com/cookpad/retrospector"
 	"github.com/cookpad/retrospector/pkg/adaptor"
+	"github.com/cookpad/retrospector/pkg/metrics"
+	"github.com/cookpad/retrospector/pkg/reader"
 )
 
 type EntityService struct {
-	newS3 adaptor.S3ClientFactory
+	newS3         adaptor.S3ClientFactory
+	rules         []*reader.Rule
+	internalCIDRs []string
 }
 
-func NewEntityService(newS3 adaptor.S3ClientFactory) *EntityService {
+// NewEntityService is constructor of EntityService. rules specify format of entity objects. Format of an object that matches no rule is detected automatically.
+func NewEntityService(newS3 adaptor.S3ClientFactory, rules ...*reader.Rule) *EntityService {
 	return &EntityService{
 		newS3: newS3,
+		rules: rules,
 	}
 }
 
+// WithInternalCIDRs sets internal networks that are applied to all formats in addition to Rule.InternalCIDRs
+func (x *EntityService) WithInternalCIDRs(cidrs []string) *EntityService {
+	x.internalCIDRs = cidrs
+	return x
+}
+
+// ruleOf returns rule of the object with internal networks of the service
+func (x *EntityService) ruleOf(bucket, key string) *reader.Rule {
+	rule := reader.FindRule(x.rules, bucket, key)
+	if len(x.internalCIDRs) == 0 {
+		return rule
+	}
+
+	merged := reader.Rule{}
+	if rule != nil {
+		merged = *rule
+	}
+	merged.InternalCIDRs = append(append([]string{}, x.internalCIDRs...), merged.InternalCIDRs...)
+	return &merged
+}
+
 type entityQueueMsg struct {
 	Error  error
 	Entity *retrospector.Entity
 }
 
 type ReadQueue struct {
-	queue  chan *entityQueueMsg
-	err    error
-	closed bool
+	queue     chan *entityQueueMsg
+	err       error
+	closed    bool
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
 func (x *ReadQueue) Read() *retrospector.Entity {
@@ -58,14 +88,36 @@ func (x *ReadQueue) Error() error {
 	return x.err
 }
 
+// Close stops reading the object and releases S3 object body. It must be called if reader stops before Read returns nil.
+func (x *ReadQueue) Close() {
+	x.closeOnce.Do(func() {
+		close(x.done)
+		x.closed = true
+	})
+}
+
+// errReadQueueClosed stops reading the object after ReadQueue is closed
+var errReadQueueClosed = golambda.NewError("ReadQueue is closed")
+
 // NewReadQueue is constructor of ReadQueue
 func (x *EntityService) NewReadQueue(region, bucket, key string) *ReadQueue {
 	queue := make(chan *entityQueueMsg, 256)
+	done := make(chan struct{})
+	// send returns false if ReadQueue is closed by reader
+	send := func(msg *entityQueueMsg) bool {
+		select {
+		case queue <- msg:
+			return true
+		case <-done:
+			return false
+		}
+	}
+
 	go func() {
 		defer close(queue)
 		s3Client, err := x.newS3(region)
 		if err != nil {
-			queue <- &entityQueueMsg{Error: err}
+			send(&entityQueueMsg{Error: err})
 			return
 		}
 
@@ -75,44 +127,104 @@ func (x *EntityService) NewReadQueue(region, bucket, key string) *ReadQueue {
 		}
 		output, err := s3Client.GetObject(input)
 		if err != nil {
-			queue <- &entityQueueMsg{
+			send(&entityQueueMsg{
 				Error: golambda.WrapError(err, "Failed GetObject").With("input", input),
-			}
+			})
 			return
 		}
+		defer output.Body.Close()
 
-		scanner := bufio.NewScanner(output.Body)
-		for scanner.Scan() {
-			buf := scanner.Bytes()
-			entity := &retrospector.Entity{}
-			if err := json.Unmarshal(buf, entity); err != nil {
-				queue <- &entityQueueMsg{
-					Error: golambda.WrapError(err, "Failed json.Marshal for scanned data").With("buf", string(buf)),
-				}
-				return
-			}
+		body, err := reader.Decompress(output.Body)
+		if err != nil {
+			send(&entityQueueMsg{Error: golambda.WrapError(err).With("input", input)})
+			return
+		}
+
+		br := bufio.NewReader(body)
+		head, _ := br.Peek(512)
 
-			queue <- &entityQueueMsg{
-				Entity: entity,
+		rule := x.ruleOf(bucket, key)
+		format := reader.FormatAuto
+		if rule != nil {
+			format = rule.Format
+		}
+		if format == reader.FormatAuto {
+			format = reader.Detect(key, head)
+		}
+
+		rd, err := reader.New(format, rule)
+		if err != nil {
+			send(&entityQueueMsg{Error: golambda.WrapError(err).With("input", input)})
+			return
+		}
+
+		count := 0
+		if err := rd.Read(br, func(entity *retrospector.Entity) error {
+			if !send(&entityQueueMsg{Entity: entity}) {
+				return errReadQueueClosed
 			}
+			count++
+			return nil
+		}); err != nil {
+			send(&entityQueueMsg{
+				Error: golambda.WrapError(err, "Failed to read entity object").With("input", input).With("format", format),
+			})
+			return
 		}
+
+		dims := metrics.Dimensions{"Format": string(format)}
+		metrics.Count("ObjectsRead", 1, dims)
+		metrics.Count("EntitiesRead", count, dims)
 	}()
 
 	return &ReadQueue{
 		queue: queue,
+		done:  done,
+	}
+}
+
+// RecordEncoder encodes records into a stream of S3 object. Begin is called before the first record and End is called after the last record.
+type RecordEncoder interface {
+	Begin(w io.Writer) error
+	Encode(w io.Writer, record interface{}) error
+	End(w io.Writer) error
+}
+
+// jsonlEncoder writes one JSON record per line
+type jsonlEncoder struct{}
+
+func (x *jsonlEncoder) Begin(w io.Writer) error { return nil }
+func (x *jsonlEncoder) End(w io.Writer) error   { return nil }
+
+func (x *jsonlEncoder) Encode(w io.Writer, record interface{}) error {
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return golambda.WrapError(err, "Failed to marshal record").With("record", record)
 	}
+
+	if _, err := w.Write(append(raw, '\n')); err != nil {
+		return golambda.WrapError(err, "Failed to write line of record").With("raw", string(raw))
+	}
+	return nil
 }
 
 type WriteQueue struct {
-	queue  chan *retrospector.Entity
+	queue  chan interface{}
 	wg     sync.WaitGroup
 	err    error
 	closed bool
+	// abortErr is set by Abort before closing queue
+	abortErr error
 }
 
 func (x *WriteQueue) Write(entity *retrospector.Entity) {
+	x.WriteRecord(entity)
+}
+
+// WriteRecord puts any record to be encoded by RecordEncoder of the queue
+func (x *WriteQueue) WriteRecord(record interface{}) {
 	if !x.closed {
-		x.queue <- entity
+		x.queue <- record
 	}
 }
 
@@ -122,9 +234,21 @@ func (x *WriteQueue) Close() error {
 	return x.err
 }
 
-// NewWriteQueue is constructor of WriteQueue
+// Abort discards written records and stops upload. Existing S3 object of the key is kept as it is.
+func (x *WriteQueue) Abort(err error) {
+	x.abortErr = err
+	close(x.queue)
+	x.wg.Wait()
+}
+
+// NewWriteQueue is constructor of WriteQueue that writes entities as gzip compressed JSONL
 func (x *EntityService) NewWriteQueue(region, bucket, key string) *WriteQueue {
-	queue := make(chan *retrospector.Entity, 256)
+	return x.NewRecordWriteQueue(region, bucket, key, &jsonlEncoder{})
+}
+
+// NewRecordWriteQueue is constructor of WriteQueue that writes records encoded by encoder as gzip compressed object. Records are streamed to S3 by multipart upload not to buffer whole object in memory.
+func (x *EntityService) NewRecordWriteQueue(region, bucket, key string, encoder RecordEncoder) *WriteQueue {
+	queue := make(chan interface{}, 256)
 	wq := &WriteQueue{
 		queue: queue,
 	}
@@ -133,6 +257,9 @@ func (x *EntityService) NewWriteQueue(region, bucket, key string) *WriteQueue {
 	go func() {
 		defer func() {
 			wq.closed = true
+			// Drain queue not to block writer after failure
+			for range queue {
+			}
 			wq.wg.Done()
 		}()
 
@@ -142,39 +269,61 @@ func (x *EntityService) NewWriteQueue(region, bucket, key string) *WriteQueue {
 			return
 		}
 
-		// TODO: async upload to S3
-		buf := &bytes.Buffer{}
-		gz := gzip.NewWriter(buf)
-		rc := []byte("\n")
-		for entity := range queue {
-			raw, err := json.Marshal(entity)
-			if err != nil {
-				wq.err = golambda.WrapError(err, "Failed to marshal entity").With("entity", entity)
-				return
-			}
-
-			if _, err := gz.Write(append(raw, rc...)); err != nil {
-				wq.err = golambda.WrapError(err, "Failed to write line of entity").With("raw", string(raw))
-				return
-			}
-		}
-		if err := gz.Close(); err != nil {
-			wq.err = golambda.WrapError(err, "Failed to close gzip stream")
-			return
-		}
+		pr, pw := io.Pipe()
+		encodeErr := make(chan error, 1)
+		go func() {
+			err := encodeRecords(pw, encoder, queue, wq)
+			// Upload fails without creating object if pipe is closed with error
+			pw.CloseWithError(err)
+			encodeErr <- err
+		}()
 
-		input := &s3.PutObjectInput{
+		input := &s3manager.UploadInput{
 			Bucket:          aws.String(bucket),
 			Key:             aws.String(key),
-			Body:            bytes.NewReader(buf.Bytes()),
+			Body:            pr,
 			ContentEncoding: aws.String("gzip"),
 			ContentType:     aws.String("application/x-gzip"),
 		}
-		if _, err := s3Client.PutObject(input); err != nil {
-			wq.err = golambda.WrapError(err, "Failed to put object").With("input", input)
+		_, uploadErr := s3Client.Upload(input)
+		// Unblock encoder if upload stopped before reading all data
+		pr.Close()
+
+		switch err := <-encodeErr; {
+		case err != nil && err == wq.abortErr:
+			return
+		case err != nil && err != io.ErrClosedPipe:
+			wq.err = err
+			return
+		}
+		if uploadErr != nil {
+			wq.err = golambda.WrapError(uploadErr, "Failed to upload object").With("bucket", bucket).With("key", key)
 			return
 		}
 	}()
 
 	return wq
 }
+
+// encodeRecords writes records in queue to w as gzip stream. It returns abort error of wq if the queue is aborted.
+func encodeRecords(w io.Writer, encoder RecordEncoder, queue chan interface{}, wq *WriteQueue) error {
+	gz := gzip.NewWriter(w)
+	if err := encoder.Begin(gz); err != nil {
+		return err
+	}
+	for record := range queue {
+		if err := encoder.Encode(gz, record); err != nil {
+			return err
+		}
+	}
+	if wq.abortErr != nil {
+		return wq.abortErr
+	}
+	if err := encoder.End(gz); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return golambda.WrapError(err, "Failed to close gzip stream")
+	}
+	return nil
+}
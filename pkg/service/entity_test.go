@@ -1,15 +1,22 @@
 package service_test
 
 import (
+	"bytes"
+	"compress/gzip"
+	"errors"
 	"fmt"
 	"os"
+	"runtime"
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/google/uuid"
 	"github.com/cookpad/retrospector"
 	"github.com/cookpad/retrospector/pkg/adaptor"
 	"github.com/cookpad/retrospector/pkg/mock"
+	"github.com/cookpad/retrospector/pkg/reader"
 	"github.com/cookpad/retrospector/pkg/service"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -83,4 +90,120 @@ func testS3Service(t *testing.T, newS3 adaptor.S3ClientFactory, s3Region, s3Buck
 
 		require.NoError(t, rq.Error())
 	})
+
+	t.Run("Closed read queue stops reading", func(t *testing.T) {
+		s3Key := fmt.Sprintf("retrospector-test/%s.json.gz", uuid.New().String())
+		svc := service.NewEntityService(newS3)
+		wq := svc.NewWriteQueue(s3Region, s3Bucket, s3Key)
+		// More entities than buffer of ReadQueue
+		for i := 0; i < 1000; i++ {
+			wq.Write(&retrospector.Entity{Source: fmt.Sprintf("hoge:%d", i)})
+		}
+		require.NoError(t, wq.Close())
+
+		goroutines := runtime.NumGoroutine()
+		rq := svc.NewReadQueue(s3Region, s3Bucket, s3Key)
+		require.NotNil(t, rq.Read())
+		rq.Close()
+		assert.Nil(t, rq.Read())
+		require.NoError(t, rq.Error())
+		// Reader goroutine exits after Close
+		for i := 0; i < 100 && runtime.NumGoroutine() > goroutines; i++ {
+			time.Sleep(time.Millisecond * 10)
+		}
+		assert.LessOrEqual(t, runtime.NumGoroutine(), goroutines)
+	})
+
+	t.Run("Aborted write keeps existing object", func(t *testing.T) {
+		entity := &retrospector.Entity{
+			Value: retrospector.Value{
+				Data: "10.1.2.3",
+				Type: retrospector.ValueIPAddr,
+			},
+			Source: "hoge:1",
+		}
+
+		s3Key := fmt.Sprintf("retrospector-test/%s.json.gz", uuid.New().String())
+		svc := service.NewEntityService(newS3)
+		wq := svc.NewWriteQueue(s3Region, s3Bucket, s3Key)
+		wq.Write(entity)
+		require.NoError(t, wq.Close())
+
+		aborted := svc.NewWriteQueue(s3Region, s3Bucket, s3Key)
+		aborted.Write(&retrospector.Entity{Source: "moge:1"})
+		aborted.Abort(errors.New("scan failed"))
+
+		rq := svc.NewReadQueue(s3Region, s3Bucket, s3Key)
+		e0 := rq.Read()
+		require.NotNil(t, e0)
+		assert.Equal(t, entity, e0)
+		assert.Nil(t, rq.Read())
+		require.NoError(t, rq.Error())
+	})
+}
+
+func TestEntityServiceFormatRule(t *testing.T) {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	_, err := gz.Write([]byte("host,remote\nblue,10.1.2.3\n"))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+
+	newS3, client := mock.NewS3Mock()
+	_, err = client.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String("my-bucket"),
+		Key:    aws.String("csv/entities.csv.gz"),
+		Body:   bytes.NewReader(buf.Bytes()),
+	})
+	require.NoError(t, err)
+
+	svc := service.NewEntityService(newS3, &reader.Rule{
+		Prefix: "csv/",
+		Format: reader.FormatCSV,
+		Source: "firewall",
+		CSV:    &reader.CSVOption{HasHeader: true},
+		Mapping: &reader.Mapping{
+			Values:  map[string]retrospector.ValueType{"remote": retrospector.ValueIPAddr},
+			Subject: "host",
+		},
+	})
+
+	rq := svc.NewReadQueue("my-region", "my-bucket", "csv/entities.csv.gz")
+	e0 := rq.Read()
+	require.NotNil(t, e0)
+	assert.Equal(t, "10.1.2.3", e0.Data)
+	assert.Equal(t, retrospector.ValueIPAddr, e0.Type)
+	assert.Equal(t, "blue", e0.Subject)
+	assert.Equal(t, "firewall", e0.Source)
+	assert.Nil(t, rq.Read())
+	require.NoError(t, rq.Error())
+}
+
+func TestEntityServiceInternalCIDRs(t *testing.T) {
+	data := "version account-id interface-id srcaddr dstaddr srcport dstport protocol packets bytes start end action log-status\n" +
+		"2 123456789012 eni-0123 10.0.0.1 198.51.100.1 49152 443 6 10 840 1600000000 1600000060 ACCEPT OK\n" +
+		"2 123456789012 eni-0123 10.0.0.1 203.0.113.1 49153 443 6 10 840 1600000000 1600000060 ACCEPT OK\n"
+
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	_, err := gz.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+
+	newS3, client := mock.NewS3Mock()
+	_, err = client.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String("my-bucket"),
+		Key:    aws.String("AWSLogs/123456789012/vpcflowlogs/ap-northeast-1/2020/09/13/flow.log"),
+		Body:   bytes.NewReader(buf.Bytes()),
+	})
+	require.NoError(t, err)
+
+	svc := service.NewEntityService(newS3).WithInternalCIDRs([]string{"203.0.113.0/24"})
+	rq := svc.NewReadQueue("my-region", "my-bucket", "AWSLogs/123456789012/vpcflowlogs/ap-northeast-1/2020/09/13/flow.log")
+	e0 := rq.Read()
+	require.NotNil(t, e0)
+	assert.Equal(t, "198.51.100.1", e0.Data)
+	assert.Equal(t, "eni-0123", e0.Subject)
+	assert.Nil(t, rq.Read())
+	require.NoError(t, rq.Error())
 }
@@ -0,0 +1,424 @@
+package service
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cookpad/retrospector"
+	"github.com/google/uuid"
+	"github.com/m-mizutani/golambda"
+)
+
+// ExportFormat is format of exported object
+type ExportFormat string
+
+const (
+	ExportJSONL ExportFormat = "jsonl"
+	ExportCSV   ExportFormat = "csv"
+	ExportSTIX  ExportFormat = "stix"
+)
+
+// Extension returns file extension of the format
+func (x ExportFormat) Extension() string {
+	switch x {
+	case ExportSTIX:
+		return "stix.json"
+	default:
+		return string(x)
+	}
+}
+
+// IsValid returns true if the format is supported
+func (x ExportFormat) IsValid() bool {
+	switch x {
+	case ExportJSONL, ExportCSV, ExportSTIX:
+		return true
+	}
+	return false
+}
+
+// ExportFilter selects IOCs and entities to be exported. Empty field matches everything. Since and Until are unix seconds and compared with UpdatedAt of IOC and seen period of entity.
+type ExportFilter struct {
+	Sources []string
+	Types   []retrospector.ValueType
+	Since   int64
+	Until   int64
+}
+
+func (x *ExportFilter) matchValue(value *retrospector.Value, source string) bool {
+	if len(x.Sources) > 0 && !containsString(x.Sources, source) {
+		return false
+	}
+	if len(x.Types) > 0 {
+		matched := false
+		for _, t := range x.Types {
+			if t == value.Type {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchIOC returns true if the IOC should be exported
+func (x *ExportFilter) MatchIOC(ioc *retrospector.IOC) bool {
+	if !x.matchValue(&ioc.Value, ioc.Source) {
+		return false
+	}
+	if x.Since > 0 && ioc.UpdatedAt < x.Since {
+		return false
+	}
+	if x.Until > 0 && ioc.UpdatedAt > x.Until {
+		return false
+	}
+	return true
+}
+
+// MatchEntity returns true if the entity should be exported. An entity matches if its seen period overlaps with the time range.
+func (x *ExportFilter) MatchEntity(entity *retrospector.Entity) bool {
+	if !x.matchValue(&entity.Value, entity.Source) {
+		return false
+	}
+	first, last, _ := entity.Seen()
+	if x.Since > 0 && last < x.Since {
+		return false
+	}
+	if x.Until > 0 && first > x.Until {
+		return false
+	}
+	return true
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// NewIOCEncoder returns RecordEncoder of IOC for the format
+func NewIOCEncoder(format ExportFormat) (RecordEncoder, error) {
+	switch format {
+	case ExportJSONL:
+		return &jsonlEncoder{}, nil
+	case ExportCSV:
+		return &csvEncoder{header: iocCSVHeader, row: iocCSVRow}, nil
+	case ExportSTIX:
+		return &stixEncoder{objects: stixIOCObjects}, nil
+	}
+	return nil, golambda.NewError("Unsupported export format").With("format", format)
+}
+
+// NewEntityEncoder returns RecordEncoder of entity for the format
+func NewEntityEncoder(format ExportFormat) (RecordEncoder, error) {
+	switch format {
+	case ExportJSONL:
+		return &jsonlEncoder{}, nil
+	case ExportCSV:
+		return &csvEncoder{header: entityCSVHeader, row: entityCSVRow}, nil
+	case ExportSTIX:
+		return &stixEncoder{objects: stixEntityObjects}, nil
+	}
+	return nil, golambda.NewError("Unsupported export format").With("format", format)
+}
+
+// csvEncoder writes header line and one row per record
+type csvEncoder struct {
+	header []string
+	row    func(record interface{}) ([]string, error)
+	w      *csv.Writer
+}
+
+func (x *csvEncoder) Begin(w io.Writer) error {
+	x.w = csv.NewWriter(w)
+	if err := x.w.Write(x.header); err != nil {
+		return golambda.WrapError(err, "Failed to write CSV header")
+	}
+	return nil
+}
+
+func (x *csvEncoder) Encode(w io.Writer, record interface{}) error {
+	row, err := x.row(record)
+	if err != nil {
+		return err
+	}
+	if err := x.w.Write(row); err != nil {
+		return golambda.WrapError(err, "Failed to write CSV row").With("record", record)
+	}
+	return nil
+}
+
+func (x *csvEncoder) End(w io.Writer) error {
+	x.w.Flush()
+	if err := x.w.Error(); err != nil {
+		return golambda.WrapError(err, "Failed to flush CSV")
+	}
+	return nil
+}
+
+var iocCSVHeader = []string{"type", "value", "source", "reason", "description", "updated_at", "first_seen", "valid_from", "valid_until", "revoked_at", "revoked_by"}
+
+func iocCSVRow(record interface{}) ([]string, error) {
+	ioc, ok := record.(*retrospector.IOC)
+	if !ok {
+		return nil, golambda.NewError("Record is not IOC").With("record", record)
+	}
+	return []string{
+		string(ioc.Type),
+		ioc.Data,
+		ioc.Source,
+		ioc.Reason,
+		ioc.Description,
+		formatUnix(ioc.UpdatedAt),
+		formatUnix(ioc.FirstSeen),
+		formatUnix(ioc.ValidFrom),
+		formatUnix(ioc.ValidUntil),
+		formatUnix(ioc.RevokedAt),
+		ioc.RevokedBy,
+	}, nil
+}
+
+var entityCSVHeader = []string{"type", "value", "subject", "source", "description", "first_seen", "last_seen", "count"}
+
+func entityCSVRow(record interface{}) ([]string, error) {
+	entity, ok := record.(*retrospector.Entity)
+	if !ok {
+		return nil, golambda.NewError("Record is not entity").With("record", record)
+	}
+	first, last, count := entity.Seen()
+	return []string{
+		string(entity.Type),
+		entity.Data,
+		entity.Subject,
+		entity.Source,
+		entity.Description,
+		formatUnix(first),
+		formatUnix(last),
+		strconv.FormatInt(count, 10),
+	}, nil
+}
+
+// formatUnix returns RFC3339 string of unix seconds. Empty string is returned for zero.
+func formatUnix(ts int64) string {
+	if ts == 0 {
+		return ""
+	}
+	return time.Unix(ts, 0).UTC().Format(time.RFC3339)
+}
+
+// stixEncoder writes STIX 2.1 bundle. Objects are streamed into "objects" array and only identifiers of written objects are kept to skip duplicated observables.
+type stixEncoder struct {
+	objects func(record interface{}) ([]stixObject, error)
+	written map[interface{}]struct{}
+}
+
+type stixObject map[string]interface{}
+
+// stixNamespace is namespace of UUIDv5 for deterministic identifiers of STIX Cyber-observable Objects defined in STIX 2.1 specification
+var stixNamespace = uuid.MustParse("00abedb4-aa42-466c-9c01-fed23315a9b7")
+
+// stixProducerNamespace is namespace of UUIDv5 for identifiers of objects produced by retrospector
+var stixProducerNamespace = uuid.NewSHA1(uuid.NameSpaceURL, []byte("https://github.com/cookpad/retrospector"))
+
+func (x *stixEncoder) Begin(w io.Writer) error {
+	x.written = make(map[interface{}]struct{})
+	id := "bundle--" + uuid.New().String()
+	if _, err := fmt.Fprintf(w, `{"type":"bundle","id":%q,"objects":[`, id); err != nil {
+		return golambda.WrapError(err, "Failed to write STIX bundle header")
+	}
+	return nil
+}
+
+func (x *stixEncoder) Encode(w io.Writer, record interface{}) error {
+	objects, err := x.objects(record)
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range objects {
+		// Observable shared by multiple entities is written only once
+		if _, ok := x.written[obj["id"]]; ok {
+			continue
+		}
+
+		raw, err := json.Marshal(obj)
+		if err != nil {
+			return golambda.WrapError(err, "Failed to marshal STIX object").With("object", obj)
+		}
+		if len(x.written) > 0 {
+			raw = append([]byte(",\n"), raw...)
+		} else {
+			raw = append([]byte("\n"), raw...)
+		}
+		if _, err := w.Write(raw); err != nil {
+			return golambda.WrapError(err, "Failed to write STIX object")
+		}
+		x.written[obj["id"]] = struct{}{}
+	}
+	return nil
+}
+
+func (x *stixEncoder) End(w io.Writer) error {
+	if _, err := w.Write([]byte("\n]}\n")); err != nil {
+		return golambda.WrapError(err, "Failed to write STIX bundle footer")
+	}
+	return nil
+}
+
+// stixLabels returns non-empty labels. STIX does not allow empty string in labels.
+func stixLabels(labels ...string) []string {
+	results := []string{}
+	for _, label := range labels {
+		if label != "" {
+			results = append(results, label)
+		}
+	}
+	return results
+}
+
+// stixTimestamp formats unix seconds as STIX timestamp
+func stixTimestamp(ts int64) string {
+	return time.Unix(ts, 0).UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+// stixObservable returns STIX Cyber-observable Object of the value and property path used in pattern
+func stixObservable(value *retrospector.Value) (stixObject, string) {
+	switch value.Type {
+	case retrospector.ValueIPAddr:
+		objType := "ipv4-addr"
+		if strings.Contains(value.Data, ":") {
+			objType = "ipv6-addr"
+		}
+		return stixObject{"type": objType, "value": value.Data}, objType + ":value"
+	case retrospector.ValueDomainName:
+		return stixObject{"type": "domain-name", "value": value.Data}, "domain-name:value"
+	case retrospector.ValueURL:
+		return stixObject{"type": "url", "value": value.Data}, "url:value"
+	case retrospector.ValueFileHashSha256:
+		return stixObject{"type": "file", "hashes": map[string]string{"SHA-256": value.Data}}, "file:hashes.'SHA-256'"
+	case retrospector.ValueFileHashSha1:
+		return stixObject{"type": "file", "hashes": map[string]string{"SHA-1": value.Data}}, "file:hashes.'SHA-1'"
+	case retrospector.ValueFileHashMD5:
+		return stixObject{"type": "file", "hashes": map[string]string{"MD5": value.Data}}, "file:hashes.MD5"
+	}
+	return nil, ""
+}
+
+// stixPattern returns STIX pattern that matches the value
+func stixPattern(value *retrospector.Value) string {
+	_, path := stixObservable(value)
+	if path == "" {
+		return ""
+	}
+	escaped := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value.Data)
+	return fmt.Sprintf("[%s = '%s']", path, escaped)
+}
+
+// stixObservableID returns deterministic identifier of the observable from its ID contributing properties
+func stixObservableID(obj stixObject) string {
+	props := stixObject{}
+	for k, v := range obj {
+		if k != "type" {
+			props[k] = v
+		}
+	}
+	raw, _ := json.Marshal(props)
+	return fmt.Sprintf("%s--%s", obj["type"], uuid.NewSHA1(stixNamespace, raw))
+}
+
+func stixProducerID(objType string, parts ...string) string {
+	name := objType + "|" + strings.Join(parts, "|")
+	return fmt.Sprintf("%s--%s", objType, uuid.NewSHA1(stixProducerNamespace, []byte(name)))
+}
+
+// stixIOCObjects converts IOC into an indicator. Revoked IOC is exported with revoked flag.
+func stixIOCObjects(record interface{}) ([]stixObject, error) {
+	ioc, ok := record.(*retrospector.IOC)
+	if !ok {
+		return nil, golambda.NewError("Record is not IOC").With("record", record)
+	}
+	pattern := stixPattern(&ioc.Value)
+	if pattern == "" {
+		return nil, nil
+	}
+
+	created := ioc.UpdatedAt
+	if published := ioc.PublishedAt(); published > 0 && published < created {
+		created = published
+	}
+	modified := ioc.UpdatedAt
+	if ioc.RevokedAt > modified {
+		modified = ioc.RevokedAt
+	}
+	validFrom := ioc.PublishedAt()
+	if validFrom == 0 {
+		validFrom = created
+	}
+
+	indicator := stixObject{
+		"type":            "indicator",
+		"spec_version":    "2.1",
+		"id":              stixProducerID("indicator", string(ioc.Type), ioc.Data, ioc.Source),
+		"created":         stixTimestamp(created),
+		"modified":        stixTimestamp(modified),
+		"name":            ioc.Data,
+		"pattern":         pattern,
+		"pattern_type":    "stix",
+		"valid_from":      stixTimestamp(validFrom),
+		"indicator_types": []string{"malicious-activity"},
+		"labels":          stixLabels(ioc.Source),
+	}
+	if ioc.Description != "" || ioc.Reason != "" {
+		indicator["description"] = strings.TrimSpace(ioc.Reason + " " + ioc.Description)
+	}
+	if ioc.ValidUntil > validFrom {
+		indicator["valid_until"] = stixTimestamp(ioc.ValidUntil)
+	}
+	if ioc.IsRevoked() {
+		indicator["revoked"] = true
+	}
+
+	return []stixObject{indicator}, nil
+}
+
+// stixEntityObjects converts entity into an observable and observed-data that refers it
+func stixEntityObjects(record interface{}) ([]stixObject, error) {
+	entity, ok := record.(*retrospector.Entity)
+	if !ok {
+		return nil, golambda.NewError("Record is not entity").With("record", record)
+	}
+	observable, _ := stixObservable(&entity.Value)
+	if observable == nil {
+		return nil, nil
+	}
+	observableID := stixObservableID(observable)
+	observable["id"] = observableID
+	observable["spec_version"] = "2.1"
+
+	first, last, count := entity.Seen()
+	observed := stixObject{
+		"type":            "observed-data",
+		"spec_version":    "2.1",
+		"id":              stixProducerID("observed-data", string(entity.Type), entity.Data, entity.Subject, entity.Source),
+		"created":         stixTimestamp(first),
+		"modified":        stixTimestamp(last),
+		"first_observed":  stixTimestamp(first),
+		"last_observed":   stixTimestamp(last),
+		"number_observed": count,
+		"object_refs":     []string{observableID},
+		"labels":          stixLabels(entity.Source, entity.Subject),
+	}
+
+	return []stixObject{observable, observed}, nil
+}
@@ -0,0 +1,139 @@
+package service_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/cookpad/retrospector"
+	"github.com/cookpad/retrospector/pkg/mock"
+	"github.com/cookpad/retrospector/pkg/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func exportRecords(t *testing.T, encoder service.RecordEncoder, records ...interface{}) []byte {
+	newS3, s3Client := mock.NewS3Mock()
+	wq := service.NewEntityService(newS3).NewRecordWriteQueue("us-east-1", "export-bucket", "export/key.gz", encoder)
+	for _, record := range records {
+		wq.WriteRecord(record)
+	}
+	require.NoError(t, wq.Close())
+
+	gz, err := gzip.NewReader(bytes.NewReader(s3Client.S3Objects["export-bucket"]["export/key.gz"]))
+	require.NoError(t, err)
+	raw, err := ioutil.ReadAll(gz)
+	require.NoError(t, err)
+	return raw
+}
+
+func TestExportFilter(t *testing.T) {
+	filter := &service.ExportFilter{
+		Sources: []string{"blue"},
+		Types:   []retrospector.ValueType{retrospector.ValueDomainName},
+		Since:   1600000000,
+		Until:   1600001000,
+	}
+	domain := retrospector.Value{Data: "example.com", Type: retrospector.ValueDomainName}
+
+	assert.True(t, filter.MatchIOC(&retrospector.IOC{Value: domain, Source: "blue", UpdatedAt: 1600000500}))
+	assert.False(t, filter.MatchIOC(&retrospector.IOC{Value: domain, Source: "orange", UpdatedAt: 1600000500}))
+	assert.False(t, filter.MatchIOC(&retrospector.IOC{
+		Value:     retrospector.Value{Data: "192.0.2.1", Type: retrospector.ValueIPAddr},
+		Source:    "blue",
+		UpdatedAt: 1600000500,
+	}))
+	assert.False(t, filter.MatchIOC(&retrospector.IOC{Value: domain, Source: "blue", UpdatedAt: 1600001001}))
+
+	// Seen period of entity overlaps with time range
+	assert.True(t, filter.MatchEntity(&retrospector.Entity{Value: domain, Source: "blue", FirstSeen: 1500000000, LastSeen: 1600000000, Count: 2}))
+	assert.False(t, filter.MatchEntity(&retrospector.Entity{Value: domain, Source: "blue", FirstSeen: 1500000000, LastSeen: 1599999999, Count: 2}))
+	assert.False(t, filter.MatchEntity(&retrospector.Entity{Value: domain, Source: "blue", RecordedAt: 1600001001}))
+}
+
+func TestExportEncoder(t *testing.T) {
+	ioc := &retrospector.IOC{
+		Value:      retrospector.Value{Data: "example.com", Type: retrospector.ValueDomainName},
+		Source:     "blue",
+		Reason:     "C2",
+		UpdatedAt:  1600000000,
+		ValidUntil: 1700000000,
+	}
+	entities := []interface{}{
+		&retrospector.Entity{
+			Value:     retrospector.Value{Data: "192.0.2.1", Type: retrospector.ValueIPAddr},
+			Subject:   "vpc-1",
+			Source:    "flowlogs",
+			FirstSeen: 1600000000,
+			LastSeen:  1600000100,
+			Count:     3,
+		},
+		&retrospector.Entity{
+			Value:      retrospector.Value{Data: "192.0.2.1", Type: retrospector.ValueIPAddr},
+			Subject:    "vpc-2",
+			Source:     "flowlogs",
+			RecordedAt: 1600000200,
+		},
+	}
+
+	t.Run("jsonl", func(t *testing.T) {
+		encoder, err := service.NewIOCEncoder(service.ExportJSONL)
+		require.NoError(t, err)
+		raw := exportRecords(t, encoder, ioc)
+
+		var decoded retrospector.IOC
+		require.NoError(t, json.Unmarshal(raw, &decoded))
+		assert.Equal(t, ioc, &decoded)
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		encoder, err := service.NewEntityEncoder(service.ExportCSV)
+		require.NoError(t, err)
+		raw := exportRecords(t, encoder, entities...)
+
+		rows, err := csv.NewReader(bytes.NewReader(raw)).ReadAll()
+		require.NoError(t, err)
+		require.Equal(t, 3, len(rows))
+		assert.Equal(t, "subject", rows[0][2])
+		assert.Equal(t, []string{"ipaddr", "192.0.2.1", "vpc-1", "flowlogs", "", "2020-09-13T12:26:40Z", "2020-09-13T12:28:20Z", "3"}, rows[1])
+		assert.Equal(t, "1", rows[2][7])
+	})
+
+	t.Run("stix indicator", func(t *testing.T) {
+		encoder, err := service.NewIOCEncoder(service.ExportSTIX)
+		require.NoError(t, err)
+		raw := exportRecords(t, encoder, ioc)
+
+		var bundle struct {
+			Type    string                   `json:"type"`
+			Objects []map[string]interface{} `json:"objects"`
+		}
+		require.NoError(t, json.Unmarshal(raw, &bundle))
+		assert.Equal(t, "bundle", bundle.Type)
+		require.Equal(t, 1, len(bundle.Objects))
+		assert.Equal(t, "indicator", bundle.Objects[0]["type"])
+		assert.Equal(t, "[domain-name:value = 'example.com']", bundle.Objects[0]["pattern"])
+		assert.Equal(t, "2020-09-13T12:26:40.000Z", bundle.Objects[0]["valid_from"])
+		assert.Equal(t, "2023-11-14T22:13:20.000Z", bundle.Objects[0]["valid_until"])
+	})
+
+	t.Run("stix observed data shares observable", func(t *testing.T) {
+		encoder, err := service.NewEntityEncoder(service.ExportSTIX)
+		require.NoError(t, err)
+		raw := exportRecords(t, encoder, entities...)
+
+		var bundle struct {
+			Objects []map[string]interface{} `json:"objects"`
+		}
+		require.NoError(t, json.Unmarshal(raw, &bundle))
+		require.Equal(t, 3, len(bundle.Objects))
+		assert.Equal(t, "ipv4-addr", bundle.Objects[0]["type"])
+		assert.Equal(t, "observed-data", bundle.Objects[1]["type"])
+		assert.Equal(t, float64(3), bundle.Objects[1]["number_observed"])
+		assert.Equal(t, "observed-data", bundle.Objects[2]["type"])
+		assert.Equal(t, []interface{}{bundle.Objects[0]["id"]}, bundle.Objects[2]["object_refs"])
+	})
+}
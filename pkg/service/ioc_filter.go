@@ -0,0 +1,231 @@
+package service
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/cookpad/retrospector"
+	"github.com/cookpad/retrospector/pkg/adaptor"
+	"github.com/cookpad/retrospector/pkg/bloom"
+	"github.com/cookpad/retrospector/pkg/reader"
+	"github.com/m-mizutani/golambda"
+)
+
+const (
+	// Default size of IOC filter. 1M items with 1% false positive rate requires about 1.2MB
+	defaultIOCFilterCapacity = 1000000
+	defaultIOCFilterFPRate   = 0.01
+)
+
+// IOCFilterService manages Bloom filter of IOC values stored in S3. The filter is used to skip repository lookup for values that are definitely not IOC.
+type IOCFilterService struct {
+	newS3  adaptor.S3ClientFactory
+	region string
+	bucket string
+	key    string
+}
+
+// NewIOCFilterService is constructor of IOCFilterService
+func NewIOCFilterService(newS3 adaptor.S3ClientFactory, region, bucket, key string) *IOCFilterService {
+	return &IOCFilterService{
+		newS3:  newS3,
+		region: region,
+		bucket: bucket,
+		key:    key,
+	}
+}
+
+// IOCFilterKey converts a value to key data of IOC filter
+func IOCFilterKey(value *retrospector.Value) []byte {
+	return []byte(string(value.Type) + "/" + value.Data)
+}
+
+func isNoSuchKey(err error) bool {
+	if aerr, ok := err.(awserr.Error); ok {
+		return aerr.Code() == s3.ErrCodeNoSuchKey
+	}
+	return err.Error() == s3.ErrCodeNoSuchKey
+}
+
+// isNotFound returns true if HeadObject failed because the object does not exist. HeadObject has no body, then error code is "NotFound" instead of NoSuchKey.
+func isNotFound(err error) bool {
+	if aerr, ok := err.(awserr.Error); ok {
+		return aerr.Code() == "NotFound" || aerr.Code() == s3.ErrCodeNoSuchKey
+	}
+	return err.Error() == "NotFound" || err.Error() == s3.ErrCodeNoSuchKey
+}
+
+// Load downloads IOC filter from S3. It returns nil without error if the filter does not exist yet.
+func (x *IOCFilterService) Load() (*bloom.Filter, error) {
+	client, err := x.newS3(x.region)
+	if err != nil {
+		return nil, golambda.WrapError(err, "Failed to create S3Client").With("region", x.region)
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(x.bucket),
+		Key:    aws.String(x.key),
+	}
+	output, err := client.GetObject(input)
+	if err != nil {
+		if isNoSuchKey(err) {
+			return nil, nil
+		}
+		return nil, golambda.WrapError(err, "Failed GetObject of IOC filter").With("input", input)
+	}
+	defer output.Body.Close()
+
+	body, err := reader.Decompress(output.Body)
+	if err != nil {
+		return nil, golambda.WrapError(err).With("input", input)
+	}
+	raw, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, golambda.WrapError(err, "Failed to read IOC filter").With("input", input)
+	}
+
+	var filter bloom.Filter
+	if err := filter.UnmarshalBinary(raw); err != nil {
+		return nil, golambda.WrapError(err).With("input", input)
+	}
+
+	return &filter, nil
+}
+
+// Save uploads IOC filter to S3
+func (x *IOCFilterService) Save(filter *bloom.Filter) error {
+	client, err := x.newS3(x.region)
+	if err != nil {
+		return golambda.WrapError(err, "Failed to create S3Client").With("region", x.region)
+	}
+
+	raw, err := filter.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	if _, err := gz.Write(raw); err != nil {
+		return golambda.WrapError(err, "Failed to compress IOC filter")
+	}
+	if err := gz.Close(); err != nil {
+		return golambda.WrapError(err, "Failed to close gzip stream")
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket:          aws.String(x.bucket),
+		Key:             aws.String(x.key),
+		Body:            bytes.NewReader(buf.Bytes()),
+		ContentEncoding: aws.String("gzip"),
+		ContentType:     aws.String("application/octet-stream"),
+	}
+	if _, err := client.PutObject(input); err != nil {
+		return golambda.WrapError(err, "Failed to put IOC filter").With("bucket", x.bucket).With("key", x.key)
+	}
+
+	return nil
+}
+
+// Build creates a new IOC filter from all IOC in repository
+func (x *IOCFilterService) Build(repo *RepositoryService) (*bloom.Filter, error) {
+	var values []retrospector.Value
+	if err := repo.ScanIOCSet(func(ioc *retrospector.IOC) error {
+		values = append(values, ioc.Value)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	capacity := uint64(defaultIOCFilterCapacity)
+	if c := uint64(len(values)) * 2; capacity < c {
+		capacity = c
+	}
+
+	filter := bloom.New(capacity, defaultIOCFilterFPRate)
+	for i := range values {
+		filter.Add(IOCFilterKey(&values[i]))
+	}
+
+	logger.Info().Int("ioc_count", len(values)).Uint64("capacity", capacity).Msg("Built IOC filter")
+	return filter, nil
+}
+
+// Update adds iocSet to IOC filter in S3. The filter is rebuilt from repository if it does not exist or is saturated. iocSet must be already saved in repository.
+//
+// Update loads, modifies and saves the filter without condition because PutObject of AWS SDK v1 does not support conditional write. Concurrent updates overwrite additions of each other and IOCs go missing from the filter, then Update must be serialized, e.g. iocRecord runs with reserved concurrency 1.
+func (x *IOCFilterService) Update(repo *RepositoryService, iocSet []*retrospector.IOC) error {
+	filter, err := x.Load()
+	if err != nil {
+		return err
+	}
+
+	if filter == nil || filter.Saturated() {
+		// Rebuilt filter includes iocSet because it is already in repository
+		if filter, err = x.Build(repo); err != nil {
+			return err
+		}
+	} else {
+		for _, ioc := range iocSet {
+			filter.Add(IOCFilterKey(&ioc.Value))
+		}
+	}
+
+	return x.Save(filter)
+}
+
+type iocFilterCache struct {
+	filter *bloom.Filter
+	etag   string
+}
+
+var (
+	iocFilterCacheMap   = map[string]*iocFilterCache{}
+	iocFilterCacheMutex sync.Mutex
+)
+
+// CachedFilter returns IOC filter loaded in this process to avoid downloading the filter for each invocation. ETag of the filter object is checked by HeadObject for each call and the filter is downloaded again if it has been updated, then IOC recorded after the last download is never dropped by a stale filter. It returns nil if the filter does not exist in S3.
+func (x *IOCFilterService) CachedFilter() (*bloom.Filter, error) {
+	iocFilterCacheMutex.Lock()
+	defer iocFilterCacheMutex.Unlock()
+
+	client, err := x.newS3(x.region)
+	if err != nil {
+		return nil, golambda.WrapError(err, "Failed to create S3Client").With("region", x.region)
+	}
+
+	input := &s3.HeadObjectInput{
+		Bucket: aws.String(x.bucket),
+		Key:    aws.String(x.key),
+	}
+	head, err := client.HeadObject(input)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, golambda.WrapError(err, "Failed HeadObject of IOC filter").With("input", input)
+	}
+	etag := aws.StringValue(head.ETag)
+
+	cacheKey := x.bucket + "/" + x.key
+	if cache, ok := iocFilterCacheMap[cacheKey]; ok && cache.etag == etag {
+		return cache.filter, nil
+	}
+
+	filter, err := x.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	// Filter updated between HeadObject and GetObject is newer than etag, then it is just downloaded again in next call
+	iocFilterCacheMap[cacheKey] = &iocFilterCache{
+		filter: filter,
+		etag:   etag,
+	}
+	return filter, nil
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"time"
+
+	"github.com/cookpad/retrospector"
+	"github.com/m-mizutani/golambda"
+)
+
+// LifecycleActor is actor name of transitions made by retrospector itself
+const LifecycleActor = "retrospector"
+
+// LifecycleService manages alert status and records transitions of it
+type LifecycleService struct {
+	repo *RepositoryService
+}
+
+func NewLifecycleService(repo *RepositoryService) *LifecycleService {
+	return &LifecycleService{repo: repo}
+}
+
+// OnDetection updates alert state of the value when it is detected and returns whether the alert should be emitted. Alert of false positive is suppressed, resolved alert is re-opened as new and open alert is emitted again with updated detection count.
+func (x *LifecycleService) OnDetection(value *retrospector.Value) (*retrospector.AlertState, bool, error) {
+	now := time.Now().Unix()
+
+	state, err := x.repo.GetAlertState(value)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if state == nil {
+		state = &retrospector.AlertState{
+			Value:     *value,
+			Status:    retrospector.AlertNew,
+			CreatedAt: now,
+		}
+		if err := x.repo.PutAlertTransition(&retrospector.AlertTransition{
+			Value: *value,
+			To:    retrospector.AlertNew,
+			Actor: LifecycleActor,
+			Note:  "detected",
+			At:    now,
+		}); err != nil {
+			return nil, false, err
+		}
+	}
+
+	emit := true
+	switch state.Status {
+	case retrospector.AlertFalsePositive:
+		logger.Info().Interface("value", value).Msg("Suppressed re-detection of false positive alert")
+		emit = false
+
+	case retrospector.AlertResolved:
+		if err := x.putTransition(state, retrospector.AlertNew, LifecycleActor, "re-detected", now); err != nil {
+			return nil, false, err
+		}
+	}
+
+	state.LastDetectedAt = now
+	state.DetectionCount++
+	state.UpdatedAt = now
+	if err := x.repo.PutAlertState(state); err != nil {
+		return nil, false, err
+	}
+
+	return state, emit, nil
+}
+
+// Transit changes status of alert by actor. Error is returned if the alert does not exist or the transition is not allowed.
+func (x *LifecycleService) Transit(value *retrospector.Value, to retrospector.AlertStatus, actor, note string) (*retrospector.AlertState, error) {
+	if !to.IsValid() {
+		return nil, golambda.NewError("Invalid alert status").With("status", to)
+	}
+
+	state, err := x.repo.GetAlertState(value)
+	if err != nil {
+		return nil, err
+	}
+	if state == nil {
+		return nil, golambda.NewError("Alert is not found").With("value", value)
+	}
+	if !state.Status.CanTransitTo(to) {
+		return nil, golambda.NewError("Alert status can not be changed").
+			With("value", value).With("from", state.Status).With("to", to)
+	}
+
+	now := time.Now().Unix()
+	if err := x.putTransition(state, to, actor, note, now); err != nil {
+		return nil, err
+	}
+	state.UpdatedAt = now
+	if err := x.repo.PutAlertState(state); err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// putTransition records transition and changes status of state. state is not saved.
+func (x *LifecycleService) putTransition(state *retrospector.AlertState, to retrospector.AlertStatus, actor, note string, now int64) error {
+	if err := x.repo.PutAlertTransition(&retrospector.AlertTransition{
+		Value: state.Value,
+		From:  state.Status,
+		To:    to,
+		Actor: actor,
+		Note:  note,
+		At:    now,
+	}); err != nil {
+		return err
+	}
+	state.Status = to
+	return nil
+}
@@ -0,0 +1,96 @@
+package service_test
+
+import (
+	"testing"
+
+	"github.com/cookpad/retrospector"
+	"github.com/cookpad/retrospector/pkg/mock"
+	"github.com/cookpad/retrospector/pkg/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLifecycleService(t *testing.T) {
+	setup := func(t *testing.T) (*service.LifecycleService, *service.RepositoryService, *retrospector.Value) {
+		repo := service.NewRepositoryService(mock.NewRepository())
+		value := &retrospector.Value{Data: "example.com", Type: retrospector.ValueDomainName}
+		return service.NewLifecycleService(repo), repo, value
+	}
+
+	t.Run("first detection creates new alert", func(t *testing.T) {
+		svc, repo, value := setup(t)
+		state, emit, err := svc.OnDetection(value)
+		require.NoError(t, err)
+		assert.True(t, emit)
+		assert.Equal(t, retrospector.AlertNew, state.Status)
+		assert.Equal(t, int64(1), state.DetectionCount)
+
+		transitions, err := repo.GetAlertTransitions(value)
+		require.NoError(t, err)
+		require.Equal(t, 1, len(transitions))
+		assert.Equal(t, retrospector.AlertNew, transitions[0].To)
+		assert.Equal(t, service.LifecycleActor, transitions[0].Actor)
+	})
+
+	t.Run("open alert is emitted again", func(t *testing.T) {
+		svc, _, value := setup(t)
+		_, _, err := svc.OnDetection(value)
+		require.NoError(t, err)
+		_, err = svc.Transit(value, retrospector.AlertTriaged, "blue", "")
+		require.NoError(t, err)
+
+		state, emit, err := svc.OnDetection(value)
+		require.NoError(t, err)
+		assert.True(t, emit)
+		assert.Equal(t, retrospector.AlertTriaged, state.Status)
+		assert.Equal(t, int64(2), state.DetectionCount)
+	})
+
+	t.Run("false positive is suppressed", func(t *testing.T) {
+		svc, _, value := setup(t)
+		_, _, err := svc.OnDetection(value)
+		require.NoError(t, err)
+		_, err = svc.Transit(value, retrospector.AlertFalsePositive, "blue", "internal service")
+		require.NoError(t, err)
+
+		state, emit, err := svc.OnDetection(value)
+		require.NoError(t, err)
+		assert.False(t, emit)
+		assert.Equal(t, retrospector.AlertFalsePositive, state.Status)
+	})
+
+	t.Run("resolved alert is re-opened", func(t *testing.T) {
+		svc, repo, value := setup(t)
+		_, _, err := svc.OnDetection(value)
+		require.NoError(t, err)
+		_, err = svc.Transit(value, retrospector.AlertResolved, "blue", "blocked")
+		require.NoError(t, err)
+
+		state, emit, err := svc.OnDetection(value)
+		require.NoError(t, err)
+		assert.True(t, emit)
+		assert.Equal(t, retrospector.AlertNew, state.Status)
+
+		transitions, err := repo.GetAlertTransitions(value)
+		require.NoError(t, err)
+		require.Equal(t, 3, len(transitions))
+		assert.Equal(t, retrospector.AlertResolved, transitions[2].From)
+		assert.Equal(t, retrospector.AlertNew, transitions[2].To)
+		assert.Equal(t, "re-detected", transitions[2].Note)
+	})
+
+	t.Run("invalid transition is rejected", func(t *testing.T) {
+		svc, _, value := setup(t)
+		_, err := svc.Transit(value, retrospector.AlertTriaged, "blue", "")
+		assert.Error(t, err, "alert not found")
+
+		_, _, err = svc.OnDetection(value)
+		require.NoError(t, err)
+		_, err = svc.Transit(value, retrospector.AlertFalsePositive, "blue", "")
+		require.NoError(t, err)
+		_, err = svc.Transit(value, retrospector.AlertResolved, "blue", "")
+		assert.Error(t, err)
+		_, err = svc.Transit(value, retrospector.AlertStatus("closed"), "blue", "")
+		assert.Error(t, err)
+	})
+}
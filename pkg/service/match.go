@@ -0,0 +1,41 @@
+package service
+
+import (
+	"time"
+
+	"github.com/cookpad/retrospector"
+)
+
+// DefaultLookbackMargin is default period before IOC publication in which entities still match the IOC
+const DefaultLookbackMargin = time.Hour * 24 * 7
+
+// DefaultSweepWindow is default overlap window in which recently stored IOC set and entities are matched again by sweeper. It should be longer than interval of sweeper and shorter than a day because stored time of values is kept for a day.
+const DefaultSweepWindow = time.Hour * 2
+
+// MatchByTime returns entities that match at least one IOC by time and IOC set that matches at least one entity. See retrospector.MatchTime.
+func MatchByTime(entities []*retrospector.Entity, iocSet retrospector.IOCChunk, lookback time.Duration) ([]*retrospector.Entity, retrospector.IOCChunk) {
+	var matchedEntities []*retrospector.Entity
+	matchedIOC := make(map[*retrospector.IOC]bool)
+
+	for _, entity := range entities {
+		matched := false
+		for _, ioc := range iocSet {
+			if retrospector.MatchTime(entity, ioc, lookback) {
+				matched = true
+				matchedIOC[ioc] = true
+			}
+		}
+		if matched {
+			matchedEntities = append(matchedEntities, entity)
+		}
+	}
+
+	var matchedIOCSet retrospector.IOCChunk
+	for _, ioc := range iocSet {
+		if matchedIOC[ioc] {
+			matchedIOCSet = append(matchedIOCSet, ioc)
+		}
+	}
+
+	return matchedEntities, matchedIOCSet
+}
@@ -0,0 +1,56 @@
+package service_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cookpad/retrospector"
+	"github.com/cookpad/retrospector/pkg/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchByTime(t *testing.T) {
+	now := time.Now()
+	day := time.Hour * 24
+	at := func(d time.Duration) int64 { return now.Add(d).Unix() }
+
+	value := retrospector.Value{Data: "example.com", Type: retrospector.ValueDomainName}
+	ioc := &retrospector.IOC{Value: value, Source: "blue", ValidFrom: at(-day)}
+
+	oldEntity := &retrospector.Entity{Value: value, Subject: "old", RecordedAt: at(-25 * day)}
+	recentEntity := &retrospector.Entity{Value: value, Subject: "recent", RecordedAt: at(-3 * day)}
+	newEntity := &retrospector.Entity{Value: value, Subject: "new", RecordedAt: at(0)}
+	spanEntity := &retrospector.Entity{Value: value, Subject: "span", FirstSeen: at(-2 * day), LastSeen: at(0), Count: 3}
+
+	t.Run("entity seen long before IOC publication does not match", func(t *testing.T) {
+		entities, iocSet := service.MatchByTime([]*retrospector.Entity{oldEntity}, retrospector.IOCChunk{ioc}, service.DefaultLookbackMargin)
+		assert.Equal(t, 0, len(entities))
+		assert.Equal(t, 0, len(iocSet))
+	})
+
+	t.Run("entity within lookback margin matches", func(t *testing.T) {
+		entities, iocSet := service.MatchByTime([]*retrospector.Entity{oldEntity, recentEntity, newEntity, spanEntity}, retrospector.IOCChunk{ioc}, service.DefaultLookbackMargin)
+		require.Equal(t, 3, len(entities))
+		assert.Equal(t, recentEntity, entities[0])
+		assert.Equal(t, 1, len(iocSet))
+
+		assert.Equal(t, retrospector.RelationBeforePublication, retrospector.RelationOf(recentEntity, ioc))
+		assert.Equal(t, retrospector.RelationAfterPublication, retrospector.RelationOf(newEntity, ioc))
+		assert.Equal(t, retrospector.RelationAcrossPublication, retrospector.RelationOf(spanEntity, ioc))
+	})
+
+	t.Run("entity after IOC expiration does not match", func(t *testing.T) {
+		expired := &retrospector.IOC{Value: value, Source: "orange", ValidFrom: at(-10 * day), ValidUntil: at(-2 * day)}
+		entities, _ := service.MatchByTime([]*retrospector.Entity{newEntity, recentEntity}, retrospector.IOCChunk{expired}, 0)
+		require.Equal(t, 1, len(entities))
+		assert.Equal(t, recentEntity, entities[0])
+	})
+
+	t.Run("IOC without validity matches any entity", func(t *testing.T) {
+		unknown := &retrospector.IOC{Value: value, Source: "red"}
+		entities, _ := service.MatchByTime([]*retrospector.Entity{oldEntity, newEntity}, retrospector.IOCChunk{unknown}, 0)
+		assert.Equal(t, 2, len(entities))
+		assert.Equal(t, retrospector.RelationUnknown, retrospector.RelationOf(oldEntity, unknown))
+	})
+}
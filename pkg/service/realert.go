@@ -0,0 +1,93 @@
+package service
+
+import (
+	"time"
+
+	"github.com/cookpad/retrospector"
+)
+
+// RealertPolicy decides whether a value that has been alerted is alerted again. The first detection of a value is always alerted.
+type RealertPolicy struct {
+	// NewSubject alerts again when a subject that has not been alerted touches the value
+	NewSubject bool
+	// NewSource alerts again when IOC of a source that has not been alerted for the subject corroborates the value
+	NewSource bool
+	// Cooldown alerts again for the same subject after the period since the last alert. Zero disables it
+	Cooldown time.Duration
+}
+
+// DefaultRealertPolicy alerts again only on a new subject
+func DefaultRealertPolicy() *RealertPolicy {
+	return &RealertPolicy{NewSubject: true}
+}
+
+// Select returns entities that should be alerted by detection history of the value
+func (x *RealertPolicy) Select(entities []*retrospector.Entity, iocChunk retrospector.IOCChunk, detections []*retrospector.Detection, now time.Time) []*retrospector.Entity {
+	if len(detections) == 0 {
+		return entities
+	}
+
+	detectionMap := make(map[string]*retrospector.Detection)
+	for _, detection := range detections {
+		detectionMap[detection.Subject] = detection
+	}
+
+	var selected []*retrospector.Entity
+	for _, entity := range entities {
+		detection, ok := detectionMap[entity.Subject]
+		if !ok {
+			if x.NewSubject {
+				selected = append(selected, entity)
+			}
+			continue
+		}
+
+		if x.Cooldown > 0 && now.Sub(time.Unix(detection.DetectedAt, 0)) >= x.Cooldown {
+			selected = append(selected, entity)
+			continue
+		}
+
+		if x.NewSource {
+			for _, ioc := range iocChunk {
+				if !detection.HasSource(ioc.Source) {
+					selected = append(selected, entity)
+					break
+				}
+			}
+		}
+	}
+
+	return selected
+}
+
+// UpdateDetections returns detection history updated by alerted entities. Sources of IOC are merged into previous detection of each subject.
+func UpdateDetections(value *retrospector.Value, entities []*retrospector.Entity, iocChunk retrospector.IOCChunk, detections []*retrospector.Detection, now time.Time) []*retrospector.Detection {
+	detectionMap := make(map[string]*retrospector.Detection)
+	for _, detection := range detections {
+		detectionMap[detection.Subject] = detection
+	}
+
+	var updated []*retrospector.Detection
+	done := make(map[string]bool)
+	for _, entity := range entities {
+		if done[entity.Subject] {
+			continue
+		}
+		done[entity.Subject] = true
+
+		detection, ok := detectionMap[entity.Subject]
+		if !ok {
+			detection = &retrospector.Detection{Value: *value, Subject: entity.Subject}
+		}
+
+		for _, ioc := range iocChunk {
+			if !detection.HasSource(ioc.Source) {
+				detection.Sources = append(detection.Sources, ioc.Source)
+			}
+		}
+		detection.DetectedAt = now.Unix()
+		updated = append(updated, detection)
+	}
+
+	return updated
+}
@@ -0,0 +1,80 @@
+package service_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cookpad/retrospector"
+	"github.com/cookpad/retrospector/pkg/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRealertPolicy(t *testing.T) {
+	now := time.Now()
+	value := retrospector.Value{Data: "example.com", Type: retrospector.ValueDomainName}
+	entities := []*retrospector.Entity{
+		{Value: value, Subject: "blue", Source: "proxy"},
+		{Value: value, Subject: "orange", Source: "proxy"},
+	}
+	iocChunk := retrospector.IOCChunk{{Value: value, Source: "otx"}}
+	detections := []*retrospector.Detection{
+		{Value: value, Subject: "blue", Sources: []string{"otx"}, DetectedAt: now.Add(-time.Hour * 48).Unix()},
+	}
+
+	t.Run("first detection is always alerted", func(t *testing.T) {
+		policy := &service.RealertPolicy{}
+		assert.Equal(t, entities, policy.Select(entities, iocChunk, nil, now))
+	})
+
+	t.Run("new subject", func(t *testing.T) {
+		selected := service.DefaultRealertPolicy().Select(entities, iocChunk, detections, now)
+		require.Equal(t, 1, len(selected))
+		assert.Equal(t, "orange", selected[0].Subject)
+
+		policy := &service.RealertPolicy{}
+		assert.Equal(t, 0, len(policy.Select(entities, iocChunk, detections, now)))
+	})
+
+	t.Run("cooldown", func(t *testing.T) {
+		policy := &service.RealertPolicy{Cooldown: time.Hour * 24}
+		selected := policy.Select(entities, iocChunk, detections, now)
+		require.Equal(t, 1, len(selected))
+		assert.Equal(t, "blue", selected[0].Subject)
+
+		policy = &service.RealertPolicy{Cooldown: time.Hour * 72}
+		assert.Equal(t, 0, len(policy.Select(entities, iocChunk, detections, now)))
+	})
+
+	t.Run("new source", func(t *testing.T) {
+		policy := &service.RealertPolicy{NewSource: true}
+		assert.Equal(t, 0, len(policy.Select(entities, iocChunk, detections, now)))
+
+		corroborated := retrospector.IOCChunk{{Value: value, Source: "otx"}, {Value: value, Source: "urlhaus"}}
+		selected := policy.Select(entities, corroborated, detections, now)
+		require.Equal(t, 1, len(selected))
+		assert.Equal(t, "blue", selected[0].Subject)
+	})
+}
+
+func TestUpdateDetections(t *testing.T) {
+	now := time.Now()
+	value := retrospector.Value{Data: "example.com", Type: retrospector.ValueDomainName}
+	entities := []*retrospector.Entity{
+		{Value: value, Subject: "blue", Source: "proxy"},
+		{Value: value, Subject: "blue", Source: "dns"},
+		{Value: value, Subject: "orange", Source: "proxy"},
+	}
+	iocChunk := retrospector.IOCChunk{{Value: value, Source: "urlhaus"}}
+	detections := []*retrospector.Detection{
+		{Value: value, Subject: "blue", Sources: []string{"otx"}, DetectedAt: now.Add(-time.Hour).Unix()},
+	}
+
+	updated := service.UpdateDetections(&value, entities, iocChunk, detections, now)
+	require.Equal(t, 2, len(updated))
+	assert.Equal(t, "blue", updated[0].Subject)
+	assert.Equal(t, []string{"otx", "urlhaus"}, updated[0].Sources)
+	assert.Equal(t, now.Unix(), updated[0].DetectedAt)
+	assert.Equal(t, "orange", updated[1].Subject)
+	assert.Equal(t, []string{"urlhaus"}, updated[1].Sources)
+}
@@ -1,9 +1,17 @@
 package service
 
 import (
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+
 	"github.com/m-mizutani/golambda"
 	"github.com/cookpad/retrospector"
 	"github.com/cookpad/retrospector/pkg/adaptor"
+	"github.com/cookpad/retrospector/pkg/metrics"
+	"github.com/cookpad/retrospector/pkg/tracing"
 )
 
 type RepositoryService struct {
@@ -16,7 +24,12 @@ func NewRepositoryService(repo adaptor.Repository) *RepositoryService {
 	}
 }
 
-func (x *RepositoryService) PutEntities(entities []*retrospector.Entity) error {
+// PutEntities saves entities. Entities of same value, subject and source are aggregated to FirstSeen, LastSeen and Count.
+func (x *RepositoryService) PutEntities(entities []*retrospector.Entity) (err error) {
+	span := startRepositorySpan("PutEntities", "entity")
+	defer func() { span.End(err) }()
+
+	entities = retrospector.AggregateEntities(entities)
 	step := 10
 	for i := 0; i < len(entities); i += step {
 		ep := i + step
@@ -25,34 +38,21 @@ func (x *RepositoryService) PutEntities(entities []*retrospector.Entity) error {
 		}
 		target := entities[i:ep]
 		if err := x.repo.PutEntities(target); err != nil {
+			countThrottle("entity", err)
 			return golambda.WrapError(err).With("i", i)
 		}
 	}
 	return nil
 }
 
-func (x *RepositoryService) DetectEntities(iocSet []*retrospector.IOC) ([]*retrospector.Entity, error) {
-	entities, err := x.repo.GetEntities(iocSet)
-	if err != nil {
-		return nil, err
-	}
-
-	var detected []*retrospector.Entity
-	for _, entity := range entities {
-		if entity.Detected { // Already detected
-			continue
-		}
-		detected = append(detected, entity)
-	}
-
-	return detected, nil
-}
-
 func (x *RepositoryService) GetEntities(iocSet []*retrospector.IOC) ([]*retrospector.Entity, error) {
 	return x.repo.GetEntities(iocSet)
 }
 
-func (x *RepositoryService) PutIOCSet(iocSet []*retrospector.IOC) error {
+func (x *RepositoryService) PutIOCSet(iocSet []*retrospector.IOC) (err error) {
+	span := startRepositorySpan("PutIOCSet", "ioc")
+	defer func() { span.End(err) }()
+
 	step := 10
 	for i := 0; i < len(iocSet); i += step {
 		ep := i + step
@@ -61,37 +61,178 @@ func (x *RepositoryService) PutIOCSet(iocSet []*retrospector.IOC) error {
 		}
 		target := iocSet[i:ep]
 		if err := x.repo.PutIOCSet(target); err != nil {
+			countThrottle("ioc", err)
 			return golambda.WrapError(err).With("i", i)
 		}
 	}
 	return nil
 }
 
-func (x *RepositoryService) DetectIOCSet(entities []*retrospector.Entity) ([]*retrospector.IOC, error) {
-	iocSet, err := x.repo.GetIOCSet(entities)
-	if err != nil {
-		return nil, err
+// PutIOCIndex writes index of IOC set to be found by BatchGetIOCSet
+func (x *RepositoryService) PutIOCIndex(iocSet []*retrospector.IOC) error {
+	return x.repo.PutIOCIndex(iocSet)
+}
+
+func (x *RepositoryService) GetIOCSet(entities []*retrospector.Entity) ([]*retrospector.IOC, error) {
+	return x.repo.GetIOCSet(entities)
+}
+
+// ScanIOCSet calls callback for each IOC in repository
+func (x *RepositoryService) ScanIOCSet(callback func(ioc *retrospector.IOC) error) error {
+	return x.repo.ScanIOCSet(callback)
+}
+
+// ScanEntities calls callback for each aggregated entity in repository
+func (x *RepositoryService) ScanEntities(callback func(entity *retrospector.Entity) error) error {
+	return x.repo.ScanEntities(callback)
+}
+
+// GetRecentIOCValues returns values of IOC set stored after since
+func (x *RepositoryService) GetRecentIOCValues(since int64) ([]*retrospector.Value, error) {
+	return x.repo.GetRecentIOCValues(since)
+}
+
+// GetRecentEntityValues returns values of entities stored after since
+func (x *RepositoryService) GetRecentEntityValues(since int64) ([]*retrospector.Value, error) {
+	return x.repo.GetRecentEntityValues(since)
+}
+
+// GetDetections returns detection history of the value per subject
+func (x *RepositoryService) GetDetections(value *retrospector.Value) ([]*retrospector.Detection, error) {
+	return x.repo.GetDetections(value)
+}
+
+func (x *RepositoryService) PutDetections(detections []*retrospector.Detection) error {
+	step := 25
+	for i := 0; i < len(detections); i += step {
+		ep := i + step
+		if len(detections) < ep {
+			ep = len(detections)
+		}
+		if err := x.repo.PutDetections(detections[i:ep]); err != nil {
+			return golambda.WrapError(err).With("i", i)
+		}
 	}
+	return nil
+}
 
-	var detected []*retrospector.IOC
-	for _, ioc := range iocSet {
-		if ioc.Detected {
+func (x *RepositoryService) PutReputation(rep *retrospector.Reputation) error {
+	return x.repo.PutReputation(rep)
+}
+
+// GetReputation returns cached reputation or nil if not found
+func (x *RepositoryService) GetReputation(value *retrospector.Value, source string) (*retrospector.Reputation, error) {
+	return x.repo.GetReputation(value, source)
+}
+
+func uniqueValues(values []*retrospector.Value) []*retrospector.Value {
+	seen := make(map[retrospector.Value]struct{})
+	var unique []*retrospector.Value
+	for _, value := range values {
+		if _, ok := seen[*value]; ok {
 			continue
 		}
-		detected = append(detected, ioc)
+		seen[*value] = struct{}{}
+		unique = append(unique, value)
 	}
+	return unique
+}
 
-	return detected, nil
+func startRepositorySpan(name, target string) *tracing.Span {
+	return tracing.Start(name, map[string]string{
+		"db.system":           "dynamodb",
+		"retrospector.target": target,
+	})
 }
 
-func (x *RepositoryService) GetIOCSet(entities []*retrospector.Entity) ([]*retrospector.IOC, error) {
-	return x.repo.GetIOCSet(entities)
+func logLookupThroughput(target string, n int, started time.Time) {
+	elapsed := time.Since(started)
+	var perSec float64
+	if elapsed > 0 {
+		perSec = float64(n) / elapsed.Seconds()
+	}
+	logger.Info().
+		Str("target", target).
+		Int("lookup_count", n).
+		Dur("elapsed", elapsed).
+		Float64("lookup_per_sec", perSec).
+		Msg("Batch lookup throughput")
+
+	dims := metrics.Dimensions{"Target": target}
+	metrics.Count("RepositoryLookups", n, dims)
+	metrics.Latency("RepositoryLookupLatency", elapsed, dims)
+}
+
+// throttleErrorCodes are error codes of AWS when DynamoDB throttles requests even after retries of SDK
+var throttleErrorCodes = map[string]bool{
+	dynamodb.ErrCodeProvisionedThroughputExceededException: true,
+	dynamodb.ErrCodeRequestLimitExceeded:                   true,
+	"ThrottlingException":                                  true,
+}
+
+// countThrottle counts the error as throttle of repository if it is
+func countThrottle(target string, err error) {
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) && throttleErrorCodes[awsErr.Code()] {
+		metrics.Count("RepositoryThrottles", 1, metrics.Dimensions{"Target": target})
+	}
+}
+
+// BatchGetEntities looks up entities of many values with concurrent queries
+func (x *RepositoryService) BatchGetEntities(values []*retrospector.Value) ([]*retrospector.Entity, error) {
+	values = uniqueValues(values)
+	started := time.Now()
+	span := startRepositorySpan("BatchGetEntities", "entity")
+	entities, err := x.repo.BatchGetEntities(values)
+	span.End(err)
+	if err != nil {
+		countThrottle("entity", err)
+		return nil, err
+	}
+	logLookupThroughput("entity", len(values), started)
+
+	return entities, nil
+}
+
+// BatchGetIOCSet looks up IOC set of many values with BatchGetItem and concurrent queries
+func (x *RepositoryService) BatchGetIOCSet(values []*retrospector.Value) ([]*retrospector.IOC, error) {
+	values = uniqueValues(values)
+	started := time.Now()
+	span := startRepositorySpan("BatchGetIOCSet", "ioc")
+	iocSet, err := x.repo.BatchGetIOCSet(values)
+	span.End(err)
+	if err != nil {
+		countThrottle("ioc", err)
+		return nil, err
+	}
+	logLookupThroughput("ioc", len(values), started)
+
+	return iocSet, nil
+}
+
+// GetAlertState returns alert state of the value or nil if not found
+func (x *RepositoryService) GetAlertState(value *retrospector.Value) (*retrospector.AlertState, error) {
+	return x.repo.GetAlertState(value)
+}
+
+func (x *RepositoryService) PutAlertState(state *retrospector.AlertState) error {
+	return x.repo.PutAlertState(state)
+}
+
+func (x *RepositoryService) PutAlertTransition(transition *retrospector.AlertTransition) error {
+	return x.repo.PutAlertTransition(transition)
+}
+
+// GetAlertTransitions returns transitions of alert in chronological order
+func (x *RepositoryService) GetAlertTransitions(value *retrospector.Value) ([]*retrospector.AlertTransition, error) {
+	return x.repo.GetAlertTransitions(value)
 }
 
-func (x *RepositoryService) UpdateEntityDetected(entity *retrospector.Entity) error {
-	return x.repo.UpdateEntityDetected(entity)
+func (x *RepositoryService) ScanAlertStates(callback func(state *retrospector.AlertState) error) error {
+	return x.repo.ScanAlertStates(callback)
 }
 
-func (x *RepositoryService) UpdateIOCDetected(ioc *retrospector.IOC) error {
-	return x.repo.UpdateIOCDetected(ioc)
+// QueryAlertStates returns a page of alert states of the status in descending order of updated_at and cursor of next page
+func (x *RepositoryService) QueryAlertStates(status retrospector.AlertStatus, limit int, cursor string) ([]*retrospector.AlertState, string, error) {
+	return x.repo.QueryAlertStates(status, limit, cursor)
 }
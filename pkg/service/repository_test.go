@@ -26,7 +26,7 @@ func TestDynamoRepositoryService(t *testing.T) {
 
 	repo, err := adaptor.NewDynamoRepository(region, tableName)
 	require.NoError(t, err)
-	svc := service.NewRepositoryService(repo)
+	svc := service.NewRepositoryService(repo.WithRecentValues())
 	testRepositoryService(t, svc)
 }
 
@@ -78,6 +78,8 @@ func testRepositoryService(t *testing.T, svc *service.RepositoryService) {
 
 		err := svc.PutEntities(data)
 		require.NoError(t, err)
+		// Saved entities have FirstSeen, LastSeen and Count
+		stored := retrospector.AggregateEntities(data)
 
 		t.Run("found one entity by one ioc", func(t *testing.T) {
 			resp, err := svc.GetEntities([]*retrospector.IOC{
@@ -90,7 +92,7 @@ func testRepositoryService(t *testing.T, svc *service.RepositoryService) {
 			})
 			require.NoError(t, err)
 			assert.Equal(t, 1, len(resp))
-			assert.Equal(t, data[0], resp[0])
+			assert.Equal(t, stored[0], resp[0])
 		})
 
 		t.Run("found 2 entities by one ioc", func(t *testing.T) {
@@ -104,8 +106,8 @@ func testRepositoryService(t *testing.T, svc *service.RepositoryService) {
 			})
 			require.NoError(t, err)
 			assert.Equal(t, 2, len(resp))
-			assert.Contains(t, resp, data[2])
-			assert.Contains(t, resp, data[3])
+			assert.Contains(t, resp, stored[2])
+			assert.Contains(t, resp, stored[3])
 		})
 
 		t.Run("found different entity by different value type", func(t *testing.T) {
@@ -119,10 +121,45 @@ func testRepositoryService(t *testing.T, svc *service.RepositoryService) {
 			})
 			require.NoError(t, err)
 			assert.Equal(t, 1, len(resp))
-			assert.Contains(t, resp, data[1])
+			assert.Contains(t, resp, stored[1])
 		})
 	})
 
+	t.Run("aggregate entities", func(t *testing.T) {
+		now := time.Now()
+		value := retrospector.Value{Data: uuid.New().String(), Type: retrospector.ValueDomainName}
+
+		require.NoError(t, svc.PutEntities([]*retrospector.Entity{
+			{Value: value, Subject: "blue", Source: "dns", RecordedAt: now.Unix(), Description: "2nd"},
+			{Value: value, Subject: "blue", Source: "dns", RecordedAt: now.Add(-time.Hour).Unix(), Description: "1st"},
+			{Value: value, Subject: "blue", Source: "proxy", RecordedAt: now.Unix()},
+		}))
+		// Older and newer sightings in another object
+		require.NoError(t, svc.PutEntities([]*retrospector.Entity{
+			{Value: value, Subject: "blue", Source: "dns", RecordedAt: now.Add(-time.Hour * 2).Unix(), Description: "0th"},
+			{Value: value, Subject: "blue", Source: "dns", RecordedAt: now.Add(time.Hour).Unix(), Description: "3rd"},
+		}))
+
+		resp, err := svc.BatchGetEntities([]*retrospector.Value{&value})
+		require.NoError(t, err)
+		require.Equal(t, 2, len(resp))
+
+		var dns *retrospector.Entity
+		for _, entity := range resp {
+			if entity.Source == "dns" {
+				dns = entity
+			} else {
+				assert.Equal(t, int64(1), entity.Count)
+			}
+		}
+		require.NotNil(t, dns)
+		assert.Equal(t, int64(4), dns.Count)
+		assert.Equal(t, now.Add(-time.Hour*2).Unix(), dns.FirstSeen)
+		assert.Equal(t, now.Add(time.Hour).Unix(), dns.LastSeen)
+		assert.Equal(t, now.Add(time.Hour).Unix(), dns.RecordedAt)
+		assert.Equal(t, "3rd", dns.Description)
+	})
+
 	t.Run("IOCTest", func(t *testing.T) {
 		now := time.Now()
 		v1 := uuid.New().String()
@@ -188,94 +225,289 @@ func testRepositoryService(t *testing.T, svc *service.RepositoryService) {
 		})
 	})
 
-	t.Run("update detection status of entity", func(t *testing.T) {
-		v1 := uuid.New().String()
+	t.Run("IOC index is not shortened by IOC of shorter validity", func(t *testing.T) {
+		now := time.Now()
+		value := retrospector.Value{Data: uuid.New().String(), Type: retrospector.ValueDomainName}
 
-		data := []*retrospector.Entity{
-			{
-				Value: retrospector.Value{
-					Data: v1,
-					Type: retrospector.ValueDomainName,
-				},
-				Subject: "tester",
-			},
-		}
-		require.NoError(t, svc.PutEntities(data))
+		require.NoError(t, svc.PutIOCSet([]*retrospector.IOC{
+			{Value: value, Source: "blue", UpdatedAt: now.Unix()},
+		}))
+		// IOC of another source was updated long ago and its expiration has passed
+		require.NoError(t, svc.PutIOCSet([]*retrospector.IOC{
+			{Value: value, Source: "orange", UpdatedAt: now.Add(-time.Hour * 24 * 40).Unix()},
+		}))
 
-		entities := []*retrospector.IOC{
-			{
-				Value: retrospector.Value{
-					Data: v1,
-					Type: retrospector.ValueDomainName,
-				},
-			},
+		resp, err := svc.BatchGetIOCSet([]*retrospector.Value{&value})
+		require.NoError(t, err)
+		var sources []string
+		for _, ioc := range resp {
+			sources = append(sources, ioc.Source)
 		}
+		assert.Contains(t, sources, "blue")
+	})
 
-		resp1, err := svc.GetEntities(entities)
-		require.NoError(t, err)
-		require.Equal(t, 1, len(resp1))
-		assert.False(t, resp1[0].Detected)
+	t.Run("detection history", func(t *testing.T) {
+		now := time.Now()
+		value := retrospector.Value{Data: uuid.New().String(), Type: retrospector.ValueDomainName}
 
-		resp2, err := svc.DetectEntities(entities)
+		detections, err := svc.GetDetections(&value)
 		require.NoError(t, err)
-		require.Equal(t, 1, len(resp2))
-
-		require.NoError(t, svc.UpdateEntityDetected(data[0]))
+		assert.Equal(t, 0, len(detections))
 
-		resp3, err := svc.GetEntities(entities)
-		require.NoError(t, err)
-		require.Equal(t, 1, len(resp3))
-		assert.True(t, resp3[0].Detected)
+		require.NoError(t, svc.PutDetections([]*retrospector.Detection{
+			{Value: value, Subject: "", Sources: []string{"blue"}, DetectedAt: now.Unix()},
+			{Value: value, Subject: "tester", Sources: []string{"blue", "orange"}, DetectedAt: now.Unix()},
+		}))
+		require.NoError(t, svc.PutDetections([]*retrospector.Detection{
+			{Value: value, Subject: "tester", Sources: []string{"red"}, DetectedAt: now.Add(time.Hour).Unix()},
+		}))
 
-		resp4, err := svc.DetectEntities(entities)
+		detections, err = svc.GetDetections(&value)
 		require.NoError(t, err)
-		require.Equal(t, 0, len(resp4))
+		require.Equal(t, 2, len(detections))
+		for _, detection := range detections {
+			switch detection.Subject {
+			case "":
+				assert.Equal(t, []string{"blue"}, detection.Sources)
+			case "tester":
+				assert.Equal(t, []string{"red"}, detection.Sources)
+				assert.Equal(t, now.Add(time.Hour).Unix(), detection.DetectedAt)
+			default:
+				assert.Fail(t, "unexpected subject", detection.Subject)
+			}
+		}
 	})
 
-	t.Run("update detection status of IOC", func(t *testing.T) {
+	t.Run("batch lookup", func(t *testing.T) {
 		now := time.Now()
 		v1 := uuid.New().String()
+		v2 := uuid.New().String()
+		v3 := uuid.New().String()
 
-		data := []*retrospector.IOC{
+		iocSet := []*retrospector.IOC{
 			{
-				Value: retrospector.Value{
-					Data: v1,
-					Type: retrospector.ValueDomainName,
-				},
-
+				Value:     retrospector.Value{Data: v1, Type: retrospector.ValueDomainName},
+				Source:    "blue",
+				UpdatedAt: now.Unix(),
+			},
+			{
+				Value:     retrospector.Value{Data: v1, Type: retrospector.ValueDomainName},
+				Source:    "orange",
+				UpdatedAt: now.Unix(),
+			},
+			{
+				Value:     retrospector.Value{Data: v2, Type: retrospector.ValueIPAddr},
 				Source:    "blue",
 				UpdatedAt: now.Unix(),
 			},
 		}
-		require.NoError(t, svc.PutIOCSet(data))
+		require.NoError(t, svc.PutIOCSet(iocSet))
 
 		entities := []*retrospector.Entity{
 			{
-				Value: retrospector.Value{
-					Data: v1,
-					Type: retrospector.ValueDomainName,
-				},
+				Value:      retrospector.Value{Data: v1, Type: retrospector.ValueDomainName},
+				Subject:    "tester1",
+				RecordedAt: now.Unix(),
 			},
+			{
+				Value:      retrospector.Value{Data: v3, Type: retrospector.ValueDomainName},
+				Subject:    "tester2",
+				RecordedAt: now.Unix(),
+			},
+		}
+		require.NoError(t, svc.PutEntities(entities))
+		stored := retrospector.AggregateEntities(entities)
+
+		values := []*retrospector.Value{
+			{Data: v1, Type: retrospector.ValueDomainName},
+			{Data: v1, Type: retrospector.ValueDomainName}, // duplicated
+			{Data: v2, Type: retrospector.ValueIPAddr},
+			{Data: v2, Type: retrospector.ValueDomainName}, // type mismatch
+			{Data: v3, Type: retrospector.ValueDomainName},
 		}
 
-		resp1, err := svc.GetIOCSet(entities)
+		t.Run("get IOC set", func(t *testing.T) {
+			resp, err := svc.BatchGetIOCSet(values)
+			require.NoError(t, err)
+			require.Equal(t, 3, len(resp))
+			assert.Contains(t, resp, iocSet[0])
+			assert.Contains(t, resp, iocSet[1])
+			assert.Contains(t, resp, iocSet[2])
+		})
+
+		t.Run("get entities", func(t *testing.T) {
+			resp, err := svc.BatchGetEntities(values)
+			require.NoError(t, err)
+			require.Equal(t, 2, len(resp))
+			assert.Contains(t, resp, stored[0])
+			assert.Contains(t, resp, stored[1])
+		})
+	})
+
+	t.Run("scan IOC set", func(t *testing.T) {
+		v1 := uuid.New().String()
+		data := []*retrospector.IOC{
+			{
+				Value:  retrospector.Value{Data: v1, Type: retrospector.ValueDomainName},
+				Source: "blue",
+			},
+			{
+				Value:  retrospector.Value{Data: v1, Type: retrospector.ValueIPAddr},
+				Source: "blue",
+			},
+		}
+		require.NoError(t, svc.PutIOCSet(data))
+
+		var found []*retrospector.IOC
+		require.NoError(t, svc.ScanIOCSet(func(ioc *retrospector.IOC) error {
+			if ioc.Data == v1 {
+				found = append(found, ioc)
+			}
+			return nil
+		}))
+		require.Equal(t, 2, len(found))
+		assert.Contains(t, found, data[0])
+		assert.Contains(t, found, data[1])
+	})
+
+	t.Run("scan entities", func(t *testing.T) {
+		v1 := uuid.New().String()
+		data := []*retrospector.Entity{
+			{
+				Value:      retrospector.Value{Data: v1, Type: retrospector.ValueDomainName},
+				Subject:    "blue",
+				Source:     "orange",
+				RecordedAt: 1600000000,
+			},
+			{
+				Value:      retrospector.Value{Data: v1, Type: retrospector.ValueDomainName},
+				Subject:    "red",
+				Source:     "orange",
+				RecordedAt: 1600000001,
+			},
+		}
+		require.NoError(t, svc.PutEntities(data))
+
+		var subjects []string
+		require.NoError(t, svc.ScanEntities(func(entity *retrospector.Entity) error {
+			if entity.Data == v1 {
+				subjects = append(subjects, entity.Subject)
+				assert.Equal(t, int64(1), entity.Count)
+			}
+			return nil
+		}))
+		assert.ElementsMatch(t, []string{"blue", "red"}, subjects)
+	})
+
+	t.Run("recent values", func(t *testing.T) {
+		since := time.Now().Unix()
+		v1 := retrospector.Value{Data: uuid.New().String(), Type: retrospector.ValueDomainName}
+		v2 := retrospector.Value{Data: uuid.New().String(), Type: retrospector.ValueDomainName}
+		require.NoError(t, svc.PutIOCSet([]*retrospector.IOC{
+			{Value: v1, Source: "blue", UpdatedAt: since},
+			{Value: v1, Source: "orange", UpdatedAt: since},
+		}))
+		require.NoError(t, svc.PutEntities([]*retrospector.Entity{
+			{Value: v2, Subject: "tester", RecordedAt: since},
+		}))
+
+		iocValues, err := svc.GetRecentIOCValues(since)
+		require.NoError(t, err)
+		assert.Contains(t, iocValues, &v1)
+		assert.NotContains(t, iocValues, &v2)
+
+		entityValues, err := svc.GetRecentEntityValues(since)
 		require.NoError(t, err)
-		require.Equal(t, 1, len(resp1))
-		assert.False(t, resp1[0].Detected)
+		assert.Contains(t, entityValues, &v2)
+		assert.NotContains(t, entityValues, &v1)
 
-		resp2, err := svc.DetectIOCSet(entities)
+		entityValues, err = svc.GetRecentEntityValues(since + 3600)
 		require.NoError(t, err)
-		assert.Equal(t, 1, len(resp2))
+		assert.NotContains(t, entityValues, &v2)
+	})
+
+	t.Run("alert state and transitions", func(t *testing.T) {
+		value := retrospector.Value{Data: uuid.New().String(), Type: retrospector.ValueDomainName}
+
+		state, err := svc.GetAlertState(&value)
+		require.NoError(t, err)
+		assert.Nil(t, state)
+
+		require.NoError(t, svc.PutAlertState(&retrospector.AlertState{
+			Value:  value,
+			Status: retrospector.AlertTriaged,
+		}))
+		require.NoError(t, svc.PutAlertTransition(&retrospector.AlertTransition{
+			Value: value, To: retrospector.AlertNew, Actor: "blue",
+		}))
+		require.NoError(t, svc.PutAlertTransition(&retrospector.AlertTransition{
+			Value: value, From: retrospector.AlertNew, To: retrospector.AlertTriaged, Actor: "orange", Note: "five",
+		}))
+
+		state, err = svc.GetAlertState(&value)
+		require.NoError(t, err)
+		require.NotNil(t, state)
+		assert.Equal(t, retrospector.AlertTriaged, state.Status)
+
+		transitions, err := svc.GetAlertTransitions(&value)
+		require.NoError(t, err)
+		require.Equal(t, 2, len(transitions))
+		assert.Equal(t, "blue", transitions[0].Actor)
+		assert.Equal(t, "orange", transitions[1].Actor)
+		assert.Equal(t, "five", transitions[1].Note)
+
+		var found []*retrospector.AlertState
+		require.NoError(t, svc.ScanAlertStates(func(state *retrospector.AlertState) error {
+			if state.Value == value {
+				found = append(found, state)
+			}
+			return nil
+		}))
+		require.Equal(t, 1, len(found))
+		assert.Equal(t, retrospector.AlertTriaged, found[0].Status)
+	})
+
+	t.Run("Query alert states", func(t *testing.T) {
+		// Far future updated_at to come first in all alert states of the test table
+		base := time.Now().Add(time.Hour * 24 * 365 * 100).Unix()
+		var values []retrospector.Value
+		for i := 0; i < 3; i++ {
+			value := retrospector.Value{Data: uuid.New().String(), Type: retrospector.ValueDomainName}
+			values = append(values, value)
+			require.NoError(t, svc.PutAlertState(&retrospector.AlertState{
+				Value:     value,
+				Status:    retrospector.AlertNew,
+				UpdatedAt: base + int64(i),
+			}))
+		}
+		// Update status and updated_at of values[0]. List items of previous state must be removed
+		require.NoError(t, svc.PutAlertState(&retrospector.AlertState{
+			Value:     values[0],
+			Status:    retrospector.AlertEscalated,
+			UpdatedAt: base + 10,
+		}))
+
+		states, cursor, err := svc.QueryAlertStates("", 2, "")
+		require.NoError(t, err)
+		require.Equal(t, 2, len(states))
+		assert.Equal(t, values[0], states[0].Value)
+		assert.Equal(t, retrospector.AlertEscalated, states[0].Status)
+		assert.Equal(t, values[2], states[1].Value)
+		require.NotEmpty(t, cursor)
 
-		require.NoError(t, svc.UpdateIOCDetected(data[0]))
+		states, _, err = svc.QueryAlertStates("", 1, cursor)
+		require.NoError(t, err)
+		require.Equal(t, 1, len(states))
+		assert.Equal(t, values[1], states[0].Value)
 
-		resp3, err := svc.GetIOCSet(entities)
+		states, _, err = svc.QueryAlertStates(retrospector.AlertEscalated, 10, "")
 		require.NoError(t, err)
-		require.Equal(t, 1, len(resp3))
-		assert.True(t, resp3[0].Detected)
+		require.NotEmpty(t, states)
+		assert.Equal(t, values[0], states[0].Value)
 
-		resp4, err := svc.DetectIOCSet(entities)
+		states, _, err = svc.QueryAlertStates(retrospector.AlertNew, 1, "")
 		require.NoError(t, err)
-		assert.Equal(t, 0, len(resp4))
+		require.Equal(t, 1, len(states))
+		assert.Equal(t, values[2], states[0].Value)
 	})
 }
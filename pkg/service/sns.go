@@ -10,6 +10,8 @@ import (
 	"github.com/cookpad/retrospector"
 	"github.com/cookpad/retrospector/pkg/adaptor"
 	"github.com/cookpad/retrospector/pkg/logging"
+	"github.com/cookpad/retrospector/pkg/metrics"
+	"github.com/cookpad/retrospector/pkg/tracing"
 )
 
 var logger = logging.Logger
@@ -46,6 +48,8 @@ func publishSNS(client adaptor.SNSClient, topicARN string, msg interface{}) erro
 	input := sns.PublishInput{
 		TopicArn: aws.String(topicARN),
 		Message:  aws.String(string(raw)),
+		// Correlation ID of current trace is propagated to subscribers
+		MessageAttributes: tracing.MessageAttributes(),
 	}
 	resp, err := client.Publish(&input)
 
@@ -81,6 +85,7 @@ func (x *SNSService) PublishIOC(topicARN string, chunk retrospector.IOCChunk) er
 		if err := publishSNS(client, topicARN, c); err != nil {
 			return golambda.WrapError(err).With("chunk", c)
 		}
+		metrics.Count("IOCsPublished", len(c), nil)
 	}
 
 	return nil
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cookpad/retrospector"
+	"github.com/m-mizutani/golambda"
+)
+
+// ManualSourcePrefix is prefix of source of manually submitted IOC. Source is "manual:<ticket>:<submitter>"
+const ManualSourcePrefix = "manual:"
+
+// DefaultSubmissionReason is reason of submitted IOC without reason
+const DefaultSubmissionReason = "Manual submission"
+
+var (
+	ticketPattern = regexp.MustCompile(`^[A-Za-z0-9._#-]+$`)
+	domainPattern = regexp.MustCompile(`^(?:[a-z0-9_](?:[a-z0-9_-]{0,61}[a-z0-9])?\.)+[a-z][a-z0-9-]{0,61}[a-z0-9]$`)
+	hexPattern    = regexp.MustCompile(`^[0-9a-f]+$`)
+
+	hashLength = map[retrospector.ValueType]int{
+		retrospector.ValueFileHashSha256: 64,
+		retrospector.ValueFileHashSha1:   40,
+		retrospector.ValueFileHashMD5:    32,
+	}
+
+	defangReplacer = strings.NewReplacer("[.]", ".", "(.)", ".", "{.}", ".", "[dot]", ".", "[:]", ":")
+)
+
+// NormalizeValue validates value and returns normalized one. Defanged value such as "example[.]com" and "hxxp://" is refanged. Type is guessed if empty.
+func NormalizeValue(value *retrospector.Value) (*retrospector.Value, error) {
+	data := defangReplacer.Replace(strings.TrimSpace(value.Data))
+	if lower := strings.ToLower(data); strings.HasPrefix(lower, "hxxp") {
+		data = "http" + data[len("hxxp"):]
+	}
+
+	valueType := value.Type
+	if valueType == "" {
+		valueType = retrospector.GuessValueType(data)
+	}
+
+	switch valueType {
+	case retrospector.ValueIPAddr:
+		ip := net.ParseIP(data)
+		if ip == nil {
+			return nil, golambda.NewError("Invalid IP address").With("value", value.Data)
+		}
+		data = ip.String()
+
+	case retrospector.ValueDomainName:
+		data = strings.TrimSuffix(strings.ToLower(data), ".")
+		if !domainPattern.MatchString(data) {
+			return nil, golambda.NewError("Invalid domain name").With("value", value.Data)
+		}
+
+	case retrospector.ValueURL:
+		u, err := url.Parse(data)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, golambda.NewError("Invalid URL").With("value", value.Data)
+		}
+		u.Scheme = strings.ToLower(u.Scheme)
+		u.Host = strings.ToLower(u.Host)
+		data = u.String()
+
+	case retrospector.ValueFileHashSha256, retrospector.ValueFileHashSha1, retrospector.ValueFileHashMD5:
+		data = strings.ToLower(data)
+		if len(data) != hashLength[valueType] || !hexPattern.MatchString(data) {
+			return nil, golambda.NewError("Invalid file hash").With("value", value.Data).With("type", valueType)
+		}
+
+	default:
+		return nil, golambda.NewError("Unsupported value type").With("value", value.Data).With("type", valueType)
+	}
+
+	return &retrospector.Value{Data: data, Type: valueType}, nil
+}
+
+// ManualSource returns source of IOC submitted by submitter for ticket
+func ManualSource(ticket, submitter string) string {
+	return ManualSourcePrefix + ticket + ":" + submitter
+}
+
+// Submission is request to submit IOC manually
+type Submission struct {
+	Values      []*retrospector.Value
+	Submitter   string
+	Ticket      string
+	Reason      string
+	Description string
+	// ValidUntil is end of IOC validity in unix seconds. Zero means validity has no end. IOC is removed from repository by TTL 30 days after submission regardless of ValidUntil
+	ValidUntil int64
+}
+
+// SubmitService publishes manually submitted IOC to IOC topic as crawlers do
+type SubmitService struct {
+	snsSvc   *SNSService
+	repo     *RepositoryService
+	topicARN string
+}
+
+// NewSubmitService is constructor of SubmitService
+func NewSubmitService(snsSvc *SNSService, repo *RepositoryService, topicARN string) *SubmitService {
+	return &SubmitService{
+		snsSvc:   snsSvc,
+		repo:     repo,
+		topicARN: topicARN,
+	}
+}
+
+// ValidateTicket checks format of ticket reference
+func ValidateTicket(ticket string) error {
+	if !ticketPattern.MatchString(ticket) {
+		return golambda.NewError("Ticket reference is required and must consist of alphanumerics, '.', '_', '#' and '-'").With("ticket", ticket)
+	}
+	return nil
+}
+
+// Submit normalizes values and publishes them as IOC of source "manual:<ticket>:<submitter>". All values are validated before publishing.
+func (x *SubmitService) Submit(sub *Submission) (retrospector.IOCChunk, error) {
+	if err := ValidateTicket(sub.Ticket); err != nil {
+		return nil, err
+	}
+	if sub.Submitter == "" {
+		return nil, golambda.NewError("Submitter is required")
+	}
+	if len(sub.Values) == 0 {
+		return nil, golambda.NewError("No value to submit")
+	}
+
+	reason := sub.Reason
+	if reason == "" {
+		reason = DefaultSubmissionReason
+	}
+
+	now := time.Now().Unix()
+	var iocChunk retrospector.IOCChunk
+	for _, value := range sub.Values {
+		normalized, err := NormalizeValue(value)
+		if err != nil {
+			return nil, err
+		}
+		iocChunk = append(iocChunk, &retrospector.IOC{
+			Value:       *normalized,
+			Source:      ManualSource(sub.Ticket, sub.Submitter),
+			UpdatedAt:   now,
+			Reason:      reason,
+			Description: sub.Description,
+			FirstSeen:   now,
+			ValidUntil:  sub.ValidUntil,
+		})
+	}
+
+	if err := x.snsSvc.PublishIOC(x.topicARN, iocChunk); err != nil {
+		return nil, err
+	}
+	logger.Info().Str("submitter", sub.Submitter).Str("ticket", sub.Ticket).Int("values", len(iocChunk)).Msg("Submitted IOC")
+	return iocChunk, nil
+}
+
+// Revoke revokes IOC of the value submitted for ticket. Revoked IOC is published so that repository keeps it with revoker. Empty IOC set is returned if no IOC is revoked.
+func (x *SubmitService) Revoke(value *retrospector.Value, ticket, revoker string) (retrospector.IOCChunk, error) {
+	if err := ValidateTicket(ticket); err != nil {
+		return nil, err
+	}
+	if revoker == "" {
+		return nil, golambda.NewError("Revoker is required")
+	}
+	normalized, err := NormalizeValue(value)
+	if err != nil {
+		return nil, err
+	}
+
+	iocSet, err := x.repo.BatchGetIOCSet([]*retrospector.Value{normalized})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	var revoked retrospector.IOCChunk
+	for _, ioc := range iocSet {
+		if !strings.HasPrefix(ioc.Source, ManualSourcePrefix+ticket+":") || ioc.IsRevoked() {
+			continue
+		}
+		ioc.UpdatedAt = now
+		ioc.RevokedAt = now
+		ioc.RevokedBy = revoker
+		revoked = append(revoked, ioc)
+	}
+	if len(revoked) == 0 {
+		return nil, nil
+	}
+
+	if err := x.snsSvc.PublishIOC(x.topicARN, revoked); err != nil {
+		return nil, err
+	}
+	logger.Info().Str("revoker", revoker).Str("ticket", ticket).Interface("value", normalized).Msg("Revoked IOC")
+	return revoked, nil
+}
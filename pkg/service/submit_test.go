@@ -0,0 +1,133 @@
+package service_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/cookpad/retrospector"
+	"github.com/cookpad/retrospector/pkg/mock"
+	"github.com/cookpad/retrospector/pkg/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeValue(t *testing.T) {
+	testCases := []struct {
+		title    string
+		input    retrospector.Value
+		expected *retrospector.Value
+	}{
+		{
+			title:    "defanged domain name",
+			input:    retrospector.Value{Data: " Example[.]COM. "},
+			expected: &retrospector.Value{Data: "example.com", Type: retrospector.ValueDomainName},
+		},
+		{
+			title:    "IPv6 address",
+			input:    retrospector.Value{Data: "2001:DB8:0:0::1", Type: retrospector.ValueIPAddr},
+			expected: &retrospector.Value{Data: "2001:db8::1", Type: retrospector.ValueIPAddr},
+		},
+		{
+			title:    "defanged URL",
+			input:    retrospector.Value{Data: "hxxps://Evil[.]Example.com/Path"},
+			expected: &retrospector.Value{Data: "https://evil.example.com/Path", Type: retrospector.ValueURL},
+		},
+		{
+			title:    "file hash",
+			input:    retrospector.Value{Data: "D41D8CD98F00B204E9800998ECF8427E"},
+			expected: &retrospector.Value{Data: "d41d8cd98f00b204e9800998ecf8427e", Type: retrospector.ValueFileHashMD5},
+		},
+		{
+			title: "invalid IP address",
+			input: retrospector.Value{Data: "192.0.2.256", Type: retrospector.ValueIPAddr},
+		},
+		{
+			title: "hash length mismatch",
+			input: retrospector.Value{Data: "d41d8cd98f00b204e9800998ecf8427e", Type: retrospector.ValueFileHashSha1},
+		},
+		{
+			title: "unknown format",
+			input: retrospector.Value{Data: "not a value"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			value, err := service.NormalizeValue(&tc.input)
+			if tc.expected == nil {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, value)
+		})
+	}
+}
+
+func TestSubmitService(t *testing.T) {
+	topicARN := "arn:aws:sns:us-east-1:111122223333:my-topic"
+	newSNS, snsClient := mock.NewSNSMock()
+	repo := service.NewRepositoryService(mock.NewRepository())
+	svc := service.NewSubmitService(service.NewSNSService(newSNS), repo, topicARN)
+
+	published := func(i int) retrospector.IOCChunk {
+		var iocChunk retrospector.IOCChunk
+		require.NoError(t, json.Unmarshal([]byte(*snsClient.PublishInput[i].Message), &iocChunk))
+		return iocChunk
+	}
+
+	t.Run("submit", func(t *testing.T) {
+		iocChunk, err := svc.Submit(&service.Submission{
+			Values:    []*retrospector.Value{{Data: "example[.]com"}, {Data: "192.0.2.1"}},
+			Submitter: "blue",
+			Ticket:    "SEC-123",
+		})
+		require.NoError(t, err)
+		require.Equal(t, 2, len(iocChunk))
+		require.Equal(t, 1, len(snsClient.PublishInput))
+		assert.Equal(t, topicARN, *snsClient.PublishInput[0].TopicArn)
+
+		iocChunk = published(0)
+		require.Equal(t, 2, len(iocChunk))
+		assert.Equal(t, "example.com", iocChunk[0].Data)
+		assert.Equal(t, "manual:SEC-123:blue", iocChunk[0].Source)
+		assert.Equal(t, service.DefaultSubmissionReason, iocChunk[0].Reason)
+		assert.NotZero(t, iocChunk[0].FirstSeen)
+
+		// IOC topic is subscribed by iocRecord
+		require.NoError(t, repo.PutIOCSet(iocChunk))
+	})
+
+	t.Run("invalid submission is not published", func(t *testing.T) {
+		_, err := svc.Submit(&service.Submission{
+			Values:    []*retrospector.Value{{Data: "example.org"}, {Data: "not a value"}},
+			Submitter: "blue",
+			Ticket:    "SEC-124",
+		})
+		assert.Error(t, err)
+
+		_, err = svc.Submit(&service.Submission{
+			Values:    []*retrospector.Value{{Data: "example.org"}},
+			Submitter: "blue",
+		})
+		assert.Error(t, err, "ticket is required")
+		assert.Equal(t, 1, len(snsClient.PublishInput))
+	})
+
+	t.Run("revoke", func(t *testing.T) {
+		revoked, err := svc.Revoke(&retrospector.Value{Data: "example.com"}, "SEC-999", "orange")
+		require.NoError(t, err)
+		assert.Equal(t, 0, len(revoked))
+
+		revoked, err = svc.Revoke(&retrospector.Value{Data: "example.com"}, "SEC-123", "orange")
+		require.NoError(t, err)
+		require.Equal(t, 1, len(revoked))
+		require.Equal(t, 2, len(snsClient.PublishInput))
+
+		iocChunk := published(1)
+		require.Equal(t, 1, len(iocChunk))
+		assert.True(t, iocChunk[0].IsRevoked())
+		assert.Equal(t, "orange", iocChunk[0].RevokedBy)
+		assert.Equal(t, "manual:SEC-123:blue", iocChunk[0].Source)
+	})
+}
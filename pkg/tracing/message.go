@@ -0,0 +1,91 @@
+package tracing
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/m-mizutani/golambda"
+)
+
+// Names of SNS message attributes to propagate trace
+const (
+	AttrCorrelationID = "correlation_id"
+	AttrTraceParent   = "traceparent"
+)
+
+// MessageAttributes returns SNS message attributes of current trace in Default tracer, or nil if no trace is current
+func MessageAttributes() map[string]*sns.MessageAttributeValue {
+	current := Default.Current()
+	if current == nil {
+		return nil
+	}
+
+	return map[string]*sns.MessageAttributeValue{
+		AttrCorrelationID: {
+			DataType:    aws.String("String"),
+			StringValue: aws.String(current.correlationID),
+		},
+		AttrTraceParent: {
+			DataType:    aws.String("String"),
+			StringValue: aws.String(fmt.Sprintf("00-%s-%s-01", current.TraceID, current.SpanID)),
+		},
+	}
+}
+
+// Message is SNS message received via SQS with trace context in its attributes. CorrelationID and ParentSpanID are empty if the message has no trace context.
+type Message struct {
+	Record        golambda.EventRecord
+	CorrelationID string
+	ParentSpanID  string
+}
+
+// StartTrace starts trace span of handling the message in Default tracer
+func (x *Message) StartTrace(name string, attrs map[string]string) *Span {
+	return StartTrace(name, x.CorrelationID, x.ParentSpanID, attrs)
+}
+
+// DecapSNSonSQSMessage is same as golambda.Event.DecapSNSonSQSMessage, but it also extracts trace context from message attributes
+func DecapSNSonSQSMessage(event golambda.Event) ([]*Message, error) {
+	var sqsEvent events.SQSEvent
+	if err := event.Bind(&sqsEvent); err != nil {
+		return nil, err
+	}
+
+	if len(sqsEvent.Records) == 0 {
+		return nil, golambda.NewError("No SQS event records")
+	}
+
+	var messages []*Message
+	for _, record := range sqsEvent.Records {
+		var snsEntity events.SNSEntity
+		if err := json.Unmarshal([]byte(record.Body), &snsEntity); err != nil {
+			return nil, golambda.WrapError(err, "Failed to unmarshal SNS entity in SQS msg").With("body", record.Body)
+		}
+
+		msg := &Message{
+			Record:        golambda.EventRecord(snsEntity.Message),
+			CorrelationID: attributeValue(snsEntity.MessageAttributes, AttrCorrelationID),
+		}
+		// traceparent: version-traceid-parentid-flags
+		if parts := strings.Split(attributeValue(snsEntity.MessageAttributes, AttrTraceParent), "-"); len(parts) == 4 {
+			msg.ParentSpanID = parts[2]
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages, nil
+}
+
+// attributeValue returns string value of SNS message attribute. Attributes are delivered as {"Type": "String", "Value": "..."} in SNS entity.
+func attributeValue(attrs map[string]interface{}, name string) string {
+	attr, ok := attrs[name].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	value, _ := attr["Value"].(string)
+	return value
+}
@@ -0,0 +1,180 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/m-mizutani/golambda"
+)
+
+// DefaultServiceName is service.name of exported spans if OTEL_SERVICE_NAME is not set
+const DefaultServiceName = "retrospector"
+
+// OTLPExporter sends spans to OpenTelemetry collector by OTLP/HTTP with JSON encoding
+type OTLPExporter struct {
+	endpoint    string
+	headers     map[string]string
+	serviceName string
+	client      *http.Client
+}
+
+// NewOTLPExporter is constructor of OTLPExporter. endpoint is full URL of traces, e.g. "http://localhost:4318/v1/traces"
+func NewOTLPExporter(endpoint, serviceName string, headers map[string]string) *OTLPExporter {
+	if serviceName == "" {
+		serviceName = DefaultServiceName
+	}
+	return &OTLPExporter{
+		endpoint:    endpoint,
+		headers:     headers,
+		serviceName: serviceName,
+		client:      &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// NewOTLPExporterFromEnv configures OTLPExporter by standard environment variables of OpenTelemetry: OTEL_EXPORTER_OTLP_TRACES_ENDPOINT or OTEL_EXPORTER_OTLP_ENDPOINT, OTEL_EXPORTER_OTLP_HEADERS and OTEL_SERVICE_NAME. It returns nil if no endpoint is set.
+func NewOTLPExporterFromEnv() Exporter {
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+		if base == "" {
+			return nil
+		}
+		endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+	}
+
+	// OTEL_EXPORTER_OTLP_HEADERS is comma separated key=value pairs
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		if kv := strings.SplitN(strings.TrimSpace(pair), "=", 2); len(kv) == 2 {
+			headers[kv[0]] = kv[1]
+		}
+	}
+
+	return NewOTLPExporter(endpoint, os.Getenv("OTEL_SERVICE_NAME"), headers)
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+// Values of OTLP enums
+const (
+	otlpSpanKindInternal = 1
+	otlpStatusOK         = 1
+	otlpStatusError      = 2
+)
+
+func toOTLPAttributes(attrs map[string]string) []otlpAttribute {
+	var keys []string
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var results []otlpAttribute
+	for _, k := range keys {
+		results = append(results, otlpAttribute{Key: k, Value: otlpValue{StringValue: attrs[k]}})
+	}
+	return results
+}
+
+// Export sends spans in one request
+func (x *OTLPExporter) Export(spans []*Span) error {
+	scope := otlpScopeSpans{}
+	scope.Scope.Name = "github.com/cookpad/retrospector"
+	for _, span := range spans {
+		s := otlpSpan{
+			TraceID:           span.TraceID,
+			SpanID:            span.SpanID,
+			ParentSpanID:      span.ParentSpanID,
+			Name:              span.Name,
+			Kind:              otlpSpanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(span.StartedAt.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.EndedAt.UnixNano(), 10),
+			Attributes:        toOTLPAttributes(span.Attributes),
+			Status:            otlpStatus{Code: otlpStatusOK},
+		}
+		if span.Error != "" {
+			s.Status = otlpStatus{Code: otlpStatusError, Message: span.Error}
+		}
+		scope.Spans = append(scope.Spans, s)
+	}
+
+	resource := otlpResourceSpans{ScopeSpans: []otlpScopeSpans{scope}}
+	resource.Resource.Attributes = toOTLPAttributes(map[string]string{"service.name": x.serviceName})
+
+	raw, err := json.Marshal(otlpRequest{ResourceSpans: []otlpResourceSpans{resource}})
+	if err != nil {
+		return golambda.WrapError(err, "Failed to marshal OTLP request")
+	}
+
+	req, err := http.NewRequest("POST", x.endpoint, bytes.NewReader(raw))
+	if err != nil {
+		return golambda.WrapError(err, "Failed to create OTLP request").With("endpoint", x.endpoint)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range x.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := x.client.Do(req)
+	if err != nil {
+		return golambda.WrapError(err, "Failed to send spans").With("endpoint", x.endpoint)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || 300 <= resp.StatusCode {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return golambda.NewError("OTLP collector error").
+			With("endpoint", x.endpoint).With("code", resp.StatusCode).With("body", string(body))
+	}
+
+	return nil
+}
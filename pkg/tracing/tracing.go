@@ -0,0 +1,242 @@
+package tracing
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/cookpad/retrospector/pkg/logging"
+	"github.com/m-mizutani/golambda"
+)
+
+var logger = logging.Logger
+
+// NewCorrelationID returns ID derived from parts such as bucket, key and ETag of S3 object, then the same object always has the same ID. entityRecord, entityIngest and entityDetect derive it from bucket, key and ETag of S3 object, so their log lines and alerts of the same object are tied by the ID. Random ID is returned if no part is given, e.g. for a crawler run. The ID is 32 hex characters and also used as trace ID of OpenTelemetry.
+func NewCorrelationID(parts ...string) string {
+	if len(parts) == 0 {
+		return randomHex(16)
+	}
+	hash := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(hash[:16])
+}
+
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		logger.Error().Err(err).Msg("Failed to generate random ID")
+	}
+	return hex.EncodeToString(buf)
+}
+
+var traceIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// traceIDOf converts correlation ID to trace ID. Correlation ID that is not generated by NewCorrelationID is hashed.
+func traceIDOf(correlationID string) string {
+	if traceIDPattern.MatchString(correlationID) {
+		return correlationID
+	}
+	return NewCorrelationID(correlationID)
+}
+
+// Span is a unit of work in a trace
+type Span struct {
+	Name         string
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	StartedAt    time.Time
+	EndedAt      time.Time
+	Attributes   map[string]string
+	// Error is message of error that failed the work. Empty means success
+	Error string
+
+	tracer        *Tracer
+	correlationID string
+	// prev is trace span that was current before this trace span. It is set only for span started by StartTrace
+	prev    *Span
+	isTrace bool
+}
+
+// SetAttribute adds attribute to the span
+func (x *Span) SetAttribute(key, value string) {
+	x.tracer.mutex.Lock()
+	defer x.tracer.mutex.Unlock()
+	x.Attributes[key] = value
+}
+
+// End finishes the span. Trace span restores previous trace and correlation ID.
+func (x *Span) End(err error) {
+	x.tracer.end(x, err)
+}
+
+// Exporter sends finished spans to a tracing backend
+type Exporter interface {
+	Export(spans []*Span) error
+}
+
+// Tracer creates spans. Spans started by Start are children of current trace span that is started by StartTrace, then Start is safe to call from concurrent goroutines.
+type Tracer struct {
+	mutex    sync.Mutex
+	exporter Exporter
+	current  *Span
+	spans    []*Span
+}
+
+// NewTracer is constructor of Tracer. Spans are not buffered if exporter is nil.
+func NewTracer(exporter Exporter) *Tracer {
+	return &Tracer{exporter: exporter}
+}
+
+// SetExporter replaces exporter of the tracer
+func (x *Tracer) SetExporter(exporter Exporter) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.exporter = exporter
+}
+
+func newSpan(tracer *Tracer, name string, attrs map[string]string) *Span {
+	span := &Span{
+		Name:       name,
+		SpanID:     randomHex(8),
+		StartedAt:  time.Now(),
+		Attributes: make(map[string]string),
+		tracer:     tracer,
+	}
+	for k, v := range attrs {
+		span.Attributes[k] = v
+	}
+	return span
+}
+
+// StartTrace starts span that becomes current trace span until End and sets correlation ID to logging. If correlationID is empty, the span joins current trace as a child. parentSpanID is ID of remote parent span, e.g. in traceparent of SNS message, and can be empty.
+func (x *Tracer) StartTrace(name, correlationID, parentSpanID string, attrs map[string]string) *Span {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	span := newSpan(x, name, attrs)
+	span.isTrace = true
+	span.prev = x.current
+
+	switch {
+	case correlationID != "":
+		span.correlationID = correlationID
+		span.TraceID = traceIDOf(correlationID)
+		span.ParentSpanID = parentSpanID
+	case x.current != nil:
+		span.correlationID = x.current.correlationID
+		span.TraceID = x.current.TraceID
+		span.ParentSpanID = x.current.SpanID
+	default:
+		span.correlationID = NewCorrelationID()
+		span.TraceID = span.correlationID
+	}
+
+	x.current = span
+	logging.SetCorrelationID(span.correlationID)
+	return span
+}
+
+// Start starts span as a child of current trace span. A new trace is started if no trace span is current.
+func (x *Tracer) Start(name string, attrs map[string]string) *Span {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	span := newSpan(x, name, attrs)
+	if x.current != nil {
+		span.TraceID = x.current.TraceID
+		span.ParentSpanID = x.current.SpanID
+	} else {
+		span.TraceID = randomHex(16)
+	}
+	return span
+}
+
+func (x *Tracer) end(span *Span, err error) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	span.EndedAt = time.Now()
+	if err != nil {
+		span.Error = err.Error()
+	}
+
+	if span.isTrace && x.current == span {
+		x.current = span.prev
+		if x.current != nil {
+			logging.SetCorrelationID(x.current.correlationID)
+		} else {
+			logging.SetCorrelationID("")
+		}
+	}
+
+	if x.exporter != nil {
+		x.spans = append(x.spans, span)
+	}
+}
+
+// Current returns current trace span or nil
+func (x *Tracer) Current() *Span {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	return x.current
+}
+
+// Flush exports finished spans and clears them
+func (x *Tracer) Flush() error {
+	x.mutex.Lock()
+	spans := x.spans
+	x.spans = nil
+	exporter := x.exporter
+	x.mutex.Unlock()
+
+	if len(spans) == 0 || exporter == nil {
+		return nil
+	}
+	return exporter.Export(spans)
+}
+
+// Default is tracer used by package level functions. Spans are exported by OTLP if OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT is set, and not exported otherwise.
+var Default *Tracer
+
+func init() {
+	Default = NewTracer(NewOTLPExporterFromEnv())
+}
+
+// StartTrace starts trace span in Default tracer
+func StartTrace(name, correlationID, parentSpanID string, attrs map[string]string) *Span {
+	return Default.StartTrace(name, correlationID, parentSpanID, attrs)
+}
+
+// Start starts span in Default tracer
+func Start(name string, attrs map[string]string) *Span {
+	return Default.Start(name, attrs)
+}
+
+// Flush exports spans of Default tracer
+func Flush() error {
+	return Default.Flush()
+}
+
+// Invoke calls handler of Lambda function in a trace of which correlation ID is derived from request ID of the invocation. Then log lines and SNS messages of a crawler run have the same ID. Spans are flushed after the handler and error of flush is only logged.
+func Invoke(function string, event golambda.Event, handler func() (interface{}, error)) (interface{}, error) {
+	var correlationID string
+	if event.Ctx != nil {
+		if lc, ok := lambdacontext.FromContext(event.Ctx); ok && lc.AwsRequestID != "" {
+			correlationID = NewCorrelationID(lc.AwsRequestID)
+		}
+	}
+
+	span := StartTrace(function, correlationID, "", map[string]string{"faas.name": function})
+	resp, err := handler()
+	span.End(err)
+
+	if flushErr := Flush(); flushErr != nil {
+		logger.Error().Err(flushErr).Msg("Failed to flush spans")
+	}
+	return resp, err
+}
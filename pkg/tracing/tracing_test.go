@@ -0,0 +1,136 @@
+package tracing_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/cookpad/retrospector/pkg/logging"
+	"github.com/cookpad/retrospector/pkg/tracing"
+	"github.com/m-mizutani/golambda"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryExporter struct {
+	spans []*tracing.Span
+}
+
+func (x *memoryExporter) Export(spans []*tracing.Span) error {
+	x.spans = append(x.spans, spans...)
+	return nil
+}
+
+func TestNewCorrelationID(t *testing.T) {
+	id := tracing.NewCorrelationID("bucket", "key", "etag")
+	assert.Equal(t, 32, len(id))
+	assert.Equal(t, id, tracing.NewCorrelationID("bucket", "key", "etag"))
+	assert.NotEqual(t, id, tracing.NewCorrelationID("bucket", "key", "etag2"))
+	assert.NotEqual(t, tracing.NewCorrelationID(), tracing.NewCorrelationID())
+}
+
+func TestTracer(t *testing.T) {
+	exporter := &memoryExporter{}
+	tracer := tracing.NewTracer(exporter)
+
+	invocation := tracer.StartTrace("iocDetect", "", "", nil)
+	runID := logging.CorrelationID()
+	assert.Equal(t, invocation.TraceID, runID)
+
+	objectID := tracing.NewCorrelationID("bucket", "key", "etag")
+	object := tracer.StartTrace("DetectEntityObject", objectID, "", nil)
+	assert.Equal(t, objectID, logging.CorrelationID())
+
+	var buf bytes.Buffer
+	logger := logging.Logger.Output(&buf)
+	logger.Info().Msg("test")
+	assert.Contains(t, buf.String(), `"correlation_id":"`+objectID+`"`)
+
+	lookup := tracer.Start("BatchGetIOCSet", map[string]string{"db.system": "dynamodb"})
+	lookup.End(errors.New("throttled"))
+	object.End(nil)
+	assert.Equal(t, runID, logging.CorrelationID())
+
+	message := tracer.StartTrace("Hunt", "", "", nil)
+	message.End(nil)
+	invocation.End(nil)
+	assert.Equal(t, "", logging.CorrelationID())
+
+	require.NoError(t, tracer.Flush())
+	require.Equal(t, 4, len(exporter.spans))
+	assert.Equal(t, object.SpanID, exporter.spans[0].ParentSpanID)
+	assert.Equal(t, objectID, exporter.spans[0].TraceID)
+	assert.Equal(t, "throttled", exporter.spans[0].Error)
+	assert.Equal(t, "", exporter.spans[1].ParentSpanID)
+	assert.Equal(t, invocation.SpanID, exporter.spans[2].ParentSpanID)
+	assert.Equal(t, runID, exporter.spans[2].TraceID)
+
+	// Buffer is cleared by flush
+	require.NoError(t, tracer.Flush())
+	assert.Equal(t, 4, len(exporter.spans))
+}
+
+func TestMessageAttributes(t *testing.T) {
+	assert.Nil(t, tracing.MessageAttributes())
+
+	span := tracing.StartTrace("crawlOTX", "", "", nil)
+	attrs := tracing.MessageAttributes()
+	span.End(nil)
+	require.NotNil(t, attrs)
+
+	// Attributes are delivered in SNS entity over SQS
+	entity := events.SNSEntity{Message: `["blue"]`, MessageAttributes: map[string]interface{}{}}
+	for name, attr := range attrs {
+		entity.MessageAttributes[name] = map[string]interface{}{"Type": *attr.DataType, "Value": *attr.StringValue}
+	}
+	body, err := json.Marshal(entity)
+	require.NoError(t, err)
+	event := golambda.Event{Origin: events.SQSEvent{
+		Records: []events.SQSMessage{{MessageId: "x", Body: string(body)}},
+	}}
+
+	messages, err := tracing.DecapSNSonSQSMessage(event)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(messages))
+	assert.Equal(t, `["blue"]`, messages[0].Record.String())
+	assert.Equal(t, span.TraceID, messages[0].CorrelationID)
+	assert.Equal(t, span.SpanID, messages[0].ParentSpanID)
+
+	received := messages[0].StartTrace("iocRecord", nil)
+	received.End(nil)
+	assert.Equal(t, span.TraceID, received.TraceID)
+	assert.Equal(t, span.SpanID, received.ParentSpanID)
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var body map[string]interface{}
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		auth = r.Header.Get("Authorization")
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+	}))
+	defer server.Close()
+
+	tracer := tracing.NewTracer(tracing.NewOTLPExporter(server.URL+"/v1/traces", "", map[string]string{"Authorization": "Bearer x"}))
+	span := tracer.StartTrace("entityDetect", "", "", map[string]string{"faas.name": "entityDetect"})
+	span.End(errors.New("failed"))
+	require.NoError(t, tracer.Flush())
+
+	assert.Equal(t, "Bearer x", auth)
+	resource := body["resourceSpans"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"key": "service.name", "value": map[string]interface{}{"stringValue": "retrospector"}},
+	}, resource["resource"].(map[string]interface{})["attributes"])
+
+	scope := resource["scopeSpans"].([]interface{})[0].(map[string]interface{})
+	s := scope["spans"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, span.TraceID, s["traceId"])
+	assert.Equal(t, span.SpanID, s["spanId"])
+	assert.Equal(t, "entityDetect", s["name"])
+	assert.Equal(t, map[string]interface{}{"code": float64(2), "message": "failed"}, s["status"])
+}
@@ -0,0 +1,66 @@
+package usecase
+
+import (
+	"time"
+
+	"github.com/cookpad/retrospector/pkg/arguments"
+	"github.com/cookpad/retrospector/pkg/logging"
+	"github.com/cookpad/retrospector/pkg/metrics"
+	"github.com/cookpad/retrospector/pkg/service"
+	"github.com/cookpad/retrospector/pkg/tracing"
+	"github.com/m-mizutani/golambda"
+)
+
+// EmitAlert emits alert for entities selected by re-alert policy, then updates detection history of the value. Alert is not emitted if no entity is selected or the alert was marked as false positive. Alert of benign value is dropped before updating alert state and detection history if SuppressBenignAlert is set.
+func EmitAlert(args *arguments.Arguments, alert *service.Alert) (err error) {
+	span := tracing.Start("EmitAlert", map[string]string{
+		"retrospector.value": alert.Target.Data,
+		"retrospector.type":  string(alert.Target.Type),
+	})
+	defer func() { span.End(err) }()
+
+	if alert.CorrelationID == "" {
+		alert.CorrelationID = logging.CorrelationID()
+	}
+
+	repo := args.RepositoryService()
+	now := time.Now()
+
+	detections, err := repo.GetDetections(alert.Target)
+	if err != nil {
+		return err
+	}
+	policy, err := args.RealertPolicy()
+	if err != nil {
+		return err
+	}
+	entities := policy.Select(alert.Entities, alert.IOCChunk, detections, now)
+	if len(entities) == 0 {
+		logger.Debug().Interface("target", alert.Target).Msg("Skip alert by re-alert policy")
+		metrics.Count("AlertsSuppressed", 1, metrics.Dimensions{"Reason": "realert_policy"})
+		return nil
+	}
+	alert.Entities = entities
+
+	alertSvc := args.AlertService()
+	if alertSvc.Evaluate(alert) {
+		return nil
+	}
+
+	state, emit, err := args.LifecycleService().OnDetection(alert.Target)
+	if err != nil {
+		return err
+	}
+	if !emit {
+		// Detection of suppressed alert is not recorded. Otherwise re-alert policy regards it as alerted after the status is changed
+		metrics.Count("AlertsSuppressed", 1, metrics.Dimensions{"Reason": "false_positive"})
+		return nil
+	}
+
+	alert.State = state
+	if err := alertSvc.EmitToSlack(alert); err != nil {
+		return golambda.WrapError(err).With("alert", alert)
+	}
+
+	return repo.PutDetections(service.UpdateDetections(alert.Target, entities, alert.IOCChunk, detections, now))
+}
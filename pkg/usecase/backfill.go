@@ -0,0 +1,207 @@
+package usecase
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/cookpad/retrospector/pkg/arguments"
+	"github.com/m-mizutani/golambda"
+)
+
+// DefaultBackfillParallel is number of objects handled at once if BackfillOptions.Parallel is not set
+const DefaultBackfillParallel = 4
+
+// BackfillOptions specifies archived entity objects to be loaded
+type BackfillOptions struct {
+	Region string
+	Bucket string
+	Prefix string
+	// Since and Until are unix seconds compared with LastModified of objects. Zero means no limit.
+	Since int64
+	Until int64
+
+	// Detect also looks up IOC set for entities in the same way as entityIngest. Entities are only recorded if false.
+	Detect   bool
+	Parallel int
+}
+
+// BackfillCheckpoint is progress of backfill. All objects of key <= After and objects in Done have been handled. Objects after After are handled in parallel, then some of them can be done before After reaches them.
+type BackfillCheckpoint struct {
+	Bucket    string   `json:"bucket"`
+	Prefix    string   `json:"prefix"`
+	After     string   `json:"after"`
+	Done      []string `json:"done,omitempty"`
+	Processed int      `json:"processed"`
+}
+
+// BackfillReport is result of backfill
+type BackfillReport struct {
+	Listed    int `json:"listed"`
+	Skipped   int `json:"skipped"`
+	Processed int `json:"processed"`
+}
+
+// BackfillSaver saves checkpoint to resume backfill. It is called every time progress of backfill changes.
+type BackfillSaver func(checkpoint *BackfillCheckpoint) error
+
+type backfillResult struct {
+	index int
+	err   error
+}
+
+// Backfill lists entity objects under Bucket/Prefix that were modified in the time range and handles them by the same path as entityRecord (or entityIngest if Detect). Objects handled in checkpoint are skipped. checkpoint is updated and saved by save during backfill.
+func Backfill(args *arguments.Arguments, opt *BackfillOptions, checkpoint *BackfillCheckpoint, save BackfillSaver) (*BackfillReport, error) {
+	if opt.Region == "" {
+		opt.Region = args.AwsRegion
+	}
+	if opt.Parallel <= 0 {
+		opt.Parallel = DefaultBackfillParallel
+	}
+	if checkpoint.Bucket == "" && checkpoint.Prefix == "" {
+		checkpoint.Bucket, checkpoint.Prefix = opt.Bucket, opt.Prefix
+	}
+	if checkpoint.Bucket != opt.Bucket || checkpoint.Prefix != opt.Prefix {
+		return nil, golambda.NewError("Checkpoint is not of the bucket and prefix").
+			With("checkpoint", checkpoint).With("bucket", opt.Bucket).With("prefix", opt.Prefix)
+	}
+
+	keys, skipped, err := listBackfillObjects(args, opt, checkpoint)
+	if err != nil {
+		return nil, err
+	}
+	report := &BackfillReport{Listed: len(keys) + skipped, Skipped: skipped}
+	logger.Info().Int("objects", len(keys)).Int("skipped", skipped).Str("after", checkpoint.After).Msg("Start backfill")
+
+	handle := RecordEntityObject
+	if opt.Detect {
+		handle = IngestEntityObject
+	}
+
+	jobs := make(chan int)
+	results := make(chan *backfillResult)
+	stop := make(chan struct{})
+
+	go func() {
+		defer close(jobs)
+		for i := range keys {
+			select {
+			case jobs <- i:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for w := 0; w < opt.Parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				err := handle(args, opt.Region, opt.Bucket, keys[i])
+				results <- &backfillResult{index: i, err: err}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	resumed := checkpoint.Done
+
+	// Results are collected in this goroutine only. Then checkpoint is not accessed concurrently.
+	done := make([]bool, len(keys))
+	watermark := 0
+	var firstErr error
+	for result := range results {
+		if result.err != nil {
+			if firstErr == nil {
+				firstErr = golambda.WrapError(result.err, "Failed to backfill object").With("key", keys[result.index])
+				close(stop)
+			}
+			continue
+		}
+
+		done[result.index] = true
+		report.Processed++
+		checkpoint.Processed++
+		for watermark < len(keys) && done[watermark] {
+			checkpoint.After = keys[watermark]
+			watermark++
+		}
+		// Objects done in previous run are kept until After passes them
+		var doneKeys []string
+		for _, key := range resumed {
+			if key > checkpoint.After {
+				doneKeys = append(doneKeys, key)
+			}
+		}
+		for i := watermark; i < len(keys); i++ {
+			if done[i] {
+				doneKeys = append(doneKeys, keys[i])
+			}
+		}
+		sort.Strings(doneKeys)
+		checkpoint.Done = doneKeys
+
+		if err := save(checkpoint); err != nil && firstErr == nil {
+			firstErr = err
+			close(stop)
+		}
+		if report.Processed%100 == 0 {
+			logger.Info().Int("processed", report.Processed).Int("total", len(keys)).Msg("Backfill progress")
+		}
+	}
+
+	if firstErr != nil {
+		return report, firstErr
+	}
+
+	logger.Info().Interface("report", report).Msg("Done backfill")
+	return report, nil
+}
+
+// listBackfillObjects returns keys of objects to be handled in order of key. Number of objects that are already done in checkpoint is also returned.
+func listBackfillObjects(args *arguments.Arguments, opt *BackfillOptions, checkpoint *BackfillCheckpoint) ([]string, int, error) {
+	client, err := args.S3Client(opt.Region)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	doneSet := make(map[string]struct{})
+	for _, key := range checkpoint.Done {
+		doneSet[key] = struct{}{}
+	}
+
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(opt.Bucket),
+		Prefix: aws.String(opt.Prefix),
+	}
+	if checkpoint.After != "" {
+		input.StartAfter = aws.String(checkpoint.After)
+	}
+
+	var keys []string
+	skipped := 0
+	if err := client.ListObjectsV2Pages(input, func(output *s3.ListObjectsV2Output, last bool) bool {
+		for _, obj := range output.Contents {
+			modified := aws.TimeValue(obj.LastModified).Unix()
+			if (opt.Since > 0 && modified < opt.Since) || (opt.Until > 0 && modified > opt.Until) {
+				continue
+			}
+			if _, ok := doneSet[aws.StringValue(obj.Key)]; ok {
+				skipped++
+				continue
+			}
+			keys = append(keys, aws.StringValue(obj.Key))
+		}
+		return true
+	}); err != nil {
+		return nil, 0, golambda.WrapError(err, "Failed to list objects").With("input", input)
+	}
+
+	return keys, skipped, nil
+}
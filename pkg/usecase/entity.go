@@ -0,0 +1,327 @@
+package usecase
+
+import (
+	"time"
+
+	"github.com/cookpad/retrospector"
+	"github.com/cookpad/retrospector/pkg/arguments"
+	"github.com/cookpad/retrospector/pkg/logging"
+	"github.com/cookpad/retrospector/pkg/metrics"
+	"github.com/cookpad/retrospector/pkg/service"
+	"github.com/m-mizutani/golambda"
+)
+
+var logger = logging.Logger
+
+// EntityMap is entity set of one S3 object grouped by value
+type EntityMap map[retrospector.Value][]*retrospector.Entity
+
+// ReadEntityObject downloads and parses an entity object only once and returns entities grouped by value
+func ReadEntityObject(args *arguments.Arguments, region, bucket, key string) (EntityMap, error) {
+	rq := args.EntityService().NewReadQueue(region, bucket, key)
+	entityMap := make(EntityMap)
+
+	for {
+		entity := rq.Read()
+		if entity == nil {
+			break
+		}
+		entityMap[entity.Value] = append(entityMap[entity.Value], entity)
+	}
+
+	if err := rq.Error(); err != nil {
+		return nil, err
+	}
+
+	return entityMap, nil
+}
+
+// RecordEntities saves entities to repository. Entities of same value, subject and source are aggregated into one record with first-seen, last-seen and count
+func RecordEntities(args *arguments.Arguments, entityMap EntityMap) error {
+	var entities []*retrospector.Entity
+	for _, set := range entityMap {
+		entities = append(entities, set...)
+	}
+
+	if err := args.RepositoryService().PutEntities(entities); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DetectEntities looks up IOC set for all values in entityMap at once and emits alert for each matched value
+func DetectEntities(args *arguments.Arguments, entityMap EntityMap) error {
+	_, err := detectEntities(args, entityMap)
+	return err
+}
+
+// detectEntities is DetectEntities that returns values matched with IOC set
+func detectEntities(args *arguments.Arguments, entityMap EntityMap) ([]retrospector.Value, error) {
+	var values []*retrospector.Value
+	for value := range entityMap {
+		value := value
+		values = append(values, &value)
+	}
+
+	matchedMap, err := lookupIOCSet(args, values)
+	if err != nil {
+		return nil, err
+	}
+	if err := alertEntities(args, entityMap, matchedMap); err != nil {
+		return nil, err
+	}
+
+	var matched []retrospector.Value
+	for value := range matchedMap {
+		matched = append(matched, value)
+	}
+	return matched, nil
+}
+
+// lookupIOCSet returns IOC set that is not revoked for each value. Values are filtered by IOC filter before looking up repository.
+func lookupIOCSet(args *arguments.Arguments, values []*retrospector.Value) (map[retrospector.Value]retrospector.IOCChunk, error) {
+	values, err := filterIOCCandidates(args, values)
+	if err != nil {
+		return nil, err
+	}
+
+	detected, err := args.RepositoryService().BatchGetIOCSet(values)
+	if err != nil {
+		return nil, err
+	}
+
+	matchedMap := make(map[retrospector.Value]retrospector.IOCChunk)
+	for _, ioc := range detected {
+		if ioc.IsRevoked() {
+			continue
+		}
+		matchedMap[ioc.Value] = append(matchedMap[ioc.Value], ioc)
+	}
+	return matchedMap, nil
+}
+
+// alertEntities emits alert for each value in matchedMap with entities of the value in entityMap
+func alertEntities(args *arguments.Arguments, entityMap EntityMap, matchedMap map[retrospector.Value]retrospector.IOCChunk) error {
+	for value, matched := range matchedMap {
+		value := value
+		// Entities seen out of validity of IOC are not alerted
+		timeMatched, matched := service.MatchByTime(entityMap[value], matched, args.LookbackMargin())
+		if len(timeMatched) == 0 {
+			logger.Debug().Interface("value", value).Msg("Skip IOC matched out of validity period")
+			continue
+		}
+		metrics.Count("Matches", 1, metrics.Dimensions{"Cause": "entity"})
+
+		entities, err := aggregatedEntities(args, &value, timeMatched)
+		if err != nil {
+			return err
+		}
+
+		alert := &service.Alert{
+			Cause:    service.AlertCauseEntity,
+			Target:   &value,
+			Entities: entities,
+			IOCChunk: matched,
+		}
+		if err := EmitAlert(args, alert); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// aggregatedEntities aggregates entities of the value in the object. Figures saved in repository are used instead if exists because they cover all objects recorded so far.
+func aggregatedEntities(args *arguments.Arguments, value *retrospector.Value, entities []*retrospector.Entity) ([]*retrospector.Entity, error) {
+	stored, err := args.RepositoryService().BatchGetEntities([]*retrospector.Value{value})
+	if err != nil {
+		return nil, err
+	}
+	storedMap := make(map[retrospector.EntityKey]*retrospector.Entity)
+	for _, entity := range stored {
+		storedMap[entity.Key()] = entity
+	}
+
+	results := retrospector.AggregateEntities(entities)
+	for i, entity := range results {
+		if s, ok := storedMap[entity.Key()]; ok && s.Count >= entity.Count {
+			results[i] = s
+		}
+	}
+	return results, nil
+}
+
+// filterIOCCandidates drops values that are definitely not in IOC set by IOC filter. All values are returned if IOC filter is not available.
+func filterIOCCandidates(args *arguments.Arguments, values []*retrospector.Value) ([]*retrospector.Value, error) {
+	filterSvc := args.IOCFilterService()
+	if filterSvc == nil {
+		return values, nil
+	}
+
+	filter, err := filterSvc.CachedFilter()
+	if err != nil {
+		return nil, err
+	}
+	if filter == nil {
+		return values, nil
+	}
+
+	var candidates []*retrospector.Value
+	for _, value := range values {
+		if filter.Test(service.IOCFilterKey(value)) {
+			candidates = append(candidates, value)
+		}
+	}
+
+	logger.Debug().Int("values", len(values)).Int("candidates", len(candidates)).Msg("Filtered values by IOC filter")
+	return candidates, nil
+}
+
+// RecordEntityObject reads an entity object and saves entities in it
+func RecordEntityObject(args *arguments.Arguments, region, bucket, key string) error {
+	return handleEntityObject(args, region, bucket, key, func(all, fresh EntityMap) ([]retrospector.Value, error) {
+		return nil, RecordEntities(args, all)
+	})
+}
+
+// DetectEntityObject reads an entity object and detects entities matched with existing IOC set
+func DetectEntityObject(args *arguments.Arguments, region, bucket, key string) error {
+	return handleEntityObject(args, region, bucket, key, func(all, fresh EntityMap) ([]retrospector.Value, error) {
+		return detectEntities(args, fresh)
+	})
+}
+
+// IngestEntityObject reads an entity object once, then both saves and detects entities in it. It halves S3 GetObject and parsing cost compared with running RecordEntityObject and DetectEntityObject separately.
+func IngestEntityObject(args *arguments.Arguments, region, bucket, key string) error {
+	return handleEntityObject(args, region, bucket, key, func(all, fresh EntityMap) ([]retrospector.Value, error) {
+		if err := RecordEntities(args, all); err != nil {
+			return nil, err
+		}
+		return detectEntities(args, fresh)
+	})
+}
+
+// WindowHandler handles entities in a window. all has every entity in the window to be recorded. fresh has only entities of values that are not handled in previous windows to be looked up. It returns values in fresh that are matched with IOC set.
+type WindowHandler func(all, fresh EntityMap) ([]retrospector.Value, error)
+
+// handleEntityObject calls handler with entities in the object. If Arguments.EntityWindowSize is set, the object is processed in streaming mode by StreamEntityObject. Otherwise handler is called once with all entities.
+func handleEntityObject(args *arguments.Arguments, region, bucket, key string, handler WindowHandler) error {
+	started := time.Now()
+	defer func() {
+		metrics.Latency("ObjectProcessingLatency", time.Since(started), nil)
+	}()
+
+	if args.EntityWindowSize > 0 {
+		return StreamEntityObject(args, region, bucket, key, handler)
+	}
+
+	entityMap, err := ReadEntityObject(args, region, bucket, key)
+	if err != nil {
+		return err
+	}
+	_, err = handler(entityMap, entityMap)
+	return err
+}
+
+// StreamEntityObject calls handler for each window that has up to Arguments.EntityWindowSize entities. Values handled in previous windows are excluded from fresh map while they remain in dedupe set that holds up to Arguments.EntityDedupeSize values, but they are still in all map to keep count of entities correct. Then memory usage does not depend on size of the object. Values matched with IOC set are not put in dedupe set because their entities in later windows can still match IOC by new subject or seen time.
+func StreamEntityObject(args *arguments.Arguments, region, bucket, key string, handler WindowHandler) error {
+	rq := args.EntityService().NewReadQueue(region, bucket, key)
+	// Stop reading S3 object if handler fails
+	defer rq.Close()
+	seen := newValueSet(args.EntityDedupeSize)
+
+	all, fresh := make(EntityMap), make(EntityMap)
+	var windowCount, windows, skipped int
+
+	flush := func() error {
+		if windowCount == 0 {
+			return nil
+		}
+		matched, err := handler(all, fresh)
+		if err != nil {
+			return golambda.WrapError(err).With("window", windows)
+		}
+		for _, value := range matched {
+			delete(fresh, value)
+		}
+		for value := range fresh {
+			seen.Add(value)
+		}
+
+		all, fresh = make(EntityMap), make(EntityMap)
+		windowCount = 0
+		windows++
+		return nil
+	}
+
+	for {
+		entity := rq.Read()
+		if entity == nil {
+			break
+		}
+
+		all[entity.Value] = append(all[entity.Value], entity)
+		if seen.Has(entity.Value) {
+			skipped++
+		} else {
+			fresh[entity.Value] = append(fresh[entity.Value], entity)
+		}
+		windowCount++
+
+		if windowCount >= args.EntityWindowSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := rq.Error(); err != nil {
+		return err
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	logger.Info().Int("windows", windows).Int("skipped", skipped).Msg("Handled entity object in streaming mode")
+	return nil
+}
+
+// valueSet is size-capped set of values. The oldest value is evicted when the set is full.
+type valueSet struct {
+	values map[retrospector.Value]struct{}
+	ring   []retrospector.Value
+	next   int
+}
+
+const defaultValueSetSize = 100000
+
+func newValueSet(size int) *valueSet {
+	if size <= 0 {
+		size = defaultValueSetSize
+	}
+	return &valueSet{
+		values: make(map[retrospector.Value]struct{}, size),
+		ring:   make([]retrospector.Value, 0, size),
+	}
+}
+
+func (x *valueSet) Has(value retrospector.Value) bool {
+	_, ok := x.values[value]
+	return ok
+}
+
+func (x *valueSet) Add(value retrospector.Value) {
+	if x.Has(value) {
+		return
+	}
+
+	if len(x.ring) < cap(x.ring) {
+		x.ring = append(x.ring, value)
+	} else {
+		delete(x.values, x.ring[x.next])
+		x.ring[x.next] = value
+		x.next = (x.next + 1) % len(x.ring)
+	}
+	x.values[value] = struct{}{}
+}
@@ -0,0 +1,158 @@
+package usecase
+
+import (
+	"github.com/cookpad/retrospector"
+	"github.com/cookpad/retrospector/pkg/arguments"
+	"github.com/cookpad/retrospector/pkg/service"
+	"github.com/m-mizutani/golambda"
+)
+
+// ExportOptions specifies destination, format and target of export
+type ExportOptions struct {
+	Region string
+	Bucket string
+	Prefix string
+	Format service.ExportFormat
+	Filter service.ExportFilter
+
+	// SkipIOCs and SkipEntities disable export of IOCs and entities respectively
+	SkipIOCs     bool
+	SkipEntities bool
+	// MatchedOnly exports only entities that have been detected as matched with IOC
+	MatchedOnly bool
+}
+
+// ExportReport is result of export
+type ExportReport struct {
+	Bucket    string `json:"bucket"`
+	IOCKey    string `json:"ioc_key,omitempty"`
+	IOCs      int    `json:"iocs"`
+	EntityKey string `json:"entity_key,omitempty"`
+	Entities  int    `json:"entities"`
+}
+
+// ExportObjectKeys returns S3 object keys of exported IOCs and entities
+func ExportObjectKeys(prefix string, format service.ExportFormat) (iocKey, entityKey string) {
+	ext := format.Extension() + ".gz"
+	return prefix + "iocs." + ext, prefix + "entities." + ext
+}
+
+// Export scans repository and writes IOCs and entities that match filter to S3 objects in the format
+func Export(args *arguments.Arguments, opt *ExportOptions) (*ExportReport, error) {
+	if !opt.Format.IsValid() {
+		return nil, golambda.NewError("Invalid export format").With("format", opt.Format)
+	}
+	if opt.Bucket == "" {
+		return nil, golambda.NewError("Bucket of export is required")
+	}
+	if opt.Region == "" {
+		opt.Region = args.AwsRegion
+	}
+
+	iocKey, entityKey := ExportObjectKeys(opt.Prefix, opt.Format)
+	report := &ExportReport{Bucket: opt.Bucket}
+
+	if !opt.SkipIOCs {
+		count, err := exportIOCs(args, opt, iocKey)
+		if err != nil {
+			return nil, err
+		}
+		report.IOCKey, report.IOCs = iocKey, count
+	}
+
+	if !opt.SkipEntities {
+		count, err := exportEntities(args, opt, entityKey)
+		if err != nil {
+			return nil, err
+		}
+		report.EntityKey, report.Entities = entityKey, count
+	}
+
+	logger.Info().Interface("report", report).Msg("Exported repository")
+	return report, nil
+}
+
+func exportIOCs(args *arguments.Arguments, opt *ExportOptions, key string) (int, error) {
+	encoder, err := service.NewIOCEncoder(opt.Format)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	wq := args.EntityService().NewRecordWriteQueue(opt.Region, opt.Bucket, key, encoder)
+	scanErr := args.RepositoryService().ScanIOCSet(func(ioc *retrospector.IOC) error {
+		if opt.Filter.MatchIOC(ioc) {
+			wq.WriteRecord(ioc)
+			count++
+		}
+		return nil
+	})
+	if scanErr != nil {
+		// Keep previous export instead of replacing it with truncated one
+		wq.Abort(scanErr)
+		return 0, scanErr
+	}
+	if err := wq.Close(); err != nil {
+		return 0, golambda.WrapError(err, "Failed to write exported IOCs").With("key", key)
+	}
+
+	return count, nil
+}
+
+func exportEntities(args *arguments.Arguments, opt *ExportOptions, key string) (int, error) {
+	encoder, err := service.NewEntityEncoder(opt.Format)
+	if err != nil {
+		return 0, err
+	}
+
+	repoSvc := args.RepositoryService()
+	// Entities of same value are scanned in a row. Then only detections of the last value are cached.
+	var cachedValue *retrospector.Value
+	var detected map[string]bool
+	isDetected := func(entity *retrospector.Entity) (bool, error) {
+		if cachedValue == nil || *cachedValue != entity.Value {
+			detections, err := repoSvc.GetDetections(&entity.Value)
+			if err != nil {
+				return false, err
+			}
+			value := entity.Value
+			cachedValue = &value
+			detected = make(map[string]bool)
+			for _, detection := range detections {
+				detected[detection.Subject] = true
+			}
+		}
+		return detected[entity.Subject], nil
+	}
+
+	count := 0
+	wq := args.EntityService().NewRecordWriteQueue(opt.Region, opt.Bucket, key, encoder)
+	scanErr := repoSvc.ScanEntities(func(entity *retrospector.Entity) error {
+		if !opt.Filter.MatchEntity(entity) {
+			return nil
+		}
+		if opt.MatchedOnly {
+			matched, err := isDetected(entity)
+			if err != nil {
+				return err
+			}
+			if !matched {
+				return nil
+			}
+		}
+
+		wq.WriteRecord(entity)
+		count++
+		return nil
+	})
+	if scanErr != nil {
+		// Keep previous export instead of replacing it with truncated one
+		wq.Abort(scanErr)
+		return 0, scanErr
+	}
+	if err := wq.Close(); err != nil {
+		return 0, golambda.WrapError(err, "Failed to write exported entities").With("key", key)
+	}
+
+	return count, nil
+}
@@ -0,0 +1,195 @@
+package usecase
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/cookpad/retrospector"
+	"github.com/cookpad/retrospector/pkg/arguments"
+	"github.com/cookpad/retrospector/pkg/metrics"
+	"github.com/cookpad/retrospector/pkg/reader"
+	"github.com/cookpad/retrospector/pkg/service"
+	"github.com/m-mizutani/golambda"
+)
+
+// DefaultHuntSource is source of IOC submitted to hunt without source
+const DefaultHuntSource = "hunt"
+
+// HuntOptions controls hunt
+type HuntOptions struct {
+	// Alert emits alert for matched values in the same way as IOC detection
+	Alert bool
+}
+
+// HuntMatch is entities matched with an IOC
+type HuntMatch struct {
+	IOC       *retrospector.IOC      `json:"ioc"`
+	Subjects  []string               `json:"subjects"`
+	FirstSeen int64                  `json:"first_seen"`
+	LastSeen  int64                  `json:"last_seen"`
+	Entities  []*retrospector.Entity `json:"entities"`
+}
+
+// HuntReport is result of hunt
+type HuntReport struct {
+	Values  int          `json:"values"`
+	Matches []*HuntMatch `json:"matches"`
+}
+
+// Hunt looks up entities matched with IOC set in history. IOC set is not saved. Alert is emitted only if opt.Alert is true.
+func Hunt(args *arguments.Arguments, iocChunk retrospector.IOCChunk, opt *HuntOptions) (*HuntReport, error) {
+	var values []*retrospector.Value
+	for _, ioc := range iocChunk {
+		values = append(values, &ioc.Value)
+	}
+
+	entities, err := args.RepositoryService().BatchGetEntities(values)
+	if err != nil {
+		return nil, err
+	}
+	entityMap := make(map[retrospector.Value][]*retrospector.Entity)
+	for _, entity := range entities {
+		entityMap[entity.Value] = append(entityMap[entity.Value], entity)
+	}
+
+	report := &HuntReport{Values: len(values), Matches: []*HuntMatch{}}
+	for _, ioc := range iocChunk {
+		if ioc.IsRevoked() {
+			continue
+		}
+
+		// Entities seen out of validity of IOC are not matched
+		matched, _ := service.MatchByTime(entityMap[ioc.Value], retrospector.IOCChunk{ioc}, args.LookbackMargin())
+		if len(matched) == 0 {
+			continue
+		}
+		report.Matches = append(report.Matches, newHuntMatch(ioc, matched))
+
+		if opt != nil && opt.Alert {
+			alert := &service.Alert{
+				Cause:    service.AlertCauseIOC,
+				Target:   &ioc.Value,
+				Entities: matched,
+				IOCChunk: retrospector.IOCChunk{ioc},
+			}
+			if err := EmitAlert(args, alert); err != nil {
+				return nil, golambda.WrapError(err).With("ioc", ioc)
+			}
+		}
+	}
+
+	metrics.Count("Matches", len(report.Matches), metrics.Dimensions{"Cause": "ioc"})
+	return report, nil
+}
+
+func newHuntMatch(ioc *retrospector.IOC, entities []*retrospector.Entity) *HuntMatch {
+	match := &HuntMatch{IOC: ioc, Entities: entities}
+	subjects := make(map[string]bool)
+	for _, entity := range entities {
+		if !subjects[entity.Subject] {
+			subjects[entity.Subject] = true
+			match.Subjects = append(match.Subjects, entity.Subject)
+		}
+
+		first, last, _ := entity.Seen()
+		if match.FirstSeen == 0 || first < match.FirstSeen {
+			match.FirstSeen = first
+		}
+		if last > match.LastSeen {
+			match.LastSeen = last
+		}
+	}
+	return match
+}
+
+// ParseHuntInput reads IOC set to hunt. Each line is JSON of retrospector.IOC, "type value" or only value of which type is guessed. A line starting with "#" is comment. Source of IOC is set to source if empty.
+func ParseHuntInput(r io.Reader, source string) (retrospector.IOCChunk, error) {
+	if source == "" {
+		source = DefaultHuntSource
+	}
+
+	var iocChunk retrospector.IOCChunk
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		ioc := &retrospector.IOC{}
+		switch fields := strings.Fields(line); {
+		case strings.HasPrefix(line, "{"):
+			if err := json.Unmarshal([]byte(line), ioc); err != nil {
+				return nil, golambda.WrapError(err, "Failed to parse IOC").With("line", lineNo)
+			}
+		case len(fields) == 2:
+			ioc.Type, ioc.Data = retrospector.ValueType(fields[0]), fields[1]
+		case len(fields) == 1:
+			ioc.Type, ioc.Data = retrospector.GuessValueType(fields[0]), fields[0]
+		default:
+			return nil, golambda.NewError("Invalid hunt input").With("line", lineNo)
+		}
+
+		if !ioc.Type.IsValid() || ioc.Data == "" {
+			return nil, golambda.NewError("Invalid value in hunt input").With("line", lineNo).With("value", ioc.Data)
+		}
+		if ioc.Source == "" {
+			ioc.Source = source
+		}
+		iocChunk = append(iocChunk, ioc)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, golambda.WrapError(err, "Failed to read hunt input")
+	}
+
+	return iocChunk, nil
+}
+
+// HuntObject reads IOC set from S3 object and writes report to reportKey in the same bucket
+func HuntObject(args *arguments.Arguments, region, bucket, key, reportKey string, opt *HuntOptions) (*HuntReport, error) {
+	s3Client, err := args.S3Client(region)
+	if err != nil {
+		return nil, golambda.WrapError(err, "Failed to create S3 client").With("region", region)
+	}
+
+	input := &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)}
+	output, err := s3Client.GetObject(input)
+	if err != nil {
+		return nil, golambda.WrapError(err, "Failed GetObject").With("input", input)
+	}
+	defer output.Body.Close()
+
+	body, err := reader.Decompress(output.Body)
+	if err != nil {
+		return nil, golambda.WrapError(err).With("input", input)
+	}
+	iocChunk, err := ParseHuntInput(body, "")
+	if err != nil {
+		return nil, golambda.WrapError(err).With("input", input)
+	}
+
+	report, err := Hunt(args, iocChunk, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := json.Marshal(report)
+	if err != nil {
+		return nil, golambda.WrapError(err, "Failed to marshal hunt report")
+	}
+	if _, err := s3Client.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(reportKey),
+		Body:        bytes.NewReader(raw),
+		ContentType: aws.String("application/json"),
+	}); err != nil {
+		return nil, golambda.WrapError(err, "Failed to put hunt report").With("bucket", bucket).With("key", reportKey)
+	}
+
+	return report, nil
+}
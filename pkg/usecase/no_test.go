@@ -0,0 +1,3 @@
+package usecase_test
+
+// No test required. Use cases are tested through handlers in lambda/*
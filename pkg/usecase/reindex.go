@@ -0,0 +1,67 @@
+package usecase
+
+import (
+	"github.com/cookpad/retrospector"
+	"github.com/cookpad/retrospector/pkg/arguments"
+)
+
+// reindexBatchSize is number of IOCs of which index is written at once
+const reindexBatchSize = 100
+
+// ReindexIOCSet writes index of all stored IOC set. It migrates IOC set stored before the index was introduced, then BatchGetIOCSet finds them without waiting for crawlers to publish them again. It returns number of indexed IOCs.
+func ReindexIOCSet(args *arguments.Arguments) (int, error) {
+	repo := args.RepositoryService()
+
+	var count int
+	var chunk retrospector.IOCChunk
+	flush := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		if err := repo.PutIOCIndex(chunk); err != nil {
+			return err
+		}
+		count += len(chunk)
+		chunk = nil
+		return nil
+	}
+
+	if err := repo.ScanIOCSet(func(ioc *retrospector.IOC) error {
+		chunk = append(chunk, ioc)
+		if len(chunk) >= reindexBatchSize {
+			return flush()
+		}
+		return nil
+	}); err != nil {
+		return count, err
+	}
+	if err := flush(); err != nil {
+		return count, err
+	}
+
+	logger.Info().Int("iocs", count).Msg("Reindexed IOC set")
+	return count, nil
+}
+
+// ReindexAlertStates puts all alert states again to write list items that are queried by QueryAlertStates. It migrates alert states stored before the list items were introduced. It returns number of reindexed alert states.
+func ReindexAlertStates(args *arguments.Arguments) (int, error) {
+	repo := args.RepositoryService()
+
+	var states []*retrospector.AlertState
+	if err := repo.ScanAlertStates(func(state *retrospector.AlertState) error {
+		states = append(states, state)
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	// Put after scan not to scan list items written during the scan
+	for i, state := range states {
+		if err := repo.PutAlertState(state); err != nil {
+			return i, err
+		}
+	}
+
+	logger.Info().Int("alerts", len(states)).Msg("Reindexed alert states")
+	return len(states), nil
+}
@@ -0,0 +1,75 @@
+package usecase
+
+import (
+	"github.com/cookpad/retrospector"
+	"github.com/cookpad/retrospector/pkg/arguments"
+	"github.com/cookpad/retrospector/pkg/service"
+)
+
+// DefaultReplayBatchSize is number of IOCs looked up at once if ReplayOptions.BatchSize is not set
+const DefaultReplayBatchSize = 100
+
+// ReplayOptions controls replay of stored IOC set
+type ReplayOptions struct {
+	// Filter selects IOCs to be replayed in the same way as export. Time range is compared with UpdatedAt of IOC.
+	Filter    service.ExportFilter
+	BatchSize int
+	// DryRun only reports matched IOCs without alert
+	DryRun bool
+}
+
+// ReplayReport is result of replay. Matches is set only in dry run.
+type ReplayReport struct {
+	IOCs    int          `json:"iocs"`
+	Matched int          `json:"matched"`
+	Matches []*HuntMatch `json:"matches,omitempty"`
+}
+
+// Replay scans stored IOC set and looks up current entities in the same way as iocDetect. Alert follows detection history and lifecycle state of each value, then values that have been already alerted for the same subject are not alerted again.
+func Replay(args *arguments.Arguments, opt *ReplayOptions) (*ReplayReport, error) {
+	batchSize := opt.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultReplayBatchSize
+	}
+
+	report := &ReplayReport{}
+	var chunk retrospector.IOCChunk
+	flush := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+
+		result, err := Hunt(args, chunk, &HuntOptions{Alert: !opt.DryRun})
+		if err != nil {
+			return err
+		}
+		report.Matched += len(result.Matches)
+		if opt.DryRun {
+			report.Matches = append(report.Matches, result.Matches...)
+		}
+
+		chunk = nil
+		return nil
+	}
+
+	if err := args.RepositoryService().ScanIOCSet(func(ioc *retrospector.IOC) error {
+		if ioc.IsRevoked() || !opt.Filter.MatchIOC(ioc) {
+			return nil
+		}
+
+		chunk = append(chunk, ioc)
+		report.IOCs++
+		if len(chunk) >= batchSize {
+			return flush()
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	logger.Info().Int("iocs", report.IOCs).Int("matched", report.Matched).Bool("dry_run", opt.DryRun).Msg("Replayed IOC set")
+	return report, nil
+}
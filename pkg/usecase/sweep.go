@@ -0,0 +1,78 @@
+package usecase
+
+import (
+	"time"
+
+	"github.com/cookpad/retrospector"
+	"github.com/cookpad/retrospector/pkg/arguments"
+)
+
+// SweepReport is result of reconciliation sweep
+type SweepReport struct {
+	Since        int64 `json:"since"`
+	IOCValues    int   `json:"ioc_values"`
+	EntityValues int   `json:"entity_values"`
+	IOCMatched   int   `json:"ioc_matched"`
+}
+
+// Sweep matches IOC set and entities stored in the overlap window (Arguments.SweepWindow) against each other. An IOC and an entity that are recorded concurrently can miss each other in iocDetect and entityDetect, then sweep looks up recent IOC set against all entities and recent entities against all IOC set. Alert follows detection history, so matches already alerted by detectors are not alerted again.
+func Sweep(args *arguments.Arguments, now time.Time) (*SweepReport, error) {
+	repoSvc := args.RepositoryService()
+	report := &SweepReport{Since: now.Add(-args.SweepWindow()).Unix()}
+
+	iocValues, err := repoSvc.GetRecentIOCValues(report.Since)
+	if err != nil {
+		return nil, err
+	}
+	report.IOCValues = len(iocValues)
+
+	for i := 0; i < len(iocValues); i += DefaultReplayBatchSize {
+		end := i + DefaultReplayBatchSize
+		if end > len(iocValues) {
+			end = len(iocValues)
+		}
+
+		iocChunk, err := repoSvc.BatchGetIOCSet(iocValues[i:end])
+		if err != nil {
+			return nil, err
+		}
+		result, err := Hunt(args, iocChunk, &HuntOptions{Alert: true})
+		if err != nil {
+			return nil, err
+		}
+		report.IOCMatched += len(result.Matches)
+	}
+
+	entityValues, err := repoSvc.GetRecentEntityValues(report.Since)
+	if err != nil {
+		return nil, err
+	}
+	report.EntityValues = len(entityValues)
+
+	// Look up IOC set first and fetch entities of only matched values
+	matchedMap, err := lookupIOCSet(args, entityValues)
+	if err != nil {
+		return nil, err
+	}
+	var matchedValues []*retrospector.Value
+	for value := range matchedMap {
+		value := value
+		matchedValues = append(matchedValues, &value)
+	}
+
+	entities, err := repoSvc.BatchGetEntities(matchedValues)
+	if err != nil {
+		return nil, err
+	}
+	entityMap := make(EntityMap)
+	for _, entity := range entities {
+		entityMap[entity.Value] = append(entityMap[entity.Value], entity)
+	}
+
+	if err := alertEntities(args, entityMap, matchedMap); err != nil {
+		return nil, err
+	}
+
+	logger.Info().Interface("report", report).Msg("Swept recent IOC set and entities")
+	return report, nil
+}
@@ -0,0 +1,21 @@
+package retrospector
+
+// Verdict is judgement of a value by reputation service
+type Verdict string
+
+const (
+	VerdictUnknown    Verdict = "unknown"
+	VerdictBenign     Verdict = "benign"
+	VerdictSuspicious Verdict = "suspicious"
+	VerdictMalicious  Verdict = "malicious"
+)
+
+// Reputation is result of reputation service such as VirusTotal for a value
+type Reputation struct {
+	Value
+	Source    string  `json:"source" dynamo:"source"`
+	Verdict   Verdict `json:"verdict" dynamo:"verdict"`
+	Score     int64   `json:"score" dynamo:"score"`
+	Detail    string  `json:"detail" dynamo:"detail"`
+	CheckedAt int64   `json:"checked_at" dynamo:"checked_at"`
+}
@@ -1,5 +1,11 @@
 package retrospector
 
+import (
+	"net"
+	"regexp"
+	"strings"
+)
+
 type Value struct {
 	Data string    `json:"value" dynamo:"value"`
 	Type ValueType `json:"type" dynamo:"type"`
@@ -12,4 +18,36 @@ const (
 	ValueDomainName     ValueType = "domain"
 	ValueURL            ValueType = "url"
 	ValueFileHashSha256 ValueType = "filehash.sha256"
+	ValueFileHashSha1   ValueType = "filehash.sha1"
+	ValueFileHashMD5    ValueType = "filehash.md5"
 )
+
+// IsValid returns true if the value type is supported
+func (x ValueType) IsValid() bool {
+	switch x {
+	case ValueIPAddr, ValueDomainName, ValueURL, ValueFileHashSha256, ValueFileHashSha1, ValueFileHashMD5:
+		return true
+	}
+	return false
+}
+
+var hexPattern = regexp.MustCompile(`^[0-9a-fA-F]+$`)
+
+// GuessValueType returns type of the value by its format. Empty type is returned if the format is unknown.
+func GuessValueType(data string) ValueType {
+	switch {
+	case net.ParseIP(data) != nil:
+		return ValueIPAddr
+	case strings.Contains(data, "://"):
+		return ValueURL
+	case hexPattern.MatchString(data) && len(data) == 64:
+		return ValueFileHashSha256
+	case hexPattern.MatchString(data) && len(data) == 40:
+		return ValueFileHashSha1
+	case hexPattern.MatchString(data) && len(data) == 32:
+		return ValueFileHashMD5
+	case strings.Contains(data, ".") && !strings.ContainsAny(data, " /"):
+		return ValueDomainName
+	}
+	return ""
+}